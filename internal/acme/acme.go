@@ -0,0 +1,502 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+	xacme "golang.org/x/crypto/acme"
+)
+
+// 验证方式
+const (
+	ChallengeHTTP01 = "http-01"
+	ChallengeDNS01  = "dns-01"
+)
+
+// obtainTimeout 单次证书申请的超时时间
+const obtainTimeout = 5 * time.Minute
+
+// retryDelay 申请或续期失败后的重试间隔
+const retryDelay = time.Hour
+
+// Manager ACME 证书管理器
+type Manager struct {
+	mu         sync.Mutex
+	client     *xacme.Client
+	registered bool
+	certDir    string
+	inflight   map[string]bool
+	onIssued   []func(cert *models.Certificate)
+
+	// TLS 证书缓存（面板 HTTPS 使用）
+	cacheMu  sync.RWMutex
+	cache    map[string]*tls.Certificate
+	fallback *tls.Certificate
+
+	// HTTP-01 验证令牌
+	tokensMu sync.RWMutex
+	tokens   map[string]string
+}
+
+var GlobalManager = &Manager{
+	inflight: make(map[string]bool),
+	cache:    make(map[string]*tls.Certificate),
+	tokens:   make(map[string]string),
+}
+
+// Init 初始化 ACME 客户端（加载或生成账户密钥）
+func (m *Manager) Init() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cfg := config.GetConfig()
+	m.certDir = filepath.Join(cfg.Server.CertDir, "acme")
+	if err := os.MkdirAll(m.certDir, 0700); err != nil {
+		return fmt.Errorf("创建证书目录失败: %v", err)
+	}
+
+	key, err := loadOrCreateKey(filepath.Join(m.certDir, "account.key"))
+	if err != nil {
+		return fmt.Errorf("加载 ACME 账户密钥失败: %v", err)
+	}
+
+	httpClient, err := newHTTPClient(cfg.ACME.CACert, cfg.ACME.Insecure)
+	if err != nil {
+		return err
+	}
+
+	m.client = &xacme.Client{
+		Key:          key,
+		DirectoryURL: cfg.ACME.Directory,
+		HTTPClient:   httpClient,
+		UserAgent:    "OpenLXD",
+	}
+	m.registered = false
+
+	return nil
+}
+
+// OnIssued 注册证书签发/续期后的回调
+func (m *Manager) OnIssued(fn func(cert *models.Certificate)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onIssued = append(m.onIssued, fn)
+}
+
+// Obtain 为域名申请证书（已存在时重新签发）
+func (m *Manager) Obtain(domain string) (*models.Certificate, error) {
+	m.mu.Lock()
+	if m.client == nil {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("ACME 客户端未初始化")
+	}
+	if m.inflight[domain] {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("域名 %s 的证书正在申请中", domain)
+	}
+	m.inflight[domain] = true
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.inflight, domain)
+		m.mu.Unlock()
+	}()
+
+	cfg := config.GetConfig()
+
+	// 记录申请状态
+	var cert models.Certificate
+	if err := models.DB.Where("domain = ?", domain).First(&cert).Error; err != nil {
+		cert = models.Certificate{Domain: domain, AutoRenew: true, Status: "pending"}
+	}
+	cert.Challenge = cfg.ACME.Challenge
+	models.DB.Save(&cert)
+
+	ctx, cancel := context.WithTimeout(context.Background(), obtainTimeout)
+	defer cancel()
+
+	certPath, keyPath, leaf, err := m.issue(ctx, domain)
+	if err != nil {
+		// 续期失败时原证书仍可使用，保持 valid 以免 HTTPS 中断，只记录错误和重试时间
+		if cert.Status != "valid" || !time.Now().Before(cert.NotAfter) {
+			cert.Status = "failed"
+		}
+		retryAt := time.Now().Add(retryDelay)
+		cert.LastError = err.Error()
+		cert.RetryAt = &retryAt
+		models.DB.Save(&cert)
+		return nil, err
+	}
+
+	cert.CertPath = certPath
+	cert.KeyPath = keyPath
+	cert.Issuer = leaf.Issuer.CommonName
+	cert.NotBefore = leaf.NotBefore
+	cert.NotAfter = leaf.NotAfter
+	cert.Status = "valid"
+	cert.LastError = ""
+	cert.RetryAt = nil
+	models.DB.Save(&cert)
+
+	// 使缓存失效
+	m.cacheMu.Lock()
+	delete(m.cache, domain)
+	m.cacheMu.Unlock()
+
+	m.mu.Lock()
+	hooks := append([]func(cert *models.Certificate){}, m.onIssued...)
+	m.mu.Unlock()
+	for _, fn := range hooks {
+		fn(&cert)
+	}
+
+	return &cert, nil
+}
+
+// ObtainAsync 后台申请证书
+func (m *Manager) ObtainAsync(domain string) {
+	go func() {
+		if _, err := m.Obtain(domain); err != nil {
+			log.Printf("证书申请失败 (%s): %v", domain, err)
+			models.LogAction("acme_obtain", "", fmt.Sprintf("证书申请失败: %s: %v", domain, err), "failed")
+			return
+		}
+		log.Printf("证书申请成功: %s", domain)
+		models.LogAction("acme_obtain", "", fmt.Sprintf("证书申请成功: %s", domain), "success")
+	}()
+}
+
+// EnsureCertificate 证书不存在或即将到期时申请
+func (m *Manager) EnsureCertificate(domain string) {
+	var cert models.Certificate
+	err := models.DB.Where("domain = ? AND status = ?", domain, "valid").First(&cert).Error
+	if err == nil && !m.needsRenewal(&cert) {
+		return
+	}
+	m.ObtainAsync(domain)
+}
+
+// RenewDue 续期即将到期的证书，并重试申请失败或中断（pending）的证书；未到重试时间或正在申请的跳过
+func (m *Manager) RenewDue() {
+	var certs []models.Certificate
+	models.DB.Where("auto_renew = ?", true).Find(&certs)
+
+	now := time.Now()
+	for _, cert := range certs {
+		if !m.needsRenewal(&cert) || (cert.RetryAt != nil && now.Before(*cert.RetryAt)) || m.obtaining(cert.Domain) {
+			continue
+		}
+		if _, err := m.Obtain(cert.Domain); err != nil {
+			log.Printf("证书续期失败 (%s): %v", cert.Domain, err)
+			models.LogAction("acme_renew", "", fmt.Sprintf("证书续期失败: %s: %v", cert.Domain, err), "failed")
+			continue
+		}
+		models.LogAction("acme_renew", "", fmt.Sprintf("证书续期成功: %s", cert.Domain), "success")
+	}
+}
+
+// obtaining 域名的证书是否正在申请
+func (m *Manager) obtaining(domain string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.inflight[domain]
+}
+
+// StartRenewal 启动证书续期任务
+func (m *Manager) StartRenewal(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		m.RenewDue()
+		for range ticker.C {
+			m.RenewDue()
+		}
+	}()
+}
+
+// needsRenewal 判断证书是否需要续期
+func (m *Manager) needsRenewal(cert *models.Certificate) bool {
+	if cert.Status != "valid" {
+		return true
+	}
+	renewBefore := time.Duration(config.GetConfig().ACME.RenewBefore) * 24 * time.Hour
+	return time.Until(cert.NotAfter) < renewBefore
+}
+
+// RemoveCertificate 删除证书记录及文件
+func (m *Manager) RemoveCertificate(id uint) error {
+	var cert models.Certificate
+	if err := models.DB.First(&cert, id).Error; err != nil {
+		return fmt.Errorf("证书不存在")
+	}
+
+	if cert.CertPath != "" {
+		os.RemoveAll(filepath.Dir(cert.CertPath))
+	}
+	models.DB.Delete(&cert)
+
+	m.cacheMu.Lock()
+	delete(m.cache, cert.Domain)
+	m.cacheMu.Unlock()
+
+	return nil
+}
+
+// SetFallbackCertificate 设置无 ACME 证书时使用的默认证书
+func (m *Manager) SetFallbackCertificate(cert *tls.Certificate) {
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+	m.fallback = cert
+}
+
+// GetCertificate 按 SNI 返回证书，用于 tls.Config.GetCertificate
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	domain := hello.ServerName
+
+	m.cacheMu.RLock()
+	cached, ok := m.cache[domain]
+	fallback := m.fallback
+	m.cacheMu.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	if domain != "" {
+		var cert models.Certificate
+		if err := models.DB.Where("domain = ? AND status = ?", domain, "valid").First(&cert).Error; err == nil {
+			pair, err := tls.LoadX509KeyPair(cert.CertPath, cert.KeyPath)
+			if err == nil {
+				m.cacheMu.Lock()
+				m.cache[domain] = &pair
+				m.cacheMu.Unlock()
+				return &pair, nil
+			}
+		}
+	}
+
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, fmt.Errorf("没有可用于 %s 的证书", domain)
+}
+
+// issue 完成 ACME 订单并保存证书
+func (m *Manager) issue(ctx context.Context, domain string) (string, string, *x509.Certificate, error) {
+	if err := m.ensureAccount(ctx); err != nil {
+		return "", "", nil, err
+	}
+
+	order, err := m.client.AuthorizeOrder(ctx, xacme.DomainIDs(domain))
+	if err != nil {
+		return "", "", nil, fmt.Errorf("创建订单失败: %v", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, authzURL); err != nil {
+			return "", "", nil, err
+		}
+	}
+
+	order, err = m.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("等待订单就绪失败: %v", err)
+	}
+
+	// 生成证书私钥和 CSR
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+	}, certKey)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("生成 CSR 失败: %v", err)
+	}
+
+	der, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("签发证书失败: %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return "", "", nil, fmt.Errorf("解析证书失败: %v", err)
+	}
+
+	certPath, keyPath, err := m.saveCertificate(domain, der, certKey)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return certPath, keyPath, leaf, nil
+}
+
+// ensureAccount 注册 ACME 账户（已注册则跳过）
+func (m *Manager) ensureAccount(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.registered {
+		return nil
+	}
+
+	account := &xacme.Account{}
+	if email := config.GetConfig().ACME.Email; email != "" {
+		account.Contact = []string{"mailto:" + email}
+	}
+
+	_, err := m.client.Register(ctx, account, xacme.AcceptTOS)
+	if err != nil && err != xacme.ErrAccountAlreadyExists {
+		return fmt.Errorf("注册 ACME 账户失败: %v", err)
+	}
+
+	m.registered = true
+	return nil
+}
+
+// authorize 完成单个授权的验证
+func (m *Manager) authorize(ctx context.Context, authzURL string) error {
+	authz, err := m.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("获取授权失败: %v", err)
+	}
+	if authz.Status == xacme.StatusValid {
+		return nil
+	}
+
+	challengeType := config.GetConfig().ACME.Challenge
+	var challenge *xacme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == challengeType {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("ACME 服务器不支持 %s 验证", challengeType)
+	}
+
+	cleanup, err := m.prepareChallenge(authz.Identifier.Value, challenge)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if _, err := m.client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("提交验证失败: %v", err)
+	}
+	if _, err := m.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("域名验证失败: %v", err)
+	}
+
+	return nil
+}
+
+// saveCertificate 保存证书链和私钥
+func (m *Manager) saveCertificate(domain string, der [][]byte, key *ecdsa.PrivateKey) (string, string, error) {
+	dir := filepath.Join(m.certDir, domain)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", fmt.Errorf("创建证书目录失败: %v", err)
+	}
+
+	var chain []byte
+	for _, block := range der {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: block})...)
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	// 先写临时文件再替换，写入失败时不破坏仍在使用的证书
+	certPath := filepath.Join(dir, "fullchain.pem")
+	keyPath := filepath.Join(dir, "privkey.pem")
+	if err := os.WriteFile(certPath+".new", chain, 0644); err != nil {
+		return "", "", fmt.Errorf("保存证书失败: %v", err)
+	}
+	if err := os.WriteFile(keyPath+".new", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600); err != nil {
+		os.Remove(certPath + ".new")
+		return "", "", fmt.Errorf("保存私钥失败: %v", err)
+	}
+	if err := os.Rename(keyPath+".new", keyPath); err != nil {
+		return "", "", fmt.Errorf("保存私钥失败: %v", err)
+	}
+	if err := os.Rename(certPath+".new", certPath); err != nil {
+		return "", "", fmt.Errorf("保存证书失败: %v", err)
+	}
+
+	return certPath, keyPath, nil
+}
+
+// loadOrCreateKey 加载 ACME 账户密钥，不存在时生成
+func loadOrCreateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("无效的密钥文件: %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// newHTTPClient 创建访问 ACME 服务器的 HTTP 客户端
+func newHTTPClient(caCert string, insecure bool) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+
+	if caCert != "" {
+		pemData, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("读取 CA 证书失败: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("无效的 CA 证书: %s", caCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}, nil
+}
@@ -0,0 +1,169 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/testutil"
+)
+
+// newTestManager 使用临时数据库和证书目录，ACME 目录指向 directory
+func newTestManager(t *testing.T, directory string) *Manager {
+	t.Helper()
+	testutil.Setup(t, func(cfg *config.Config) {
+		cfg.Server.CertDir = t.TempDir()
+		cfg.ACME.Directory = directory
+		cfg.ACME.Challenge = ChallengeHTTP01
+		cfg.ACME.RenewBefore = 30
+		cfg.ACME.CACert = os.Getenv("PEBBLE_CA_CERT")
+		cfg.ACME.Insecure = cfg.ACME.CACert == ""
+	})
+
+	m := &Manager{
+		inflight: make(map[string]bool),
+		cache:    make(map[string]*tls.Certificate),
+		tokens:   make(map[string]string),
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// failingDirectory 模拟不可用的 ACME 服务器，返回请求计数
+func failingDirectory(t *testing.T) (string, *int32) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		http.Error(w, "unavailable", http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, &hits
+}
+
+// writeSelfSigned 生成自签名证书作为已签发的证书
+func writeSelfSigned(t *testing.T, domain string, notAfter time.Time) (string, string) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: domain}}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, _ := x509.MarshalECPrivateKey(key)
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "fullchain.pem")
+	keyPath := filepath.Join(dir, "privkey.pem")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600)
+	return certPath, keyPath
+}
+
+func TestRenewalFailureKeepsValidCertificate(t *testing.T) {
+	directory, hits := failingDirectory(t)
+	m := newTestManager(t, directory)
+
+	domain := "panel.example.com"
+	notAfter := time.Now().Add(5 * 24 * time.Hour)
+	certPath, keyPath := writeSelfSigned(t, domain, notAfter)
+	models.DB.Create(&models.Certificate{Domain: domain, CertPath: certPath, KeyPath: keyPath, NotAfter: notAfter, AutoRenew: true, Status: "valid"})
+
+	m.RenewDue()
+	if atomic.LoadInt32(hits) == 0 {
+		t.Fatal("即将到期的证书应尝试续期")
+	}
+
+	var cert models.Certificate
+	models.DB.Where("domain = ?", domain).First(&cert)
+	if cert.Status != "valid" || cert.LastError == "" || cert.RetryAt == nil {
+		t.Fatalf("续期失败后应保持 valid 并记录错误和重试时间: status=%s error=%q retry=%v", cert.Status, cert.LastError, cert.RetryAt)
+	}
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: domain}); err != nil {
+		t.Fatalf("续期失败后原证书应继续使用: %v", err)
+	}
+
+	// 未到重试时间不再请求 ACME 服务器
+	before := atomic.LoadInt32(hits)
+	m.RenewDue()
+	if atomic.LoadInt32(hits) != before {
+		t.Fatal("未到重试时间不应再次续期")
+	}
+}
+
+func TestRenewDueRetriesPendingCertificate(t *testing.T) {
+	directory, hits := failingDirectory(t)
+	m := newTestManager(t, directory)
+
+	// 上次申请中断，记录停留在 pending
+	models.DB.Create(&models.Certificate{Domain: "stuck.example.com", AutoRenew: true, Status: "pending"})
+
+	m.RenewDue()
+	if atomic.LoadInt32(hits) == 0 {
+		t.Fatal("pending 的证书应重新申请")
+	}
+	var cert models.Certificate
+	models.DB.Where("domain = ?", "stuck.example.com").First(&cert)
+	if cert.Status != "failed" || cert.RetryAt == nil {
+		t.Fatalf("没有可用证书时申请失败应标记 failed: status=%s retry=%v", cert.Status, cert.RetryAt)
+	}
+
+	// 到达重试时间后再次申请
+	past := time.Now().Add(-time.Minute)
+	models.DB.Model(&cert).Update("retry_at", &past)
+	before := atomic.LoadInt32(hits)
+	m.RenewDue()
+	if atomic.LoadInt32(hits) == before {
+		t.Fatal("到达重试时间后应再次申请")
+	}
+}
+
+// TestPebbleIssueAndRenew 需要本地 Pebble（PEBBLE_VA_ALWAYS_VALID=1）：
+// PEBBLE_DIRECTORY=https://localhost:14000/dir PEBBLE_CA_CERT=pebble.minica.pem go test ./internal/acme
+func TestPebbleIssueAndRenew(t *testing.T) {
+	directory := os.Getenv("PEBBLE_DIRECTORY")
+	if directory == "" {
+		t.Skip("未设置 PEBBLE_DIRECTORY")
+	}
+	m := newTestManager(t, directory)
+
+	domain := "openlxd.test"
+	first, err := m.Obtain(domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Status != "valid" || first.NotAfter.IsZero() {
+		t.Fatalf("签发后应为 valid: %+v", first)
+	}
+
+	renewed, err := m.Obtain(domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed.ID != first.ID || renewed.Status != "valid" {
+		t.Fatalf("续期应更新同一条记录: %+v", renewed)
+	}
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: domain}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,138 @@
+package acme
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openlxd/backend/internal/config"
+	xacme "golang.org/x/crypto/acme"
+)
+
+// challengePathPrefix HTTP-01 验证路径前缀
+const challengePathPrefix = "/.well-known/acme-challenge/"
+
+// prepareChallenge 布置验证内容，返回清理函数
+func (m *Manager) prepareChallenge(domain string, challenge *xacme.Challenge) (func(), error) {
+	switch challenge.Type {
+	case ChallengeHTTP01:
+		return m.prepareHTTP01(challenge)
+	case ChallengeDNS01:
+		return m.prepareDNS01(domain, challenge)
+	default:
+		return nil, fmt.Errorf("不支持的验证方式: %s", challenge.Type)
+	}
+}
+
+// prepareHTTP01 写入 HTTP-01 验证文件
+// 验证内容同时写入 webroot（供 nginx 读取）和内存（供内置监听器读取）
+func (m *Manager) prepareHTTP01(challenge *xacme.Challenge) (func(), error) {
+	keyAuth, err := m.client.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	m.tokensMu.Lock()
+	m.tokens[challenge.Token] = keyAuth
+	m.tokensMu.Unlock()
+
+	var tokenFile string
+	if webroot := config.GetConfig().ACME.Webroot; webroot != "" {
+		dir := filepath.Join(webroot, ".well-known", "acme-challenge")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("创建验证目录失败: %v", err)
+		}
+		tokenFile = filepath.Join(dir, challenge.Token)
+		if err := os.WriteFile(tokenFile, []byte(keyAuth), 0644); err != nil {
+			return nil, fmt.Errorf("写入验证文件失败: %v", err)
+		}
+	}
+
+	return func() {
+		m.tokensMu.Lock()
+		delete(m.tokens, challenge.Token)
+		m.tokensMu.Unlock()
+		if tokenFile != "" {
+			os.Remove(tokenFile)
+		}
+	}, nil
+}
+
+// prepareDNS01 通过 DNS 服务商添加 TXT 记录
+func (m *Manager) prepareDNS01(domain string, challenge *xacme.Challenge) (func(), error) {
+	cfg := config.GetConfig()
+	provider, err := NewDNSProvider(cfg.ACME.DNSProvider, cfg.ACME.DNSConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := m.client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	fqdn := "_acme-challenge." + strings.TrimSuffix(domain, ".") + "."
+	if err := provider.Present(domain, fqdn, value); err != nil {
+		return nil, fmt.Errorf("添加 DNS 记录失败: %v", err)
+	}
+
+	// 等待 DNS 记录生效
+	time.Sleep(propagationWait(cfg.ACME.DNSConfig))
+
+	return func() {
+		if err := provider.CleanUp(domain, fqdn, value); err != nil {
+			log.Printf("清理 DNS 记录失败 (%s): %v", fqdn, err)
+		}
+	}, nil
+}
+
+// HTTPHandler 返回处理 HTTP-01 验证请求的 Handler，其他请求交给 next
+func (m *Manager) HTTPHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, challengePathPrefix) {
+			if next == nil {
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := strings.TrimPrefix(r.URL.Path, challengePathPrefix)
+		m.tokensMu.RLock()
+		keyAuth, ok := m.tokens[token]
+		m.tokensMu.RUnlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(keyAuth))
+	})
+}
+
+// StartHTTPListener 启动独立的 HTTP-01 验证监听（未配置 http_listen 时不启动）
+func (m *Manager) StartHTTPListener() {
+	addr := config.GetConfig().ACME.HTTPListen
+	if addr == "" {
+		return
+	}
+
+	go func() {
+		log.Printf("ACME HTTP-01 验证服务监听在 %s", addr)
+		server := &http.Server{
+			Addr:         addr,
+			Handler:      m.HTTPHandler(nil),
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("ACME HTTP-01 验证服务启动失败: %v", err)
+		}
+	}()
+}
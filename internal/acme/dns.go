@@ -0,0 +1,151 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultPropagationWait 默认 DNS 记录生效等待时间
+const defaultPropagationWait = 30 * time.Second
+
+// DNSProvider DNS-01 验证的 DNS 服务商
+type DNSProvider interface {
+	// Present 添加 TXT 记录
+	Present(domain, fqdn, value string) error
+	// CleanUp 删除 TXT 记录
+	CleanUp(domain, fqdn, value string) error
+}
+
+// DNSProviderFactory 根据配置创建 DNS 服务商
+type DNSProviderFactory func(config map[string]string) (DNSProvider, error)
+
+var (
+	dnsProvidersMu sync.RWMutex
+	dnsProviders   = map[string]DNSProviderFactory{
+		"exec":    newExecProvider,
+		"httpreq": newHTTPReqProvider,
+	}
+)
+
+// RegisterDNSProvider 注册 DNS 服务商
+func RegisterDNSProvider(name string, factory DNSProviderFactory) {
+	dnsProvidersMu.Lock()
+	defer dnsProvidersMu.Unlock()
+	dnsProviders[name] = factory
+}
+
+// NewDNSProvider 创建指定名称的 DNS 服务商
+func NewDNSProvider(name string, config map[string]string) (DNSProvider, error) {
+	dnsProvidersMu.RLock()
+	factory, ok := dnsProviders[name]
+	dnsProvidersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("不支持的 DNS 服务商: %s", name)
+	}
+	return factory(config)
+}
+
+// propagationWait 读取 DNS 生效等待时间（秒）
+func propagationWait(config map[string]string) time.Duration {
+	if v, ok := config["propagation_wait"]; ok {
+		if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return defaultPropagationWait
+}
+
+// execProvider 调用外部脚本管理 DNS 记录
+// 脚本参数: <present|cleanup> <fqdn> <value>
+type execProvider struct {
+	command string
+}
+
+func newExecProvider(config map[string]string) (DNSProvider, error) {
+	command := config["command"]
+	if command == "" {
+		return nil, fmt.Errorf("exec DNS 服务商缺少 command 配置")
+	}
+	return &execProvider{command: command}, nil
+}
+
+// Present 添加 TXT 记录
+func (p *execProvider) Present(domain, fqdn, value string) error {
+	return p.run("present", fqdn, value)
+}
+
+// CleanUp 删除 TXT 记录
+func (p *execProvider) CleanUp(domain, fqdn, value string) error {
+	return p.run("cleanup", fqdn, value)
+}
+
+func (p *execProvider) run(action, fqdn, value string) error {
+	output, err := exec.Command(p.command, action, fqdn, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// httpReqProvider 通过 HTTP 接口管理 DNS 记录
+// 向 endpoint/present 和 endpoint/cleanup 发送 {"fqdn": "...", "value": "..."}
+type httpReqProvider struct {
+	endpoint string
+	username string
+	password string
+	client   *http.Client
+}
+
+func newHTTPReqProvider(config map[string]string) (DNSProvider, error) {
+	endpoint := strings.TrimSuffix(config["endpoint"], "/")
+	if endpoint == "" {
+		return nil, fmt.Errorf("httpreq DNS 服务商缺少 endpoint 配置")
+	}
+	return &httpReqProvider{
+		endpoint: endpoint,
+		username: config["username"],
+		password: config["password"],
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Present 添加 TXT 记录
+func (p *httpReqProvider) Present(domain, fqdn, value string) error {
+	return p.send("/present", fqdn, value)
+}
+
+// CleanUp 删除 TXT 记录
+func (p *httpReqProvider) CleanUp(domain, fqdn, value string) error {
+	return p.send("/cleanup", fqdn, value)
+}
+
+func (p *httpReqProvider) send(path, fqdn, value string) error {
+	body, _ := json.Marshal(map[string]string{"fqdn": fqdn, "value": value})
+
+	req, err := http.NewRequest("POST", p.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.username != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("DNS 接口返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,430 @@
+package alert
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/quota"
+)
+
+// 指标类规则
+const (
+	MetricHostCPU         = "host_cpu"         // 宿主机 CPU 使用率（%）
+	MetricHostMemory      = "host_memory"      // 宿主机内存使用率（%）
+	MetricHostDisk        = "host_disk"        // 宿主机磁盘使用率（%）
+	MetricHostLoad        = "host_load"        // 宿主机 1 分钟负载
+	MetricContainerCPU    = "container_cpu"    // 容器 CPU 使用率（%）
+	MetricContainerMemory = "container_memory" // 容器内存使用率（%）
+	MetricContainerDisk   = "container_disk"   // 容器磁盘使用率（%）
+	MetricTrafficQuota    = "traffic_quota"    // 容器流量配额使用率（%）
+)
+
+// 事件类规则
+const (
+	EventContainerOOM    = "container_oom"
+	EventMigrationFailed = "migration_failed"
+)
+
+// 告警状态
+const (
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// 宿主机告警的对象名
+const hostTarget = "host"
+
+var metricNames = map[string]string{
+	MetricHostCPU:         "宿主机 CPU 使用率",
+	MetricHostMemory:      "宿主机内存使用率",
+	MetricHostDisk:        "宿主机磁盘使用率",
+	MetricHostLoad:        "宿主机负载",
+	MetricContainerCPU:    "容器 CPU 使用率",
+	MetricContainerMemory: "容器内存使用率",
+	MetricContainerDisk:   "容器磁盘使用率",
+	MetricTrafficQuota:    "流量配额使用率",
+	EventContainerOOM:     "容器内存溢出",
+	EventMigrationFailed:  "迁移失败",
+}
+
+var severityLevels = map[string]int{
+	"info":     0,
+	"warning":  1,
+	"critical": 2,
+}
+
+// sample 一个对象的当前指标值
+type sample struct {
+	Target      string
+	ContainerID uint
+	UserID      uint
+	Value       float64
+}
+
+// Engine 告警规则评估器
+type Engine struct {
+	mu        sync.Mutex // 串行化规则评估和事件告警
+	oomCounts map[string]uint64
+}
+
+var GlobalEngine = &Engine{
+	oomCounts: make(map[string]uint64),
+}
+
+// IsEvent 判断是否为事件类指标
+func IsEvent(metric string) bool {
+	return metric == EventContainerOOM || metric == EventMigrationFailed
+}
+
+// ValidateRule 校验告警规则
+func ValidateRule(rule *models.AlertRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("规则名称不能为空")
+	}
+	if _, ok := metricNames[rule.Metric]; !ok {
+		return fmt.Errorf("不支持的指标: %s", rule.Metric)
+	}
+	if rule.Operator == "" {
+		rule.Operator = ">"
+	}
+	switch rule.Operator {
+	case ">", ">=", "<", "<=":
+	default:
+		return fmt.Errorf("不支持的比较符: %s", rule.Operator)
+	}
+	if rule.Severity == "" {
+		rule.Severity = "warning"
+	}
+	if _, ok := severityLevels[rule.Severity]; !ok {
+		return fmt.Errorf("不支持的告警级别: %s，可选: info, warning, critical", rule.Severity)
+	}
+	if rule.Duration < 0 {
+		return fmt.Errorf("持续时间不能为负数")
+	}
+	return nil
+}
+
+// Init 首次启动时创建默认告警规则
+func Init() {
+	var count int64
+	models.DB.Model(&models.AlertRule{}).Count(&count)
+	if count > 0 {
+		return
+	}
+
+	defaults := []models.AlertRule{
+		{Name: "宿主机磁盘使用率过高", Metric: MetricHostDisk, Operator: ">", Threshold: 90, Duration: 300, Severity: "critical"},
+		{Name: "容器内存溢出", Metric: EventContainerOOM, Duration: 3600, Severity: "critical"},
+		{Name: "流量配额即将用尽", Metric: MetricTrafficQuota, Operator: ">=", Threshold: 90, Severity: "warning"},
+		{Name: "容器迁移失败", Metric: EventMigrationFailed, Duration: 3600, Severity: "critical"},
+	}
+	for _, rule := range defaults {
+		rule.Enabled = true
+		if err := models.DB.Create(&rule).Error; err != nil {
+			log.Printf("警告: 创建默认告警规则失败: %v", err)
+		}
+	}
+}
+
+// Start 启动告警规则评估
+func (e *Engine) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := e.Evaluate(time.Now()); err != nil {
+				log.Printf("告警规则评估失败: %v", err)
+			}
+		}
+	}()
+}
+
+// Evaluate 评估全部启用的规则，更新告警状态并发送通知
+func (e *Engine) Evaluate(now time.Time) error {
+	var rules []models.AlertRule
+	if err := models.DB.Where("enabled = ?", true).Find(&rules).Error; err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if rule.Metric == EventContainerOOM {
+			e.detectOOM()
+			break
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	samples := make(map[string][]sample)
+	for _, rule := range rules {
+		if IsEvent(rule.Metric) {
+			e.expireEvents(rule, now)
+			continue
+		}
+
+		current, ok := samples[rule.Metric]
+		if !ok {
+			var err error
+			current, err = collectSamples(rule.Metric, now)
+			if err != nil {
+				log.Printf("采集告警指标 %s 失败: %v", rule.Metric, err)
+				continue
+			}
+			samples[rule.Metric] = current
+		}
+		e.evaluateRule(rule, current, now)
+	}
+	return nil
+}
+
+// evaluateRule 按当前指标值推进一条规则下各对象的告警状态
+// 条件满足后先进入 pending，持续 Duration 秒后转为 firing；条件不再满足或对象消失时恢复
+func (e *Engine) evaluateRule(rule models.AlertRule, samples []sample, now time.Time) {
+	var active []models.Alert
+	models.DB.Where("rule_id = ? AND state IN ?", rule.ID, []string{StatePending, StateFiring}).Find(&active)
+	byTarget := make(map[string]*models.Alert, len(active))
+	for i := range active {
+		byTarget[active[i].Target] = &active[i]
+	}
+
+	for _, s := range samples {
+		if rule.ContainerID != 0 && s.ContainerID != rule.ContainerID {
+			continue
+		}
+		existing := byTarget[s.Target]
+		delete(byTarget, s.Target)
+
+		if !compare(s.Value, rule.Operator, rule.Threshold) {
+			if existing != nil {
+				e.resolve(existing, now)
+			}
+			continue
+		}
+
+		if existing == nil {
+			existing = &models.Alert{
+				RuleID:      rule.ID,
+				RuleName:    rule.Name,
+				Metric:      rule.Metric,
+				Severity:    rule.Severity,
+				Target:      s.Target,
+				ContainerID: s.ContainerID,
+				UserID:      s.UserID,
+				State:       StatePending,
+				StartsAt:    now,
+			}
+		}
+		existing.Value = s.Value
+		existing.Message = fmt.Sprintf("%s 当前值 %.2f，阈值 %s %.2f", metricNames[rule.Metric], s.Value, rule.Operator, rule.Threshold)
+
+		if existing.State == StatePending && now.Sub(existing.StartsAt) >= time.Duration(rule.Duration)*time.Second {
+			existing.State = StateFiring
+			existing.FiredAt = &now
+			models.DB.Save(existing)
+			e.notify(*existing)
+			continue
+		}
+		models.DB.Save(existing)
+	}
+
+	// 对象已不存在或没有最新数据
+	for _, alert := range byTarget {
+		e.resolve(alert, now)
+	}
+}
+
+// resolve 恢复告警，未触发过的 pending 告警直接删除
+func (e *Engine) resolve(alert *models.Alert, now time.Time) {
+	if alert.State == StatePending {
+		models.DB.Delete(alert)
+		return
+	}
+	alert.State = StateResolved
+	alert.ResolvedAt = &now
+	models.DB.Save(alert)
+	e.notify(*alert)
+}
+
+// expireEvents 恢复已超过保持时间的事件告警
+func (e *Engine) expireEvents(rule models.AlertRule, now time.Time) {
+	var firing []models.Alert
+	models.DB.Where("rule_id = ? AND state = ?", rule.ID, StateFiring).Find(&firing)
+	for i := range firing {
+		if firing[i].FiredAt == nil || now.Sub(*firing[i].FiredAt) >= time.Duration(rule.Duration)*time.Second {
+			e.resolve(&firing[i], now)
+		}
+	}
+}
+
+// RaiseEvent 触发事件类告警，target 为容器名
+// 同一规则和对象已有未恢复的告警时只累加次数（Value）并更新描述，不重复通知
+func RaiseEvent(metric, target, message string) {
+	GlobalEngine.Raise(metric, target, message)
+}
+
+// Raise 触发事件类告警
+func (e *Engine) Raise(metric, target, message string) {
+	if !config.GetConfig().Alert.Enabled {
+		return
+	}
+
+	var container models.Container
+	models.DB.Where("hostname = ?", target).First(&container)
+
+	var rules []models.AlertRule
+	models.DB.Where("enabled = ? AND metric = ?", true, metric).Find(&rules)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	for _, rule := range rules {
+		if rule.ContainerID != 0 && rule.ContainerID != container.ID {
+			continue
+		}
+
+		var existing models.Alert
+		err := models.DB.Where("rule_id = ? AND target = ? AND state = ?", rule.ID, target, StateFiring).First(&existing).Error
+		if err == nil {
+			models.DB.Model(&existing).Updates(map[string]interface{}{
+				"value":   existing.Value + 1,
+				"message": message,
+			})
+			continue
+		}
+
+		alert := models.Alert{
+			RuleID:      rule.ID,
+			RuleName:    rule.Name,
+			Metric:      metric,
+			Severity:    rule.Severity,
+			Target:      target,
+			ContainerID: container.ID,
+			UserID:      container.UserID,
+			State:       StateFiring,
+			Value:       1,
+			Message:     message,
+			StartsAt:    now,
+			FiredAt:     &now,
+		}
+		if err := models.DB.Create(&alert).Error; err != nil {
+			log.Printf("保存告警失败: %v", err)
+			continue
+		}
+		e.notify(alert)
+	}
+}
+
+// collectSamples 获取指标在各对象上的最新值，超过三个采集周期的数据视为过期
+func collectSamples(metric string, now time.Time) ([]sample, error) {
+	since := now.Add(-3 * time.Duration(config.GetConfig().Monitor.Interval) * time.Second)
+
+	switch metric {
+	case MetricHostCPU, MetricHostMemory, MetricHostDisk, MetricHostLoad:
+		var latest models.SystemMetric
+		err := models.DB.Where("timestamp >= ?", since).Order("timestamp DESC").First(&latest).Error
+		if err != nil {
+			return nil, nil
+		}
+		value := latest.CPUUsage
+		switch metric {
+		case MetricHostMemory:
+			value = latest.MemoryUsage
+		case MetricHostDisk:
+			value = latest.DiskUsage
+		case MetricHostLoad:
+			value = latest.LoadAverage1
+		}
+		return []sample{{Target: hostTarget, Value: value}}, nil
+
+	case MetricContainerCPU, MetricContainerMemory, MetricContainerDisk:
+		var metrics []models.ContainerMetric
+		if err := models.DB.Where("timestamp >= ?", since).Order("timestamp").Find(&metrics).Error; err != nil {
+			return nil, err
+		}
+		owners, err := containerOwners()
+		if err != nil {
+			return nil, err
+		}
+		latest := make(map[uint]models.ContainerMetric)
+		for _, m := range metrics {
+			latest[m.ContainerID] = m
+		}
+
+		samples := make([]sample, 0, len(latest))
+		for id, m := range latest {
+			value := m.CPUUsage
+			switch metric {
+			case MetricContainerMemory:
+				value = m.MemoryUsage
+			case MetricContainerDisk:
+				value = m.DiskUsage
+			}
+			samples = append(samples, sample{Target: m.ContainerName, ContainerID: id, UserID: owners[id], Value: value})
+		}
+		return samples, nil
+
+	case MetricTrafficQuota:
+		var quotas []models.Quota
+		if err := models.DB.Where("traffic_quota > 0").Find(&quotas).Error; err != nil {
+			return nil, err
+		}
+		var containers []models.Container
+		if err := models.DB.Find(&containers).Error; err != nil {
+			return nil, err
+		}
+		byID := make(map[uint]models.Container, len(containers))
+		for _, container := range containers {
+			byID[container.ID] = container
+		}
+
+		samples := make([]sample, 0, len(quotas))
+		for _, q := range quotas {
+			container, ok := byID[q.ContainerID]
+			if !ok {
+				continue
+			}
+			samples = append(samples, sample{
+				Target:      container.Hostname,
+				ContainerID: container.ID,
+				UserID:      container.UserID,
+				Value:       quota.BytesToGB(q.TrafficUsed) / float64(q.TrafficQuota) * 100,
+			})
+		}
+		return samples, nil
+	}
+
+	return nil, fmt.Errorf("不支持的指标: %s", metric)
+}
+
+// containerOwners 获取容器 ID 到所属用户的映射
+func containerOwners() (map[uint]uint, error) {
+	var containers []models.Container
+	if err := models.DB.Select("id", "user_id").Find(&containers).Error; err != nil {
+		return nil, err
+	}
+	owners := make(map[uint]uint, len(containers))
+	for _, container := range containers {
+		owners[container.ID] = container.UserID
+	}
+	return owners, nil
+}
+
+// compare 按比较符比较指标值和阈值
+func compare(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	}
+	return value > threshold
+}
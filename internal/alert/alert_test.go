@@ -0,0 +1,139 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/testutil"
+)
+
+// setupTest 使用临时数据库和最小配置
+func setupTest(t *testing.T) {
+	testutil.Setup(t, func(cfg *config.Config) {
+		cfg.Alert.Enabled = true
+		cfg.Monitor.Interval = 60
+	})
+}
+
+// webhookStandIn 记录收到的告警状态
+func webhookStandIn(t *testing.T) (*httptest.Server, chan string) {
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Status string `json:"status"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		received <- body.Status
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func TestEvaluateFiresAndResolves(t *testing.T) {
+	setupTest(t)
+	server, received := webhookStandIn(t)
+
+	models.DB.Create(&models.AlertChannel{Name: "ops", Type: "webhook", URL: server.URL, MinSeverity: "info", Enabled: true})
+	rule := models.AlertRule{Name: "磁盘", Metric: MetricHostDisk, Operator: ">", Threshold: 90, Duration: 60, Severity: "critical", Enabled: true}
+	models.DB.Create(&rule)
+
+	now := time.Now()
+	models.DB.Create(&models.SystemMetric{Timestamp: now, DiskUsage: 95})
+
+	engine := &Engine{oomCounts: make(map[string]uint64)}
+	if err := engine.Evaluate(now); err != nil {
+		t.Fatal(err)
+	}
+	var alert models.Alert
+	if err := models.DB.Where("rule_id = ?", rule.ID).First(&alert).Error; err != nil || alert.State != StatePending {
+		t.Fatalf("首次满足条件应为 pending，实际 %q (%v)", alert.State, err)
+	}
+
+	engine.Evaluate(now.Add(61 * time.Second))
+	if status := testutil.Receive(t, received); status != StateFiring {
+		t.Fatalf("持续超过 duration 后应通知 firing，实际 %q", status)
+	}
+
+	models.DB.Create(&models.SystemMetric{Timestamp: now.Add(62 * time.Second), DiskUsage: 50})
+	engine.Evaluate(now.Add(62 * time.Second))
+	if status := testutil.Receive(t, received); status != StateResolved {
+		t.Fatalf("条件不再满足后应通知 resolved，实际 %q", status)
+	}
+}
+
+func TestTenantChannelRestrictions(t *testing.T) {
+	setupTest(t)
+	server, received := webhookStandIn(t)
+
+	tenant := models.User{Username: "tenant", Email: "tenant@example.com", PasswordHash: "x", Role: "user", Status: "active"}
+	models.DB.Create(&tenant)
+
+	hook := models.AlertChannel{Name: "hook", Type: "webhook", URL: server.URL, UserID: tenant.ID}
+	if err := ValidateChannel(&hook); err == nil {
+		t.Fatal("普通用户的 webhook 渠道不应允许回环地址")
+	}
+	mail := models.AlertChannel{Name: "mail", Type: "email", Email: "someone@example.com", UserID: tenant.ID}
+	if err := ValidateChannel(&mail); err == nil {
+		t.Fatal("普通用户不应能创建邮件渠道")
+	}
+	global := models.AlertChannel{Name: "global", Type: "webhook", URL: server.URL}
+	if err := ValidateChannel(&global); err != nil {
+		t.Fatalf("管理员渠道应允许内网地址: %v", err)
+	}
+
+	// 已保存的渠道在发送时同样受限（拨号检查，覆盖重定向和 DNS 变化）
+	if err := SendTest(&hook); err == nil {
+		t.Fatal("普通用户的 webhook 渠道不应能连接回环地址")
+	}
+	if err := SendTest(&mail); err == nil {
+		t.Fatal("普通用户的邮件渠道不应发送")
+	}
+	select {
+	case <-received:
+		t.Fatal("受限渠道不应产生请求")
+	default:
+	}
+}
+
+func TestEmailAndTelegramChannels(t *testing.T) {
+	setupTest(t)
+
+	messages := testutil.SMTPStandIn(t)
+	config.GlobalConfig.Alert.SMTPFrom = "panel@example.com"
+
+	if err := SendTest(&models.AlertChannel{Name: "mail", Type: "email", Email: "ops@example.com, oncall@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	message := testutil.Receive(t, messages)
+	if !strings.Contains(message, "<ops@example.com>") || !strings.Contains(message, "<oncall@example.com>") {
+		t.Fatalf("收件人不正确: %s", message)
+	}
+	if !strings.Contains(message, "这是一条测试告警") {
+		t.Fatalf("邮件正文不正确: %s", message)
+	}
+
+	telegram := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path != "/botTOKEN/sendMessage" || body["chat_id"] != "42" {
+			w.Write([]byte(`{"ok":false,"description":"chat not found"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer telegram.Close()
+	config.GlobalConfig.Alert.TelegramAPI = telegram.URL
+
+	if err := SendTest(&models.AlertChannel{Name: "tg", Type: "telegram", BotToken: "TOKEN", ChatID: "42"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SendTest(&models.AlertChannel{Name: "tg", Type: "telegram", BotToken: "TOKEN", ChatID: "7"}); err == nil {
+		t.Fatal("Telegram API 返回错误时应失败")
+	}
+}
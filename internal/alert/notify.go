@@ -0,0 +1,241 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/webhook"
+)
+
+// Notifier 告警通知渠道的发送实现
+type Notifier interface {
+	Send(channel *models.AlertChannel, alert *models.Alert) error
+}
+
+var notifiers = map[string]Notifier{
+	"webhook":  webhookNotifier{},
+	"email":    emailNotifier{},
+	"telegram": telegramNotifier{},
+}
+
+// notifyTimeout 外发通知的超时
+const notifyTimeout = 10 * time.Second
+
+var httpClient = &http.Client{Timeout: notifyTimeout}
+
+// ValidateChannel 校验通知渠道配置
+func ValidateChannel(channel *models.AlertChannel) error {
+	if channel.Name == "" {
+		return fmt.Errorf("渠道名称不能为空")
+	}
+	if channel.MinSeverity == "" {
+		channel.MinSeverity = "info"
+	}
+	if _, ok := severityLevels[channel.MinSeverity]; !ok {
+		return fmt.Errorf("不支持的告警级别: %s，可选: info, warning, critical", channel.MinSeverity)
+	}
+
+	switch channel.Type {
+	case "webhook":
+		// 普通用户的渠道不能指向内网地址，与 webhook 订阅一致
+		if err := webhook.ValidateURL(context.Background(), channel.URL, webhook.Restricted(channel.UserID)); err != nil {
+			return fmt.Errorf("webhook %v", err)
+		}
+	case "email":
+		// 邮件经由面板的 SMTP 账号发送，收件人不经验证，只允许管理员（全局）渠道使用
+		if webhook.Restricted(channel.UserID) {
+			return fmt.Errorf("邮件渠道只能由管理员配置")
+		}
+		if channel.Email == "" {
+			return fmt.Errorf("收件人不能为空")
+		}
+	case "telegram":
+		if channel.BotToken == "" || channel.ChatID == "" {
+			return fmt.Errorf("bot_token 和 chat_id 不能为空")
+		}
+	default:
+		return fmt.Errorf("不支持的渠道类型: %s，可选: webhook, email, telegram", channel.Type)
+	}
+	return nil
+}
+
+// notify 将告警异步发送到匹配的渠道：全局渠道和告警所属用户的渠道，且告警级别不低于渠道的最低级别
+func (e *Engine) notify(alert models.Alert) {
+	var channels []models.AlertChannel
+	query := models.DB.Where("enabled = ?", true)
+	if alert.UserID != 0 {
+		query = query.Where("user_id = 0 OR user_id = ?", alert.UserID)
+	} else {
+		query = query.Where("user_id = 0")
+	}
+	if err := query.Find(&channels).Error; err != nil {
+		log.Printf("查询告警通知渠道失败: %v", err)
+		return
+	}
+
+	for i := range channels {
+		channel := channels[i]
+		if severityLevels[alert.Severity] < severityLevels[channel.MinSeverity] {
+			continue
+		}
+		go func() {
+			if err := Send(&channel, &alert); err != nil {
+				log.Printf("告警通知发送失败 (渠道 %s): %v", channel.Name, err)
+			}
+		}()
+	}
+}
+
+// Send 通过指定渠道发送告警
+func Send(channel *models.AlertChannel, alert *models.Alert) error {
+	notifier, ok := notifiers[channel.Type]
+	if !ok {
+		return fmt.Errorf("不支持的渠道类型: %s", channel.Type)
+	}
+	return notifier.Send(channel, alert)
+}
+
+// SendTest 通过渠道发送一条测试告警
+func SendTest(channel *models.AlertChannel) error {
+	now := time.Now()
+	return Send(channel, &models.Alert{
+		RuleName: "测试告警",
+		Metric:   "test",
+		Severity: "info",
+		Target:   hostTarget,
+		State:    StateFiring,
+		Message:  "这是一条测试告警，收到说明通知渠道配置正确",
+		StartsAt: now,
+		FiredAt:  &now,
+	})
+}
+
+// formatSubject 告警标题
+func formatSubject(alert *models.Alert) string {
+	return fmt.Sprintf("[%s][%s] %s - %s", strings.ToUpper(alert.State), alert.Severity, alert.RuleName, alert.Target)
+}
+
+// formatText 告警正文
+func formatText(alert *models.Alert) string {
+	var b strings.Builder
+	b.WriteString(formatSubject(alert) + "\n")
+	b.WriteString("对象: " + alert.Target + "\n")
+	b.WriteString("描述: " + alert.Message + "\n")
+	b.WriteString("开始时间: " + alert.StartsAt.Format("2006-01-02 15:04:05") + "\n")
+	if alert.ResolvedAt != nil {
+		b.WriteString("恢复时间: " + alert.ResolvedAt.Format("2006-01-02 15:04:05") + "\n")
+	}
+	return b.String()
+}
+
+// webhookNotifier 以 JSON POST 告警内容
+type webhookNotifier struct{}
+
+func (webhookNotifier) Send(channel *models.AlertChannel, alert *models.Alert) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"status":  alert.State,
+		"subject": formatSubject(alert),
+		"alert":   alert,
+	})
+	if err != nil {
+		return err
+	}
+
+	client := webhook.NewClient(notifyTimeout, webhook.Restricted(channel.UserID))
+	resp, err := client.Post(channel.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// emailNotifier 通过配置的 SMTP 服务器发送邮件
+type emailNotifier struct{}
+
+func (emailNotifier) Send(channel *models.AlertChannel, alert *models.Alert) error {
+	if webhook.Restricted(channel.UserID) {
+		return fmt.Errorf("邮件渠道只能由管理员配置")
+	}
+	var to []string
+	for _, addr := range strings.Split(channel.Email, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+	return SendMail(to, formatSubject(alert), formatText(alert))
+}
+
+// SendMail 通过告警配置中的 SMTP 服务器发送纯文本邮件（也用于密码重置等账号通知）
+func SendMail(to []string, subject, text string) error {
+	cfg := config.GetConfig().Alert
+	if cfg.SMTPHost == "" || cfg.SMTPFrom == "" {
+		return fmt.Errorf("未配置 SMTP 服务器或发件人")
+	}
+
+	var msg strings.Builder
+	msg.WriteString("From: " + cfg.SMTPFrom + "\r\n")
+	msg.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	addr := cfg.SMTPHost + ":" + strconv.Itoa(cfg.SMTPPort)
+	return smtp.SendMail(addr, auth, cfg.SMTPFrom, to, []byte(msg.String()))
+}
+
+// telegramNotifier 通过 Telegram Bot API 的 sendMessage 发送消息
+type telegramNotifier struct{}
+
+func (telegramNotifier) Send(channel *models.AlertChannel, alert *models.Alert) error {
+	body, err := json.Marshal(map[string]string{
+		"chat_id": channel.ChatID,
+		"text":    formatText(alert),
+	})
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(config.GetConfig().Alert.TelegramAPI, "/") + "/bot" + channel.BotToken + "/sendMessage"
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// 错误信息中的 URL 含有令牌
+		return fmt.Errorf("请求 Telegram API 失败")
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("解析 Telegram API 响应失败: %v", err)
+	}
+	if !result.OK {
+		return fmt.Errorf("Telegram API 返回错误: %s", result.Description)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package alert
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/openlxd/backend/internal/lxd"
+	"github.com/openlxd/backend/internal/models"
+)
+
+// cgroupRoot cgroup 文件系统挂载点
+var cgroupRoot = "/sys/fs/cgroup"
+
+// detectOOM 检查本机节点上运行中容器的 OOM kill 计数，计数增加时触发 container_oom 告警
+// 远程节点的 cgroup 不可直接读取，暂不检测；首次读取只记录基准值
+func (e *Engine) detectOOM() {
+	var containers []models.Container
+	models.DB.Where("status = ? AND (node = ? OR node = '')", "Running", lxd.LocalNode).Find(&containers)
+
+	for _, container := range containers {
+		count, ok := oomKillCount(container.Hostname)
+		if !ok {
+			continue
+		}
+
+		e.mu.Lock()
+		last, seen := e.oomCounts[container.Hostname]
+		e.oomCounts[container.Hostname] = count
+		e.mu.Unlock()
+
+		if seen && count > last {
+			RaiseEvent(EventContainerOOM, container.Hostname,
+				fmt.Sprintf("容器 %s 发生 %d 次 OOM kill（累计 %d 次），内存限制 %d MB", container.Hostname, count-last, count, container.Memory))
+		}
+	}
+}
+
+// oomKillCount 读取容器 cgroup 中的 OOM kill 计数（cgroup v2 的 memory.events 或 v1 的 memory.oom_control）
+func oomKillCount(name string) (uint64, bool) {
+	paths := []string{
+		filepath.Join(cgroupRoot, "lxc.payload."+name, "memory.events"),
+		filepath.Join(cgroupRoot, "memory", "lxc.payload."+name, "memory.oom_control"),
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "oom_kill" {
+				if count, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+					return count, true
+				}
+			}
+		}
+	}
+	return 0, false
+}
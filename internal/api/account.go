@@ -0,0 +1,388 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/openlxd/backend/internal/alert"
+	"github.com/openlxd/backend/internal/audit"
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+)
+
+// accountUser 账号相关接口需要以具体用户身份调用（登录令牌或用户 API 密钥）
+func accountUser(w http.ResponseWriter, r *http.Request) *models.User {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		respondJSON(w, 400, "系统 API Hash 没有对应的用户账号", nil)
+		return nil
+	}
+	return user
+}
+
+// HandleTwoFactorSetup 开始启用两步验证（POST）：生成新密钥，需调用 verify 确认后才生效
+func HandleTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	user := accountUser(w, r)
+	if user == nil {
+		return
+	}
+	if r.Method != http.MethodPost {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+	if user.TOTPEnabled {
+		respondJSON(w, 400, "两步验证已启用，如需更换设备请先停用", nil)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondJSON(w, 500, "生成密钥失败", nil)
+		return
+	}
+	if err := models.DB.Model(user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		respondJSON(w, 500, fmt.Sprintf("保存失败: %v", err), nil)
+		return
+	}
+
+	respondJSON(w, 200, "请使用身份验证器应用扫码，并提交验证码完成启用", map[string]interface{}{
+		"secret":      secret,
+		"otpauth_url": auth.TOTPURL(user.Username, secret),
+	})
+}
+
+// HandleTwoFactorVerify 确认启用两步验证（POST {code}），成功后返回一次性恢复码
+func HandleTwoFactorVerify(w http.ResponseWriter, r *http.Request) {
+	user := accountUser(w, r)
+	if user == nil {
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+		respondJSON(w, 400, "请求参数错误", nil)
+		return
+	}
+	if user.TOTPEnabled {
+		respondJSON(w, 400, "两步验证已启用", nil)
+		return
+	}
+	if user.TOTPSecret == "" {
+		respondJSON(w, 400, "请先调用 setup 生成密钥", nil)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, req.Code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		respondJSON(w, 400, auth.ErrInvalidOTP.Error(), nil)
+		return
+	}
+	codes, err := auth.GenerateRecoveryCodes(user.ID)
+	if err != nil {
+		respondJSON(w, 500, fmt.Sprintf("生成恢复码失败: %v", err), nil)
+		return
+	}
+	if err := models.DB.Model(user).Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step}).Error; err != nil {
+		respondJSON(w, 500, fmt.Sprintf("保存失败: %v", err), nil)
+		return
+	}
+
+	models.LogAction("enable_2fa", "", fmt.Sprintf("用户 %s 启用两步验证", user.Username), "success")
+	respondJSON(w, 200, "两步验证已启用，请妥善保存恢复码，每个只能使用一次", map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// HandleTwoFactorDisable 停用两步验证（POST {password, code}）；管理员可通过 user_id 为丢失设备的用户停用
+func HandleTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	isAdmin := user == nil || user.IsAdmin()
+	if r.Method != http.MethodPost {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	target := user
+	if v := r.URL.Query().Get("user_id"); v != "" && isAdmin {
+		id, err := strconv.ParseUint(v, 10, 32)
+		target = &models.User{}
+		if err != nil || models.DB.First(target, id).Error != nil {
+			respondJSON(w, 404, "用户不存在", nil)
+			return
+		}
+	} else {
+		if user == nil {
+			respondJSON(w, 400, "系统 API Hash 需要指定 user_id", nil)
+			return
+		}
+		var req struct {
+			Password string `json:"password"`
+			Code     string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, 400, "请求参数错误", nil)
+			return
+		}
+		if !auth.CheckPasswordHash(req.Password, user.PasswordHash) {
+			respondJSON(w, 400, "密码错误", nil)
+			return
+		}
+		if user.TOTPEnabled {
+			if _, ok := auth.VerifySecondFactor(user, req.Code); !ok {
+				respondJSON(w, 400, auth.ErrInvalidOTP.Error(), nil)
+				return
+			}
+		}
+	}
+
+	err := models.DB.Model(target).Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error
+	if err == nil {
+		err = models.DB.Where("user_id = ?", target.ID).Delete(&models.RecoveryCode{}).Error
+	}
+	if err != nil {
+		respondJSON(w, 500, fmt.Sprintf("停用失败: %v", err), nil)
+		return
+	}
+
+	models.LogAction("disable_2fa", "", fmt.Sprintf("用户 %s 的两步验证已停用", target.Username), "success")
+	respondJSON(w, 200, "两步验证已停用", nil)
+}
+
+// HandleRecoveryCodes 重新生成恢复码（POST {code}），旧恢复码全部作废
+func HandleRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user := accountUser(w, r)
+	if user == nil {
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+		respondJSON(w, 400, "请求参数错误", nil)
+		return
+	}
+	if !user.TOTPEnabled {
+		respondJSON(w, 400, "未启用两步验证", nil)
+		return
+	}
+	if !auth.UseTOTP(user, req.Code) {
+		respondJSON(w, 400, auth.ErrInvalidOTP.Error(), nil)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(user.ID)
+	if err != nil {
+		respondJSON(w, 500, fmt.Sprintf("生成恢复码失败: %v", err), nil)
+		return
+	}
+	respondJSON(w, 200, "恢复码已重新生成", map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// HandleSessions 登录会话：GET 列出未过期的会话，DELETE ?id= 撤销指定会话，DELETE ?all=true 撤销除当前会话外的全部会话
+// 管理员可通过 user_id 查看和撤销其他用户的会话
+func HandleSessions(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	isAdmin := user == nil || user.IsAdmin()
+
+	var userID uint
+	if v := r.URL.Query().Get("user_id"); v != "" && isAdmin {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			respondJSON(w, 400, "user_id 无效", nil)
+			return
+		}
+		userID = uint(id)
+	} else if user != nil {
+		userID = user.ID
+	} else {
+		respondJSON(w, 400, "系统 API Hash 需要指定 user_id", nil)
+		return
+	}
+
+	current := ""
+	if claims := auth.GetClaimsFromContext(r.Context()); claims != nil {
+		current = claims.ID
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sessions, err := auth.ActiveSessions(userID)
+		if err != nil {
+			respondJSON(w, 500, fmt.Sprintf("查询失败: %v", err), nil)
+			return
+		}
+		result := make([]map[string]interface{}, 0, len(sessions))
+		for _, session := range sessions {
+			result = append(result, map[string]interface{}{
+				"id":         session.ID,
+				"ip":         session.IP,
+				"user_agent": session.UserAgent,
+				"method":     session.Method,
+				"created_at": session.CreatedAt,
+				"expires_at": session.ExpiresAt,
+				"current":    session.JTI == current,
+			})
+		}
+		respondJSON(w, 200, "获取成功", result)
+
+	case http.MethodDelete:
+		if r.URL.Query().Get("all") == "true" {
+			count, err := auth.RevokeUserSessions(userID, current)
+			if err != nil {
+				respondJSON(w, 500, fmt.Sprintf("撤销失败: %v", err), nil)
+				return
+			}
+			respondJSON(w, 200, fmt.Sprintf("已撤销 %d 个会话", count), nil)
+			return
+		}
+
+		id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+		if err != nil {
+			respondJSON(w, 400, "会话ID无效", nil)
+			return
+		}
+		var session models.UserSession
+		if err := models.DB.Where("user_id = ? AND revoked_at IS NULL", userID).First(&session, id).Error; err != nil {
+			respondJSON(w, 404, "会话不存在", nil)
+			return
+		}
+		if err := auth.RevokeSession(&session); err != nil {
+			respondJSON(w, 500, fmt.Sprintf("撤销失败: %v", err), nil)
+			return
+		}
+		respondJSON(w, 200, "会话已撤销", nil)
+
+	default:
+		respondJSON(w, 405, "Method not allowed", nil)
+	}
+}
+
+// HandleLogout 退出登录（POST），撤销当前登录令牌
+func HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+	claims := auth.GetClaimsFromContext(r.Context())
+	if claims == nil {
+		respondJSON(w, 400, "当前请求未使用登录令牌", nil)
+		return
+	}
+
+	var session models.UserSession
+	if err := models.DB.Where("jti = ?", claims.ID).First(&session).Error; err == nil {
+		err = auth.RevokeSession(&session)
+		if err != nil {
+			respondJSON(w, 500, fmt.Sprintf("退出失败: %v", err), nil)
+			return
+		}
+	} else if err := auth.RevokeToken(claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		respondJSON(w, 500, fmt.Sprintf("退出失败: %v", err), nil)
+		return
+	}
+	respondJSON(w, 200, "已退出登录", nil)
+}
+
+// HandleForgotPassword 申请重置密码（POST {username} 或 {email}），向账号邮箱发送限时重置链接
+// 无论账号是否存在都返回相同结果，避免被用于探测账号
+func HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil || (req.Username == "" && req.Email == "") {
+		respondJSON(w, 400, "请提供用户名或邮箱", nil)
+		return
+	}
+
+	var user models.User
+	query := models.DB.Where("status = ?", "active")
+	if req.Username != "" {
+		query = query.Where("username = ?", req.Username)
+	} else {
+		query = query.Where("email = ?", req.Email)
+	}
+	if err := query.First(&user).Error; err == nil && user.Email != "" {
+		go sendResetEmail(user)
+	}
+
+	respondJSON(w, 200, "如果账号存在，重置链接已发送到账号邮箱", nil)
+}
+
+// sendResetEmail 发送密码重置邮件
+func sendResetEmail(user models.User) {
+	cfg := config.GetConfig()
+	ttl := time.Duration(cfg.Security.ResetTokenTTL) * time.Minute
+	link := resetURL(cfg) + "?reset_token=" + url.QueryEscape(auth.GenerateResetToken(&user, ttl))
+
+	text := fmt.Sprintf("%s，您好：\n\n我们收到了重置 OpenLXD 面板密码的请求。请在 %d 分钟内打开以下链接设置新密码：\n\n%s\n\n如果不是您本人操作，请忽略此邮件，原密码仍然有效。\n",
+		user.Username, cfg.Security.ResetTokenTTL, link)
+	if err := alert.SendMail([]string{user.Email}, "OpenLXD 密码重置", text); err != nil {
+		log.Printf("发送密码重置邮件失败 (%s): %v", user.Username, err)
+	}
+}
+
+// resetURL 密码重置页面地址：优先使用配置，否则根据 server 配置生成
+func resetURL(cfg *config.Config) string {
+	if cfg.Security.ResetURL != "" {
+		return cfg.Security.ResetURL
+	}
+	return panelURL(cfg) + "/admin/login"
+}
+
+// panelURL 面板的外部访问地址，由 server 配置生成（不使用请求的 Host，防止邮件和回调中的链接被伪造）
+func panelURL(cfg *config.Config) string {
+	scheme := "http"
+	if cfg.Server.HTTPS {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, cfg.Server.Domain, cfg.Server.Port)
+}
+
+// HandleResetPassword 使用重置令牌设置新密码（POST {token, password}），成功后撤销该用户的全部会话
+func HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+		respondJSON(w, 400, "请求参数错误", nil)
+		return
+	}
+
+	user, err := auth.ParseResetToken(req.Token)
+	if err != nil {
+		respondJSON(w, 400, err.Error(), nil)
+		return
+	}
+	if err := auth.ValidatePassword(req.Password); err != nil {
+		respondJSON(w, 400, "密码长度至少 8 位", nil)
+		return
+	}
+	passwordHash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		respondJSON(w, 500, "密码加密失败", nil)
+		return
+	}
+	if err := models.DB.Model(user).Update("password_hash", passwordHash).Error; err != nil {
+		respondJSON(w, 500, fmt.Sprintf("保存失败: %v", err), nil)
+		return
+	}
+
+	revoked, err := auth.RevokeUserSessions(user.ID, "")
+	if err != nil {
+		log.Printf("重置密码后撤销会话失败 (%s): %v", user.Username, err)
+	}
+	auth.GlobalLoginGuard.Reset(user.Username)
+	models.LogAction("reset_password", "", fmt.Sprintf("用户 %s 通过邮件重置密码（来自 %s），撤销 %d 个会话", user.Username, audit.ClientIP(r), revoked), "success")
+	respondJSON(w, 200, "密码已重置，请使用新密码登录", nil)
+}
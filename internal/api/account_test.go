@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/testutil"
+)
+
+// setupAccountTest 使用临时数据库和 SMTP 替身，返回收到的邮件
+func setupAccountTest(t *testing.T) chan string {
+	t.Helper()
+	testutil.Setup(t, func(cfg *config.Config) {
+		cfg.Server.Domain = "panel.example.com"
+		cfg.Server.Port = 8080
+		cfg.Security.LoginMaxAttempts = 5
+		cfg.Security.LoginIPMaxAttempts = 20
+		cfg.Security.LoginLockout = 15
+		cfg.Security.ResetTokenTTL = 30
+		cfg.Alert.SMTPFrom = "panel@example.com"
+	})
+	return testutil.SMTPStandIn(t)
+}
+
+// callJSON 调用处理函数，返回响应体中的 code
+func callJSON(t *testing.T, handler http.HandlerFunc, user *models.User, body interface{}) int {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data)))
+	if user != nil {
+		r = r.WithContext(context.WithValue(r.Context(), auth.UserContextKey, user))
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	var resp struct {
+		Code int `json:"code"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Code
+}
+
+func TestPasswordResetByEmail(t *testing.T) {
+	messages := setupAccountTest(t)
+
+	hash, _ := auth.HashPassword("old-password")
+	user := models.User{Username: "alice", Email: "alice@example.com", PasswordHash: hash, Role: "user", Status: "active"}
+	models.DB.Create(&user)
+	token, _, err := auth.NewSession(&user, "192.0.2.1", "test", auth.LoginMethodPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := callJSON(t, HandleForgotPassword, nil, map[string]string{"email": "nobody@example.com"}); code != 200 {
+		t.Fatalf("不存在的账号应返回相同结果，实际 %d", code)
+	}
+	if code := callJSON(t, HandleForgotPassword, nil, map[string]string{"username": "alice"}); code != 200 {
+		t.Fatalf("申请重置应成功，实际 %d", code)
+	}
+
+	message := testutil.Receive(t, messages)
+	if !strings.Contains(message, "http://panel.example.com:8080/admin/login?reset_token=") {
+		t.Fatalf("邮件中的链接应使用配置的面板地址: %s", message)
+	}
+	match := regexp.MustCompile(`reset_token=(\S+)`).FindStringSubmatch(message)
+	if match == nil {
+		t.Fatalf("邮件中没有重置链接: %s", message)
+	}
+	resetToken, _ := url.QueryUnescape(match[1])
+
+	if code := callJSON(t, HandleResetPassword, nil, map[string]string{"token": resetToken, "password": "new-password"}); code != 200 {
+		t.Fatalf("使用重置令牌设置密码应成功，实际 %d", code)
+	}
+	if _, err := auth.ParseToken(token); err != auth.ErrTokenRevoked {
+		t.Fatalf("重置密码后原有会话应被撤销，实际 %v", err)
+	}
+	if _, _, err := auth.Login("alice", "new-password", "", "192.0.2.1"); err != nil {
+		t.Fatalf("应可以使用新密码登录: %v", err)
+	}
+	if code := callJSON(t, HandleResetPassword, nil, map[string]string{"token": resetToken, "password": "another-password"}); code != 400 {
+		t.Fatalf("重置令牌只能使用一次，实际 %d", code)
+	}
+}
+
+func TestRecoveryCodesRejectReplayedTOTP(t *testing.T) {
+	setupAccountTest(t)
+
+	secret, _ := auth.GenerateTOTPSecret()
+	user := models.User{Username: "bob", PasswordHash: "x", Role: "user", Status: "active", TOTPSecret: secret, TOTPEnabled: true}
+	models.DB.Create(&user)
+	code, _ := auth.TOTPCode(secret, time.Now().Unix()/30)
+
+	// 每个请求使用各自读取的用户记录，与认证中间件一致
+	first, second := user, user
+	if resp := callJSON(t, HandleRecoveryCodes, &first, map[string]string{"code": code}); resp != 200 {
+		t.Fatalf("首次使用验证码应可以重新生成恢复码，实际 %d", resp)
+	}
+	if resp := callJSON(t, HandleRecoveryCodes, &second, map[string]string{"code": code}); resp != 400 {
+		t.Fatalf("重放的验证码应被拒绝，实际 %d", resp)
+	}
+}
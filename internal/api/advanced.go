@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
+	"github.com/openlxd/backend/internal/capacity"
 	"github.com/openlxd/backend/internal/lxd"
 	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/quota"
 )
 
 // HandleSnapshots 处理容器快照请求
@@ -46,6 +49,7 @@ func HandleSnapshots(w http.ResponseWriter, r *http.Request) {
 
 		// 记录日志
 		models.LogAction("create_snapshot", containerName, fmt.Sprintf("创建快照: %s", req.SnapshotName), "success")
+		emitSnapshotEvent(containerName, req.SnapshotName)
 		respondJSON(w, 200, "快照创建成功", nil)
 
 	case http.MethodPut:
@@ -114,6 +118,22 @@ func HandleClone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 克隆出的容器归属源容器的用户，按源容器规格检查用户配额
+	var source models.Container
+	sourceKnown := models.DB.Where("hostname = ?", req.SourceContainer).First(&source).Error == nil
+	if sourceKnown {
+		release, err := quota.GlobalQuotaManager.ReserveUserContainer(source.UserID, source.CPUs, source.Memory, source.Disk)
+		if err != nil {
+			respondJSON(w, 403, err.Error(), nil)
+			return
+		}
+		defer release()
+		if err := capacity.GlobalManager.CheckAdmission(source.Node, source.CPUs, source.Memory, source.Disk); err != nil {
+			respondJSON(w, 409, err.Error(), nil)
+			return
+		}
+	}
+
 	var err error
 	if req.SnapshotName != "" {
 		// 从快照克隆
@@ -128,6 +148,24 @@ func HandleClone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 保存到数据库，计入用户配额
+	if sourceKnown {
+		models.DB.Create(&models.Container{
+			Hostname:     req.TargetContainer,
+			Status:       "Stopped",
+			Image:        source.Image,
+			CPUs:         source.CPUs,
+			Memory:       source.Memory,
+			Disk:         source.Disk,
+			Ingress:      source.Ingress,
+			Egress:       source.Egress,
+			TrafficLimit: source.TrafficLimit,
+			UserID:       source.UserID,
+			CreatedBy:    source.CreatedBy,
+			Node:         source.Node,
+		})
+	}
+
 	// 记录日志
 	models.LogAction("clone_container", req.TargetContainer, fmt.Sprintf("从 %s 克隆", req.SourceContainer), "success")
 	respondJSON(w, 200, "容器克隆成功", nil)
@@ -237,8 +275,61 @@ func HandleResourceLimits(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := lxd.SetResourceLimits(req.Container, req.CPULimit, req.MemoryLimit, req.DiskLimit)
+	// 解析目标规格（不带单位时内存按 MB、磁盘按 GB）
+	var spec lxd.ResizeSpec
+	if req.CPULimit != "" {
+		cpus, err := strconv.Atoi(req.CPULimit)
+		if err != nil || cpus <= 0 {
+			respondJSON(w, 400, "CPU 限制必须为正整数核心数", nil)
+			return
+		}
+		spec.CPUs = cpus
+	}
+	if req.MemoryLimit != "" {
+		size, err := parseSpecSize(req.MemoryLimit, 1000*1000)
+		if err != nil {
+			respondJSON(w, 400, "无效的内存大小", nil)
+			return
+		}
+		spec.MemoryMB = size
+	}
+	if req.DiskLimit != "" {
+		size, err := parseSpecSize(req.DiskLimit, 1000*1000*1000)
+		if err != nil {
+			respondJSON(w, 400, "无效的磁盘大小", nil)
+			return
+		}
+		spec.DiskGB = size
+	}
+	if spec.IsEmpty() {
+		respondJSON(w, 400, "没有需要调整的规格", nil)
+		return
+	}
+
+	var container models.Container
+	if err := models.DB.Where("hostname = ?", req.Container).First(&container).Error; err != nil {
+		respondJSON(w, 404, "容器不存在", nil)
+		return
+	}
+
+	// 检查用户配额
+	if err := quota.GlobalQuotaManager.CheckUserResizeQuota(container.ID, spec.CPUs, spec.MemoryMB, spec.DiskGB); err != nil {
+		respondJSON(w, 403, err.Error(), nil)
+		return
+	}
+
+	// 检查宿主机容量策略
+	if err := capacity.GlobalManager.CheckResize(container.ID, spec.CPUs, spec.MemoryMB, spec.DiskGB); err != nil {
+		respondJSON(w, 409, err.Error(), nil)
+		return
+	}
+
+	// 一次性提交到 LXD，数据库保存失败时回滚
+	err := lxd.ResizeContainer(req.Container, spec, func() error {
+		return saveContainerSpec(models.DB, &container, spec)
+	})
 	if err != nil {
+		models.LogAction("set_limits", req.Container, fmt.Sprintf("设置资源限制失败: %v", err), "failed")
 		respondJSON(w, 500, fmt.Sprintf("设置资源限制失败: %v", err), nil)
 		return
 	}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/openlxd/backend/internal/alert"
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/models"
+)
+
+// alertPageOptions 告警列表的排序和搜索字段
+var alertPageOptions = pageOptions{
+	Sorts: map[string]string{
+		"id":         "id",
+		"starts_at":  "starts_at",
+		"updated_at": "updated_at",
+		"severity":   "severity",
+	},
+	DefaultSort:  "-starts_at",
+	DefaultLimit: 100,
+	Search:       []string{"target", "rule_name", "message"},
+}
+
+// HandleAlerts 查询告警列表（GET），可按 state、severity、target 过滤，普通用户只能看到自己容器的告警
+func HandleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	page, err := parsePage(r, alertPageOptions)
+	if err != nil {
+		respondJSON(w, 400, err.Error(), nil)
+		return
+	}
+
+	values := r.URL.Query()
+	query := models.DB.Model(&models.Alert{})
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		query = query.Where("user_id = ?", user.ID)
+	}
+	if state := values.Get("state"); state != "" {
+		query = query.Where("state = ?", state)
+	}
+	if severity := values.Get("severity"); severity != "" {
+		query = query.Where("severity = ?", severity)
+	}
+	if target := values.Get("target"); target != "" {
+		query = query.Where("target = ?", target)
+	}
+
+	var alerts []models.Alert
+	query, total, err := page.Apply(query, &models.Alert{})
+	if err == nil {
+		err = query.Find(&alerts).Error
+	}
+	if err != nil {
+		respondJSON(w, 500, fmt.Sprintf("查询失败: %v", err), nil)
+		return
+	}
+	page.SetHeaders(w, total, len(alerts))
+
+	respondJSON(w, 200, "获取成功", page.Result(alerts, total, len(alerts)))
+}
+
+// HandleAlertRules 管理告警规则（仅管理员）：GET 列表，POST 创建或更新（指定 id），DELETE ?id= 删除
+func HandleAlertRules(w http.ResponseWriter, r *http.Request) {
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		respondJSON(w, 403, "需要管理员权限", nil)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var rules []models.AlertRule
+		models.DB.Order("id").Find(&rules)
+		respondJSON(w, 200, "获取成功", rules)
+
+	case http.MethodPost:
+		var req struct {
+			models.AlertRule
+			Enabled *bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, 400, "请求参数错误", nil)
+			return
+		}
+
+		rule := req.AlertRule
+		if rule.ID != 0 {
+			var existing models.AlertRule
+			if err := models.DB.First(&existing, rule.ID).Error; err != nil {
+				respondJSON(w, 404, "规则不存在", nil)
+				return
+			}
+			rule.CreatedAt = existing.CreatedAt
+			rule.Enabled = existing.Enabled
+		} else {
+			rule.Enabled = true
+		}
+		if req.Enabled != nil {
+			rule.Enabled = *req.Enabled
+		}
+		if err := alert.ValidateRule(&rule); err != nil {
+			respondJSON(w, 400, err.Error(), nil)
+			return
+		}
+
+		if err := models.DB.Save(&rule).Error; err != nil {
+			respondJSON(w, 500, fmt.Sprintf("保存失败: %v", err), nil)
+			return
+		}
+		models.LogAction("save_alert_rule", "", fmt.Sprintf("保存告警规则: %s", rule.Name), "success")
+		respondJSON(w, 200, "保存成功", rule)
+
+	case http.MethodDelete:
+		id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+		if err != nil {
+			respondJSON(w, 400, "规则ID无效", nil)
+			return
+		}
+		result := models.DB.Delete(&models.AlertRule{}, id)
+		if result.Error != nil {
+			respondJSON(w, 500, fmt.Sprintf("删除失败: %v", result.Error), nil)
+			return
+		}
+		if result.RowsAffected == 0 {
+			respondJSON(w, 404, "规则不存在", nil)
+			return
+		}
+		// 未恢复的告警随规则一起关闭
+		models.DB.Where("rule_id = ? AND state <> ?", id, alert.StateResolved).Delete(&models.Alert{})
+		models.LogAction("delete_alert_rule", "", fmt.Sprintf("删除告警规则: %d", id), "success")
+		respondJSON(w, 200, "删除成功", nil)
+
+	default:
+		respondJSON(w, 405, "Method not allowed", nil)
+	}
+}
+
+// HandleAlertChannels 管理告警通知渠道：GET 列表，POST 创建或更新（指定 id），DELETE ?id= 删除
+// 普通用户只能管理自己的渠道（即订阅自己容器的告警）；管理员创建的渠道 user_id 为 0 时接收全部告警
+func HandleAlertChannels(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	isAdmin := user == nil || user.IsAdmin()
+
+	query := models.DB.Model(&models.AlertChannel{})
+	if !isAdmin {
+		query = query.Where("user_id = ?", user.ID)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var channels []models.AlertChannel
+		query.Order("id").Find(&channels)
+		respondJSON(w, 200, "获取成功", channels)
+
+	case http.MethodPost:
+		var req struct {
+			models.AlertChannel
+			Enabled *bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, 400, "请求参数错误", nil)
+			return
+		}
+
+		channel := req.AlertChannel
+		if channel.ID != 0 {
+			var existing models.AlertChannel
+			if err := query.First(&existing, channel.ID).Error; err != nil {
+				respondJSON(w, 404, "渠道不存在", nil)
+				return
+			}
+			channel.CreatedAt = existing.CreatedAt
+			channel.Enabled = existing.Enabled
+		} else {
+			channel.Enabled = true
+		}
+		if req.Enabled != nil {
+			channel.Enabled = *req.Enabled
+		}
+		if !isAdmin {
+			channel.UserID = user.ID
+		}
+		if err := alert.ValidateChannel(&channel); err != nil {
+			respondJSON(w, 400, err.Error(), nil)
+			return
+		}
+
+		if err := models.DB.Save(&channel).Error; err != nil {
+			respondJSON(w, 500, fmt.Sprintf("保存失败: %v", err), nil)
+			return
+		}
+		models.LogAction("save_alert_channel", "", fmt.Sprintf("保存告警通知渠道: %s (%s)", channel.Name, channel.Type), "success")
+		respondJSON(w, 200, "保存成功", channel)
+
+	case http.MethodDelete:
+		id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+		if err != nil {
+			respondJSON(w, 400, "渠道ID无效", nil)
+			return
+		}
+		result := query.Where("id = ?", id).Delete(&models.AlertChannel{})
+		if result.Error != nil {
+			respondJSON(w, 500, fmt.Sprintf("删除失败: %v", result.Error), nil)
+			return
+		}
+		if result.RowsAffected == 0 {
+			respondJSON(w, 404, "渠道不存在", nil)
+			return
+		}
+		models.LogAction("delete_alert_channel", "", fmt.Sprintf("删除告警通知渠道: %d", id), "success")
+		respondJSON(w, 200, "删除成功", nil)
+
+	default:
+		respondJSON(w, 405, "Method not allowed", nil)
+	}
+}
+
+// HandleTestAlertChannel 通过指定渠道发送测试告警（POST ?id=）
+func HandleTestAlertChannel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		respondJSON(w, 400, "渠道ID无效", nil)
+		return
+	}
+
+	user := auth.GetUserFromContext(r.Context())
+	isAdmin := user == nil || user.IsAdmin()
+	query := models.DB.Model(&models.AlertChannel{})
+	if !isAdmin {
+		query = query.Where("user_id = ?", user.ID)
+	}
+
+	var channel models.AlertChannel
+	if err := query.First(&channel, id).Error; err != nil {
+		respondJSON(w, 404, "渠道不存在", nil)
+		return
+	}
+
+	if err := alert.SendTest(&channel); err != nil {
+		// 具体错误可能暴露内网连通性，只返回给管理员
+		if !isAdmin {
+			log.Printf("测试告警渠道 %d 失败: %v", channel.ID, err)
+			respondJSON(w, 502, "发送失败，请检查渠道配置", nil)
+			return
+		}
+		respondJSON(w, 502, fmt.Sprintf("发送失败: %v", err), nil)
+		return
+	}
+	respondJSON(w, 200, "测试告警已发送", nil)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/events"
+	"github.com/openlxd/backend/internal/models"
+)
+
+// HandleAPIKeys 管理 API 密钥：GET 列表，POST 创建，DELETE ?id= 撤销
+// 普通用户只能管理自己的密钥；管理员可通过 user_id 管理其他用户的密钥。密钥明文只在创建时返回一次
+func HandleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	isAdmin := user == nil || user.IsAdmin()
+
+	// 目标用户：普通用户固定为自己，管理员可指定 user_id
+	var owner models.User
+	switch {
+	case isAdmin && r.URL.Query().Get("user_id") != "":
+		id, err := strconv.ParseUint(r.URL.Query().Get("user_id"), 10, 32)
+		if err != nil || models.DB.First(&owner, id).Error != nil {
+			respondJSON(w, 404, "用户不存在", nil)
+			return
+		}
+	case user != nil:
+		owner = *user
+	case r.Method != http.MethodGet:
+		respondJSON(w, 400, "使用系统 API Hash 时需要指定 user_id", nil)
+		return
+	}
+
+	query := models.DB.Model(&models.APIKey{})
+	if owner.ID != 0 {
+		query = query.Where("user_id = ?", owner.ID)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var keys []models.APIKey
+		query.Order("id").Find(&keys)
+		respondJSON(w, 200, "获取成功", map[string]interface{}{
+			"keys":   keys,
+			"scopes": auth.Scopes,
+		})
+
+	case http.MethodPost:
+		var req struct {
+			Name          string     `json:"name"`
+			Scopes        string     `json:"scopes"`
+			AllowedIPs    string     `json:"allowed_ips"`
+			ExpiresAt     *time.Time `json:"expires_at"`
+			ExpiresInDays int        `json:"expires_in_days"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, 400, "请求参数错误", nil)
+			return
+		}
+		if req.Name == "" {
+			respondJSON(w, 400, "密钥名称不能为空", nil)
+			return
+		}
+
+		// 只有管理员账号的密钥可以授予 admin
+		scopes, err := auth.ParseScopes(req.Scopes, &owner)
+		if err != nil {
+			respondJSON(w, 400, err.Error(), nil)
+			return
+		}
+		allowedIPs, err := auth.ParseAllowedIPs(req.AllowedIPs)
+		if err != nil {
+			respondJSON(w, 400, err.Error(), nil)
+			return
+		}
+
+		expiresAt := req.ExpiresAt
+		if expiresAt == nil && req.ExpiresInDays > 0 {
+			t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+			expiresAt = &t
+		}
+		if expiresAt != nil && !expiresAt.After(time.Now()) {
+			respondJSON(w, 400, "过期时间必须晚于当前时间", nil)
+			return
+		}
+
+		plaintext, key, err := auth.CreateAPIKey(owner.ID, req.Name, scopes, allowedIPs, expiresAt)
+		if err != nil {
+			respondJSON(w, 500, fmt.Sprintf("创建失败: %v", err), nil)
+			return
+		}
+		models.LogAction("create_api_key", "", fmt.Sprintf("为用户 %s 创建 API 密钥: %s (%s)", owner.Username, key.Name, key.Prefix), "success")
+		respondJSON(w, 200, "创建成功，请妥善保存密钥，之后将无法再次查看", map[string]interface{}{
+			"key":     plaintext,
+			"api_key": key,
+		})
+
+	case http.MethodDelete:
+		id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+		if err != nil {
+			respondJSON(w, 400, "密钥ID无效", nil)
+			return
+		}
+		var key models.APIKey
+		if err := query.First(&key, id).Error; err != nil {
+			respondJSON(w, 404, "密钥不存在", nil)
+			return
+		}
+		if err := models.DB.Delete(&key).Error; err != nil {
+			respondJSON(w, 500, fmt.Sprintf("撤销失败: %v", err), nil)
+			return
+		}
+		events.GlobalBroker.CloseAPIKey(key.ID)
+		models.LogAction("revoke_api_key", "", fmt.Sprintf("撤销 API 密钥: %s (%s)", key.Name, key.Prefix), "success")
+		respondJSON(w, 200, "撤销成功", nil)
+
+	default:
+		respondJSON(w, 405, "Method not allowed", nil)
+	}
+}
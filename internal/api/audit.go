@@ -0,0 +1,208 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// auditPageOptions 审计日志的排序和搜索字段
+var auditPageOptions = pageOptions{
+	Sorts: map[string]string{
+		"id":         "id",
+		"created_at": "created_at",
+		"actor":      "actor",
+		"route":      "route",
+	},
+	DefaultSort:  "-id",
+	DefaultLimit: 100,
+	Search:       []string{"actor", "route", "container", "body"},
+}
+
+// auditCSVHeader 导出 CSV 的列
+var auditCSVHeader = []string{"id", "created_at", "actor_type", "actor", "user_id", "ip", "method", "route", "query", "container", "status", "body", "prev_hash", "hash"}
+
+// HandleAuditLogs 查询审计日志（GET），可按 actor、actor_type、user_id、container、route、method、from、to 过滤
+// format=csv 或 format=json 时导出全部匹配记录（按 ID 升序，包含哈希便于离线校验）；普通用户只能查看自己的记录
+func HandleAuditLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	query, err := auditQuery(r)
+	if err != nil {
+		respondJSON(w, 400, err.Error(), nil)
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "":
+	case "csv", "json":
+		exportAuditLogs(w, query.Order("id"), format)
+		return
+	default:
+		respondJSON(w, 400, "format 只支持 csv 或 json", nil)
+		return
+	}
+
+	page, err := parsePage(r, auditPageOptions)
+	if err != nil {
+		respondJSON(w, 400, err.Error(), nil)
+		return
+	}
+
+	var logs []models.AuditLog
+	query, total, err := page.Apply(query, &models.AuditLog{})
+	if err == nil {
+		err = query.Find(&logs).Error
+	}
+	if err != nil {
+		respondJSON(w, 500, fmt.Sprintf("查询失败: %v", err), nil)
+		return
+	}
+	page.SetHeaders(w, total, len(logs))
+
+	respondJSON(w, 200, "获取成功", page.Result(logs, total, len(logs)))
+}
+
+// HandleAuditVerify 校验审计日志哈希链（GET，仅管理员）
+func HandleAuditVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		respondJSON(w, 403, "需要管理员权限", nil)
+		return
+	}
+
+	result, err := models.VerifyAuditChain()
+	if err != nil {
+		respondJSON(w, 500, fmt.Sprintf("校验失败: %v", err), nil)
+		return
+	}
+	if !result.Valid {
+		respondJSON(w, 200, fmt.Sprintf("审计日志在记录 %d 处校验失败: %s", result.BrokenID, result.Reason), result)
+		return
+	}
+	respondJSON(w, 200, "审计日志完整", result)
+}
+
+// auditQuery 根据过滤参数构造查询
+func auditQuery(r *http.Request) (*gorm.DB, error) {
+	values := r.URL.Query()
+	query := models.DB.Model(&models.AuditLog{})
+
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		query = query.Where("user_id = ?", user.ID)
+	} else if userID := values.Get("user_id"); userID != "" {
+		id, err := strconv.ParseUint(userID, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("user_id 无效")
+		}
+		query = query.Where("user_id = ?", id)
+	}
+
+	for _, column := range []string{"actor", "actor_type", "container", "route", "method"} {
+		if v := values.Get(column); v != "" {
+			query = query.Where(column+" = ?", v)
+		}
+	}
+
+	if v := values.Get("from"); v != "" {
+		from, err := parseTimeParam(v)
+		if err != nil {
+			return nil, fmt.Errorf("from 格式无效，支持 RFC3339、YYYY-MM-DD 或 Unix 时间戳")
+		}
+		query = query.Where("created_at >= ?", from.UTC())
+	}
+	if v := values.Get("to"); v != "" {
+		to, err := parseTimeParam(v)
+		if err != nil {
+			return nil, fmt.Errorf("to 格式无效，支持 RFC3339、YYYY-MM-DD 或 Unix 时间戳")
+		}
+		query = query.Where("created_at < ?", to.UTC())
+	}
+	return query, nil
+}
+
+// parseTimeParam 解析时间参数：RFC3339、YYYY-MM-DD（本地时区）或 Unix 秒
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	sec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// exportAuditLogs 分批流式导出审计日志
+func exportAuditLogs(w http.ResponseWriter, query *gorm.DB, format string) {
+	filename := fmt.Sprintf("audit-%s.%s", time.Now().Format("20060102-150405"), format)
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+
+	var batch []models.AuditLog
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writer := csv.NewWriter(w)
+		writer.Write(auditCSVHeader)
+		query.FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for _, entry := range batch {
+				writer.Write([]string{
+					strconv.FormatUint(uint64(entry.ID), 10),
+					entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+					entry.ActorType,
+					entry.Actor,
+					strconv.FormatUint(uint64(entry.UserID), 10),
+					entry.IP,
+					entry.Method,
+					entry.Route,
+					entry.Query,
+					entry.Container,
+					strconv.Itoa(entry.Status),
+					entry.Body,
+					entry.PrevHash,
+					entry.Hash,
+				})
+			}
+			writer.Flush()
+			return writer.Error()
+		})
+		return
+	}
+
+	// JSON 导出为数组，逐条写出避免一次性加载全部记录
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("["))
+	first := true
+	query.FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, entry := range batch {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if !first {
+				w.Write([]byte(","))
+			}
+			first = false
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	w.Write([]byte("]\n"))
+}
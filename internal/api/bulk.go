@@ -0,0 +1,325 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/lxd"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/operations"
+)
+
+// 批量操作默认和最大并发数
+const (
+	defaultBulkParallelism = 4
+	maxBulkParallelism     = 20
+)
+
+// BulkSelector 批量操作的容器选择条件，多个条件同时生效
+type BulkSelector struct {
+	Names  []string      `json:"names"`
+	UserID uint          `json:"user_id"`
+	Image  string        `json:"image"`
+	Node   string        `json:"node"`
+	Status string        `json:"status"`
+	Labels models.Labels `json:"labels"` // 值为空时只要求存在该标签
+	All    bool          `json:"all"`    // 未指定其他条件时必须显式选择全部容器
+}
+
+// BulkRequest 批量操作请求
+type BulkRequest struct {
+	Selector     BulkSelector `json:"selector"`
+	Action       string       `json:"action"` // start, stop, restart, suspend, unsuspend, snapshot
+	SnapshotName string       `json:"snapshot_name"`
+	Parallelism  int          `json:"parallelism"`
+	DryRun       bool         `json:"dry_run"`
+	Wait         bool         `json:"wait"` // 等待全部完成后返回逐项结果
+}
+
+// HandleBulkContainers 批量执行容器操作
+// 按选择条件匹配容器，以有限并发执行操作；dry_run 时只返回匹配的容器，
+// 否则返回操作记录，可通过 /api/v1/operations 查询进度和逐项结果
+func HandleBulkContainers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		RespondContainerJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	var req BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondContainerJSON(w, 400, "请求参数错误", nil)
+		return
+	}
+
+	switch req.Action {
+	case "start", "stop", "restart", "suspend", "unsuspend", "snapshot":
+	default:
+		RespondContainerJSON(w, 400, "不支持的操作: "+req.Action, nil)
+		return
+	}
+
+	// 普通用户只能操作自己的容器
+	user := auth.GetUserFromContext(r.Context())
+	if user != nil && !user.IsAdmin() {
+		req.Selector.UserID = user.ID
+	}
+
+	containers, err := selectContainers(req.Selector)
+	if err != nil {
+		RespondContainerJSON(w, 400, err.Error(), nil)
+		return
+	}
+
+	names := make([]string, 0, len(containers))
+	for _, container := range containers {
+		names = append(names, container.Hostname)
+	}
+	missing := unmatchedNames(req.Selector.Names, containers)
+
+	if req.DryRun {
+		RespondContainerJSON(w, 200, fmt.Sprintf("匹配 %d 个容器", len(names)), map[string]interface{}{
+			"action":     req.Action,
+			"total":      len(names),
+			"containers": names,
+			"unmatched":  missing,
+		})
+		return
+	}
+
+	if len(containers) == 0 && len(missing) == 0 {
+		RespondContainerJSON(w, 400, "没有匹配的容器", nil)
+		return
+	}
+
+	parallelism := req.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultBulkParallelism
+	}
+	if parallelism > maxBulkParallelism {
+		parallelism = maxBulkParallelism
+	}
+
+	createdBy := "admin"
+	if user != nil {
+		createdBy = user.Username
+	}
+
+	total := len(containers) + len(missing)
+	op := operations.GlobalManager.Create("bulk_"+req.Action,
+		fmt.Sprintf("批量%s %d 个容器", bulkActionNames[req.Action], total), createdBy, total,
+		map[string]interface{}{
+			"action":      req.Action,
+			"selector":    req.Selector,
+			"parallelism": parallelism,
+		})
+
+	// 指定名称但未匹配到的容器记为失败项
+	for _, name := range missing {
+		op.AddResult(operations.Result{Target: name, Status: "failed", Error: "容器不存在或不符合选择条件"})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runBulk(op, containers, req, parallelism)
+	}()
+
+	if req.Wait {
+		<-done
+		result, _ := operations.GlobalManager.Get(op.ID)
+		RespondContainerJSON(w, 200, "批量操作已完成", result)
+		return
+	}
+
+	RespondContainerJSON(w, 202, "批量操作已开始", op.Snapshot())
+}
+
+// bulkActionNames 操作的中文名称
+var bulkActionNames = map[string]string{
+	"start":     "启动",
+	"stop":      "停止",
+	"restart":   "重启",
+	"suspend":   "暂停",
+	"unsuspend": "恢复",
+	"snapshot":  "快照",
+}
+
+// selectContainers 按选择条件查询容器
+func selectContainers(selector BulkSelector) ([]models.Container, error) {
+	query := models.DB.Model(&models.Container{})
+	filtered := false
+
+	if len(selector.Names) > 0 {
+		query = query.Where("hostname IN ?", selector.Names)
+		filtered = true
+	}
+	if selector.UserID != 0 {
+		query = query.Where("user_id = ?", selector.UserID)
+		filtered = true
+	}
+	if selector.Image != "" {
+		query = query.Where("image = ?", selector.Image)
+		filtered = true
+	}
+	if selector.Node != "" {
+		query = query.Where("node = ?", selector.Node)
+		filtered = true
+	}
+	if selector.Status != "" {
+		query = query.Where("LOWER(status) = LOWER(?)", selector.Status)
+		filtered = true
+	}
+	if len(selector.Labels) > 0 {
+		query = models.WhereLabels(query, selector.Labels)
+		filtered = true
+	}
+	if !filtered && !selector.All {
+		return nil, fmt.Errorf("请指定选择条件，或设置 all 选择全部容器")
+	}
+
+	var containers []models.Container
+	if err := query.Order("id ASC").Find(&containers).Error; err != nil {
+		return nil, fmt.Errorf("查询容器失败: %v", err)
+	}
+	return containers, nil
+}
+
+// unmatchedNames 按名称选择时没有匹配到容器的名称（不存在、无权访问或不符合其他条件）
+func unmatchedNames(names []string, containers []models.Container) []string {
+	matched := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		matched[container.Hostname] = true
+	}
+
+	missing := []string{}
+	for _, name := range names {
+		if !matched[name] {
+			missing = append(missing, name)
+			matched[name] = true
+		}
+	}
+	return missing
+}
+
+// runBulk 以有限并发执行批量操作，取消后未开始的容器标记为跳过
+func runBulk(op *operations.Operation, containers []models.Container, req BulkRequest, parallelism int) {
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for _, container := range containers {
+		if op.Cancelled() {
+			op.AddResult(operations.Result{Target: container.Hostname, Status: "skipped", Error: "操作已取消"})
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := executeBulkAction(name, req); err != nil {
+				op.AddResult(operations.Result{Target: name, Status: "failed", Error: err.Error()})
+				return
+			}
+			op.AddResult(operations.Result{Target: name, Status: "success"})
+		}(container.Hostname)
+	}
+	wg.Wait()
+	op.Finish()
+
+	snapshot := op.Snapshot()
+	models.LogAction(op.Type, "",
+		fmt.Sprintf("%s: 成功 %d, 失败 %d, 共 %d", op.Description, snapshot.Succeeded, snapshot.Failed, snapshot.Total), snapshot.Status)
+}
+
+// executeBulkAction 对单个容器执行操作并同步数据库状态
+func executeBulkAction(name string, req BulkRequest) error {
+	var status string
+	var err error
+
+	switch req.Action {
+	case "start":
+		status = "Running"
+		err = lxd.StartContainer(name)
+	case "stop":
+		status = "Stopped"
+		err = lxd.StopContainer(name)
+	case "restart":
+		status = "Running"
+		err = lxd.RestartContainer(name)
+	case "suspend":
+		status = "suspended"
+		err = lxd.StopContainer(name)
+	case "unsuspend":
+		status = "running"
+		err = lxd.StartContainer(name)
+	case "snapshot":
+		err = lxd.CreateSnapshot(name, req.SnapshotName, false)
+	}
+	if err != nil {
+		return err
+	}
+
+	if status != "" {
+		models.DB.Model(&models.Container{}).Where("hostname = ?", name).Update("status", status)
+	}
+	if req.Action == "snapshot" {
+		emitSnapshotEvent(name, req.SnapshotName)
+	} else if event, ok := actionEvents[req.Action]; ok {
+		emitContainerEvent(event, name)
+	}
+	return nil
+}
+
+// HandleOperations 查询后台操作列表或详情（GET，指定 id 时返回逐项结果），取消操作（DELETE）
+func HandleOperations(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	id := r.URL.Query().Get("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		if id == "" {
+			list := operations.GlobalManager.List()
+			if user != nil && !user.IsAdmin() {
+				own := make([]*operations.Operation, 0, len(list))
+				for _, op := range list {
+					if op.CreatedBy == user.Username {
+						own = append(own, op)
+					}
+				}
+				list = own
+			}
+			respondJSON(w, 200, "获取成功", list)
+			return
+		}
+
+		op, err := operations.GlobalManager.Get(id)
+		if err != nil || (user != nil && !user.IsAdmin() && op.CreatedBy != user.Username) {
+			respondJSON(w, 404, "操作不存在", nil)
+			return
+		}
+		respondJSON(w, 200, "获取成功", op)
+
+	case http.MethodDelete:
+		if id == "" {
+			respondJSON(w, 400, "操作ID不能为空", nil)
+			return
+		}
+		op, err := operations.GlobalManager.Get(id)
+		if err != nil || (user != nil && !user.IsAdmin() && op.CreatedBy != user.Username) {
+			respondJSON(w, 404, "操作不存在", nil)
+			return
+		}
+		if err := operations.GlobalManager.Cancel(id); err != nil {
+			respondJSON(w, 400, err.Error(), nil)
+			return
+		}
+		respondJSON(w, 200, "操作已取消", nil)
+
+	default:
+		respondJSON(w, 405, "Method not allowed", nil)
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/openlxd/backend/internal/acme"
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/network"
+)
+
+// HandleCertificates ACME 证书管理：普通用户只能查看自己反向代理域名的证书，申请和删除仅限管理员
+func HandleCertificates(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if r.Method != "GET" && user != nil && !user.IsAdmin() {
+		respondJSON(w, 403, "需要管理员权限", nil)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		query := models.DB.Order("not_after ASC")
+		if user != nil && !user.IsAdmin() {
+			query = query.Where("domain IN (SELECT proxy_configs.domain FROM proxy_configs JOIN containers ON containers.id = proxy_configs.container_id WHERE containers.user_id = ?)", user.ID)
+		}
+		var certs []models.Certificate
+		query.Find(&certs)
+		respondJSON(w, 200, "成功", certs)
+	case "POST":
+		handleObtainCertificate(w, r)
+	case "DELETE":
+		handleRemoveCertificate(w, r)
+	default:
+		respondJSON(w, 405, "不支持的请求方法", nil)
+	}
+}
+
+// handleObtainCertificate 申请或续期证书
+func handleObtainCertificate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Domain string `json:"domain"`
+		Async  bool   `json:"async"` // 后台申请，立即返回
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, 400, "请求参数错误", nil)
+		return
+	}
+
+	if !network.ValidateDomain(req.Domain) {
+		respondJSON(w, 400, "无效的域名", nil)
+		return
+	}
+
+	if req.Async {
+		acme.GlobalManager.ObtainAsync(req.Domain)
+		respondJSON(w, 200, "证书申请已提交", nil)
+		return
+	}
+
+	cert, err := acme.GlobalManager.Obtain(req.Domain)
+	if err != nil {
+		models.LogAction("acme_obtain", "", fmt.Sprintf("证书申请失败: %s: %v", req.Domain, err), "failed")
+		respondJSON(w, 500, fmt.Sprintf("证书申请失败: %v", err), nil)
+		return
+	}
+
+	models.LogAction("acme_obtain", "", fmt.Sprintf("证书申请成功: %s", req.Domain), "success")
+	respondJSON(w, 200, "证书申请成功", cert)
+}
+
+// handleRemoveCertificate 删除证书
+func handleRemoveCertificate(w http.ResponseWriter, r *http.Request) {
+	certID, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		respondJSON(w, 400, "无效的证书ID", nil)
+		return
+	}
+
+	if err := acme.GlobalManager.RemoveCertificate(uint(certID)); err != nil {
+		respondJSON(w, 500, fmt.Sprintf("删除证书失败: %v", err), nil)
+		return
+	}
+
+	models.LogAction("remove_certificate", "", fmt.Sprintf("删除证书: ID %d", certID), "success")
+	respondJSON(w, 200, "证书删除成功", nil)
+}
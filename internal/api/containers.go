@@ -2,34 +2,77 @@ package api
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
+	lxdapi "github.com/canonical/lxd/shared/api"
+	"github.com/openlxd/backend/internal/audit"
+	"github.com/openlxd/backend/internal/auth"
 	"github.com/openlxd/backend/internal/lxd"
+	"github.com/openlxd/backend/internal/metrics"
 	"github.com/openlxd/backend/internal/models"
-	lxdapi "github.com/canonical/lxd/shared/api"
+	"github.com/openlxd/backend/internal/quota"
+	"github.com/openlxd/backend/internal/scheduler"
+	"github.com/openlxd/backend/internal/webhook"
 )
 
-// HandleListContainers 获取容器列表
+// containerPageOptions 容器列表的排序和搜索字段
+var containerPageOptions = pageOptions{
+	Sorts: map[string]string{
+		"id":         "id",
+		"name":       "hostname",
+		"status":     "status",
+		"image":      "image",
+		"node":       "node",
+		"user":       "user_id",
+		"cpu":        "cpus",
+		"memory":     "memory",
+		"disk":       "disk",
+		"created_at": "created_at",
+	},
+	DefaultSort: "id",
+	Search:      []string{"hostname", "ipv4", "ipv6", "image", `user_id IN (SELECT id FROM users WHERE username LIKE ? ESCAPE '\')`},
+}
+
+// HandleListContainers 获取容器列表（支持分页、排序、搜索和标签过滤）
 func HandleListContainers(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		RespondContainerJSON(w, 405, "Method not allowed", nil)
 		return
 	}
 
+	// 按标签过滤（label=key=value，可重复）
+	selector, err := parseLabelSelector(r)
+	if err != nil {
+		RespondContainerJSON(w, 400, err.Error(), nil)
+		return
+	}
+	page, err := parsePage(r, containerPageOptions)
+	if err != nil {
+		RespondContainerJSON(w, 400, err.Error(), nil)
+		return
+	}
+
 	// 从数据库获取容器列表
+	query, total, err := page.Apply(models.WhereLabels(models.DB, selector), &models.Container{})
+	if err != nil {
+		RespondContainerJSON(w, 500, "获取容器列表失败: "+err.Error(), nil)
+		return
+	}
 	var containers []models.Container
-	if err := models.DB.Find(&containers).Error; err != nil {
+	if err := query.Find(&containers).Error; err != nil {
 		RespondContainerJSON(w, 500, "获取容器列表失败: "+err.Error(), nil)
 		return
 	}
+	models.LoadContainerLabels(containers)
+	page.SetHeaders(w, total, len(containers))
 
-	// 获取LXD客户端
-	client := lxd.GetClient()
-	if client == nil {
+	// 检查LXD连接
+	if lxd.GetClient() == nil {
 		// LXD未连接，返回数据库中的容器信息
-		RespondContainerJSON(w, 200, "获取成功", containers)
+		RespondContainerJSON(w, 200, "获取成功", page.Result(containers, total, len(containers)))
 		return
 	}
 
@@ -37,20 +80,22 @@ func HandleListContainers(w http.ResponseWriter, r *http.Request) {
 	var result []map[string]interface{}
 	for _, container := range containers {
 		// 获取容器状态
-		state, _, err := client.GetInstanceState(container.Hostname)
+		state, err := lxd.GetContainerState(container.Hostname)
 		if err != nil {
 			// 如果获取失败，使用数据库中的信息
 			result = append(result, map[string]interface{}{
-				"id":          container.ID,
-				"name":        container.Hostname,
-				"status":      container.Status,
-				"image":       container.Image,
-				"cpu":         container.CPUs,
-				"memory":      container.Memory,
-				"disk":        container.Disk,
-				"ipv4":        container.IPv4,
-				"ipv6":        container.IPv6,
-				"created_at":  container.CreatedAt,
+				"id":         container.ID,
+				"name":       container.Hostname,
+				"status":     container.Status,
+				"image":      container.Image,
+				"cpu":        container.CPUs,
+				"memory":     container.Memory,
+				"disk":       container.Disk,
+				"ipv4":       container.IPv4,
+				"ipv6":       container.IPv6,
+				"labels":     container.Labels,
+				"notes":      container.Notes,
+				"created_at": container.CreatedAt,
 			})
 			continue
 		}
@@ -60,22 +105,24 @@ func HandleListContainers(w http.ResponseWriter, r *http.Request) {
 
 		// 构建返回数据
 		result = append(result, map[string]interface{}{
-			"id":          container.ID,
-			"name":        container.Hostname,
-			"status":      strings.ToLower(state.Status),
-			"image":       container.Image,
-			"cpu":         container.CPUs,
-			"memory":      container.Memory,
-			"disk":        container.Disk,
-			"ipv4":        ipv4,
-			"ipv6":        ipv6,
-			"created_at":  container.CreatedAt,
-			"cpu_usage":   state.CPU.Usage,
+			"id":           container.ID,
+			"name":         container.Hostname,
+			"status":       strings.ToLower(state.Status),
+			"image":        container.Image,
+			"cpu":          container.CPUs,
+			"memory":       container.Memory,
+			"disk":         container.Disk,
+			"ipv4":         ipv4,
+			"ipv6":         ipv6,
+			"labels":       container.Labels,
+			"notes":        container.Notes,
+			"created_at":   container.CreatedAt,
+			"cpu_usage":    state.CPU.Usage,
 			"memory_usage": state.Memory.Usage,
 		})
 	}
 
-	RespondContainerJSON(w, 200, "获取成功", result)
+	RespondContainerJSON(w, 200, "获取成功", page.Result(result, total, len(containers)))
 }
 
 // HandleCreateContainer 创建容器
@@ -86,12 +133,17 @@ func HandleCreateContainer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Name     string `json:"name"`
-		Image    string `json:"image"`
-		CPU      int    `json:"cpu"`
-		Memory   int    `json:"memory"`
-		Disk     int    `json:"disk"`
-		Password string `json:"password"`
+		Name          string        `json:"name"`
+		Image         string        `json:"image"`
+		CPU           int           `json:"cpu"`
+		Memory        int           `json:"memory"`
+		Disk          int           `json:"disk"`
+		Password      string        `json:"password"`
+		UserID        uint          `json:"user_id"`        // 所属用户，仅管理员可指定
+		QuotaTemplate string        `json:"quota_template"` // 配额模板名称
+		Labels        models.Labels `json:"labels"`
+		Notes         string        `json:"notes"`
+		scheduler.Placement
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -105,6 +157,11 @@ func HandleCreateContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := models.ValidateLabels(req.Labels); err != nil {
+		RespondContainerJSON(w, 400, err.Error(), nil)
+		return
+	}
+
 	// 检查容器名称是否已存在
 	var existing models.Container
 	if err := models.DB.Where("hostname = ?", req.Name).First(&existing).Error; err == nil {
@@ -112,10 +169,63 @@ func HandleCreateContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 获取LXD客户端
-	client := lxd.GetClient()
-	if client == nil {
-		RespondContainerJSON(w, 500, "LXD client not available", nil)
+	// 确定所属用户：普通用户只能为自己创建
+	var ownerID uint
+	var createdBy string
+	user := auth.GetUserFromContext(r.Context())
+	if user != nil {
+		ownerID, createdBy = user.ID, user.Username
+	}
+	if req.UserID != 0 {
+		// 只有管理员和系统 API Hash 可以指定所属用户
+		switch {
+		case user != nil && user.IsAdmin():
+			ownerID = req.UserID
+		case user == nil && audit.ActorFromContext(r.Context()).Type == audit.ActorSystem:
+			ownerID, createdBy = req.UserID, "system"
+		case user == nil:
+			RespondContainerJSON(w, 403, "无权指定所属用户", nil)
+			return
+		}
+	}
+
+	// 配额模板只能由管理员和系统 API Hash 指定
+	if req.QuotaTemplate != "" && user != nil && !user.IsAdmin() {
+		RespondContainerJSON(w, 403, "只有管理员可以指定配额模板", nil)
+		return
+	}
+
+	// 检查并预占用户配额，容器写入数据库后释放（之后由数据库中的记录计入用量）
+	release, err := quota.GlobalQuotaManager.ReserveUserContainer(ownerID, req.CPU, req.Memory, req.Disk)
+	if err != nil {
+		RespondContainerJSON(w, 403, err.Error(), nil)
+		return
+	}
+	defer release()
+
+	// 选择节点（含容量策略检查）并预留节点资源，容器写入数据库后释放
+	node, releaseNode, err := scheduler.GlobalScheduler.ScheduleAndReserve(scheduler.Request{
+		Placement: req.Placement,
+		CPUs:      req.CPU,
+		Memory:    req.Memory,
+		Disk:      req.Disk,
+	})
+	if err != nil {
+		RespondContainerJSON(w, 409, err.Error(), nil)
+		return
+	}
+	defer releaseNode()
+
+	tpl, err := quota.GlobalQuotaManager.ResolveTemplate(req.QuotaTemplate)
+	if err != nil {
+		RespondContainerJSON(w, 400, err.Error(), nil)
+		return
+	}
+
+	// 获取目标节点的LXD客户端
+	client, err := lxd.NodeClient(node)
+	if err != nil {
+		RespondContainerJSON(w, 500, "LXD client not available: "+err.Error(), nil)
 		return
 	}
 
@@ -163,12 +273,15 @@ func HandleCreateContainer(w http.ResponseWriter, r *http.Request) {
 
 	// 保存到数据库
 	container := models.Container{
-		Hostname: req.Name,
-		Status:   "Stopped",
-		Image:    req.Image,
-		CPUs:     req.CPU,
-		Memory:   req.Memory,
-		Disk:     req.Disk,
+		Hostname:  req.Name,
+		Status:    "Stopped",
+		Image:     req.Image,
+		CPUs:      req.CPU,
+		Memory:    req.Memory,
+		Disk:      req.Disk,
+		UserID:    ownerID,
+		CreatedBy: createdBy,
+		Node:      node,
 	}
 
 	if err := models.DB.Create(&container).Error; err != nil {
@@ -176,6 +289,21 @@ func HandleCreateContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 保存标签和备注
+	if len(req.Labels) > 0 || req.Notes != "" {
+		if err := saveContainerLabels(&container, req.Labels, &req.Notes); err != nil {
+			log.Printf("警告: 保存容器 %s 的标签失败: %v", container.Hostname, err)
+		}
+	}
+
+	// 应用配额模板
+	if tpl != nil {
+		if err := quota.GlobalQuotaManager.ApplyTemplate(container.ID, tpl.ID); err != nil {
+			log.Printf("警告: 为容器 %s 应用配额模板 %s 失败: %v", container.Hostname, tpl.Name, err)
+		}
+	}
+
+	webhook.EmitContainer(webhook.EventContainerCreated, &container)
 	RespondContainerJSON(w, 200, "Container created successfully", container)
 }
 
@@ -201,15 +329,13 @@ func HandleContainerAction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 获取LXD客户端
-	client := lxd.GetClient()
-	if client == nil {
-		RespondContainerJSON(w, 500, "LXD client not available", nil)
+	// 获取容器所在节点的LXD客户端
+	client, err := lxd.ContainerClient(req.Name)
+	if err != nil {
+		RespondContainerJSON(w, 500, "LXD client not available: "+err.Error(), nil)
 		return
 	}
 
-	var err error
-
 	switch req.Action {
 	case "start":
 		reqState := lxdapi.InstanceStatePut{
@@ -249,7 +375,9 @@ func HandleContainerAction(w http.ResponseWriter, r *http.Request) {
 		delOp, err := client.DeleteInstance(req.Name)
 		if err == nil && delOp != nil {
 			if err := delOp.Wait(); err == nil {
+				emitContainerEvent(webhook.EventContainerDeleted, req.Name)
 				// 从数据库删除
+				models.DeleteContainerLabels(req.Name)
 				models.DB.Where("hostname = ?", req.Name).Delete(&models.Container{})
 			}
 		}
@@ -275,6 +403,9 @@ func HandleContainerAction(w http.ResponseWriter, r *http.Request) {
 			status = "Running"
 		}
 		models.DB.Model(&models.Container{}).Where("hostname = ?", req.Name).Update("status", status)
+		if event, ok := actionEvents[req.Action]; ok {
+			emitContainerEvent(event, req.Name)
+		}
 	}
 
 	RespondContainerJSON(w, 200, "Action completed successfully", nil)
@@ -299,6 +430,7 @@ func extractIPFromContainerState(state *lxdapi.InstanceState) (string, string) {
 func RespondContainerJSON(w http.ResponseWriter, code int, message string, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	metrics.ReportCode(w, code)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"code": code,
 		"msg":  message,
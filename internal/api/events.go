@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/events"
+	"github.com/openlxd/backend/internal/models"
+)
+
+// heartbeatInterval SSE 心跳间隔，防止代理因空闲断开连接
+const heartbeatInterval = 25 * time.Second
+
+// HandleEvents 以 Server-Sent Events 推送实时事件（GET）
+// 可选参数：types（逗号分隔：lifecycle, operation, migration, metrics）、container；
+// 断线重连时浏览器自动携带 Last-Event-ID，也可通过 last_event_id 参数指定，补发之后的事件
+// 普通用户只会收到自己容器的事件和自己发起的操作；连接使用的登录令牌或 API 密钥被撤销时关闭连接
+func HandleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	values := r.URL.Query()
+	types, err := events.ValidateTypes(values.Get("types"))
+	if err != nil {
+		respondJSON(w, 400, err.Error(), nil)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = values.Get("last_event_id")
+	}
+	var since uint64
+	if lastID != "" {
+		if since, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+			respondJSON(w, 400, "last_event_id 无效", nil)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondJSON(w, 500, "连接不支持流式响应", nil)
+		return
+	}
+	// 长连接不受服务器写超时限制
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sub := events.NewSubscriber(auth.GetUserFromContext(r.Context()), types, values.Get("container"))
+	if claims := auth.GetClaimsFromContext(r.Context()); claims != nil {
+		sub.JTI = claims.ID
+	}
+	if key := auth.GetAPIKeyFromContext(r.Context()); key != nil {
+		sub.APIKeyID = key.ID
+	}
+	backlog := events.GlobalBroker.Subscribe(sub, since)
+	defer events.GlobalBroker.Unsubscribe(sub)
+
+	// 认证之后、订阅之前撤销的凭据不会触发关闭通知，订阅后再检查一次
+	if !streamCredentialValid(r) {
+		return
+	}
+
+	fmt.Fprint(w, "retry: 5000\n\n")
+	for _, e := range backlog {
+		writeEvent(w, e)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.Closed():
+			return
+		case e := <-sub.C:
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			// 凭据过期、用户停用等没有关闭通知的情况在心跳时检查
+			if !streamCredentialValid(r) {
+				return
+			}
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// streamCredentialValid 长连接使用的凭据是否仍然有效：令牌未撤销未过期，API 密钥未删除未过期，用户未停用
+func streamCredentialValid(r *http.Request) bool {
+	ctx := r.Context()
+	now := time.Now()
+	if claims := auth.GetClaimsFromContext(ctx); claims != nil {
+		if auth.IsTokenRevoked(claims.ID) || (claims.ExpiresAt != nil && now.After(claims.ExpiresAt.Time)) {
+			return false
+		}
+	}
+	if key := auth.GetAPIKeyFromContext(ctx); key != nil {
+		var current models.APIKey
+		if err := models.DB.First(&current, key.ID).Error; err != nil || current.Expired(now) {
+			return false
+		}
+	}
+	if user := auth.GetUserFromContext(ctx); user != nil {
+		var current models.User
+		if err := models.DB.Select("id", "status").First(&current, user.ID).Error; err != nil || !current.IsActive() {
+			return false
+		}
+	}
+	return true
+}
+
+// writeEvent 按 SSE 格式写出一个事件，event 字段为事件类型
+func writeEvent(w http.ResponseWriter, e *events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/lxd"
+	"github.com/openlxd/backend/internal/models"
+)
+
+// parseLabelSelector 解析查询参数中的标签过滤条件
+// 格式：label=key=value 要求标签值相等，label=key 只要求存在该标签，可重复指定
+func parseLabelSelector(r *http.Request) (models.Labels, error) {
+	values := r.URL.Query()["label"]
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	selector := make(models.Labels, len(values))
+	for _, value := range values {
+		name, v, _ := strings.Cut(value, "=")
+		selector[name] = v
+	}
+	names := make(models.Labels, len(selector))
+	for name := range selector {
+		names[name] = ""
+	}
+	if err := models.ValidateLabels(names); err != nil {
+		return nil, err
+	}
+	return selector, nil
+}
+
+// saveContainerLabels 保存容器标签和备注，labels 或 notes 为 nil 时保持不变
+// 开启 lxd.mirror_labels 时同步写入 LXD 配置，同步失败只记录日志
+func saveContainerLabels(container *models.Container, labels models.Labels, notes *string) error {
+	if labels != nil {
+		if err := models.SetContainerLabels(container.ID, labels); err != nil {
+			return err
+		}
+	}
+	if notes != nil {
+		if err := models.DB.Model(container).Update("notes", *notes).Error; err != nil {
+			return fmt.Errorf("保存备注失败: %v", err)
+		}
+		container.Notes = *notes
+	}
+	container.Labels = models.GetContainerLabels(container.ID)
+
+	if config.GetConfig().LXD.MirrorLabels {
+		if err := lxd.SyncLabels(container.Hostname, container.Labels, container.Notes); err != nil {
+			log.Printf("警告: 容器 %s 的标签同步到 LXD 失败: %v", container.Hostname, err)
+		}
+	}
+	return nil
+}
+
+// HandleContainerLabels 查询（GET ?name=）或更新（POST）容器标签和备注
+// 更新时 labels 替换全部标签，未提供的字段保持不变
+func HandleContainerLabels(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name   string        `json:"name"`
+		Labels models.Labels `json:"labels"`
+		Notes  *string       `json:"notes"`
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		req.Name = r.URL.Query().Get("name")
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondContainerJSON(w, 400, "请求参数错误", nil)
+			return
+		}
+	default:
+		RespondContainerJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	if req.Name == "" {
+		RespondContainerJSON(w, 400, "容器名称不能为空", nil)
+		return
+	}
+
+	query := models.DB.Where("hostname = ?", req.Name)
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		query = query.Where("user_id = ?", user.ID)
+	}
+	var container models.Container
+	if err := query.First(&container).Error; err != nil {
+		RespondContainerJSON(w, 404, "容器不存在", nil)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		container.Labels = models.GetContainerLabels(container.ID)
+		RespondContainerJSON(w, 200, "获取成功", map[string]interface{}{
+			"name":   container.Hostname,
+			"labels": container.Labels,
+			"notes":  container.Notes,
+		})
+		return
+	}
+
+	if req.Labels == nil && req.Notes == nil {
+		RespondContainerJSON(w, 400, "没有需要更新的字段", nil)
+		return
+	}
+	if err := saveContainerLabels(&container, req.Labels, req.Notes); err != nil {
+		RespondContainerJSON(w, 400, err.Error(), nil)
+		return
+	}
+
+	models.LogAction("update_labels", container.Hostname, "更新容器标签", "success")
+	RespondContainerJSON(w, 200, "更新成功", map[string]interface{}{
+		"name":   container.Hostname,
+		"labels": container.Labels,
+		"notes":  container.Notes,
+	})
+}
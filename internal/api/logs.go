@@ -2,73 +2,97 @@ package api
 
 import (
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/openlxd/backend/internal/models"
 )
 
-// GetContainerLogs 获取容器操作日志
+// logPageOptions 操作日志的排序和搜索字段
+var logPageOptions = pageOptions{
+	Sorts: map[string]string{
+		"id":         "id",
+		"action":     "action",
+		"status":     "status",
+		"created_at": "created_at",
+	},
+	DefaultSort:  "-created_at",
+	DefaultLimit: 100,
+	Search:       []string{"action", "container", "description"},
+}
+
+// GetContainerLogs 获取容器操作日志（支持分页、排序和搜索）
 func GetContainerLogs(w http.ResponseWriter, r *http.Request) {
 	containerName := r.URL.Query().Get("container")
-	limitStr := r.URL.Query().Get("limit")
-	
-	limit := 100
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
+
+	page, err := parsePage(r, logPageOptions)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, "error", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
 	}
-	
-	var logs []models.OperationLog
-	query := models.DB.Order("created_at DESC").Limit(limit)
-	
+
+	query := models.DB
 	if containerName != "" {
-		query = query.Where("container_name = ?", containerName)
+		query = query.Where("container = ?", containerName)
 	}
-	
-	if err := query.Find(&logs).Error; err != nil {
+
+	var logs []models.OperationLog
+	query, total, err := page.Apply(query, &models.OperationLog{})
+	if err == nil {
+		err = query.Find(&logs).Error
+	}
+	if err != nil {
 		respondJSON(w, http.StatusInternalServerError, "error", map[string]interface{}{
 			"error": "获取日志失败: " + err.Error(),
 		})
 		return
 	}
-	
+	page.SetHeaders(w, total, len(logs))
+
 	respondJSON(w, http.StatusOK, "success", map[string]interface{}{
-		"logs": logs,
+		"logs":        logs,
+		"total":       total,
+		"next_cursor": page.NextCursor(total, len(logs)),
 	})
 }
 
-// GetSystemLogs 获取系统日志
+// GetSystemLogs 获取系统日志（支持分页、排序和搜索）
 func GetSystemLogs(w http.ResponseWriter, r *http.Request) {
-	limitStr := r.URL.Query().Get("limit")
 	levelStr := r.URL.Query().Get("level")
-	
-	limit := 100
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
+
+	page, err := parsePage(r, logPageOptions)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, "error", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
 	}
-	
+
 	// 这里可以从数据库或日志文件中读取系统日志
 	// 暂时返回操作日志作为系统日志
-	var logs []models.OperationLog
-	query := models.DB.Order("created_at DESC").Limit(limit)
-	
+	query := models.DB
 	if levelStr != "" {
 		query = query.Where("status = ?", levelStr)
 	}
-	
-	if err := query.Find(&logs).Error; err != nil {
+
+	var logs []models.OperationLog
+	query, total, err := page.Apply(query, &models.OperationLog{})
+	if err == nil {
+		err = query.Find(&logs).Error
+	}
+	if err != nil {
 		respondJSON(w, http.StatusInternalServerError, "error", map[string]interface{}{
 			"error": "获取系统日志失败: " + err.Error(),
 		})
 		return
 	}
-	
+	page.SetHeaders(w, total, len(logs))
+
 	respondJSON(w, http.StatusOK, "success", map[string]interface{}{
-		"logs": logs,
+		"logs":        logs,
+		"total":       total,
+		"next_cursor": page.NextCursor(total, len(logs)),
 	})
 }
 
@@ -81,7 +105,7 @@ func GetContainerDetail(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	
+
 	// 从数据库获取容器信息
 	var container models.Container
 	if err := models.DB.Where("name = ?", name).First(&container).Error; err != nil {
@@ -90,25 +114,25 @@ func GetContainerDetail(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	
+
 	// 获取容器的配额信息
 	var quota models.Quota
 	models.DB.Where("container_name = ?", name).First(&quota)
-	
+
 	// 获取容器的网络信息
 	var ipAddresses []models.IPAddress
 	models.DB.Where("container_name = ?", name).Find(&ipAddresses)
-	
+
 	var portMappings []models.PortMapping
 	models.DB.Where("container_name = ?", name).Find(&portMappings)
-	
+
 	var proxyConfigs []models.ProxyConfig
 	models.DB.Where("container_name = ?", name).Find(&proxyConfigs)
-	
+
 	// 获取容器的最近操作日志
 	var logs []models.OperationLog
-	models.DB.Where("container_name = ?", name).Order("created_at DESC").Limit(10).Find(&logs)
-	
+	models.DB.Where("container = ?", name).Order("created_at DESC").Limit(10).Find(&logs)
+
 	respondJSON(w, http.StatusOK, "success", map[string]interface{}{
 		"container":     container,
 		"quota":         quota,
@@ -128,7 +152,7 @@ func GetContainerStats(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	
+
 	// 获取最近1小时的容器监控数据
 	oneHourAgo := time.Now().Add(-1 * time.Hour)
 	var metrics []models.ContainerMetric
@@ -139,9 +163,8 @@ func GetContainerStats(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	
+
 	respondJSON(w, http.StatusOK, "success", map[string]interface{}{
 		"metrics": metrics,
 	})
 }
-
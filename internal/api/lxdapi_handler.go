@@ -5,9 +5,10 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/openlxd/backend/internal/audit"
 	"github.com/openlxd/backend/internal/auth"
 	"github.com/openlxd/backend/internal/lxd"
-	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/ratelimit"
 	"gorm.io/gorm"
 )
 
@@ -27,41 +28,66 @@ func NewLXDAPIRouter(db *gorm.DB, lxdClient *lxd.ClientWrapper) *LXDAPIRouter {
 
 // ServeHTTP 实现http.Handler接口
 func (router *LXDAPIRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 认证失败次数过多的 IP 在认证前直接限流
+	if result := ratelimit.PeekIP(r); !result.Allowed {
+		ratelimit.SetHeaders(w, result)
+		RespondLXDAPIError(w, ratelimit.Message(result), http.StatusTooManyRequests)
+		return
+	}
+
 	// API Key认证（支持X-API-Key和X-API-Hash）
 	apiKey := r.Header.Get("X-API-Key")
 	if apiKey == "" {
 		apiKey = r.Header.Get("X-API-Hash")
 	}
-	
+
 	if apiKey == "" {
 		RespondLXDAPIError(w, "Missing API key", http.StatusUnauthorized)
 		return
 	}
-	
-	// 验证API Key
-	var user models.User
-	if err := router.db.Where("api_key = ?", apiKey).First(&user).Error; err != nil {
-		RespondLXDAPIError(w, "Invalid API key", http.StatusUnauthorized)
+
+	// 验证API Key（哈希匹配、有效期、IP 允许列表）
+	key, user, err := auth.AuthenticateAPIKey(apiKey, audit.ClientIP(r))
+	if err != nil {
+		ratelimit.AuthFailed(r)
+		status := http.StatusUnauthorized
+		if err == auth.ErrIPNotAllowed || err == auth.ErrUserInactive {
+			status = http.StatusForbidden
+		}
+		RespondLXDAPIError(w, err.Error(), status)
+		return
+	}
+
+	// 检查权限范围
+	if required := auth.RequiredScope(r.Method, r.URL.Path); !auth.HasScope(auth.SplitScopes(key.Scopes), required) {
+		RespondLXDAPIError(w, auth.ErrScopeForbidden.Error()+"，需要 "+required, http.StatusForbidden)
 		return
 	}
-	
-	// 检查用户状态
-	if !user.IsActive() {
-		RespondLXDAPIError(w, "User account is not active", http.StatusForbidden)
+
+	// 请求限流（按 API Key）
+	result := ratelimit.Request(r, ratelimit.Classify(r), "apikey:"+key.Prefix, user.Username+"/"+key.Prefix)
+	ratelimit.SetHeaders(w, result)
+	if !result.Allowed {
+		RespondLXDAPIError(w, ratelimit.Message(result), http.StatusTooManyRequests)
 		return
 	}
-	
+
 	// 将用户信息存入上下文
-	ctx := context.WithValue(r.Context(), auth.UserContextKey, &user)
+	ctx := auth.WithAPIKey(context.WithValue(r.Context(), auth.UserContextKey, user), key)
 	r = r.WithContext(ctx)
-	
-	// 路由分发
+	r = audit.WithActor(r, audit.Actor{Type: audit.ActorAPIKey, Name: user.Username + "/" + key.Prefix, UserID: user.ID})
+
+	audit.Record(router.route)(w, r)
+}
+
+// route 路由分发
+func (router *LXDAPIRouter) route(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
 	method := r.Method
-	
+
 	// 移除前缀 /api/system
 	path = strings.TrimPrefix(path, "/api/system")
-	
+
 	switch {
 	case path == "/containers" && method == "GET":
 		router.handler.ListContainers(w, r)
@@ -96,15 +122,15 @@ func (router *LXDAPIRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func extractContainerName(path string) string {
 	// 移除 /containers/ 前缀
 	path = strings.TrimPrefix(path, "/containers/")
-	
+
 	// 移除操作后缀
-	suffixes := []string{"/start", "/stop", "/restart", "/suspend", "/unsuspend", 
+	suffixes := []string{"/start", "/stop", "/restart", "/suspend", "/unsuspend",
 		"/reinstall", "/password", "/traffic/reset"}
 	for _, suffix := range suffixes {
 		if strings.HasSuffix(path, suffix) {
 			return strings.TrimSuffix(path, suffix)
 		}
 	}
-	
+
 	return path
 }
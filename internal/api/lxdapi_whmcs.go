@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -10,6 +11,9 @@ import (
 	"github.com/openlxd/backend/internal/auth"
 	"github.com/openlxd/backend/internal/lxd"
 	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/quota"
+	"github.com/openlxd/backend/internal/scheduler"
+	"github.com/openlxd/backend/internal/webhook"
 	"gorm.io/gorm"
 )
 
@@ -29,28 +33,32 @@ func NewLXDAPIHandler(db *gorm.DB, lxdClient *lxd.ClientWrapper) *LXDAPIHandler
 
 // LXDAPICreateContainerRequest lxdapi创建容器请求
 type LXDAPICreateContainerRequest struct {
-	Name                string `json:"name"`
-	Image               string `json:"image"`
-	Username            string `json:"username"`
-	Password            string `json:"password"`
-	CPU                 int    `json:"cpu"`
-	Memory              int    `json:"memory"` // MB
-	Disk                int    `json:"disk"`   // MB
-	Ingress             int    `json:"ingress"`
-	Egress              int    `json:"egress"`
-	TrafficLimit        int    `json:"traffic_limit"`
-	IPv4PoolLimit       int    `json:"ipv4_pool_limit"`
-	IPv4MappingLimit    int    `json:"ipv4_mapping_limit"`
-	IPv6PoolLimit       int    `json:"ipv6_pool_limit"`
-	IPv6MappingLimit    int    `json:"ipv6_mapping_limit"`
-	ReverseProxyLimit   int    `json:"reverse_proxy_limit"`
-	CPUAllowance        int    `json:"cpu_allowance"`
-	IORead              int    `json:"io_read"`
-	IOWrite             int    `json:"io_write"`
-	ProcessesLimit      int    `json:"processes_limit"`
-	AllowNesting        bool   `json:"allow_nesting"`
-	MemorySwap          bool   `json:"memory_swap"`
-	Privileged          bool   `json:"privileged"`
+	Name              string        `json:"name"`
+	Image             string        `json:"image"`
+	Username          string        `json:"username"`
+	Password          string        `json:"password"`
+	CPU               int           `json:"cpu"`
+	Memory            int           `json:"memory"` // MB
+	Disk              int           `json:"disk"`   // MB
+	Ingress           int           `json:"ingress"`
+	Egress            int           `json:"egress"`
+	TrafficLimit      int           `json:"traffic_limit"`
+	IPv4PoolLimit     int           `json:"ipv4_pool_limit"`
+	IPv4MappingLimit  int           `json:"ipv4_mapping_limit"`
+	IPv6PoolLimit     int           `json:"ipv6_pool_limit"`
+	IPv6MappingLimit  int           `json:"ipv6_mapping_limit"`
+	ReverseProxyLimit int           `json:"reverse_proxy_limit"`
+	CPUAllowance      int           `json:"cpu_allowance"`
+	IORead            int           `json:"io_read"`
+	IOWrite           int           `json:"io_write"`
+	ProcessesLimit    int           `json:"processes_limit"`
+	AllowNesting      bool          `json:"allow_nesting"`
+	MemorySwap        bool          `json:"memory_swap"`
+	Privileged        bool          `json:"privileged"`
+	QuotaTemplate     string        `json:"quota_template"` // 配额模板名称
+	Labels            models.Labels `json:"labels"`
+	Notes             string        `json:"notes"`
+	scheduler.Placement
 }
 
 // CreateContainer 创建容器（lxdapi兼容）
@@ -72,6 +80,10 @@ func (h *LXDAPIHandler) CreateContainer(w http.ResponseWriter, r *http.Request)
 		RespondLXDAPIError(w, "容器名称和镜像不能为空", http.StatusBadRequest)
 		return
 	}
+	if err := models.ValidateLabels(req.Labels); err != nil {
+		RespondLXDAPIError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// 检查容器是否已存在
 	var existingContainer models.Container
@@ -80,19 +92,53 @@ func (h *LXDAPIHandler) CreateContainer(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// 配额模板只能由管理员指定
+	if req.QuotaTemplate != "" && !user.IsAdmin() {
+		RespondLXDAPIError(w, "只有管理员可以指定配额模板", http.StatusForbidden)
+		return
+	}
+
+	// 检查用户配额
+	release, err := quota.GlobalQuotaManager.ReserveUserContainer(user.ID, req.CPU, req.Memory, req.Disk/1024)
+	if err != nil {
+		RespondLXDAPIError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	defer release()
+
+	// 选择节点（含容量策略检查）并预留节点资源，容器写入数据库后释放
+	node, releaseNode, err := scheduler.GlobalScheduler.ScheduleAndReserve(scheduler.Request{
+		Placement: req.Placement,
+		CPUs:      req.CPU,
+		Memory:    req.Memory,
+		Disk:      req.Disk / 1024,
+	})
+	if err != nil {
+		RespondLXDAPIError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	defer releaseNode()
+
+	tpl, err := quota.GlobalQuotaManager.ResolveTemplate(req.QuotaTemplate)
+	if err != nil {
+		RespondLXDAPIError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// 创建LXD容器
 	createReq := lxd.CreateContainerRequest{
-		Hostname: req.Name,
-		Image:    req.Image,
-		CPUs:     req.CPU,
-		Memory:   req.Memory,
-		Disk:     req.Disk / 1024, // 转换为GB
-		Password: req.Password,
-		Ingress:  req.Ingress,
-		Egress:   req.Egress,
+		Node:         node,
+		Hostname:     req.Name,
+		Image:        req.Image,
+		CPUs:         req.CPU,
+		Memory:       req.Memory,
+		Disk:         req.Disk / 1024, // 转换为GB
+		Password:     req.Password,
+		Ingress:      req.Ingress,
+		Egress:       req.Egress,
 		CPUAllowance: req.CPUAllowance,
 	}
-	err := lxd.CreateContainer(createReq)
+	err = lxd.CreateContainer(createReq)
 	if err != nil {
 		RespondLXDAPIError(w, fmt.Sprintf("创建容器失败: %v", err), http.StatusInternalServerError)
 		return
@@ -138,6 +184,7 @@ func (h *LXDAPIHandler) CreateContainer(w http.ResponseWriter, r *http.Request)
 		Egress:    req.Egress,
 		UserID:    user.ID,
 		CreatedBy: user.Username,
+		Node:      node,
 		CreatedAt: time.Now(),
 	}
 
@@ -146,6 +193,21 @@ func (h *LXDAPIHandler) CreateContainer(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// 保存标签和备注
+	if len(req.Labels) > 0 || req.Notes != "" {
+		if err := saveContainerLabels(&container, req.Labels, &req.Notes); err != nil {
+			log.Printf("警告: 保存容器 %s 的标签失败: %v", container.Hostname, err)
+		}
+	}
+
+	// 应用配额模板
+	if tpl != nil {
+		if err := quota.GlobalQuotaManager.ApplyTemplate(container.ID, tpl.ID); err != nil {
+			log.Printf("警告: 为容器 %s 应用配额模板 %s 失败: %v", container.Hostname, tpl.Name, err)
+		}
+	}
+	webhook.EmitContainer(webhook.EventContainerCreated, &container)
+
 	// 返回响应
 	RespondLXDAPISuccess(w, map[string]interface{}{
 		"name":     req.Name,
@@ -182,6 +244,7 @@ func (h *LXDAPIHandler) StartContainer(w http.ResponseWriter, r *http.Request) {
 
 	// 更新数据库状态
 	h.db.Model(&container).Update("status", "running")
+	webhook.EmitContainer(webhook.EventContainerStarted, &container)
 
 	RespondLXDAPISuccess(w, nil, "启动容器成功")
 }
@@ -213,6 +276,7 @@ func (h *LXDAPIHandler) StopContainer(w http.ResponseWriter, r *http.Request) {
 
 	// 更新数据库状态
 	h.db.Model(&container).Update("status", "stopped")
+	webhook.EmitContainer(webhook.EventContainerStopped, &container)
 
 	RespondLXDAPISuccess(w, nil, "停止容器成功")
 }
@@ -274,12 +338,14 @@ func (h *LXDAPIHandler) DeleteContainer(w http.ResponseWriter, r *http.Request)
 	}
 
 	// 从数据库删除
+	webhook.EmitContainer(webhook.EventContainerDeleted, &container)
+	models.DeleteContainerLabels(container.Hostname)
 	h.db.Delete(&container)
 
 	RespondLXDAPISuccess(w, nil, "删除容器成功")
 }
 
-// ListContainers 获取容器列表
+// ListContainers 获取容器列表（支持分页、排序、搜索和标签过滤）
 func (h *LXDAPIHandler) ListContainers(w http.ResponseWriter, r *http.Request) {
 	user := auth.GetUserFromContext(r.Context())
 	if user == nil {
@@ -287,24 +353,43 @@ func (h *LXDAPIHandler) ListContainers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 按标签过滤（label=key=value，可重复）
+	selector, err := parseLabelSelector(r)
+	if err != nil {
+		RespondLXDAPIError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := parsePage(r, containerPageOptions)
+	if err != nil {
+		RespondLXDAPIError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// 获取用户的所有容器
+	query, total, err := page.Apply(models.WhereLabels(h.db.Where("user_id = ?", user.ID), selector), &models.Container{})
+	if err != nil {
+		RespondLXDAPIError(w, fmt.Sprintf("获取容器列表失败: %v", err), http.StatusInternalServerError)
+		return
+	}
 	var containers []models.Container
-	if err := h.db.Where("user_id = ?", user.ID).Find(&containers).Error; err != nil {
+	if err := query.Find(&containers).Error; err != nil {
 		RespondLXDAPIError(w, fmt.Sprintf("获取容器列表失败: %v", err), http.StatusInternalServerError)
 		return
 	}
+	models.LoadContainerLabels(containers)
+	page.SetHeaders(w, total, len(containers))
 
-	// 获取LXD客户端
-	client := lxd.GetClient()
-	if client == nil {
+	// 检查LXD连接
+	if lxd.GetClient() == nil {
 		// LXD未连接，返回数据库中的数据
-		RespondLXDAPISuccess(w, containers, "获取成功")
+		RespondLXDAPISuccess(w, page.Result(containers, total, len(containers)), "获取成功")
 		return
 	}
 
 	// 更新容器状态
 	for i := range containers {
-		state, _, err := client.GetInstanceState(containers[i].Hostname)
+		state, err := lxd.GetContainerState(containers[i].Hostname)
 		if err == nil {
 			containers[i].Status = state.Status
 			if state.Network != nil {
@@ -319,7 +404,7 @@ func (h *LXDAPIHandler) ListContainers(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	RespondLXDAPISuccess(w, containers, "获取成功")
+	RespondLXDAPISuccess(w, page.Result(containers, total, len(containers)), "获取成功")
 }
 
 // GetContainerInfo 获取容器信息
@@ -390,6 +475,7 @@ func (h *LXDAPIHandler) SuspendContainer(w http.ResponseWriter, r *http.Request)
 
 	// 更新数据库状态
 	h.db.Model(&container).Update("status", "suspended")
+	webhook.EmitContainer(webhook.EventContainerSuspended, &container)
 
 	RespondLXDAPISuccess(w, nil, "暂停容器成功")
 }
@@ -421,6 +507,7 @@ func (h *LXDAPIHandler) UnsuspendContainer(w http.ResponseWriter, r *http.Reques
 
 	// 更新数据库状态
 	h.db.Model(&container).Update("status", "running")
+	webhook.EmitContainer(webhook.EventContainerStarted, &container)
 
 	RespondLXDAPISuccess(w, nil, "恢复容器成功")
 }
@@ -499,6 +586,7 @@ func (h *LXDAPIHandler) ReinstallContainer(w http.ResponseWriter, r *http.Reques
 		"image":  image,
 		"status": "running",
 	})
+	webhook.EmitContainer(webhook.EventContainerReinstalled, &container)
 
 	RespondLXDAPISuccess(w, nil, "重装容器成功")
 }
@@ -565,30 +653,28 @@ func (h *LXDAPIHandler) ResetTraffic(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 重置流量统计（这里简单实现，实际可能需要更复杂的逻辑）
-	h.db.Model(&container).Updates(map[string]interface{}{
-		"traffic_used":     0,
-		"traffic_reset_at": time.Now(),
-	})
+	// 重置流量统计（保留当前计费周期）
+	if err := quota.GlobalQuotaManager.ResetTraffic(container.ID); err != nil {
+		RespondLXDAPIError(w, fmt.Sprintf("重置流量失败: %v", err), http.StatusInternalServerError)
+		return
+	}
 
 	RespondLXDAPISuccess(w, nil, "流量重置成功")
 }
 
-
-
 // extractContainerNameFromPath 从URL路径中提取容器名称
 func extractContainerNameFromPath(path string) string {
 	// 移除 /api/system/containers/ 前缀
 	path = strings.TrimPrefix(path, "/api/system/containers/")
-	
+
 	// 移除操作后缀
-	suffixes := []string{"/start", "/stop", "/restart", "/suspend", "/unsuspend", 
+	suffixes := []string{"/start", "/stop", "/restart", "/suspend", "/unsuspend",
 		"/reinstall", "/password", "/traffic/reset"}
 	for _, suffix := range suffixes {
 		if strings.HasSuffix(path, suffix) {
 			return strings.TrimSuffix(path, suffix)
 		}
 	}
-	
+
 	return path
 }
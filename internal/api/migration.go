@@ -2,20 +2,23 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
+	"github.com/openlxd/backend/internal/lxd"
 	"github.com/openlxd/backend/internal/migration"
 	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/scheduler"
 )
 
 // HandleCreateMigrationTask 创建迁移任务
 func HandleCreateMigrationTask(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		ContainerName  string `json:"container_name"`
-		SourceHost     string `json:"source_host"`
-		TargetHost     string `json:"target_host"`
-		MigrationType  string `json:"migration_type"` // live, cold
+		ContainerName string `json:"container_name"`
+		SourceHost    string `json:"source_host"`
+		TargetHost    string `json:"target_host"`
+		MigrationType string `json:"migration_type"` // live, cold
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -30,7 +33,7 @@ func HandleCreateMigrationTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if req.SourceHost == "" {
-		req.SourceHost = "local"
+		req.SourceHost = lxd.ContainerNode(req.ContainerName)
 	}
 
 	if req.MigrationType == "" {
@@ -149,20 +152,30 @@ func HandleRollbackMigration(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, 200, "迁移已回滚", nil)
 }
 
-// HandleCreateRemoteHost 创建远程主机配置
+// HandleCreateRemoteHost 创建远程主机配置，启用状态的主机会立即作为节点连接
 func HandleCreateRemoteHost(w http.ResponseWriter, r *http.Request) {
-	var host models.RemoteHost
+	var req struct {
+		models.RemoteHost
+		Labels      map[string]string `json:"labels"`
+		Schedulable *bool             `json:"schedulable"`
+	}
 
-	if err := json.NewDecoder(r.Body).Decode(&host); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondJSON(w, 400, "请求参数错误", nil)
 		return
 	}
+	host := req.RemoteHost
+	host.Labels = scheduler.EncodeLabels(req.Labels)
 
 	// 验证参数
 	if host.Name == "" || host.Address == "" {
 		respondJSON(w, 400, "主机名称和地址不能为空", nil)
 		return
 	}
+	if host.Name == lxd.LocalNode {
+		respondJSON(w, 400, "节点名称 local 为本机保留", nil)
+		return
+	}
 
 	if host.Port == 0 {
 		host.Port = 8443
@@ -172,11 +185,29 @@ func HandleCreateRemoteHost(w http.ResponseWriter, r *http.Request) {
 		host.Protocol = "https"
 	}
 
+	// 固定节点服务器证书：未提供时获取节点当前证书，之后的连接只信任该证书
+	if host.ServerCertificate == "" && host.Protocol != scheduler.ProtocolUnix {
+		if err := scheduler.PinServerCertificate(&host); err != nil {
+			respondJSON(w, 400, err.Error()+"，请在 server_certificate 中提供节点证书", nil)
+			return
+		}
+	}
+
 	// 创建主机配置
 	if err := models.DB.Create(&host).Error; err != nil {
-		respondJSON(w, 500, "创建失败: " + err.Error(), nil)
+		respondJSON(w, 500, "创建失败: "+err.Error(), nil)
 		return
 	}
+	if req.Schedulable != nil && !*req.Schedulable {
+		models.DB.Model(&host).Update("schedulable", false)
+	}
+
+	if host.Status == "active" {
+		if err := scheduler.ConnectNode(&host); err != nil {
+			respondJSON(w, 200, "创建成功，但节点连接失败: "+err.Error(), host)
+			return
+		}
+	}
 
 	respondJSON(w, 200, "创建成功", host)
 }
@@ -203,10 +234,27 @@ func HandleDeleteRemoteHost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := models.DB.Delete(&models.RemoteHost{}, req.ID).Error; err != nil {
-		respondJSON(w, 500, "删除失败: " + err.Error(), nil)
+	var host models.RemoteHost
+	if err := models.DB.First(&host, req.ID).Error; err != nil {
+		respondJSON(w, 404, "主机不存在", nil)
+		return
+	}
+	if host.Name == lxd.LocalNode {
+		respondJSON(w, 400, "不能删除本机节点", nil)
+		return
+	}
+	var count int64
+	models.DB.Model(&models.Container{}).Where("node = ?", host.Name).Count(&count)
+	if count > 0 {
+		respondJSON(w, 409, fmt.Sprintf("节点上还有 %d 个容器，请先迁移", count), nil)
+		return
+	}
+
+	if err := models.DB.Delete(&host).Error; err != nil {
+		respondJSON(w, 500, "删除失败: "+err.Error(), nil)
 		return
 	}
+	scheduler.DisconnectNode(host.Name)
 
 	respondJSON(w, 200, "删除成功", nil)
 }
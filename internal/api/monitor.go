@@ -10,35 +10,24 @@ import (
 	"github.com/openlxd/backend/internal/monitor"
 )
 
+// metricPageOptions 监控数据的排序字段，默认按时间正序且不分页
+var metricPageOptions = pageOptions{
+	Sorts: map[string]string{
+		"id":        "id",
+		"timestamp": "timestamp",
+	},
+	DefaultSort: "timestamp",
+}
+
 // HandleSystemMetrics 处理系统监控指标请求
+// 查询参数 hours（默认 1）、resolution（raw、5m、1h，默认按范围自动选择）
 func HandleSystemMetrics(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		respondJSON(w, 405, "Method not allowed", nil)
 		return
 	}
 
-	// 获取查询参数
-	hoursStr := r.URL.Query().Get("hours")
-	hours := 1 // 默认1小时
-	if hoursStr != "" {
-		if h, err := strconv.Atoi(hoursStr); err == nil && h > 0 {
-			hours = h
-		}
-	}
-
-	// 查询最近N小时的数据
-	var metrics []models.SystemMetric
-	startTime := time.Now().Add(-time.Duration(hours) * time.Hour)
-	err := models.DB.Where("timestamp >= ?", startTime).
-		Order("timestamp ASC").
-		Find(&metrics).Error
-
-	if err != nil {
-		respondJSON(w, 500, fmt.Sprintf("查询失败: %v", err), nil)
-		return
-	}
-
-	respondJSON(w, 200, "获取成功", metrics)
+	respondMetricSeries(w, r, 0)
 }
 
 // HandleCurrentSystemMetrics 处理当前系统监控指标请求
@@ -59,16 +48,26 @@ func HandleCurrentSystemMetrics(w http.ResponseWriter, r *http.Request) {
 }
 
 // HandleContainerMetrics 处理容器监控指标请求
+// 查询参数 container_id（必填）、hours（默认 1）、resolution（raw、5m、1h，默认按范围自动选择）
 func HandleContainerMetrics(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		respondJSON(w, 405, "Method not allowed", nil)
 		return
 	}
 
-	// 获取查询参数
-	containerIDStr := r.URL.Query().Get("container_id")
+	containerID, err := strconv.ParseUint(r.URL.Query().Get("container_id"), 10, 32)
+	if err != nil || containerID == 0 {
+		respondJSON(w, 400, "请指定有效的 container_id", nil)
+		return
+	}
+
+	respondMetricSeries(w, r, uint(containerID))
+}
+
+// respondMetricSeries 查询宿主机（containerID 为 0）或容器最近 N 小时的监控数据
+// 每个数据点包含时间桶内各指标的 min/avg/max
+func respondMetricSeries(w http.ResponseWriter, r *http.Request, containerID uint) {
 	hoursStr := r.URL.Query().Get("hours")
-	
 	hours := 1 // 默认1小时
 	if hoursStr != "" {
 		if h, err := strconv.Atoi(hoursStr); err == nil && h > 0 {
@@ -76,25 +75,43 @@ func HandleContainerMetrics(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// 查询最近N小时的数据
-	var metrics []models.ContainerMetric
-	startTime := time.Now().Add(-time.Duration(hours) * time.Hour)
-	
-	query := models.DB.Where("timestamp >= ?", startTime)
-	if containerIDStr != "" {
-		containerID, err := strconv.ParseUint(containerIDStr, 10, 32)
-		if err == nil {
-			query = query.Where("container_id = ?", containerID)
-		}
+	resolution, err := monitor.ParseResolution(r.URL.Query().Get("resolution"))
+	if err != nil {
+		respondJSON(w, 400, err.Error(), nil)
+		return
 	}
-	
-	err := query.Order("timestamp ASC").Find(&metrics).Error
+	page, err := parsePage(r, metricPageOptions)
 	if err != nil {
-		respondJSON(w, 500, fmt.Sprintf("查询失败: %v", err), nil)
+		respondJSON(w, 400, err.Error(), nil)
 		return
 	}
 
-	respondJSON(w, 200, "获取成功", metrics)
+	endTime := time.Now()
+	startTime := endTime.Add(-time.Duration(hours) * time.Hour)
+	if resolution < 0 {
+		resolution = monitor.ChooseResolution(startTime, endTime)
+	}
+
+	points, err := monitor.GlobalStore.Query(containerID, startTime, endTime, resolution)
+	if err != nil {
+		respondJSON(w, 500, fmt.Sprintf("查询失败: %v", err), nil)
+		return
+	}
+	if page.Desc {
+		for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+			points[i], points[j] = points[j], points[i]
+		}
+	}
+	start, end := page.Window(len(points))
+	total := int64(len(points))
+	page.SetHeaders(w, total, end-start)
+
+	respondJSON(w, 200, "获取成功", map[string]interface{}{
+		"resolution":  monitor.ResolutionName(resolution),
+		"points":      points[start:end],
+		"total":       total,
+		"next_cursor": page.NextCursor(total, end-start),
+	})
 }
 
 // HandleNetworkTraffic 处理网络流量请求
@@ -107,7 +124,7 @@ func HandleNetworkTraffic(w http.ResponseWriter, r *http.Request) {
 	// 获取查询参数
 	containerIDStr := r.URL.Query().Get("container_id")
 	hoursStr := r.URL.Query().Get("hours")
-	
+
 	hours := 24 // 默认24小时
 	if hoursStr != "" {
 		if h, err := strconv.Atoi(hoursStr); err == nil && h > 0 {
@@ -115,10 +132,16 @@ func HandleNetworkTraffic(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	page, err := parsePage(r, metricPageOptions)
+	if err != nil {
+		respondJSON(w, 400, err.Error(), nil)
+		return
+	}
+
 	// 查询最近N小时的数据
 	var traffic []models.NetworkTraffic
 	startTime := time.Now().Add(-time.Duration(hours) * time.Hour)
-	
+
 	query := models.DB.Where("timestamp >= ?", startTime)
 	if containerIDStr != "" {
 		containerID, err := strconv.ParseUint(containerIDStr, 10, 32)
@@ -126,14 +149,18 @@ func HandleNetworkTraffic(w http.ResponseWriter, r *http.Request) {
 			query = query.Where("container_id = ?", containerID)
 		}
 	}
-	
-	err := query.Order("timestamp ASC").Find(&traffic).Error
+
+	query, total, err := page.Apply(query, &models.NetworkTraffic{})
+	if err == nil {
+		err = query.Find(&traffic).Error
+	}
 	if err != nil {
 		respondJSON(w, 500, fmt.Sprintf("查询失败: %v", err), nil)
 		return
 	}
+	page.SetHeaders(w, total, len(traffic))
 
-	respondJSON(w, 200, "获取成功", traffic)
+	respondJSON(w, 200, "获取成功", page.Result(traffic, total, len(traffic)))
 }
 
 // HandleResourceStats 处理资源统计请求
@@ -153,14 +180,14 @@ func HandleResourceStats(w http.ResponseWriter, r *http.Request) {
 
 	// 统计每个容器的资源使用情况
 	var stats []map[string]interface{}
-	
+
 	for _, container := range containers {
 		// 查询最近24小时的指标
 		var metrics []models.ContainerMetric
 		startTime := time.Now().Add(-24 * time.Hour)
 		err := models.DB.Where("container_id = ? AND timestamp >= ?", container.ID, startTime).
 			Find(&metrics).Error
-		
+
 		if err != nil || len(metrics) == 0 {
 			continue
 		}
@@ -174,7 +201,7 @@ func HandleResourceStats(w http.ResponseWriter, r *http.Request) {
 			cpuSum += m.CPUUsage
 			memSum += m.MemoryUsage
 			diskSum += m.DiskUsage
-			
+
 			if m.CPUUsage > cpuMax {
 				cpuMax = m.CPUUsage
 			}
@@ -184,13 +211,13 @@ func HandleResourceStats(w http.ResponseWriter, r *http.Request) {
 			if m.DiskUsage > diskMax {
 				diskMax = m.DiskUsage
 			}
-			
+
 			rxTotal = m.NetworkRxTotal
 			txTotal = m.NetworkTxTotal
 		}
 
 		count := float64(len(metrics))
-		
+
 		// 查询配额使用情况
 		var ipv4Count, ipv6Count, portMappingCount, proxyCount int64
 		models.DB.Model(&models.IPAddress{}).Where("container_id = ? AND type = ?", container.ID, "ipv4").Count(&ipv4Count)
@@ -199,22 +226,22 @@ func HandleResourceStats(w http.ResponseWriter, r *http.Request) {
 		models.DB.Model(&models.ProxyConfig{}).Where("container_id = ?", container.ID).Count(&proxyCount)
 
 		stat := map[string]interface{}{
-			"container_id":        container.ID,
-			"container_name":      container.Hostname,
-			"cpu_usage_avg":       cpuSum / count,
-			"cpu_usage_max":       cpuMax,
-			"memory_usage_avg":    memSum / count,
-			"memory_usage_max":    memMax,
-			"disk_usage_avg":      diskSum / count,
-			"disk_usage_max":      diskMax,
-			"network_rx_total":    rxTotal,
-			"network_tx_total":    txTotal,
-			"ipv4_count":          ipv4Count,
-			"ipv6_count":          ipv6Count,
-			"port_mapping_count":  portMappingCount,
-			"proxy_count":         proxyCount,
+			"container_id":       container.ID,
+			"container_name":     container.Hostname,
+			"cpu_usage_avg":      cpuSum / count,
+			"cpu_usage_max":      cpuMax,
+			"memory_usage_avg":   memSum / count,
+			"memory_usage_max":   memMax,
+			"disk_usage_avg":     diskSum / count,
+			"disk_usage_max":     diskMax,
+			"network_rx_total":   rxTotal,
+			"network_tx_total":   txTotal,
+			"ipv4_count":         ipv4Count,
+			"ipv6_count":         ipv6Count,
+			"port_mapping_count": portMappingCount,
+			"proxy_count":        proxyCount,
 		}
-		
+
 		stats = append(stats, stat)
 	}
 
@@ -249,12 +276,9 @@ func HandleMonitorDashboard(w http.ResponseWriter, r *http.Request) {
 	models.DB.Model(&models.ProxyConfig{}).Count(&totalProxies)
 
 	// 获取最近24小时的系统指标
-	var recentMetrics []models.SystemMetric
-	startTime := time.Now().Add(-24 * time.Hour)
-	models.DB.Where("timestamp >= ?", startTime).
-		Order("timestamp DESC").
-		Limit(288). // 每5分钟一个点，24小时=288个点
-		Find(&recentMetrics)
+	// 使用 5 分钟汇总，24小时=288个点
+	endTime := time.Now()
+	recentMetrics, _ := monitor.GlobalStore.Query(0, endTime.Add(-24*time.Hour), endTime, monitor.Resolution5m)
 
 	dashboard := map[string]interface{}{
 		"current_system": systemMetric,
@@ -264,14 +288,14 @@ func HandleMonitorDashboard(w http.ResponseWriter, r *http.Request) {
 			"stopped": totalContainers - runningContainers,
 		},
 		"network": map[string]interface{}{
-			"ipv4_total":       totalIPv4,
-			"ipv4_used":        usedIPv4,
-			"ipv4_available":   totalIPv4 - usedIPv4,
-			"ipv6_total":       totalIPv6,
-			"ipv6_used":        usedIPv6,
-			"ipv6_available":   totalIPv6 - usedIPv6,
-			"port_mappings":    totalPortMappings,
-			"proxies":          totalProxies,
+			"ipv4_total":     totalIPv4,
+			"ipv4_used":      usedIPv4,
+			"ipv4_available": totalIPv4 - usedIPv4,
+			"ipv6_total":     totalIPv6,
+			"ipv6_used":      usedIPv6,
+			"ipv6_available": totalIPv6 - usedIPv6,
+			"port_mappings":  totalPortMappings,
+			"proxies":        totalProxies,
 		},
 		"recent_metrics": recentMetrics,
 	}
@@ -3,9 +3,14 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/openlxd/backend/internal/acme"
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/metrics"
 	"github.com/openlxd/backend/internal/models"
 	"github.com/openlxd/backend/internal/network"
 )
@@ -111,7 +116,7 @@ func HandlePortMapping(w http.ResponseWriter, r *http.Request) {
 // handleGetPortMappings 获取端口映射列表
 func handleGetPortMappings(w http.ResponseWriter, r *http.Request) {
 	containerIDStr := r.URL.Query().Get("container_id")
-	
+
 	if containerIDStr != "" {
 		// 获取指定容器的端口映射
 		containerID, _ := strconv.ParseUint(containerIDStr, 10, 32)
@@ -132,14 +137,17 @@ func handleGetPortMappings(w http.ResponseWriter, r *http.Request) {
 // handleAddPortMapping 添加端口映射
 func handleAddPortMapping(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		ContainerID  uint   `json:"container_id"`
-		ContainerIP  string `json:"container_ip"`
-		Protocol     string `json:"protocol"`
-		ExternalPort int    `json:"external_port"`
-		InternalPort int    `json:"internal_port"`
-		Description  string `json:"description"`
-		Type         string `json:"type"` // single, range, random
-		Count        int    `json:"count"` // 用于端口段
+		ContainerID   uint   `json:"container_id"`
+		ContainerIP   string `json:"container_ip"`
+		PublicIP      string `json:"public_ip"` // 绑定的公网IP，空表示所有地址
+		Protocol      string `json:"protocol"`  // tcp, udp, tcp+udp
+		ExternalPort  int    `json:"external_port"`
+		InternalPort  int    `json:"internal_port"`
+		Description   string `json:"description"`
+		Type          string `json:"type"`           // single, range, random
+		Count         int    `json:"count"`          // 用于端口段
+		Mode          string `json:"mode"`           // iptables, proxy, proxy-nat
+		ProxyProtocol bool   `json:"proxy_protocol"` // 仅 proxy 模式
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -147,12 +155,45 @@ func handleAddPortMapping(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Protocol == "" {
+		req.Protocol = network.ProtocolTCP
+	}
+	if !network.ValidateProtocol(req.Protocol) {
+		respondJSON(w, 400, "协议必须为 tcp、udp 或 tcp+udp", nil)
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = network.ModeIPTables
+	}
+	if err := network.ValidateMode(req.Mode, req.ProxyProtocol); err != nil {
+		respondJSON(w, 400, err.Error(), nil)
+		return
+	}
+
+	// 普通用户只能映射到自己的容器，指定的外部端口必须在管理员定义的端口段内
+	user := auth.GetUserFromContext(r.Context())
+	if !ownsContainer(user, req.ContainerID) || !ownsContainerIP(user, req.ContainerIP) {
+		respondJSON(w, 403, "无权操作该容器", nil)
+		return
+	}
+	if user != nil && !user.IsAdmin() && (req.Type == "single" || req.Type == "range") {
+		end := req.ExternalPort
+		if req.Type == "range" {
+			end = req.ExternalPort + req.Count - 1
+		}
+		if err := network.GlobalNATManager.CheckAllowedPorts(req.PublicIP, req.Protocol, req.ExternalPort, end); err != nil {
+			respondJSON(w, 403, err.Error(), nil)
+			return
+		}
+	}
+
 	// 根据类型添加端口映射
 	switch req.Type {
 	case "single":
 		// 单端口映射
 		mapping, err := network.GlobalNATManager.AddPortMapping(
-			req.ContainerID, req.ContainerIP, req.Protocol,
+			req.ContainerID, req.ContainerIP, req.PublicIP, req.Protocol, req.Mode, req.ProxyProtocol,
 			req.ExternalPort, req.InternalPort, req.Description,
 		)
 		if err != nil {
@@ -169,7 +210,7 @@ func handleAddPortMapping(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		err := network.GlobalNATManager.AddPortRange(
-			req.ContainerID, req.ContainerIP, req.Protocol,
+			req.ContainerID, req.ContainerIP, req.PublicIP, req.Protocol, req.Mode, req.ProxyProtocol,
 			req.ExternalPort, req.InternalPort, req.Count, req.Description,
 		)
 		if err != nil {
@@ -182,7 +223,7 @@ func handleAddPortMapping(w http.ResponseWriter, r *http.Request) {
 	case "random":
 		// 随机端口映射
 		mapping, err := network.GlobalNATManager.AddRandomPort(
-			req.ContainerID, req.ContainerIP, req.Protocol,
+			req.ContainerID, req.ContainerIP, req.PublicIP, req.Protocol, req.Mode, req.ProxyProtocol,
 			req.InternalPort, req.Description,
 		)
 		if err != nil {
@@ -211,6 +252,16 @@ func handleRemovePortMapping(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var mapping models.PortMapping
+	if err := models.DB.First(&mapping, mappingID).Error; err != nil {
+		respondJSON(w, 404, "端口映射不存在", nil)
+		return
+	}
+	if !ownsContainer(auth.GetUserFromContext(r.Context()), mapping.ContainerID) {
+		respondJSON(w, 403, "无权操作该容器", nil)
+		return
+	}
+
 	err = network.GlobalNATManager.RemovePortMapping(uint(mappingID))
 	if err != nil {
 		respondJSON(w, 500, fmt.Sprintf("删除端口映射失败: %v", err), nil)
@@ -221,6 +272,168 @@ func handleRemovePortMapping(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, 200, "端口映射删除成功", nil)
 }
 
+// HandleReconcileProxyDevices 同步 LXD proxy 设备与端口映射表（仅管理员）
+func HandleReconcileProxyDevices(w http.ResponseWriter, r *http.Request) {
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		respondJSON(w, 403, "需要管理员权限", nil)
+		return
+	}
+	if r.Method != "POST" {
+		respondJSON(w, 405, "不支持的请求方法", nil)
+		return
+	}
+
+	result, err := network.GlobalNATManager.ReconcileProxyDevices()
+	if err != nil {
+		respondJSON(w, 500, fmt.Sprintf("同步 proxy 设备失败: %v", err), nil)
+		return
+	}
+
+	models.LogAction("reconcile_proxy_devices", "", fmt.Sprintf("同步 proxy 设备: 新增 %d, 删除 %d", result.Added, result.Removed), "success")
+	respondJSON(w, 200, "同步完成", result)
+}
+
+// HandlePortRanges 可分配端口段管理：GET 所有用户可查看，POST、DELETE 仅管理员
+func HandlePortRanges(w http.ResponseWriter, r *http.Request) {
+	if user := auth.GetUserFromContext(r.Context()); r.Method != "GET" && user != nil && !user.IsAdmin() {
+		respondJSON(w, 403, "需要管理员权限", nil)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		ranges, err := network.GlobalNATManager.GetAllowedRanges()
+		if err != nil {
+			respondJSON(w, 500, fmt.Sprintf("获取端口段失败: %v", err), nil)
+			return
+		}
+		respondJSON(w, 200, "成功", ranges)
+	case "POST":
+		handleAddAllowedRange(w, r)
+	case "DELETE":
+		handleRemoveAllowedRange(w, r)
+	default:
+		respondJSON(w, 405, "不支持的请求方法", nil)
+	}
+}
+
+// handleAddAllowedRange 添加可分配端口段
+func handleAddAllowedRange(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PublicIP    string `json:"public_ip"`
+		Protocol    string `json:"protocol"`
+		StartPort   int    `json:"start_port"`
+		EndPort     int    `json:"end_port"`
+		Description string `json:"description"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, 400, "请求参数错误", nil)
+		return
+	}
+
+	portRange, err := network.GlobalNATManager.AddAllowedRange(req.PublicIP, req.Protocol, req.StartPort, req.EndPort, req.Description)
+	if err != nil {
+		respondJSON(w, 400, fmt.Sprintf("添加端口段失败: %v", err), nil)
+		return
+	}
+
+	models.LogAction("add_allowed_port_range", "", fmt.Sprintf("添加可分配端口段: %s %d-%d/%s", req.PublicIP, req.StartPort, req.EndPort, portRange.Protocol), "success")
+	respondJSON(w, 200, "端口段添加成功", portRange)
+}
+
+// handleRemoveAllowedRange 删除可分配端口段
+func handleRemoveAllowedRange(w http.ResponseWriter, r *http.Request) {
+	rangeID, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		respondJSON(w, 400, "无效的端口段ID", nil)
+		return
+	}
+
+	if err := network.GlobalNATManager.RemoveAllowedRange(uint(rangeID)); err != nil {
+		respondJSON(w, 500, fmt.Sprintf("删除端口段失败: %v", err), nil)
+		return
+	}
+
+	models.LogAction("remove_allowed_port_range", "", fmt.Sprintf("删除可分配端口段: ID %d", rangeID), "success")
+	respondJSON(w, 200, "端口段删除成功", nil)
+}
+
+// HandleHostListeners 查看宿主机已监听的端口（仅管理员）
+func HandleHostListeners(w http.ResponseWriter, r *http.Request) {
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		respondJSON(w, 403, "需要管理员权限", nil)
+		return
+	}
+	if r.Method != "GET" {
+		respondJSON(w, 405, "不支持的请求方法", nil)
+		return
+	}
+
+	protocols := []string{network.ProtocolTCP, network.ProtocolUDP}
+	if p := r.URL.Query().Get("protocol"); p != "" {
+		protocols = []string{p}
+	}
+
+	var listeners []network.HostListener
+	for _, p := range protocols {
+		entries, err := network.GetHostListeners(p)
+		if err != nil {
+			respondJSON(w, 400, fmt.Sprintf("读取监听端口失败: %v", err), nil)
+			return
+		}
+		listeners = append(listeners, entries...)
+	}
+
+	respondJSON(w, 200, "成功", listeners)
+}
+
+// ownsContainer 调用方能否操作容器：管理员和系统 API Hash 不受限，普通用户只能操作自己的容器
+func ownsContainer(user *models.User, containerID uint) bool {
+	if user == nil || user.IsAdmin() {
+		return true
+	}
+	var container models.Container
+	return models.DB.First(&container, containerID).Error == nil && container.UserID == user.ID
+}
+
+// ownsContainerIP 调用方能否转发到该地址：普通用户只能转发到自己容器的地址
+func ownsContainerIP(user *models.User, ip string) bool {
+	if user == nil || user.IsAdmin() {
+		return true
+	}
+	if ip == "" {
+		return false
+	}
+	var count int64
+	models.DB.Model(&models.Container{}).Where(&models.Container{UserID: user.ID, IPv4: ip}).
+		Or(&models.Container{UserID: user.ID, IPv6: ip}).Count(&count)
+	return count > 0
+}
+
+// ownsProxy 调用方能否修改反向代理：普通用户只能修改自己容器的反向代理
+func ownsProxy(user *models.User, proxyID uint) bool {
+	if user == nil || user.IsAdmin() {
+		return true
+	}
+	var proxy models.ProxyConfig
+	return models.DB.First(&proxy, proxyID).Error == nil && ownsContainer(user, proxy.ContainerID)
+}
+
+// ownsUpstreams 反向代理的目标和所有后端是否都是调用方容器的地址（targetIP 为空时只检查后端）
+func ownsUpstreams(user *models.User, targetIP string, opts *network.ProxyOptions) bool {
+	ips := opts.UpstreamIPs()
+	if targetIP != "" {
+		ips = append(ips, targetIP)
+	}
+	for _, ip := range ips {
+		if !ownsContainerIP(user, ip) {
+			return false
+		}
+	}
+	return true
+}
+
 // HandleProxy 反向代理管理
 func HandleProxy(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -240,7 +453,7 @@ func HandleProxy(w http.ResponseWriter, r *http.Request) {
 // handleGetProxies 获取反向代理列表
 func handleGetProxies(w http.ResponseWriter, r *http.Request) {
 	containerIDStr := r.URL.Query().Get("container_id")
-	
+
 	if containerIDStr != "" {
 		// 获取指定容器的反向代理
 		containerID, _ := strconv.ParseUint(containerIDStr, 10, 32)
@@ -268,6 +481,8 @@ func handleAddProxy(w http.ResponseWriter, r *http.Request) {
 		SSL         bool   `json:"ssl"`
 		CertPath    string `json:"cert_path"`
 		KeyPath     string `json:"key_path"`
+		AutoCert    bool   `json:"auto_cert"` // 通过 ACME 自动申请证书
+		network.ProxyOptions
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -276,31 +491,55 @@ func handleAddProxy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 验证域名
+	req.Domain = strings.ToLower(strings.TrimSpace(req.Domain))
 	if !network.ValidateDomain(req.Domain) {
 		respondJSON(w, 400, "无效的域名", nil)
 		return
 	}
 
+	// 验证目标和高级选项
+	if net.ParseIP(req.TargetIP) == nil || req.TargetPort < 1 || req.TargetPort > 65535 {
+		respondJSON(w, 400, "无效的目标地址", nil)
+		return
+	}
+	if err := network.ValidateProxyOptions(&req.ProxyOptions); err != nil {
+		respondJSON(w, 400, err.Error(), nil)
+		return
+	}
+
+	// 普通用户只能为自己的容器添加反向代理，后端只能是自己容器的地址
+	user := auth.GetUserFromContext(r.Context())
+	if !ownsContainer(user, req.ContainerID) || !ownsUpstreams(user, req.TargetIP, &req.ProxyOptions) {
+		respondJSON(w, 403, "无权转发到该地址", nil)
+		return
+	}
+
 	// 添加反向代理
 	proxy, err := network.GlobalProxyManager.AddProxy(
 		req.ContainerID, req.Domain, req.TargetIP, req.TargetPort,
-		req.SSL, req.CertPath, req.KeyPath,
+		req.SSL, req.CertPath, req.KeyPath, req.AutoCert, req.ProxyOptions,
 	)
 	if err != nil {
 		respondJSON(w, 500, fmt.Sprintf("添加反向代理失败: %v", err), nil)
 		return
 	}
 
+	// 后台申请证书，签发后自动启用 SSL
+	if req.AutoCert {
+		acme.GlobalManager.ObtainAsync(req.Domain)
+	}
+
 	models.LogAction("add_proxy", "", fmt.Sprintf("添加反向代理: %s -> %s:%d", req.Domain, req.TargetIP, req.TargetPort), "success")
 	respondJSON(w, 200, "反向代理添加成功", proxy)
 }
 
-// handleUpdateProxy 更新反向代理
+// handleUpdateProxy 更新反向代理（SSL 证书或高级选项）
 func handleUpdateProxy(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		ProxyID  uint   `json:"proxy_id"`
-		CertPath string `json:"cert_path"`
-		KeyPath  string `json:"key_path"`
+		ProxyID  uint                  `json:"proxy_id"`
+		CertPath string                `json:"cert_path"`
+		KeyPath  string                `json:"key_path"`
+		Options  *network.ProxyOptions `json:"options"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -308,6 +547,36 @@ func handleUpdateProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := auth.GetUserFromContext(r.Context())
+	if !ownsProxy(user, req.ProxyID) {
+		respondJSON(w, 403, "无权操作该反向代理", nil)
+		return
+	}
+
+	if req.Options != nil {
+		if err := network.ValidateProxyOptions(req.Options); err != nil {
+			respondJSON(w, 400, err.Error(), nil)
+			return
+		}
+		if !ownsUpstreams(user, "", req.Options) {
+			respondJSON(w, 403, "无权转发到该地址", nil)
+			return
+		}
+		proxy, err := network.GlobalProxyManager.UpdateProxyOptions(req.ProxyID, *req.Options)
+		if err != nil {
+			respondJSON(w, 500, fmt.Sprintf("更新反向代理失败: %v", err), nil)
+			return
+		}
+		models.LogAction("update_proxy", "", fmt.Sprintf("更新反向代理选项: ID %d", req.ProxyID), "success")
+		respondJSON(w, 200, "反向代理更新成功", proxy)
+		return
+	}
+
+	if req.CertPath == "" || req.KeyPath == "" {
+		respondJSON(w, 400, "缺少证书路径或高级选项", nil)
+		return
+	}
+
 	err := network.GlobalProxyManager.UpdateProxySSL(req.ProxyID, req.CertPath, req.KeyPath)
 	if err != nil {
 		respondJSON(w, 500, fmt.Sprintf("更新反向代理失败: %v", err), nil)
@@ -332,6 +601,11 @@ func handleRemoveProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !ownsProxy(auth.GetUserFromContext(r.Context()), uint(proxyID)) {
+		respondJSON(w, 403, "无权操作该反向代理", nil)
+		return
+	}
+
 	err = network.GlobalProxyManager.RemoveProxy(uint(proxyID))
 	if err != nil {
 		respondJSON(w, 500, fmt.Sprintf("删除反向代理失败: %v", err), nil)
@@ -342,6 +616,16 @@ func handleRemoveProxy(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, 200, "反向代理删除成功", nil)
 }
 
+// HandleProxyStats 内置反向代理各域名访问统计
+func HandleProxyStats(w http.ResponseWriter, r *http.Request) {
+	if network.GlobalProxyManager.GetBackend() != network.BackendBuiltin {
+		respondJSON(w, 400, "访问统计仅支持内置反向代理", nil)
+		return
+	}
+
+	respondJSON(w, 200, "成功", network.GlobalBuiltinProxy.GetStats())
+}
+
 // HandleNetworkStats 网络统计信息
 func HandleNetworkStats(w http.ResponseWriter, r *http.Request) {
 	ipv4Available := network.GlobalIPPool.GetAvailableIPv4Count()
@@ -361,12 +645,13 @@ func HandleNetworkStats(w http.ResponseWriter, r *http.Request) {
 func respondJSON(w http.ResponseWriter, code int, message string, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	
+	metrics.ReportCode(w, code)
+
 	response := map[string]interface{}{
 		"code": code,
 		"msg":  message,
 		"data": data,
 	}
-	
+
 	json.NewEncoder(w).Encode(response)
 }
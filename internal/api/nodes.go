@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/lxd"
+	"github.com/openlxd/backend/internal/migration"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/scheduler"
+)
+
+// HandleNodes 获取节点列表（含连接状态和容量）（仅管理员）
+func HandleNodes(w http.ResponseWriter, r *http.Request) {
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		respondJSON(w, 403, "需要管理员权限", nil)
+		return
+	}
+	if r.Method != http.MethodGet {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	nodes, err := scheduler.ListNodes()
+	if err != nil {
+		respondJSON(w, 500, err.Error(), nil)
+		return
+	}
+
+	respondJSON(w, 200, "获取成功", nodes)
+}
+
+// HandleUpdateNode 更新节点标签、可调度状态和启用状态（仅管理员）
+func HandleUpdateNode(w http.ResponseWriter, r *http.Request) {
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		respondJSON(w, 403, "需要管理员权限", nil)
+		return
+	}
+	if r.Method != http.MethodPost {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	var req struct {
+		Name        string             `json:"name"`
+		Labels      *map[string]string `json:"labels"`
+		Schedulable *bool              `json:"schedulable"`
+		Status      string             `json:"status"` // active, inactive
+		// ServerCertificate 更换节点服务器证书（节点证书轮换后），"auto" 表示重新获取节点当前证书
+		ServerCertificate string `json:"server_certificate"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, 400, "请求参数错误", nil)
+		return
+	}
+
+	var host models.RemoteHost
+	if err := models.DB.Where("name = ?", req.Name).First(&host).Error; err != nil {
+		respondJSON(w, 404, "节点不存在", nil)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Labels != nil {
+		updates["labels"] = scheduler.EncodeLabels(*req.Labels)
+	}
+	if req.Schedulable != nil {
+		updates["schedulable"] = *req.Schedulable
+	}
+	if req.Status != "" {
+		if req.Status != "active" && req.Status != "inactive" {
+			respondJSON(w, 400, "状态只能是 active 或 inactive", nil)
+			return
+		}
+		if host.Name == lxd.LocalNode && req.Status != "active" {
+			respondJSON(w, 400, "不能停用本机节点", nil)
+			return
+		}
+		updates["status"] = req.Status
+	}
+	switch req.ServerCertificate {
+	case "":
+	case "auto":
+		if host.Name == lxd.LocalNode {
+			respondJSON(w, 400, "本机节点不使用服务器证书", nil)
+			return
+		}
+		certificate, err := lxd.FetchServerCertificate(scheduler.NodeURL(&host))
+		if err != nil {
+			respondJSON(w, 400, err.Error(), nil)
+			return
+		}
+		updates["server_certificate"] = certificate
+	default:
+		updates["server_certificate"] = req.ServerCertificate
+	}
+	if len(updates) == 0 {
+		respondJSON(w, 400, "没有需要更新的字段", nil)
+		return
+	}
+
+	if err := models.DB.Model(&host).Updates(updates).Error; err != nil {
+		respondJSON(w, 500, "更新失败: "+err.Error(), nil)
+		return
+	}
+
+	// 启用或更换证书时重新连接，停用时断开
+	if host.Status == "active" && (req.Status == "active" || req.ServerCertificate != "") {
+		scheduler.DisconnectNode(host.Name)
+		if err := scheduler.ConnectNode(&host); err != nil {
+			respondJSON(w, 200, "更新成功，但节点连接失败: "+err.Error(), host)
+			return
+		}
+	} else if host.Status == "inactive" {
+		scheduler.DisconnectNode(host.Name)
+	}
+
+	models.LogAction("update_node", "", "更新节点 "+host.Name, "success")
+	respondJSON(w, 200, "更新成功", host)
+}
+
+// HandleDrainNode 排空节点：停止调度并迁移节点上的所有容器（仅管理员）
+func HandleDrainNode(w http.ResponseWriter, r *http.Request) {
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		respondJSON(w, 403, "需要管理员权限", nil)
+		return
+	}
+	if r.Method != http.MethodPost {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	var req struct {
+		Name        string `json:"name"`
+		TargetNode  string `json:"target_node"` // 为空时自动调度
+		Concurrency int    `json:"concurrency"` // 同时迁移的容器数
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, 400, "请求参数错误", nil)
+		return
+	}
+	if req.Name == "" {
+		respondJSON(w, 400, "节点名称不能为空", nil)
+		return
+	}
+
+	job, err := migration.StartDrain(req.Name, req.TargetNode, req.Concurrency)
+	if err != nil {
+		respondJSON(w, 400, err.Error(), nil)
+		return
+	}
+
+	respondJSON(w, 200, "排空任务已创建", job)
+}
+
+// HandleUndrainNode 恢复节点调度（仅管理员）
+func HandleUndrainNode(w http.ResponseWriter, r *http.Request) {
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		respondJSON(w, 403, "需要管理员权限", nil)
+		return
+	}
+	if r.Method != http.MethodPost {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, 400, "请求参数错误", nil)
+		return
+	}
+
+	if err := migration.Undrain(req.Name); err != nil {
+		respondJSON(w, 400, err.Error(), nil)
+		return
+	}
+
+	respondJSON(w, 200, "节点已恢复调度", nil)
+}
+
+// HandleDrainJobs 获取排空任务列表，指定 id 时返回任务详情和进度（仅管理员）
+func HandleDrainJobs(w http.ResponseWriter, r *http.Request) {
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		respondJSON(w, 403, "需要管理员权限", nil)
+		return
+	}
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" {
+		jobs, err := migration.GetDrainJobs()
+		if err != nil {
+			respondJSON(w, 500, err.Error(), nil)
+			return
+		}
+		respondJSON(w, 200, "获取成功", jobs)
+		return
+	}
+
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		respondJSON(w, 400, "任务ID格式错误", nil)
+		return
+	}
+
+	job, err := migration.GetDrainJob(uint(id))
+	if err != nil {
+		respondJSON(w, 404, "任务不存在", nil)
+		return
+	}
+
+	respondJSON(w, 200, "获取成功", job)
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/openlxd/backend/internal/audit"
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/oidc"
+)
+
+// oidcStateCookie 将 state 绑定到发起登录的浏览器，防止登录 CSRF
+const oidcStateCookie = "openlxd_oidc_state"
+
+// oidcCallbackPath 回调路由
+const oidcCallbackPath = "/api/v1/users/oidc/callback"
+
+// oidcResultPage 登录完成页：把令牌写入 localStorage（与密码登录一致）后跳转，令牌不出现在 URL 中
+var oidcResultPage = template.Must(template.New("oidc").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head><meta charset="UTF-8"><title>OpenLXD 单点登录</title></head>
+<body>
+{{if .Error}}<p>单点登录失败：{{.Error}}</p><p><a href="/admin/login">返回登录页</a></p>
+{{else}}<script>
+localStorage.setItem('auth_token', {{.Token}});
+localStorage.setItem('api_key', {{.Token}});
+window.location.replace({{.Redirect}});
+</script>{{end}}
+</body>
+</html>`))
+
+// oidcRedirectURL 回调地址：优先使用配置，否则根据 server 配置生成
+func oidcRedirectURL() string {
+	cfg := config.GetConfig()
+	if cfg.OIDC.RedirectURL != "" {
+		return cfg.OIDC.RedirectURL
+	}
+	return panelURL(cfg) + oidcCallbackPath
+}
+
+// HandleOIDCInfo 单点登录是否可用（GET），供登录页决定是否显示入口
+func HandleOIDCInfo(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, 200, "获取成功", map[string]interface{}{
+		"enabled":   oidc.Enabled(),
+		"login_url": "/api/v1/users/oidc/login",
+	})
+}
+
+// HandleOIDCLogin 发起单点登录（GET ?redirect=/站内地址），跳转到身份提供方
+func HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	next := r.URL.Query().Get("redirect")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = "/"
+	}
+
+	state, authURL, err := oidc.GlobalProvider.AuthURL(r.Context(), oidcRedirectURL(), next)
+	if err != nil {
+		log.Printf("发起 OIDC 登录失败: %v", err)
+		renderOIDCResult(w, http.StatusServiceUnavailable, map[string]string{"Error": err.Error()})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/v1/users/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(oidcRedirectURL(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandleOIDCCallback 身份提供方回调（GET ?code=&state=）：换取并校验令牌，创建或关联用户后签发登录令牌
+func HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/v1/users/oidc", MaxAge: -1})
+
+	if e := query.Get("error"); e != "" {
+		renderOIDCResult(w, http.StatusUnauthorized, map[string]string{"Error": strings.TrimSpace(e + " " + query.Get("error_description"))})
+		return
+	}
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || query.Get("state") == "" || cookie.Value != query.Get("state") {
+		renderOIDCResult(w, http.StatusBadRequest, map[string]string{"Error": oidc.ErrInvalidState.Error()})
+		return
+	}
+
+	identity, next, err := oidc.GlobalProvider.Exchange(r.Context(), oidcRedirectURL(), query.Get("state"), query.Get("code"))
+	if err != nil {
+		log.Printf("OIDC 登录失败: %v", err)
+		renderOIDCResult(w, http.StatusUnauthorized, map[string]string{"Error": err.Error()})
+		return
+	}
+	user, err := oidc.Provision(identity)
+	if err != nil {
+		log.Printf("OIDC 用户 %s (%s) 登录被拒绝: %v", identity.Username, identity.Subject, err)
+		renderOIDCResult(w, http.StatusForbidden, map[string]string{"Error": err.Error()})
+		return
+	}
+
+	token, _, err := auth.NewSession(user, audit.ClientIP(r), r.UserAgent(), auth.LoginMethodOIDC)
+	if err != nil {
+		renderOIDCResult(w, http.StatusInternalServerError, map[string]string{"Error": "生成登录令牌失败"})
+		return
+	}
+
+	models.LogAction("oidc_login", "", fmt.Sprintf("用户 %s 通过 OIDC 登录（来自 %s）", user.Username, audit.ClientIP(r)), "success")
+	renderOIDCResult(w, http.StatusOK, map[string]string{"Token": token, "Redirect": next})
+}
+
+// renderOIDCResult 输出登录完成页
+func renderOIDCResult(w http.ResponseWriter, status int, data map[string]string) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := oidcResultPage.Execute(w, data); err != nil {
+		log.Printf("输出 OIDC 登录结果页失败: %v", err)
+	}
+}
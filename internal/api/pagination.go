@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 单页最大条数
+const maxPageLimit = 1000
+
+// pageOptions 列表接口的分页、排序和搜索配置
+type pageOptions struct {
+	Sorts        map[string]string // 排序键 -> 数据库列
+	DefaultSort  string            // 默认排序键，"-" 前缀表示倒序
+	DefaultLimit int               // 未指定 limit 时的条数，0 表示不限制
+	Search       []string          // q 参数模糊匹配的列；含 ? 的项作为完整条件（? 为匹配模式）
+}
+
+// Page 解析后的分页参数
+// 查询参数：limit、offset 或 cursor（上一页返回的 next_cursor）、sort（如 -created_at）、q
+type Page struct {
+	Limit  int
+	Offset int
+	Order  string
+	Desc   bool
+	Query  string
+	search []string
+	paged  bool // 请求指定了 limit/offset/cursor，或接口有默认条数
+}
+
+// parsePage 解析分页、排序和搜索参数
+func parsePage(r *http.Request, opts pageOptions) (*Page, error) {
+	values := r.URL.Query()
+	page := &Page{
+		Limit:  opts.DefaultLimit,
+		Query:  strings.TrimSpace(values.Get("q")),
+		search: opts.Search,
+		paged:  opts.DefaultLimit > 0,
+	}
+
+	if limitStr := values.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("limit 必须是正整数")
+		}
+		page.Limit = limit
+		page.paged = true
+	}
+	if page.Limit > maxPageLimit {
+		page.Limit = maxPageLimit
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		offset, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("无效的游标")
+		}
+		page.Offset = offset
+		page.paged = true
+	} else if offsetStr := values.Get("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("offset 必须是非负整数")
+		}
+		page.Offset = offset
+		page.paged = true
+	}
+
+	sortKey := values.Get("sort")
+	if sortKey == "" {
+		sortKey = opts.DefaultSort
+	}
+	desc := strings.HasPrefix(sortKey, "-")
+	column, ok := opts.Sorts[strings.TrimPrefix(sortKey, "-")]
+	if !ok {
+		keys := make([]string, 0, len(opts.Sorts))
+		for key := range opts.Sorts {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("不支持的排序字段: %s，可选: %s", sortKey, strings.Join(keys, ", "))
+	}
+	page.Order = column
+	page.Desc = desc
+	if desc {
+		page.Order += " DESC"
+	}
+	// 排序值相同时按 id 保证翻页顺序稳定
+	if column != "id" {
+		page.Order += ", id"
+	}
+
+	return page, nil
+}
+
+// Apply 对查询应用搜索条件，返回总数和已分页排序的查询
+func (p *Page) Apply(query *gorm.DB, model interface{}) (*gorm.DB, int64, error) {
+	query = query.Model(model)
+	if p.Query != "" && len(p.search) > 0 {
+		conditions := make([]string, 0, len(p.search))
+		args := make([]interface{}, 0, len(p.search))
+		pattern := "%" + escapeLike(p.Query) + "%"
+		for _, column := range p.search {
+			if !strings.Contains(column, "?") {
+				column += ` LIKE ? ESCAPE '\'`
+			}
+			conditions = append(conditions, column)
+			args = append(args, pattern)
+		}
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = query.Order(p.Order)
+	if p.Limit > 0 {
+		query = query.Limit(p.Limit)
+	}
+	if p.Offset > 0 {
+		query = query.Offset(p.Offset)
+	}
+	return query, total, nil
+}
+
+// Window 对已在内存中的结果分页，返回切片的起止下标
+func (p *Page) Window(total int) (int, int) {
+	start := p.Offset
+	if start > total {
+		start = total
+	}
+	end := total
+	if p.Limit > 0 && start+p.Limit < end {
+		end = start + p.Limit
+	}
+	return start, end
+}
+
+// SetHeaders 写入 X-Total-Count，还有下一页时写入 X-Next-Cursor
+func (p *Page) SetHeaders(w http.ResponseWriter, total int64, count int) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	if next := p.NextCursor(total, count); next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+}
+
+// NextCursor 下一页的游标，已是最后一页时为空
+func (p *Page) NextCursor(total int64, count int) string {
+	if next := p.Offset + count; p.Limit > 0 && int64(next) < total {
+		return encodeCursor(next)
+	}
+	return ""
+}
+
+// Result 列表接口的响应数据：分页时返回 {items, total, next_cursor}，
+// 未分页时原样返回完整列表，兼容不传分页参数的调用方
+func (p *Page) Result(items interface{}, total int64, count int) interface{} {
+	if !p.paged {
+		return items
+	}
+	return map[string]interface{}{
+		"items":       items,
+		"total":       total,
+		"next_cursor": p.NextCursor(total, count),
+	}
+}
+
+// escapeLike 转义 LIKE 模式中的通配符，配合 ESCAPE '\' 使用
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// encodeCursor 将偏移量编码为不透明游标
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("o:" + strconv.Itoa(offset)))
+}
+
+// decodeCursor 解析游标中的偏移量
+func decodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	offsetStr, ok := strings.CutPrefix(string(data), "o:")
+	if !ok {
+		return 0, fmt.Errorf("无效的游标")
+	}
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("无效的游标")
+	}
+	return offset, nil
+}
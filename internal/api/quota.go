@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/openlxd/backend/internal/auth"
 	"github.com/openlxd/backend/internal/quota"
 )
 
@@ -28,7 +29,7 @@ func HandleQuota(w http.ResponseWriter, r *http.Request) {
 // handleGetQuota 获取配额信息
 func handleGetQuota(w http.ResponseWriter, r *http.Request) {
 	containerIDStr := r.URL.Query().Get("container_id")
-	
+
 	if containerIDStr == "" {
 		// 获取所有配额
 		quotas, err := quota.GlobalQuotaManager.GetAllQuotas()
@@ -65,7 +66,10 @@ func handleCreateQuota(w http.ResponseWriter, r *http.Request) {
 		PortMappingQuota int    `json:"port_mapping_quota"`
 		ProxyQuota       int    `json:"proxy_quota"`
 		TrafficQuota     int64  `json:"traffic_quota"`
+		TrafficMode      string `json:"traffic_mode"` // in, out, sum, max
+		BillingDay       int    `json:"billing_day"`
 		OnExceed         string `json:"on_exceed"`
+		TemplateID       uint   `json:"template_id"` // 指定时使用模板值，忽略其他配额字段
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&req)
@@ -81,6 +85,20 @@ func handleCreateQuota(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.TemplateID != 0 {
+		if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+			respondJSON(w, 403, "只有管理员可以应用配额模板", nil)
+			return
+		}
+		if err := quota.GlobalQuotaManager.ApplyTemplate(req.ContainerID, req.TemplateID); err != nil {
+			respondJSON(w, 400, err.Error(), nil)
+			return
+		}
+		quotaInfo, _ = quota.GlobalQuotaManager.GetOrCreateQuota(req.ContainerID)
+		respondJSON(w, 200, "配额创建成功", quotaInfo)
+		return
+	}
+
 	// 更新配额设置
 	updates := map[string]interface{}{
 		"ipv4_quota":         req.IPv4Quota,
@@ -90,6 +108,12 @@ func handleCreateQuota(w http.ResponseWriter, r *http.Request) {
 		"traffic_quota":      req.TrafficQuota,
 		"on_exceed":          req.OnExceed,
 	}
+	if req.TrafficMode != "" {
+		updates["traffic_mode"] = req.TrafficMode
+	}
+	if req.BillingDay != 0 {
+		updates["billing_day"] = req.BillingDay
+	}
 
 	err = quota.GlobalQuotaManager.UpdateQuota(req.ContainerID, updates)
 	if err != nil {
@@ -103,8 +127,8 @@ func handleCreateQuota(w http.ResponseWriter, r *http.Request) {
 // handleUpdateQuota 更新配额
 func handleUpdateQuota(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		ContainerID      uint                   `json:"container_id"`
-		Updates          map[string]interface{} `json:"updates"`
+		ContainerID uint                   `json:"container_id"`
+		Updates     map[string]interface{} `json:"updates"`
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&req)
@@ -212,4 +236,234 @@ func HandleResetTraffic(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, 200, "流量重置成功", nil)
 }
 
+// HandleTrafficHistory 获取已结束的流量计费周期
+func HandleTrafficHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	containerID, err := strconv.ParseUint(r.URL.Query().Get("container_id"), 10, 32)
+	if err != nil {
+		respondJSON(w, 400, "无效的容器ID", nil)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	cycles, err := quota.GlobalQuotaManager.GetTrafficHistory(uint(containerID), limit)
+	if err != nil {
+		respondJSON(w, 500, fmt.Sprintf("获取流量历史失败: %v", err), nil)
+		return
+	}
+
+	respondJSON(w, 200, "获取成功", cycles)
+}
+
+// HandleUserQuota 处理用户配额请求
+func HandleUserQuota(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleGetUserQuota(w, r)
+	case http.MethodPost, http.MethodPut:
+		handleUpdateUserQuota(w, r)
+	case http.MethodDelete:
+		handleDeleteUserQuota(w, r)
+	default:
+		respondJSON(w, 405, "Method not allowed", nil)
+	}
+}
+
+// handleGetUserQuota 获取用户配额及使用情况（未指定 user_id 时返回当前用户）
+func handleGetUserQuota(w http.ResponseWriter, r *http.Request) {
+	var userID uint
+	if userIDStr := r.URL.Query().Get("user_id"); userIDStr != "" {
+		id, err := strconv.ParseUint(userIDStr, 10, 32)
+		if err != nil {
+			respondJSON(w, 400, "无效的用户ID", nil)
+			return
+		}
+		userID = uint(id)
+	} else if user := auth.GetUserFromContext(r.Context()); user != nil {
+		userID = user.ID
+	} else {
+		respondJSON(w, 400, "缺少用户ID", nil)
+		return
+	}
+
+	// 普通用户只能查看自己的配额
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() && user.ID != userID {
+		respondJSON(w, 403, "无权查看其他用户的配额", nil)
+		return
+	}
+
+	usage, err := quota.GlobalQuotaManager.GetUserQuotaUsage(userID)
+	if err != nil {
+		respondJSON(w, 500, fmt.Sprintf("获取用户配额失败: %v", err), nil)
+		return
+	}
+
+	respondJSON(w, 200, "获取成功", usage)
+}
+
+// handleUpdateUserQuota 设置用户配额
+func handleUpdateUserQuota(w http.ResponseWriter, r *http.Request) {
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		respondJSON(w, 403, "只有管理员可以设置用户配额", nil)
+		return
+	}
+
+	var req struct {
+		UserID     uint                   `json:"user_id"`
+		TemplateID uint                   `json:"template_id"` // 先应用模板，再应用 updates
+		Updates    map[string]interface{} `json:"updates"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 {
+		respondJSON(w, 400, "无效的请求数据", nil)
+		return
+	}
+
+	if req.TemplateID != 0 {
+		if err := quota.GlobalQuotaManager.ApplyUserTemplate(req.UserID, req.TemplateID); err != nil {
+			respondJSON(w, 400, err.Error(), nil)
+			return
+		}
+	}
+
+	quotaInfo, err := quota.GlobalQuotaManager.UpdateUserQuota(req.UserID, req.Updates)
+	if err != nil {
+		respondJSON(w, 500, fmt.Sprintf("更新用户配额失败: %v", err), nil)
+		return
+	}
+
+	respondJSON(w, 200, "用户配额更新成功", quotaInfo)
+}
+
+// handleDeleteUserQuota 删除用户配额
+func handleDeleteUserQuota(w http.ResponseWriter, r *http.Request) {
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		respondJSON(w, 403, "只有管理员可以删除用户配额", nil)
+		return
+	}
+
+	userID, err := strconv.ParseUint(r.URL.Query().Get("user_id"), 10, 32)
+	if err != nil {
+		respondJSON(w, 400, "无效的用户ID", nil)
+		return
+	}
+
+	if err := quota.GlobalQuotaManager.DeleteUserQuota(uint(userID)); err != nil {
+		respondJSON(w, 500, fmt.Sprintf("删除用户配额失败: %v", err), nil)
+		return
+	}
+
+	respondJSON(w, 200, "用户配额删除成功", nil)
+}
+
+// HandleQuotaTemplates 处理配额模板请求
+func HandleQuotaTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+			respondJSON(w, 403, "只有管理员可以管理配额模板", nil)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		templates, err := quota.GlobalQuotaManager.ListTemplates()
+		if err != nil {
+			respondJSON(w, 500, fmt.Sprintf("获取配额模板失败: %v", err), nil)
+			return
+		}
+		respondJSON(w, 200, "获取成功", templates)
+	case http.MethodPost:
+		handleCreateQuotaTemplate(w, r)
+	case http.MethodPut:
+		handleUpdateQuotaTemplate(w, r)
+	case http.MethodDelete:
+		handleDeleteQuotaTemplate(w, r)
+	default:
+		respondJSON(w, 405, "Method not allowed", nil)
+	}
+}
+
+// handleCreateQuotaTemplate 创建配额模板（未提供的配额字段默认为无限制）
+func handleCreateQuotaTemplate(w http.ResponseWriter, r *http.Request) {
+	tpl := quota.NewQuotaTemplate()
+	if err := json.NewDecoder(r.Body).Decode(&tpl); err != nil {
+		respondJSON(w, 400, "无效的请求数据", nil)
+		return
+	}
+	tpl.ID = 0
+
+	if err := quota.GlobalQuotaManager.CreateTemplate(&tpl); err != nil {
+		respondJSON(w, 400, fmt.Sprintf("创建配额模板失败: %v", err), nil)
+		return
+	}
+
+	respondJSON(w, 200, "配额模板创建成功", tpl)
+}
+
+// handleUpdateQuotaTemplate 更新配额模板
+func handleUpdateQuotaTemplate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID        uint                   `json:"id"`
+		Updates   map[string]interface{} `json:"updates"`
+		Propagate bool                   `json:"propagate"` // 同步到所有使用该模板的容器和用户
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+		respondJSON(w, 400, "无效的请求数据", nil)
+		return
+	}
+
+	tpl, affected, err := quota.GlobalQuotaManager.UpdateTemplate(req.ID, req.Updates, req.Propagate)
+	if err != nil {
+		respondJSON(w, 400, err.Error(), nil)
+		return
+	}
+
+	respondJSON(w, 200, "配额模板更新成功", map[string]interface{}{
+		"template":   tpl,
+		"propagated": affected,
+	})
+}
+
+// handleDeleteQuotaTemplate 删除配额模板
+func handleDeleteQuotaTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		respondJSON(w, 400, "无效的模板ID", nil)
+		return
+	}
+
+	if err := quota.GlobalQuotaManager.DeleteTemplate(uint(id)); err != nil {
+		respondJSON(w, 500, fmt.Sprintf("删除配额模板失败: %v", err), nil)
+		return
+	}
+
+	respondJSON(w, 200, "配额模板删除成功", nil)
+}
+
+// HandleQuotaTemplateDeviations 列出与模板不一致的容器和用户配额
+func HandleQuotaTemplateDeviations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		respondJSON(w, 400, "无效的模板ID", nil)
+		return
+	}
 
+	deviations, err := quota.GlobalQuotaManager.GetTemplateDeviations(uint(id))
+	if err != nil {
+		respondJSON(w, 404, err.Error(), nil)
+		return
+	}
+
+	respondJSON(w, 200, "获取成功", deviations)
+}
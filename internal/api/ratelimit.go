@@ -0,0 +1,46 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/ratelimit"
+)
+
+// HandleRateLimits 限流计数（管理员）
+// GET 查看各调用方的令牌桶和被限流次数（?throttled=true 只返回被限流过的）；
+// DELETE ?key=apikey:xxx|user:1|ip:1.2.3.4[&class=auth|mutate|read] 解除限流
+func HandleRateLimits(w http.ResponseWriter, r *http.Request) {
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		respondJSON(w, 403, "需要管理员权限", nil)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		cfg := config.GetConfig().RateLimit
+		respondJSON(w, 200, "获取成功", map[string]interface{}{
+			"enabled": cfg.Enabled,
+			"limits": map[string]interface{}{
+				ratelimit.ClassAuth:   map[string]int{"rate": cfg.AuthRate, "burst": cfg.AuthBurst},
+				ratelimit.ClassMutate: map[string]int{"rate": cfg.MutateRate, "burst": cfg.MutateBurst},
+				ratelimit.ClassRead:   map[string]int{"rate": cfg.ReadRate, "burst": cfg.ReadBurst},
+			},
+			"callers": ratelimit.GlobalLimiter.Stats(r.URL.Query().Get("throttled") == "true"),
+		})
+
+	case http.MethodDelete:
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			respondJSON(w, 400, "缺少 key 参数", nil)
+			return
+		}
+		removed := ratelimit.GlobalLimiter.Reset(r.URL.Query().Get("class"), key)
+		respondJSON(w, 200, fmt.Sprintf("已解除 %s 的限流（%d 个令牌桶）", key, removed), nil)
+
+	default:
+		respondJSON(w, 405, "Method not allowed", nil)
+	}
+}
@@ -2,9 +2,11 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 
+	"github.com/openlxd/backend/internal/audit"
 	"github.com/openlxd/backend/internal/auth"
 	"github.com/openlxd/backend/internal/models"
 	"gorm.io/gorm"
@@ -31,12 +33,13 @@ type RegisterRequest struct {
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	OTP      string `json:"otp"` // 启用两步验证时必填：验证码或恢复码
 }
 
 // LoginResponse 登录响应
 type LoginResponse struct {
-	Token    string       `json:"token"`
-	User     *models.User `json:"user"`
+	Token string       `json:"token"`
+	User  *models.User `json:"user"`
 }
 
 // Register 用户注册
@@ -79,19 +82,11 @@ func (api *UserAPI) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 生成API密钥
-	apiKey, err := auth.GenerateAPIKey()
-	if err != nil {
-		respondError(w, "Failed to generate API key", http.StatusInternalServerError)
-		return
-	}
-
 	// 创建用户
 	user := models.User{
 		Username:     req.Username,
 		Email:        req.Email,
 		PasswordHash: passwordHash,
-		APIKey:       apiKey,
 		Role:         "user",
 		Status:       "active",
 	}
@@ -101,8 +96,16 @@ func (api *UserAPI) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 生成默认API密钥（明文只在此时返回）
+	apiKey, _, err := auth.CreateAPIKey(user.ID, "default", defaultUserScopes, "", nil)
+	if err != nil {
+		respondError(w, "Failed to generate API key", http.StatusInternalServerError)
+		return
+	}
+	user.APIKey = apiKey
+
 	// 生成Token
-	token, err := auth.GenerateToken(user.ID, user.Username, user.Role)
+	token, _, err := auth.NewSession(&user, audit.ClientIP(r), r.UserAgent(), auth.LoginMethodPassword)
 	if err != nil {
 		respondError(w, "Failed to generate token", http.StatusInternalServerError)
 		return
@@ -128,27 +131,24 @@ func (api *UserAPI) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 查找用户
-	var user models.User
-	if err := api.db.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		respondError(w, "Invalid username or password", http.StatusUnauthorized)
-		return
-	}
-
-	// 验证密码
-	if !auth.CheckPasswordHash(req.Password, user.PasswordHash) {
-		respondError(w, "Invalid username or password", http.StatusUnauthorized)
-		return
-	}
-
-	// 检查用户状态
-	if !user.IsActive() {
-		respondError(w, "User account is not active", http.StatusForbidden)
+	// 校验密码、两步验证码和登录失败锁定
+	ip := audit.ClientIP(r)
+	user, method, err := auth.Login(req.Username, req.Password, req.OTP, ip)
+	if err != nil {
+		var locked *auth.LockedError
+		switch {
+		case errors.As(err, &locked):
+			respondError(w, err.Error(), http.StatusTooManyRequests)
+		case err == auth.ErrUserInactive:
+			respondError(w, "User account is not active", http.StatusForbidden)
+		default:
+			respondError(w, err.Error(), http.StatusUnauthorized)
+		}
 		return
 	}
 
 	// 生成Token
-	token, err := auth.GenerateToken(user.ID, user.Username, user.Role)
+	token, _, err := auth.NewSession(user, ip, r.UserAgent(), method)
 	if err != nil {
 		respondError(w, "Failed to generate token", http.StatusInternalServerError)
 		return
@@ -156,7 +156,7 @@ func (api *UserAPI) Login(w http.ResponseWriter, r *http.Request) {
 
 	respondSuccess(w, LoginResponse{
 		Token: token,
-		User:  &user,
+		User:  user,
 	})
 }
 
@@ -171,6 +171,9 @@ func (api *UserAPI) GetProfile(w http.ResponseWriter, r *http.Request) {
 	respondSuccess(w, user)
 }
 
+// defaultUserScopes 注册和重新生成时默认授予的权限范围
+const defaultUserScopes = auth.ScopeRead + "," + auth.ScopeContainerWrite + "," + auth.ScopeNetworkWrite
+
 // RegenerateAPIKey 重新生成API密钥
 func (api *UserAPI) RegenerateAPIKey(w http.ResponseWriter, r *http.Request) {
 	user := auth.GetUserFromContext(r.Context())
@@ -179,16 +182,14 @@ func (api *UserAPI) RegenerateAPIKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 生成新的API密钥
-	apiKey, err := auth.GenerateAPIKey()
-	if err != nil {
-		respondError(w, "Failed to generate API key", http.StatusInternalServerError)
+	// 撤销原有的默认密钥后生成新密钥，通过 /api/v1/apikeys 创建的命名密钥不受影响
+	if err := api.db.Where("user_id = ? AND name IN ?", user.ID, []string{"default", "legacy", "regenerated"}).Delete(&models.APIKey{}).Error; err != nil {
+		respondError(w, "Failed to revoke API key", http.StatusInternalServerError)
 		return
 	}
-
-	// 更新数据库
-	if err := api.db.Model(user).Update("api_key", apiKey).Error; err != nil {
-		respondError(w, "Failed to update API key", http.StatusInternalServerError)
+	apiKey, _, err := auth.CreateAPIKey(user.ID, "regenerated", defaultUserScopes, "", nil)
+	if err != nil {
+		respondError(w, "Failed to generate API key", http.StatusInternalServerError)
 		return
 	}
 
@@ -196,15 +197,41 @@ func (api *UserAPI) RegenerateAPIKey(w http.ResponseWriter, r *http.Request) {
 	respondSuccess(w, user)
 }
 
-// ListUsers 获取用户列表（管理员）
+// userPageOptions 用户列表的排序和搜索字段
+var userPageOptions = pageOptions{
+	Sorts: map[string]string{
+		"id":         "id",
+		"username":   "username",
+		"email":      "email",
+		"role":       "role",
+		"status":     "status",
+		"created_at": "created_at",
+	},
+	DefaultSort: "id",
+	Search:      []string{"username", "email"},
+}
+
+// ListUsers 获取用户列表（管理员，支持分页、排序和搜索）
 func (api *UserAPI) ListUsers(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r, userPageOptions)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query, total, err := page.Apply(api.db, &models.User{})
+	if err != nil {
+		respondError(w, "Failed to fetch users", http.StatusInternalServerError)
+		return
+	}
 	var users []models.User
-	if err := api.db.Find(&users).Error; err != nil {
+	if err := query.Find(&users).Error; err != nil {
 		respondError(w, "Failed to fetch users", http.StatusInternalServerError)
 		return
 	}
+	page.SetHeaders(w, total, len(users))
 
-	respondSuccess(w, users)
+	respondSuccess(w, page.Result(users, total, len(users)))
 }
 
 // UpdateUserStatus 更新用户状态（管理员）
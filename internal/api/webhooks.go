@@ -0,0 +1,284 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/webhook"
+)
+
+// actionEvents 容器操作对应的 webhook 事件
+var actionEvents = map[string]string{
+	"start":     webhook.EventContainerStarted,
+	"stop":      webhook.EventContainerStopped,
+	"suspend":   webhook.EventContainerSuspended,
+	"unsuspend": webhook.EventContainerStarted,
+	"delete":    webhook.EventContainerDeleted,
+}
+
+// deliveryPageOptions 投递记录的排序字段
+var deliveryPageOptions = pageOptions{
+	Sorts: map[string]string{
+		"id":         "id",
+		"created_at": "created_at",
+		"attempts":   "attempts",
+	},
+	DefaultSort:  "-id",
+	DefaultLimit: 100,
+	Search:       []string{"event", "event_id"},
+}
+
+// emitContainerEvent 发送容器事件，删除事件需在删除数据库记录前调用以便带上所属用户
+func emitContainerEvent(event, name string) {
+	var container models.Container
+	if err := models.DB.Where("hostname = ?", name).First(&container).Error; err != nil {
+		container.Hostname = name
+	}
+	webhook.EmitContainer(event, &container)
+}
+
+// emitSnapshotEvent 发送快照创建事件
+func emitSnapshotEvent(name, snapshot string) {
+	var container models.Container
+	if err := models.DB.Where("hostname = ?", name).First(&container).Error; err != nil {
+		container.Hostname = name
+	}
+	webhook.Emit(webhook.EventSnapshotCreated, container.UserID, map[string]interface{}{
+		"container": container,
+		"snapshot":  snapshot,
+	})
+}
+
+// HandleWebhooks 管理 webhook 订阅：GET 列表，POST 创建或更新（指定 id），DELETE ?id= 删除
+// 普通用户只能管理自己的订阅，只会收到与其名下容器相关的事件；列表中不返回签名密钥
+func HandleWebhooks(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	isAdmin := user == nil || user.IsAdmin()
+
+	query := models.DB.Model(&models.WebhookSubscription{})
+	if !isAdmin {
+		query = query.Where("user_id = ?", user.ID)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var subscriptions []models.WebhookSubscription
+		query.Order("id").Find(&subscriptions)
+		for i := range subscriptions {
+			subscriptions[i].Secret = ""
+		}
+		respondJSON(w, 200, "获取成功", map[string]interface{}{
+			"subscriptions": subscriptions,
+			"events":        webhook.Events,
+		})
+
+	case http.MethodPost:
+		var req struct {
+			models.WebhookSubscription
+			Enabled      *bool `json:"enabled"`
+			RotateSecret bool  `json:"rotate_secret"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, 400, "请求参数错误", nil)
+			return
+		}
+
+		sub := req.WebhookSubscription
+		if sub.ID != 0 {
+			var existing models.WebhookSubscription
+			if err := query.First(&existing, sub.ID).Error; err != nil {
+				respondJSON(w, 404, "订阅不存在", nil)
+				return
+			}
+			sub.CreatedAt = existing.CreatedAt
+			sub.Enabled = existing.Enabled
+			if sub.Secret == "" && !req.RotateSecret {
+				sub.Secret = existing.Secret
+			}
+		} else {
+			sub.Enabled = true
+		}
+		if req.Enabled != nil {
+			sub.Enabled = *req.Enabled
+		}
+		if sub.Secret == "" {
+			sub.Secret = webhook.GenerateSecret()
+		}
+		if !isAdmin {
+			sub.UserID = user.ID
+		}
+
+		if sub.Name == "" {
+			respondJSON(w, 400, "订阅名称不能为空", nil)
+			return
+		}
+		if err := webhook.ValidateURL(r.Context(), sub.URL, webhook.Restricted(sub.UserID)); err != nil {
+			respondJSON(w, 400, fmt.Sprintf("webhook %v", err), nil)
+			return
+		}
+		if err := webhook.ValidateEvents(sub.Events); err != nil {
+			respondJSON(w, 400, err.Error(), nil)
+			return
+		}
+
+		if err := models.DB.Save(&sub).Error; err != nil {
+			respondJSON(w, 500, fmt.Sprintf("保存失败: %v", err), nil)
+			return
+		}
+		models.LogAction("save_webhook", "", fmt.Sprintf("保存 webhook 订阅: %s", sub.Name), "success")
+		respondJSON(w, 200, "保存成功", sub)
+
+	case http.MethodDelete:
+		id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+		if err != nil {
+			respondJSON(w, 400, "订阅ID无效", nil)
+			return
+		}
+		result := query.Where("id = ?", id).Delete(&models.WebhookSubscription{})
+		if result.Error != nil {
+			respondJSON(w, 500, fmt.Sprintf("删除失败: %v", result.Error), nil)
+			return
+		}
+		if result.RowsAffected == 0 {
+			respondJSON(w, 404, "订阅不存在", nil)
+			return
+		}
+		// 未完成的投递不再重试
+		models.DB.Model(&models.WebhookDelivery{}).
+			Where("subscription_id = ? AND status = ?", id, webhook.StatusPending).
+			Updates(map[string]interface{}{"status": webhook.StatusFailed, "error": "订阅已删除", "next_attempt_at": nil})
+		models.LogAction("delete_webhook", "", fmt.Sprintf("删除 webhook 订阅: %d", id), "success")
+		respondJSON(w, 200, "删除成功", nil)
+
+	default:
+		respondJSON(w, 405, "Method not allowed", nil)
+	}
+}
+
+// HandleWebhookPing 向订阅发送测试事件并返回投递结果（POST ?id=）
+func HandleWebhookPing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	sub, ok := findSubscription(w, r, r.URL.Query().Get("id"))
+	if !ok {
+		return
+	}
+
+	delivery, err := webhook.GlobalDispatcher.Ping(sub)
+	if err != nil {
+		respondJSON(w, 500, fmt.Sprintf("发送失败: %v", err), nil)
+		return
+	}
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		delivery.ResponseBody = ""
+	}
+	respondJSON(w, 200, "测试事件已发送", delivery)
+}
+
+// HandleWebhookDeliveries 查询投递记录（GET），可按 subscription_id、event、status 过滤
+func HandleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	page, err := parsePage(r, deliveryPageOptions)
+	if err != nil {
+		respondJSON(w, 400, err.Error(), nil)
+		return
+	}
+
+	values := r.URL.Query()
+	query := models.DB.Model(&models.WebhookDelivery{})
+	user := auth.GetUserFromContext(r.Context())
+	isAdmin := user == nil || user.IsAdmin()
+	if !isAdmin {
+		own := models.DB.Model(&models.WebhookSubscription{}).Select("id").Where("user_id = ?", user.ID)
+		query = query.Where("subscription_id IN (?)", own)
+	}
+	if id := values.Get("subscription_id"); id != "" {
+		query = query.Where("subscription_id = ?", id)
+	}
+	if event := values.Get("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+	if status := values.Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var deliveries []models.WebhookDelivery
+	query, total, err := page.Apply(query, &models.WebhookDelivery{})
+	if err == nil {
+		err = query.Find(&deliveries).Error
+	}
+	if err != nil {
+		respondJSON(w, 500, fmt.Sprintf("查询失败: %v", err), nil)
+		return
+	}
+	page.SetHeaders(w, total, len(deliveries))
+
+	// 响应体只对管理员可见，避免普通用户借 webhook 读取其他服务的内容
+	if !isAdmin {
+		for i := range deliveries {
+			deliveries[i].ResponseBody = ""
+		}
+	}
+
+	respondJSON(w, 200, "获取成功", page.Result(deliveries, total, len(deliveries)))
+}
+
+// HandleWebhookRedeliver 以原内容重新投递（POST ?id=投递记录ID）
+func HandleWebhookRedeliver(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondJSON(w, 405, "Method not allowed", nil)
+		return
+	}
+
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		respondJSON(w, 400, "投递记录ID无效", nil)
+		return
+	}
+	var original models.WebhookDelivery
+	if err := models.DB.First(&original, id).Error; err != nil {
+		respondJSON(w, 404, "投递记录不存在", nil)
+		return
+	}
+	if _, ok := findSubscription(w, r, strconv.FormatUint(uint64(original.SubscriptionID), 10)); !ok {
+		return
+	}
+
+	delivery, err := webhook.GlobalDispatcher.Redeliver(original.ID)
+	if err != nil {
+		respondJSON(w, 500, err.Error(), nil)
+		return
+	}
+	respondJSON(w, 200, "已加入投递队列", delivery)
+}
+
+// findSubscription 查找当前用户可访问的订阅，不存在时直接写入响应
+func findSubscription(w http.ResponseWriter, r *http.Request, idStr string) (*models.WebhookSubscription, bool) {
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		respondJSON(w, 400, "订阅ID无效", nil)
+		return nil, false
+	}
+
+	query := models.DB.Model(&models.WebhookSubscription{})
+	if user := auth.GetUserFromContext(r.Context()); user != nil && !user.IsAdmin() {
+		query = query.Where("user_id = ?", user.ID)
+	}
+	var sub models.WebhookSubscription
+	if err := query.First(&sub, id).Error; err != nil {
+		respondJSON(w, 404, "订阅不存在", nil)
+		return nil, false
+	}
+	return &sub, true
+}
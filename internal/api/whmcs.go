@@ -3,12 +3,18 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/capacity"
 	"github.com/openlxd/backend/internal/lxd"
 	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/quota"
+	"github.com/openlxd/backend/internal/scheduler"
+	"github.com/openlxd/backend/internal/webhook"
 	"gorm.io/gorm"
 )
 
@@ -28,14 +34,16 @@ func NewWHMCSAPI(db *gorm.DB, lxdClient *lxd.ClientWrapper) *WHMCSAPI {
 
 // CreateContainerRequest 创建容器请求
 type CreateContainerRequest struct {
-	Name     string `json:"name"`
-	Image    string `json:"image"`
-	CPU      int    `json:"cpu"`
-	Memory   string `json:"memory"` // 如 "2GB"
-	Disk     string `json:"disk"`   // 如 "20GB"
-	IPv4     string `json:"ipv4"`   // "auto" 或具体IP
-	IPv6     string `json:"ipv6"`   // "auto" 或具体IP
-	Password string `json:"password,omitempty"`
+	Name          string `json:"name"`
+	Image         string `json:"image"`
+	CPU           int    `json:"cpu"`
+	Memory        string `json:"memory"` // 如 "2GB"
+	Disk          string `json:"disk"`   // 如 "20GB"
+	IPv4          string `json:"ipv4"`   // "auto" 或具体IP
+	IPv6          string `json:"ipv6"`   // "auto" 或具体IP
+	Password      string `json:"password,omitempty"`
+	QuotaTemplate string `json:"quota_template,omitempty"` // 配额模板名称
+	scheduler.Placement
 }
 
 // ContainerActionRequest 容器操作请求
@@ -103,6 +111,39 @@ func (api *WHMCSAPI) CreateContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 配额模板只能由管理员指定
+	if req.QuotaTemplate != "" && !user.IsAdmin() {
+		api.respondError(w, "只有管理员可以指定配额模板", http.StatusForbidden)
+		return
+	}
+
+	// 检查用户配额
+	release, err := quota.GlobalQuotaManager.ReserveUserContainer(user.ID, req.CPU, memoryMB, diskGB)
+	if err != nil {
+		api.respondError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	defer release()
+
+	// 选择节点（含容量策略检查）并预留节点资源，容器写入数据库后释放
+	node, releaseNode, err := scheduler.GlobalScheduler.ScheduleAndReserve(scheduler.Request{
+		Placement: req.Placement,
+		CPUs:      req.CPU,
+		Memory:    memoryMB,
+		Disk:      diskGB,
+	})
+	if err != nil {
+		api.respondError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	defer releaseNode()
+
+	tpl, err := quota.GlobalQuotaManager.ResolveTemplate(req.QuotaTemplate)
+	if err != nil {
+		api.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// 分配IP地址
 	var ipv4, ipv6 string
 	if req.IPv4 == "auto" || req.IPv4 == "" {
@@ -129,6 +170,7 @@ func (api *WHMCSAPI) CreateContainer(w http.ResponseWriter, r *http.Request) {
 
 	// 创建LXD容器
 	config := lxd.ContainerConfig{
+		Node:   node,
 		Name:   req.Name,
 		Image:  req.Image,
 		CPU:    req.CPU,
@@ -167,6 +209,7 @@ func (api *WHMCSAPI) CreateContainer(w http.ResponseWriter, r *http.Request) {
 		Disk:      diskGB,
 		UserID:    user.ID,
 		CreatedBy: user.Username,
+		Node:      node,
 	}
 
 	if err := api.db.Create(&container).Error; err != nil {
@@ -174,6 +217,13 @@ func (api *WHMCSAPI) CreateContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 应用配额模板
+	if tpl != nil {
+		if err := quota.GlobalQuotaManager.ApplyTemplate(container.ID, tpl.ID); err != nil {
+			log.Printf("警告: 为容器 %s 应用配额模板 %s 失败: %v", container.Hostname, tpl.Name, err)
+		}
+	}
+
 	// 更新IP地址关联
 	if ipv4 != "" {
 		api.db.Model(&models.IPAddress{}).Where("ip = ?", ipv4).Update("container_id", container.ID)
@@ -182,6 +232,7 @@ func (api *WHMCSAPI) CreateContainer(w http.ResponseWriter, r *http.Request) {
 		api.db.Model(&models.IPAddress{}).Where("ip = ?", ipv6).Update("container_id", container.ID)
 	}
 
+	webhook.EmitContainer(webhook.EventContainerCreated, &container)
 	api.respondSuccess(w, map[string]interface{}{
 		"container_id": container.ID,
 		"name":         container.Hostname,
@@ -228,6 +279,7 @@ func (api *WHMCSAPI) StartContainer(w http.ResponseWriter, r *http.Request) {
 
 	// 更新数据库
 	api.db.Model(&container).Update("status", "Running")
+	webhook.EmitContainer(webhook.EventContainerStarted, &container)
 
 	api.respondSuccess(w, map[string]interface{}{
 		"name":   req.Name,
@@ -269,6 +321,7 @@ func (api *WHMCSAPI) StopContainer(w http.ResponseWriter, r *http.Request) {
 
 	// 更新数据库
 	api.db.Model(&container).Update("status", "Stopped")
+	webhook.EmitContainer(webhook.EventContainerStopped, &container)
 
 	api.respondSuccess(w, map[string]interface{}{
 		"name":   req.Name,
@@ -361,6 +414,8 @@ func (api *WHMCSAPI) DeleteContainer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 从数据库删除
+	webhook.EmitContainer(webhook.EventContainerDeleted, &container)
+	models.DeleteContainerLabels(container.Hostname)
 	api.db.Delete(&container)
 
 	api.respondSuccess(w, map[string]interface{}{
@@ -440,50 +495,52 @@ func (api *WHMCSAPI) UpdateContainerConfig(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	updates := make(map[string]interface{})
-
-	// 更新CPU
-	if req.CPU > 0 {
-		if err := api.lxdClient.SetCPULimit(req.Name, req.CPU); err != nil {
-			api.respondError(w, fmt.Sprintf("Failed to update CPU: %v", err), http.StatusInternalServerError)
-			return
-		}
-		updates["cpus"] = req.CPU
-	}
-
-	// 更新内存
+	// 解析内存和磁盘大小（不带单位时内存按 MB、磁盘按 GB）
+	spec := lxd.ResizeSpec{CPUs: req.CPU}
 	if req.Memory != "" {
-		memoryMB, err := parseSize(req.Memory)
+		size, err := parseSpecSize(req.Memory, 1000*1000)
 		if err != nil {
 			api.respondError(w, "Invalid memory size", http.StatusBadRequest)
 			return
 		}
-		if err := api.lxdClient.SetMemoryLimit(req.Name, memoryMB); err != nil {
-			api.respondError(w, fmt.Sprintf("Failed to update memory: %v", err), http.StatusInternalServerError)
-			return
-		}
-		updates["memory"] = memoryMB
+		spec.MemoryMB = size
 	}
-
-	// 更新磁盘
 	if req.Disk != "" {
-		diskGB, err := parseSize(req.Disk)
+		size, err := parseSpecSize(req.Disk, 1000*1000*1000)
 		if err != nil {
 			api.respondError(w, "Invalid disk size", http.StatusBadRequest)
 			return
 		}
-		if err := api.lxdClient.SetDiskLimit(req.Name, diskGB); err != nil {
-			api.respondError(w, fmt.Sprintf("Failed to update disk: %v", err), http.StatusInternalServerError)
-			return
-		}
-		updates["disk"] = diskGB
+		spec.DiskGB = size
+	}
+	if spec.IsEmpty() {
+		api.respondError(w, "Nothing to update", http.StatusBadRequest)
+		return
 	}
 
-	// 更新数据库
-	if len(updates) > 0 {
-		api.db.Model(&container).Updates(updates)
+	// 检查用户配额
+	if err := quota.GlobalQuotaManager.CheckUserResizeQuota(container.ID, spec.CPUs, spec.MemoryMB, spec.DiskGB); err != nil {
+		api.respondError(w, err.Error(), http.StatusForbidden)
+		return
 	}
 
+	// 检查宿主机容量策略
+	if err := capacity.GlobalManager.CheckResize(container.ID, spec.CPUs, spec.MemoryMB, spec.DiskGB); err != nil {
+		api.respondError(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	// 一次性提交到 LXD，数据库保存失败时回滚
+	if err := api.lxdClient.ResizeContainer(req.Name, spec, func() error {
+		return saveContainerSpec(api.db, &container, spec)
+	}); err != nil {
+		models.LogAction("resize_container", req.Name, fmt.Sprintf("调整规格失败: %v", err), "failed")
+		api.respondError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	models.LogAction("resize_container", req.Name,
+		fmt.Sprintf("调整规格: CPU %d, 内存 %dMB, 磁盘 %dGB", container.CPUs, container.Memory, container.Disk), "success")
+
 	api.respondSuccess(w, map[string]interface{}{
 		"name":   req.Name,
 		"cpu":    container.CPUs,
@@ -492,6 +549,51 @@ func (api *WHMCSAPI) UpdateContainerConfig(w http.ResponseWriter, r *http.Reques
 	}, "Container configuration updated successfully")
 }
 
+// saveContainerSpec 在事务中保存容器规格
+func saveContainerSpec(db *gorm.DB, container *models.Container, spec lxd.ResizeSpec) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		updates := make(map[string]interface{})
+		if spec.CPUs > 0 {
+			updates["cpus"] = spec.CPUs
+		}
+		if spec.MemoryMB > 0 {
+			updates["memory"] = spec.MemoryMB
+		}
+		if spec.DiskGB > 0 {
+			updates["disk"] = spec.DiskGB
+		}
+		result := tx.Model(container).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("容器记录不存在")
+		}
+		return nil
+	})
+}
+
+// parseSpecSize 将带单位的大小转换为 unit 字节的整数倍，不带单位的数字直接返回
+func parseSpecSize(value string, unit int64) (int, error) {
+	if n, err := strconv.Atoi(value); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("invalid size format")
+		}
+		return n, nil
+	}
+	// 兼容 2G、2gb、2GIB 等写法
+	value = strings.ToUpper(strings.TrimSpace(value))
+	value = strings.Replace(value, "IB", "iB", 1)
+	if strings.HasSuffix(value, "G") || strings.HasSuffix(value, "M") || strings.HasSuffix(value, "T") {
+		value += "B"
+	}
+	bytes := lxd.ParseSize(value)
+	if bytes < unit {
+		return 0, fmt.Errorf("invalid size format")
+	}
+	return int(bytes / unit), nil
+}
+
 // respondError 返回错误响应
 func (api *WHMCSAPI) respondError(w http.ResponseWriter, message string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
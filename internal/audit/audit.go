@@ -0,0 +1,268 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/openlxd/backend/internal/models"
+)
+
+// 操作者类型
+const (
+	ActorSystem    = "system"    // 系统 API Hash
+	ActorUser      = "user"      // JWT 登录用户
+	ActorAPIKey    = "api_key"   // 用户 API Key
+	ActorAnonymous = "anonymous" // 未认证
+)
+
+const (
+	maxBodyRead   = 64 << 10 // 读取用于审计的请求体上限，超出部分不解析
+	maxBodyStored = 8 << 10  // 写入审计日志的请求体上限
+	maxRespPeek   = 512      // 解析业务状态码时读取的响应前缀
+	redacted      = "[REDACTED]"
+)
+
+// sensitiveKeys 字段名包含这些词（或以 key 结尾，如 api_key）时脱敏
+var sensitiveKeys = []string{"password", "passwd", "secret", "token", "credential", "private", "otp", "recovery"}
+
+// Actor 请求的操作者
+type Actor struct {
+	Type   string
+	Name   string
+	UserID uint
+}
+
+type contextKey struct{}
+
+// WithActor 将操作者写入请求上下文，由认证中间件在认证通过后调用
+func WithActor(r *http.Request, actor Actor) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), contextKey{}, actor))
+}
+
+// ActorFromContext 获取请求的操作者，未设置时为匿名
+func ActorFromContext(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(contextKey{}).(Actor); ok {
+		return actor
+	}
+	return Actor{Type: ActorAnonymous}
+}
+
+// Record 记录所有修改类请求（POST/PUT/PATCH/DELETE）：操作者、客户端 IP、路由、脱敏后的请求体和结果
+func Record(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !mutating(r.Method) {
+			next(w, r)
+			return
+		}
+
+		var body []byte
+		if r.Body != nil {
+			body, _ = io.ReadAll(io.LimitReader(r.Body, maxBodyRead))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+
+		actor := ActorFromContext(r.Context())
+		entry := &models.AuditLog{
+			ActorType: actor.Type,
+			Actor:     actor.Name,
+			UserID:    actor.UserID,
+			IP:        ClientIP(r),
+			Method:    r.Method,
+			Route:     r.URL.Path,
+			Query:     redactQuery(r.URL.Query()),
+			Container: containerOf(r, body),
+			Status:    recorder.resultCode(),
+			Body:      redactBody(r.Header.Get("Content-Type"), body),
+		}
+		if err := models.AppendAuditLog(entry); err != nil {
+			log.Printf("写入审计日志失败: %v", err)
+		}
+	}
+}
+
+// mutating 是否为修改类请求
+func mutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// ClientIP 获取客户端 IP；仅当请求来自本机（如 nginx 反向代理）时信任 X-Real-IP / X-Forwarded-For
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return host
+	}
+
+	if real := strings.TrimSpace(r.Header.Get("X-Real-IP")); real != "" {
+		return real
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		parts := strings.Split(forwarded, ",")
+		return strings.TrimSpace(parts[len(parts)-1])
+	}
+	return host
+}
+
+// containerOf 从查询参数、路径（/containers/{name}/...）或 JSON 请求体中识别操作的容器
+func containerOf(r *http.Request, body []byte) string {
+	values := r.URL.Query()
+	for _, key := range []string{"container", "hostname", "name"} {
+		if v := values.Get(key); v != "" {
+			return v
+		}
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "containers" && parts[i+1] != "" && !strings.Contains(parts[i+1], ".") {
+			switch parts[i+1] {
+			case "create", "action", "bulk", "labels":
+			default:
+				return parts[i+1]
+			}
+		}
+	}
+
+	var fields map[string]interface{}
+	if json.Unmarshal(body, &fields) == nil {
+		for _, key := range []string{"container", "hostname", "container_name", "name"} {
+			if v, ok := fields[key].(string); ok && v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// sensitive 字段名是否需要脱敏
+func sensitive(key string) bool {
+	key = strings.ToLower(key)
+	if key != "key" && strings.HasSuffix(key, "key") {
+		return true
+	}
+	for _, word := range sensitiveKeys {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactQuery 脱敏查询参数（如 api_key）
+func redactQuery(values url.Values) string {
+	if len(values) == 0 {
+		return ""
+	}
+	for key := range values {
+		if sensitive(key) {
+			values[key] = []string{redacted}
+		}
+	}
+	return values.Encode()
+}
+
+// redactBody 脱敏请求体：JSON 和表单按字段名脱敏，其他类型只记录长度
+func redactBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var result string
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err == nil {
+		data, _ := json.Marshal(redactValue(value))
+		result = string(data)
+	} else if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "[无法解析的表单]"
+		}
+		result = redactQuery(values)
+	} else {
+		return "[" + http.DetectContentType(body) + "]"
+	}
+
+	if len(result) > maxBodyStored {
+		result = result[:maxBodyStored] + "...[truncated]"
+	}
+	return result
+}
+
+// redactValue 递归脱敏 JSON 值
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if sensitive(key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return value
+}
+
+// responseRecorder 记录响应状态码和响应体前缀（接口多以 HTTP 200 + JSON code 返回结果）
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	peek   []byte
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if room := maxRespPeek - len(r.peek); room > 0 {
+		if len(b) < room {
+			room = len(b)
+		}
+		r.peek = append(r.peek, b[:room]...)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap 供 http.ResponseController 访问底层连接
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// resultCode HTTP 200 时取响应 JSON 中的 code 字段（respondJSON 将 code 放在最前面）
+func (r *responseRecorder) resultCode() int {
+	if r.status != http.StatusOK {
+		return r.status
+	}
+	if i := bytes.Index(r.peek, []byte(`"code":`)); i >= 0 {
+		var code int
+		if err := json.NewDecoder(bytes.NewReader(r.peek[i+len(`"code":`):])).Decode(&code); err == nil {
+			return code
+		}
+	}
+	return r.status
+}
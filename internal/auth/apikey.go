@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/openlxd/backend/internal/models"
+)
+
+// API 密钥权限范围
+const (
+	ScopeRead           = "read"            // 只读（GET 请求）
+	ScopeContainerWrite = "container:write" // 创建、操作、删除容器及快照、克隆等
+	ScopeNetworkWrite   = "network:write"   // 端口映射、IP 池、反向代理、证书
+	ScopeAdmin          = "admin"           // 全部操作（仅管理员账号可授予）
+)
+
+// Scopes 支持的权限范围
+var Scopes = []string{ScopeRead, ScopeContainerWrite, ScopeNetworkWrite, ScopeAdmin}
+
+// APIKeyPrefix 新生成的 API 密钥前缀
+const APIKeyPrefix = "olxd_"
+
+// lastUsedInterval 最近使用时间的最小更新间隔，避免每个请求都写数据库
+const lastUsedInterval = time.Minute
+
+// 认证失败原因
+var (
+	ErrInvalidAPIKey  = errors.New("API 密钥无效")
+	ErrAPIKeyExpired  = errors.New("API 密钥已过期")
+	ErrIPNotAllowed   = errors.New("客户端 IP 不在 API 密钥的允许列表中")
+	ErrUserInactive   = errors.New("用户账号未激活")
+	ErrScopeForbidden = errors.New("API 密钥权限不足")
+)
+
+// containerWritePrefixes 需要 container:write 的路由前缀
+var containerWritePrefixes = []string{
+	"/api/v1/containers", "/api/system/containers", "/api/container/",
+	"/api/snapshots", "/api/clone", "/api/dns", "/api/exec", "/api/limits",
+	"/api/system/traffic/reset", "/api/quota/reset-traffic", "/api/v1/operations",
+}
+
+// networkWritePrefixes 需要 network:write 的路由前缀
+var networkWritePrefixes = []string{"/api/network/", "/api/certificates"}
+
+// apiKeyContextKey 请求使用的 API 密钥
+const apiKeyContextKey contextKey = "api_key"
+
+// GenerateScopedAPIKey 生成带前缀的新 API 密钥明文
+func GenerateScopedAPIKey() (string, error) {
+	key, err := GenerateAPIKey()
+	if err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + key, nil
+}
+
+// CreateAPIKey 为用户创建新的 API 密钥，返回只在此时可见的明文
+func CreateAPIKey(userID uint, name, scopes, allowedIPs string, expiresAt *time.Time) (string, *models.APIKey, error) {
+	plaintext, err := GenerateScopedAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+	key := &models.APIKey{
+		UserID:     userID,
+		Name:       name,
+		Prefix:     models.APIKeyPrefix(plaintext),
+		KeyHash:    models.HashAPIKey(plaintext),
+		Scopes:     scopes,
+		AllowedIPs: allowedIPs,
+		ExpiresAt:  expiresAt,
+	}
+	if err := models.DB.Create(key).Error; err != nil {
+		return "", nil, err
+	}
+	return plaintext, key, nil
+}
+
+// ParseAllowedIPs 校验并规范化 IP 允许列表（逗号分隔的 IP 或 CIDR）
+func ParseAllowedIPs(allowedIPs string) (string, error) {
+	var result []string
+	for _, entry := range strings.Split(allowedIPs, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return "", fmt.Errorf("无效的 IP 或 CIDR: %s", entry)
+		}
+		result = append(result, entry)
+	}
+	return strings.Join(result, ","), nil
+}
+
+// ParseScopes 解析并校验权限范围（逗号分隔），只有管理员可以授予 admin
+func ParseScopes(scopes string, user *models.User) (string, error) {
+	var result []string
+	seen := make(map[string]bool)
+	for _, scope := range SplitScopes(scopes) {
+		if seen[scope] {
+			continue
+		}
+		valid := false
+		for _, known := range Scopes {
+			if scope == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return "", fmt.Errorf("不支持的权限范围: %s，可选: %s", scope, strings.Join(Scopes, ", "))
+		}
+		if scope == ScopeAdmin && user != nil && !user.IsAdmin() {
+			return "", fmt.Errorf("只有管理员可以授予 admin 权限")
+		}
+		seen[scope] = true
+		result = append(result, scope)
+	}
+	if len(result) == 0 {
+		return "", fmt.Errorf("至少需要一个权限范围")
+	}
+	return strings.Join(result, ","), nil
+}
+
+// SplitScopes 拆分逗号分隔的权限范围
+func SplitScopes(scopes string) []string {
+	var result []string
+	for _, scope := range strings.Split(scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+// RequiredScope 请求所需的权限范围：读请求需要 read，写请求按路由分为 container:write、network:write，其余需要 admin
+func RequiredScope(method, path string) string {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return ScopeRead
+	}
+	for _, prefix := range containerWritePrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return ScopeContainerWrite
+		}
+	}
+	for _, prefix := range networkWritePrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return ScopeNetworkWrite
+		}
+	}
+	return ScopeAdmin
+}
+
+// HasScope 已授予的权限是否满足要求：admin 包含全部权限，任一写权限包含 read
+func HasScope(granted []string, required string) bool {
+	for _, scope := range granted {
+		if scope == ScopeAdmin || scope == required {
+			return true
+		}
+		if required == ScopeRead && strings.HasSuffix(scope, ":write") {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateAPIKey 校验 API 密钥：哈希匹配、未过期、客户端 IP 在允许列表内且用户处于激活状态，并记录最近使用
+func AuthenticateAPIKey(key, clientIP string) (*models.APIKey, *models.User, error) {
+	var apiKey models.APIKey
+	if err := models.DB.Where("key_hash = ?", models.HashAPIKey(key)).First(&apiKey).Error; err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if apiKey.Expired(now) {
+		return nil, nil, ErrAPIKeyExpired
+	}
+	if !apiKey.AllowsIP(clientIP) {
+		return nil, nil, ErrIPNotAllowed
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, apiKey.UserID).Error; err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if !user.IsActive() {
+		return nil, nil, ErrUserInactive
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= lastUsedInterval || apiKey.LastUsedIP != clientIP {
+		models.DB.Model(&apiKey).UpdateColumns(map[string]interface{}{"last_used_at": now, "last_used_ip": clientIP})
+	}
+	return &apiKey, &user, nil
+}
+
+// WithAPIKey 将请求使用的 API 密钥存入上下文
+func WithAPIKey(ctx context.Context, key *models.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey, key)
+}
+
+// GetAPIKeyFromContext 获取请求使用的 API 密钥，使用登录令牌或系统 API Hash 时为 nil
+func GetAPIKeyFromContext(ctx context.Context) *models.APIKey {
+	key, _ := ctx.Value(apiKeyContextKey).(*models.APIKey)
+	return key
+}
@@ -13,7 +13,7 @@ import (
 var (
 	// JWTSecret JWT密钥（生产环境应该从配置文件读取）
 	JWTSecret = []byte("openlxd-secret-key-change-in-production")
-	
+
 	// TokenExpiration Token过期时间
 	TokenExpiration = 24 * time.Hour
 )
@@ -47,16 +47,27 @@ func GenerateAPIKey() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-// GenerateToken 生成JWT Token
+// GenerateToken 生成JWT Token（带随机 jti，可通过黑名单撤销；需要出现在会话列表中时使用 NewSession）
 func GenerateToken(userID uint, username, role string) (string, error) {
+	jti, err := generateJTI()
+	if err != nil {
+		return "", err
+	}
+	return signToken(userID, username, role, jti, time.Now().Add(TokenExpiration))
+}
+
+// signToken 签发JWT Token
+func signToken(userID uint, username, role, jti string, expiresAt time.Time) (string, error) {
+	now := time.Now()
 	claims := Claims{
 		UserID:   userID,
 		Username: username,
 		Role:     role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenExpiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
@@ -64,21 +75,24 @@ func GenerateToken(userID uint, username, role string) (string, error) {
 	return token.SignedString(JWTSecret)
 }
 
-// ParseToken 解析JWT Token
+// ParseToken 解析JWT Token，已撤销或没有 jti 的令牌视为无效
 func ParseToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return JWTSecret, nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid || claims.ID == "" {
+		return nil, errors.New("invalid token")
 	}
-
-	return nil, errors.New("invalid token")
+	if IsTokenRevoked(claims.ID) {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
 }
 
 // ValidatePassword 验证密码强度
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/testutil"
+)
+
+// setupTest 使用临时数据库、默认登录保护配置和空的登录失败计数
+func setupTest(t *testing.T) {
+	t.Helper()
+	testutil.Setup(t, func(cfg *config.Config) {
+		cfg.Security.LoginMaxAttempts = 3
+		cfg.Security.LoginIPMaxAttempts = 100
+		cfg.Security.LoginLockout = 15
+	})
+	GlobalLoginGuard = &LoginGuard{failures: make(map[string]*loginFailure)}
+	resetDenylist()
+}
+
+// resetDenylist 清空黑名单的内存副本，下次使用时从数据库重新加载
+func resetDenylist() {
+	denylist.Lock()
+	denylist.once = sync.Once{}
+	denylist.tokens = nil
+	denylist.Unlock()
+}
+
+// createUser 创建测试用户，secret 非空时启用两步验证
+func createUser(t *testing.T, username, password, secret string) *models.User {
+	t.Helper()
+	hash, err := HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{
+		Username:     username,
+		Email:        username + "@example.com",
+		PasswordHash: hash,
+		Role:         "user",
+		Status:       "active",
+		TOTPSecret:   secret,
+		TOTPEnabled:  secret != "",
+	}
+	if err := models.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// currentCode 当前时间步的验证码
+func currentCode(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := TOTPCode(secret, time.Now().Unix()/totpPeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTOTPCannotBeReplayed(t *testing.T) {
+	setupTest(t)
+	secret, _ := GenerateTOTPSecret()
+	user := createUser(t, "alice", "password123", secret)
+	code := currentCode(t, secret)
+
+	// 请求开始时读取的用户记录（并发请求各自持有旧的 totp_last_step）
+	stale := *user
+	if !UseTOTP(user, code) {
+		t.Fatal("首次使用验证码应通过")
+	}
+	if UseTOTP(user, code) {
+		t.Fatal("同一验证码不能再次通过")
+	}
+	if UseTOTP(&stale, code) {
+		t.Fatal("并发请求中同一验证码只能通过一次")
+	}
+
+	var saved models.User
+	models.DB.First(&saved, user.ID)
+	if saved.TOTPLastStep != user.TOTPLastStep || saved.TOTPLastStep == 0 {
+		t.Fatalf("应记录通过的时间步，实际 %d", saved.TOTPLastStep)
+	}
+
+	if _, _, err := Login("alice", "password123", code, "192.0.2.1"); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("登录时重放验证码应失败，实际 %v", err)
+	}
+}
+
+func TestRecoveryCodeSingleUse(t *testing.T) {
+	setupTest(t)
+	secret, _ := GenerateTOTPSecret()
+	user := createUser(t, "bob", "password123", secret)
+
+	codes, err := GenerateRecoveryCodes(user.ID)
+	if err != nil || len(codes) != recoveryCodeCount {
+		t.Fatalf("生成恢复码失败: %v", err)
+	}
+	if method, ok := VerifySecondFactor(user, codes[0]); !ok || method != LoginMethodRecoveryCode {
+		t.Fatal("恢复码应可以使用一次")
+	}
+	if _, ok := VerifySecondFactor(user, codes[0]); ok {
+		t.Fatal("恢复码使用后应作废")
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	setupTest(t)
+	createUser(t, "carol", "password123", "")
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := Login("carol", "wrong-password", "", "192.0.2.1"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("第 %d 次密码错误应返回 ErrInvalidCredentials，实际 %v", i+1, err)
+		}
+	}
+
+	// 达到上限后即使密码正确也被锁定（换 IP 同样锁定账号）
+	_, _, err := Login("carol", "password123", "", "192.0.2.2")
+	var locked *LockedError
+	if !errors.As(err, &locked) || locked.RetryAfter <= 0 {
+		t.Fatalf("连续失败后账号应被锁定，实际 %v", err)
+	}
+
+	// 锁定期满后恢复
+	GlobalLoginGuard.mu.Lock()
+	for _, f := range GlobalLoginGuard.failures {
+		f.lockedUntil = time.Now().Add(-time.Second)
+	}
+	GlobalLoginGuard.mu.Unlock()
+	if _, _, err := Login("carol", "password123", "", "192.0.2.1"); err != nil {
+		t.Fatalf("锁定期满后应可以登录，实际 %v", err)
+	}
+}
+
+func TestResetToken(t *testing.T) {
+	setupTest(t)
+	user := createUser(t, "dave", "password123", "")
+
+	token := GenerateResetToken(user, time.Hour)
+	parsed, err := ParseResetToken(token)
+	if err != nil || parsed.ID != user.ID {
+		t.Fatalf("有效的重置令牌应通过校验: %v", err)
+	}
+
+	if _, err := ParseResetToken(GenerateResetToken(user, -time.Minute)); err != ErrInvalidResetToken {
+		t.Fatal("过期的重置令牌应失效")
+	}
+	if _, err := ParseResetToken(token + "x"); err != ErrInvalidResetToken {
+		t.Fatal("签名被篡改的重置令牌应失效")
+	}
+
+	// 密码修改后旧链接失效
+	hash, _ := HashPassword("new-password")
+	models.DB.Model(user).Update("password_hash", hash)
+	if _, err := ParseResetToken(token); err != ErrInvalidResetToken {
+		t.Fatal("密码修改后旧的重置令牌应失效")
+	}
+}
+
+func TestRevokedTokenDenylist(t *testing.T) {
+	setupTest(t)
+	user := createUser(t, "erin", "password123", "")
+
+	token, session, err := NewSession(user, "192.0.2.1", "test", LoginMethodPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := NewSession(user, "192.0.2.1", "test", LoginMethodPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseToken(token); err != nil {
+		t.Fatalf("新签发的令牌应有效: %v", err)
+	}
+
+	var observed string
+	TokenRevokedObserver = func(jti string) { observed = jti }
+	defer func() { TokenRevokedObserver = nil }()
+
+	if err := RevokeSession(session); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseToken(token); err != ErrTokenRevoked {
+		t.Fatalf("撤销后的令牌应失效，实际 %v", err)
+	}
+	if observed != session.JTI {
+		t.Fatal("撤销令牌时应通知关闭实时连接")
+	}
+	if _, err := ParseToken(other); err != nil {
+		t.Fatalf("未撤销的会话不受影响: %v", err)
+	}
+
+	// 黑名单持久化在数据库中，重启后仍然有效
+	resetDenylist()
+	if _, err := ParseToken(token); err != ErrTokenRevoked {
+		t.Fatalf("重新加载黑名单后撤销的令牌仍应失效，实际 %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// 登录失败原因
+var (
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	ErrTwoFactorRequired  = errors.New("需要两步验证码")
+	ErrInvalidOTP         = errors.New("两步验证码错误")
+	ErrInvalidResetToken  = errors.New("重置链接无效或已过期")
+)
+
+// 登录方式，记录在会话中
+const (
+	LoginMethodPassword     = "password"
+	LoginMethodTOTP         = "totp"
+	LoginMethodRecoveryCode = "recovery_code"
+	LoginMethodOIDC         = "oidc"
+)
+
+// recoveryCodeCount 每次生成的恢复码数量
+const recoveryCodeCount = 10
+
+// dummyPasswordHash 用户不存在时参与比对的哈希，使响应时间与用户存在时一致
+var dummyPasswordHash, _ = HashPassword("openlxd-dummy-password")
+
+// LockedError 账号或 IP 因连续登录失败被锁定
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	minutes := int(e.RetryAfter.Minutes()) + 1
+	return fmt.Sprintf("登录失败次数过多，请 %d 分钟后再试", minutes)
+}
+
+// loginFailure 失败计数
+type loginFailure struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+// LoginGuard 按账号和 IP 统计连续登录失败次数，超过上限后锁定
+type LoginGuard struct {
+	mu       sync.Mutex
+	failures map[string]*loginFailure
+}
+
+// GlobalLoginGuard 全局登录保护
+var GlobalLoginGuard = &LoginGuard{failures: make(map[string]*loginFailure)}
+
+// guardKeys 账号和 IP 的计数键及各自的失败上限
+func guardKeys(username, ip string) map[string]int {
+	cfg := config.GetConfig().Security
+	return map[string]int{
+		"user:" + strings.ToLower(username): cfg.LoginMaxAttempts,
+		"ip:" + ip:                          cfg.LoginIPMaxAttempts,
+	}
+}
+
+// lockout 锁定时长，同时作为失败计数的统计窗口
+func lockout() time.Duration {
+	return time.Duration(config.GetConfig().Security.LoginLockout) * time.Minute
+}
+
+// Check 账号或 IP 是否处于锁定状态
+func (g *LoginGuard) Check(username, ip string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for key := range guardKeys(username, ip) {
+		if f, ok := g.failures[key]; ok && now.Before(f.lockedUntil) {
+			return &LockedError{RetryAfter: f.lockedUntil.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// Fail 记录一次登录失败，达到上限时锁定
+func (g *LoginGuard) Fail(username, ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	window := lockout()
+	for key, limit := range guardKeys(username, ip) {
+		f, ok := g.failures[key]
+		if !ok || now.Sub(f.first) > window {
+			f = &loginFailure{first: now}
+			g.failures[key] = f
+		}
+		f.count++
+		if limit > 0 && f.count >= limit {
+			f.lockedUntil = now.Add(window)
+			f.count = 0
+			f.first = now
+		}
+	}
+
+	// 清理过期的计数
+	for key, f := range g.failures {
+		if now.Sub(f.first) > window && now.After(f.lockedUntil) {
+			delete(g.failures, key)
+		}
+	}
+}
+
+// Reset 登录成功或重置密码后清除账号的失败计数（IP 计数保留，避免撞库时用自己的账号解锁）
+func (g *LoginGuard) Reset(username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.failures, "user:"+strings.ToLower(username))
+}
+
+// Login 校验用户名、密码和两步验证码（启用两步验证时，otp 可以是验证码或恢复码），返回用户和登录方式
+func Login(username, password, otp, ip string) (*models.User, string, error) {
+	if err := GlobalLoginGuard.Check(username, ip); err != nil {
+		return nil, "", err
+	}
+
+	var user models.User
+	if err := models.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		CheckPasswordHash(password, dummyPasswordHash)
+		GlobalLoginGuard.Fail(username, ip)
+		return nil, "", ErrInvalidCredentials
+	}
+	if !CheckPasswordHash(password, user.PasswordHash) {
+		GlobalLoginGuard.Fail(username, ip)
+		return nil, "", ErrInvalidCredentials
+	}
+	if !user.IsActive() {
+		return nil, "", ErrUserInactive
+	}
+
+	method := LoginMethodPassword
+	if user.TOTPEnabled {
+		if strings.TrimSpace(otp) == "" {
+			return nil, "", ErrTwoFactorRequired
+		}
+		var ok bool
+		if method, ok = VerifySecondFactor(&user, otp); !ok {
+			GlobalLoginGuard.Fail(username, ip)
+			return nil, "", ErrInvalidOTP
+		}
+	}
+
+	GlobalLoginGuard.Reset(username)
+	return &user, method, nil
+}
+
+// VerifySecondFactor 校验验证码（6 位数字）或恢复码，恢复码使用后作废
+func VerifySecondFactor(user *models.User, otp string) (string, bool) {
+	otp = strings.TrimSpace(otp)
+	if UseTOTP(user, otp) {
+		return LoginMethodTOTP, true
+	}
+	if useRecoveryCode(user.ID, otp) {
+		return LoginMethodRecoveryCode, true
+	}
+	return "", false
+}
+
+// UseTOTP 校验验证码并记录时间步，同一验证码只能通过一次（并发请求中也只有一个成功）
+func UseTOTP(user *models.User, code string) bool {
+	step, ok := ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return false
+	}
+	result := models.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		UpdateColumn("totp_last_step", step)
+	if result.Error != nil || result.RowsAffected != 1 {
+		return false
+	}
+	user.TOTPLastStep = step
+	return true
+}
+
+// normalizeRecoveryCode 恢复码忽略大小写、空格和连字符
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
+
+// useRecoveryCode 使用一个未使用的恢复码
+func useRecoveryCode(userID uint, code string) bool {
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return false
+	}
+	result := models.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, models.HashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// GenerateRecoveryCodes 为用户生成新的恢复码（旧恢复码全部作废），返回明文
+func GenerateRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(b)
+		codes = append(codes, code[:5]+"-"+code[5:])
+		rows = append(rows, models.RecoveryCode{UserID: userID, CodeHash: models.HashRecoveryCode(code)})
+	}
+
+	// 旧恢复码在新恢复码写入成功后才作废
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// resetSignature 密码重置令牌的签名，包含当前密码哈希，密码修改后旧链接自动失效
+func resetSignature(user *models.User, expires int64) []byte {
+	mac := hmac.New(sha256.New, JWTSecret)
+	fmt.Fprintf(mac, "password-reset\n%d\n%d\n%s", user.ID, expires, user.PasswordHash)
+	return mac.Sum(nil)
+}
+
+// GenerateResetToken 生成密码重置令牌：用户ID.过期时间.签名
+func GenerateResetToken(user *models.User, ttl time.Duration) string {
+	expires := time.Now().Add(ttl).Unix()
+	signature := base64.RawURLEncoding.EncodeToString(resetSignature(user, expires))
+	return fmt.Sprintf("%d.%d.%s", user.ID, expires, signature)
+}
+
+// ParseResetToken 校验密码重置令牌，返回对应的用户
+func ParseResetToken(token string) (*models.User, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidResetToken
+	}
+	userID, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return nil, ErrInvalidResetToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return nil, ErrInvalidResetToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidResetToken
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, userID).Error; err != nil {
+		return nil, ErrInvalidResetToken
+	}
+	if !hmac.Equal(signature, resetSignature(&user, expires)) {
+		return nil, ErrInvalidResetToken
+	}
+	return &user, nil
+}
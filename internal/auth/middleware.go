@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/openlxd/backend/internal/audit"
 	"github.com/openlxd/backend/internal/models"
 	"gorm.io/gorm"
 )
@@ -63,35 +64,37 @@ func AuthMiddleware(db *gorm.DB) func(http.Handler) http.Handler {
 	}
 }
 
-	// APIKeyMiddleware API Key认证中间件（兼容lxdapi的X-API-Hash）
-	func APIKeyMiddleware(db *gorm.DB) func(http.Handler) http.Handler {
-		return func(next http.Handler) http.Handler {
-			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				// 从请求头获取API Key（兼容X-API-Key和X-API-Hash）
-				apiKey := r.Header.Get("X-API-Key")
-				if apiKey == "" {
-					apiKey = r.Header.Get("X-API-Hash")
-				}
-				if apiKey == "" {
-					respondError(w, "Missing API key", http.StatusUnauthorized)
-					return
-				}
-
-			// 从数据库查找用户
-			var user models.User
-			if err := db.Where("api_key = ?", apiKey).First(&user).Error; err != nil {
-				respondError(w, "Invalid API key", http.StatusUnauthorized)
+// APIKeyMiddleware API Key认证中间件（兼容lxdapi的X-API-Hash）
+func APIKeyMiddleware(db *gorm.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 从请求头获取API Key（兼容X-API-Key和X-API-Hash）
+			apiKey := r.Header.Get("X-API-Key")
+			if apiKey == "" {
+				apiKey = r.Header.Get("X-API-Hash")
+			}
+			if apiKey == "" {
+				respondError(w, "Missing API key", http.StatusUnauthorized)
 				return
 			}
 
-			// 检查用户状态
-			if !user.IsActive() {
-				respondError(w, "User account is not active", http.StatusForbidden)
+			// 校验API Key及其权限范围
+			key, user, err := AuthenticateAPIKey(apiKey, audit.ClientIP(r))
+			if err != nil {
+				status := http.StatusUnauthorized
+				if err == ErrIPNotAllowed || err == ErrUserInactive {
+					status = http.StatusForbidden
+				}
+				respondError(w, err.Error(), status)
+				return
+			}
+			if !HasScope(SplitScopes(key.Scopes), RequiredScope(r.Method, r.URL.Path)) {
+				respondError(w, ErrScopeForbidden.Error(), http.StatusForbidden)
 				return
 			}
 
 			// 将用户信息存入上下文
-			ctx := context.WithValue(r.Context(), UserContextKey, &user)
+			ctx := WithAPIKey(context.WithValue(r.Context(), UserContextKey, user), key)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/openlxd/backend/internal/models"
+)
+
+// ErrTokenRevoked 令牌已被撤销（退出登录、撤销会话或重置密码）
+var ErrTokenRevoked = errors.New("登录令牌已被撤销")
+
+// claimsContextKey 当前请求的登录令牌
+const claimsContextKey contextKey = "claims"
+
+// TokenRevokedObserver 令牌撤销时的回调（由事件推送模块设置，用于关闭该令牌的实时连接）
+var TokenRevokedObserver func(jti string)
+
+// denylist 已撤销令牌的内存副本（jti -> 过期时间），首次使用时从数据库加载
+var denylist struct {
+	sync.RWMutex
+	once   sync.Once
+	tokens map[string]time.Time
+}
+
+// generateJTI 生成令牌 ID
+func generateJTI() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewSession 为用户签发登录令牌并记录会话
+func NewSession(user *models.User, ip, userAgent, method string) (string, *models.UserSession, error) {
+	jti, err := generateJTI()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	session := &models.UserSession{
+		UserID:    user.ID,
+		JTI:       jti,
+		IP:        ip,
+		UserAgent: userAgent,
+		Method:    method,
+		ExpiresAt: time.Now().Add(TokenExpiration),
+	}
+	token, err := signToken(user.ID, user.Username, user.Role, jti, session.ExpiresAt)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := models.DB.Create(session).Error; err != nil {
+		return "", nil, err
+	}
+	return token, session, nil
+}
+
+// ActiveSessions 用户未过期且未撤销的会话
+func ActiveSessions(userID uint) ([]models.UserSession, error) {
+	var sessions []models.UserSession
+	err := models.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("id DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeSession 撤销会话：标记会话并将其令牌加入黑名单
+func RevokeSession(session *models.UserSession) error {
+	now := time.Now()
+	if err := models.DB.Model(session).Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return RevokeToken(session.JTI, session.UserID, session.ExpiresAt)
+}
+
+// RevokeUserSessions 撤销用户的全部会话，exceptJTI 非空时保留该会话（如当前会话）
+func RevokeUserSessions(userID uint, exceptJTI string) (int, error) {
+	sessions, err := ActiveSessions(userID)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for i := range sessions {
+		if sessions[i].JTI == exceptJTI {
+			continue
+		}
+		if err := RevokeSession(&sessions[i]); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// RevokeToken 将令牌加入黑名单，并顺带清理已过期的黑名单记录
+func RevokeToken(jti string, userID uint, expiresAt time.Time) error {
+	loadDenylist()
+	entry := models.RevokedToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt}
+	if err := models.DB.Where(models.RevokedToken{JTI: jti}).FirstOrCreate(&entry).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	models.DB.Where("expires_at < ?", now).Delete(&models.RevokedToken{})
+
+	denylist.Lock()
+	denylist.tokens[jti] = expiresAt
+	for id, expiry := range denylist.tokens {
+		if expiry.Before(now) {
+			delete(denylist.tokens, id)
+		}
+	}
+	denylist.Unlock()
+
+	if TokenRevokedObserver != nil {
+		TokenRevokedObserver(jti)
+	}
+	return nil
+}
+
+// IsTokenRevoked 令牌是否在黑名单中
+func IsTokenRevoked(jti string) bool {
+	loadDenylist()
+	denylist.RLock()
+	defer denylist.RUnlock()
+	_, revoked := denylist.tokens[jti]
+	return revoked
+}
+
+// loadDenylist 从数据库加载未过期的黑名单
+func loadDenylist() {
+	denylist.once.Do(func() {
+		denylist.tokens = make(map[string]time.Time)
+		if models.DB == nil {
+			return
+		}
+		var tokens []models.RevokedToken
+		models.DB.Where("expires_at > ?", time.Now()).Find(&tokens)
+		for _, token := range tokens {
+			denylist.tokens[token.JTI] = token.ExpiresAt
+		}
+	})
+}
+
+// WithClaims 将登录令牌存入上下文
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
+// GetClaimsFromContext 获取当前请求的登录令牌，使用 API 密钥时为 nil
+func GetClaimsFromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(claimsContextKey).(*Claims)
+	return claims
+}
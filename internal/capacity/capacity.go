@@ -0,0 +1,271 @@
+package capacity
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/lxd"
+	"github.com/openlxd/backend/internal/models"
+)
+
+// LXD 的 MB/GB 为十进制单位
+const (
+	bytesPerMB = int64(1000 * 1000)
+	bytesPerGB = int64(1000 * 1000 * 1000)
+)
+
+// Resource 单项资源的容量
+type Resource struct {
+	Physical    float64 `json:"physical"`    // 物理容量
+	Ratio       float64 `json:"ratio"`       // 超售比
+	Allocatable float64 `json:"allocatable"` // 可分配总量 = (物理容量 - 保留) × 超售比
+	Allocated   float64 `json:"allocated"`   // 已分配给容器
+	Free        float64 `json:"free"`        // 剩余可分配
+	Usage       float64 `json:"usage"`       // 已分配 / 可分配（%）
+	Available   bool    `json:"available"`   // 是否成功获取物理容量
+}
+
+// Report 节点容量报告
+type Report struct {
+	Node        string   `json:"node"`
+	Enabled     bool     `json:"enabled"`
+	Containers  int      `json:"containers"`
+	CPU         Resource `json:"cpu"`    // 核心
+	Memory      Resource `json:"memory"` // MB
+	Disk        Resource `json:"disk"`   // GB
+	StoragePool string   `json:"storage_pool"`
+}
+
+// Manager 容量管理器
+type Manager struct {
+	mu sync.Mutex
+}
+
+var GlobalManager = &Manager{}
+
+// GetReports 获取所有已连接节点的容量报告
+func (m *Manager) GetReports() []*Report {
+	var reports []*Report
+	for _, node := range lxd.NodeNames() {
+		reports = append(reports, m.GetNodeReport(node))
+	}
+	return reports
+}
+
+// GetNodeReport 汇总节点的物理资源、超售策略和已分配资源
+func (m *Manager) GetNodeReport(node string) *Report {
+	if node == "" {
+		node = lxd.LocalNode
+	}
+
+	cfg := config.GlobalConfig.Capacity
+	report := &Report{
+		Node:        node,
+		Enabled:     cfg.Enabled,
+		StoragePool: cfg.StoragePool,
+	}
+
+	var totals struct {
+		Containers int
+		CPUs       int
+		Memory     int
+		Disk       int
+	}
+	models.DB.Model(&models.Container{}).
+		Select("COUNT(*) AS containers, COALESCE(SUM(cpus), 0) AS cpus, COALESCE(SUM(memory), 0) AS memory, COALESCE(SUM(disk), 0) AS disk").
+		Where("node = ?", node).
+		Scan(&totals)
+	report.Containers = totals.Containers
+
+	report.CPU = Resource{Ratio: cfg.CPURatio, Allocated: float64(totals.CPUs)}
+	report.Memory = Resource{Ratio: cfg.MemoryRatio, Allocated: float64(totals.Memory)}
+	if cpus, memory, err := physicalResources(node); err == nil {
+		report.CPU.Physical = float64(cpus)
+		report.CPU.Available = true
+		report.Memory.Physical = float64(memory)
+		report.Memory.Available = true
+	}
+
+	report.Disk = Resource{Ratio: cfg.DiskRatio, Allocated: float64(totals.Disk)}
+	if disk, err := storagePoolGB(node, cfg.StoragePool); err == nil {
+		report.Disk.Physical = disk
+		report.Disk.Available = true
+	}
+
+	report.CPU.calculate(0)
+	report.Memory.calculate(float64(cfg.ReserveMemory))
+	report.Disk.calculate(0)
+
+	return report
+}
+
+// calculate 计算可分配、剩余和使用率
+func (r *Resource) calculate(reserve float64) {
+	if !r.Available {
+		return
+	}
+	physical := r.Physical - reserve
+	if physical < 0 {
+		physical = 0
+	}
+	r.Allocatable = physical * r.Ratio
+	r.Free = r.Allocatable - r.Allocated
+	if r.Allocatable > 0 {
+		r.Usage = r.Allocated / r.Allocatable * 100
+	}
+}
+
+// AddAllocated 将尚未写入数据库的分配（如进行中的迁移）计入报告
+func (r *Report) AddAllocated(cpus, memory, disk int) {
+	r.CPU.Allocated += float64(cpus)
+	r.Memory.Allocated += float64(memory)
+	r.Disk.Allocated += float64(disk)
+
+	cfg := config.GlobalConfig.Capacity
+	r.CPU.calculate(0)
+	r.Memory.calculate(float64(cfg.ReserveMemory))
+	r.Disk.calculate(0)
+}
+
+// CheckAdmission 检查在节点上新建容器（创建、克隆）是否超出容量策略
+// memory 单位 MB，disk 单位 GB
+func (m *Manager) CheckAdmission(node string, cpus, memory, disk int) error {
+	if !config.GlobalConfig.Capacity.Enabled {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return Check(m.GetNodeReport(node), cpus, memory, disk)
+}
+
+// CheckResize 检查调整容器规格后是否超出容量策略（值为 0 表示不修改，缩小规格时不受限制）
+func (m *Manager) CheckResize(containerID uint, cpus, memory, disk int) error {
+	if !config.GlobalConfig.Capacity.Enabled {
+		return nil
+	}
+
+	var container models.Container
+	if err := models.DB.First(&container, containerID).Error; err != nil {
+		return nil
+	}
+
+	delta := func(newValue, current int) int {
+		if newValue <= 0 {
+			return 0
+		}
+		return newValue - current
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return Check(m.GetNodeReport(container.Node),
+		delta(cpus, container.CPUs), delta(memory, container.Memory), delta(disk, container.Disk))
+}
+
+// Check 检查新增资源是否超过节点剩余可分配量
+func Check(report *Report, cpus, memory, disk int) error {
+	if cpus > 0 && report.CPU.Available && float64(cpus) > report.CPU.Free {
+		return fmt.Errorf("节点 %s CPU 容量不足 (已分配: %.0f 核, 需要: %d 核, 可分配: %.0f 核, 超售比: %.2f)",
+			report.Node, report.CPU.Allocated, cpus, report.CPU.Allocatable, report.CPU.Ratio)
+	}
+	if memory > 0 && report.Memory.Available && float64(memory) > report.Memory.Free {
+		return fmt.Errorf("节点 %s 内存容量不足 (已分配: %.0f MB, 需要: %d MB, 可分配: %.0f MB, 超售比: %.2f)",
+			report.Node, report.Memory.Allocated, memory, report.Memory.Allocatable, report.Memory.Ratio)
+	}
+	if disk > 0 && report.Disk.Available && float64(disk) > report.Disk.Free {
+		return fmt.Errorf("节点 %s 存储池 %s 容量不足 (已分配: %.0f GB, 需要: %d GB, 可分配: %.0f GB, 超售比: %.2f)",
+			report.Node, report.StoragePool, report.Disk.Allocated, disk, report.Disk.Allocatable, report.Disk.Ratio)
+	}
+	return nil
+}
+
+// physicalResources 获取节点的 CPU 核心数和内存（MB）
+// 本机节点读取 /proc，远程节点通过 LXD 资源接口获取
+func physicalResources(node string) (int, int64, error) {
+	if node == lxd.LocalNode {
+		cpus, err := physicalCPUs()
+		if err != nil {
+			return 0, 0, err
+		}
+		memory, err := physicalMemoryMB()
+		if err != nil {
+			return 0, 0, err
+		}
+		return cpus, memory, nil
+	}
+
+	client, err := lxd.NodeClient(node)
+	if err != nil {
+		return 0, 0, err
+	}
+	resources, err := client.GetServerResources()
+	if err != nil {
+		return 0, 0, fmt.Errorf("获取节点 %s 资源失败: %v", node, err)
+	}
+	return int(resources.CPU.Total), int64(resources.Memory.Total) / bytesPerMB, nil
+}
+
+// physicalCPUs 从 /proc/stat 统计逻辑 CPU 数量
+func physicalCPUs() (int, error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && strings.HasPrefix(fields[0], "cpu") && fields[0] != "cpu" {
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("无法读取CPU信息")
+	}
+	return count, nil
+}
+
+// physicalMemoryMB 从 /proc/meminfo 读取物理内存（MB）
+func physicalMemoryMB() (int64, error) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb * 1024 / bytesPerMB, nil
+		}
+	}
+	return 0, fmt.Errorf("无法读取内存信息")
+}
+
+// storagePoolGB 获取节点 LXD 存储池总容量（GB）
+func storagePoolGB(node, pool string) (float64, error) {
+	client, err := lxd.NodeClient(node)
+	if err != nil {
+		return 0, err
+	}
+	resources, err := client.GetStoragePoolResources(pool)
+	if err != nil {
+		return 0, fmt.Errorf("获取存储池 %s 容量失败: %v", pool, err)
+	}
+	return float64(resources.Space.Total) / float64(bytesPerGB), nil
+}
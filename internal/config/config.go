@@ -11,27 +11,109 @@ import (
 // Config 配置结构
 type Config struct {
 	Server struct {
-		Port       int    `yaml:"port"`
-		Host       string `yaml:"host"`
-		HTTPS      bool   `yaml:"https"`
-		Domain     string `yaml:"domain"`
-		CertDir    string `yaml:"cert_dir"`
-		AutoTLS    bool   `yaml:"auto_tls"`
+		Port    int    `yaml:"port"`
+		Host    string `yaml:"host"`
+		HTTPS   bool   `yaml:"https"`
+		Domain  string `yaml:"domain"`
+		CertDir string `yaml:"cert_dir"`
+		AutoTLS bool   `yaml:"auto_tls"`
 	} `yaml:"server"`
 	Security struct {
 		APIHash       string `yaml:"api_hash"`
+		APIHashScopes string `yaml:"api_hash_scopes"` // 系统 API Hash 的权限范围（逗号分隔），api_hash 为空时禁用
 		AdminUser     string `yaml:"admin_user"`
 		AdminPass     string `yaml:"admin_pass"`
-		SessionSecret string `yaml:"session_secret"`
+		SessionSecret string `yaml:"session_secret"` // 登录令牌和密码重置链接的签名密钥
+
+		LoginMaxAttempts   int    `yaml:"login_max_attempts"`    // 同一账号连续登录失败多少次后锁定
+		LoginIPMaxAttempts int    `yaml:"login_ip_max_attempts"` // 同一 IP 连续登录失败多少次后锁定
+		LoginLockout       int    `yaml:"login_lockout"`         // 锁定时长（分钟），同时作为失败计数的统计窗口
+		ResetTokenTTL      int    `yaml:"reset_token_ttl"`       // 密码重置链接有效期（分钟）
+		ResetURL           string `yaml:"reset_url"`             // 密码重置页面地址，为空时根据 server 配置生成
 	} `yaml:"security"`
 	Database struct {
 		Type string `yaml:"type"`
 		Path string `yaml:"path"`
 	} `yaml:"database"`
 	LXD struct {
-		Socket string `yaml:"socket"`
-		Bridge string `yaml:"bridge"`
+		Socket       string `yaml:"socket"`
+		Bridge       string `yaml:"bridge"`
+		MirrorLabels bool   `yaml:"mirror_labels"` // 容器标签和备注同步写入 LXD user.* 配置
 	} `yaml:"lxd"`
+	ACME struct {
+		Email       string            `yaml:"email"`
+		Directory   string            `yaml:"directory"`    // ACME 目录地址
+		Challenge   string            `yaml:"challenge"`    // http-01, dns-01
+		Webroot     string            `yaml:"webroot"`      // HTTP-01 验证文件目录
+		HTTPListen  string            `yaml:"http_listen"`  // 独立 HTTP-01 监听地址，为空则不启动
+		DNSProvider string            `yaml:"dns_provider"` // exec, httpreq
+		DNSConfig   map[string]string `yaml:"dns_config"`
+		RenewBefore int               `yaml:"renew_before"` // 到期前多少天续期
+		CACert      string            `yaml:"ca_cert"`      // 自定义 CA 根证书（如 Pebble 测试）
+		Insecure    bool              `yaml:"insecure"`     // 跳过 ACME 服务器证书校验（仅测试）
+	} `yaml:"acme"`
+	Proxy struct {
+		Backend        string `yaml:"backend"`         // nginx, builtin
+		HTTPListen     string `yaml:"http_listen"`     // 内置代理 HTTP 监听地址
+		HTTPSListen    string `yaml:"https_listen"`    // 内置代理 HTTPS 监听地址
+		ReloadInterval int    `yaml:"reload_interval"` // 内置代理从数据库重载配置的间隔（秒）
+	} `yaml:"proxy"`
+	Capacity struct {
+		Enabled       bool    `yaml:"enabled"`        // 是否启用准入控制
+		CPURatio      float64 `yaml:"cpu_ratio"`      // CPU 超售比
+		MemoryRatio   float64 `yaml:"memory_ratio"`   // 内存超售比
+		DiskRatio     float64 `yaml:"disk_ratio"`     // 磁盘超售比
+		ReserveMemory int     `yaml:"reserve_memory"` // 为宿主机保留的内存（MB）
+		StoragePool   string  `yaml:"storage_pool"`   // 计算磁盘容量的存储池
+	} `yaml:"capacity"`
+	Monitor struct {
+		Interval        int `yaml:"interval"`         // 采集间隔（秒）
+		RawRetention    int `yaml:"raw_retention"`    // 原始数据保留时间（小时）
+		Rollup5mDays    int `yaml:"rollup_5m_days"`   // 5 分钟汇总保留天数
+		Rollup1hDays    int `yaml:"rollup_1h_days"`   // 1 小时汇总保留天数
+		CompactInterval int `yaml:"compact_interval"` // 降采样任务间隔（秒）
+	} `yaml:"monitor"`
+	Metrics struct {
+		Enabled     bool   `yaml:"enabled"`      // 是否开放 /metrics
+		ScrapeToken string `yaml:"scrape_token"` // Prometheus 采集令牌，与 API Key 分开
+	} `yaml:"metrics"`
+	Alert struct {
+		Enabled          bool   `yaml:"enabled"`           // 是否启用告警规则评估
+		EvaluateInterval int    `yaml:"evaluate_interval"` // 规则评估间隔（秒）
+		SMTPHost         string `yaml:"smtp_host"`         // 邮件通知使用的 SMTP 服务器
+		SMTPPort         int    `yaml:"smtp_port"`
+		SMTPUsername     string `yaml:"smtp_username"` // 为空时不进行认证
+		SMTPPassword     string `yaml:"smtp_password"`
+		SMTPFrom         string `yaml:"smtp_from"`
+		TelegramAPI      string `yaml:"telegram_api"` // Telegram Bot API 地址，可指向兼容的本地服务
+	} `yaml:"alert"`
+	Webhook struct {
+		MaxAttempts int `yaml:"max_attempts"` // 投递失败后的最大尝试次数
+		Timeout     int `yaml:"timeout"`      // 单次投递超时（秒）
+	} `yaml:"webhook"`
+	OIDC struct {
+		Enabled       bool   `yaml:"enabled"` // 是否启用 OIDC 单点登录
+		Issuer        string `yaml:"issuer"`  // 身份提供方地址，通过 /.well-known/openid-configuration 发现端点
+		ClientID      string `yaml:"client_id"`
+		ClientSecret  string `yaml:"client_secret"`  // 为空时按公共客户端处理（仅依赖 PKCE）
+		RedirectURL   string `yaml:"redirect_url"`   // 回调地址，需在身份提供方登记，如 https://panel.example.com/api/v1/users/oidc/callback
+		Scopes        string `yaml:"scopes"`         // 申请的 scope（空格分隔）
+		UsernameClaim string `yaml:"username_claim"` // 作为用户名的 claim
+		RoleClaim     string `yaml:"role_claim"`     // 用于角色映射的 claim（字符串或字符串数组，如 groups）
+		AdminValues   string `yaml:"admin_values"`   // role_claim 包含其中任一值（逗号分隔）时为管理员
+		UserValues    string `yaml:"user_values"`    // role_claim 包含其中任一值时为普通用户，为空时其余用户均可登录
+		AutoProvision bool   `yaml:"auto_provision"` // 首次登录时自动创建用户，关闭时只允许已关联或邮箱匹配的用户登录
+	} `yaml:"oidc"`
+	RateLimit struct {
+		Enabled     bool   `yaml:"enabled"`     // 是否启用请求限流（令牌桶）
+		AuthRate    int    `yaml:"auth_rate"`   // 登录、注册、找回密码等接口及认证失败每分钟次数（按 IP），0 为不限
+		AuthBurst   int    `yaml:"auth_burst"`  // 突发容量，0 时等于每分钟请求数
+		MutateRate  int    `yaml:"mutate_rate"` // 写操作和命令执行每分钟请求数（按 API Key、用户或 IP）
+		MutateBurst int    `yaml:"mutate_burst"`
+		ReadRate    int    `yaml:"read_rate"` // 只读请求每分钟请求数
+		ReadBurst   int    `yaml:"read_burst"`
+		ExemptIPs   string `yaml:"exempt_ips"` // 不限流的 IP 或 CIDR（逗号分隔），如 WHMCS 服务器
+	} `yaml:"rate_limit"`
 }
 
 var GlobalConfig Config
@@ -40,15 +122,16 @@ var GlobalConfig Config
 func LoadConfig() error {
 	// 按优先级尝试多个配置文件路径
 	configPaths := []string{
-		"./config.yaml",              // 当前目录（最高优先级）
-		"configs/config.yaml",        // 开发环境路径
-		"/etc/openlxd/config.yaml",  // 生产环境路径
-		"/opt/openlxd/config.yaml",   // 备用路径
+		"./config.yaml",            // 当前目录（最高优先级）
+		"configs/config.yaml",      // 开发环境路径
+		"/etc/openlxd/config.yaml", // 生产环境路径
+		"/opt/openlxd/config.yaml", // 备用路径
 	}
 
 	for _, path := range configPaths {
 		data, err := os.ReadFile(path)
 		if err == nil {
+			setSwitchDefaults()
 			if err := yaml.Unmarshal(data, &GlobalConfig); err != nil {
 				return fmt.Errorf("配置文件解析失败 (%s): %v", path, err)
 			}
@@ -61,12 +144,12 @@ func LoadConfig() error {
 	// 未找到配置文件，使用默认配置并创建配置文件
 	log.Println("未找到配置文件，使用默认配置")
 	loadDefaultConfig()
-	
+
 	// 尝试创建默认配置文件
 	if err := createDefaultConfigFile("./config.yaml"); err != nil {
 		log.Printf("警告: 无法创建配置文件: %v", err)
 	}
-	
+
 	return nil
 }
 
@@ -75,7 +158,6 @@ func GetConfig() *Config {
 	return &GlobalConfig
 }
 
-
 // loadDefaultConfig 加载默认配置
 func loadDefaultConfig() {
 	GlobalConfig.Server.Port = 8443
@@ -84,23 +166,89 @@ func loadDefaultConfig() {
 	GlobalConfig.Server.Domain = "localhost"
 	GlobalConfig.Server.CertDir = "./certs"
 	GlobalConfig.Server.AutoTLS = false
-	
+
 	GlobalConfig.Security.APIHash = "default-api-key-please-change"
+	GlobalConfig.Security.APIHashScopes = "admin"
 	GlobalConfig.Security.AdminUser = "admin"
 	GlobalConfig.Security.AdminPass = "admin123"
 	GlobalConfig.Security.SessionSecret = "default-secret-please-change"
-	
+	GlobalConfig.Security.LoginMaxAttempts = 5
+	GlobalConfig.Security.LoginIPMaxAttempts = 20
+	GlobalConfig.Security.LoginLockout = 15
+	GlobalConfig.Security.ResetTokenTTL = 30
+
 	GlobalConfig.Database.Type = "sqlite"
 	GlobalConfig.Database.Path = "./openlxd.db"
-	
+
 	GlobalConfig.LXD.Socket = "/var/snap/lxd/common/lxd/unix.socket"
 	GlobalConfig.LXD.Bridge = "lxdbr0"
-	
+
+	GlobalConfig.ACME.Directory = "https://acme-v02.api.letsencrypt.org/directory"
+	GlobalConfig.ACME.Challenge = "http-01"
+	GlobalConfig.ACME.Webroot = "/var/lib/openlxd/acme-webroot"
+	GlobalConfig.ACME.RenewBefore = 30
+
+	GlobalConfig.Proxy.Backend = "nginx"
+	GlobalConfig.Proxy.HTTPListen = ":80"
+	GlobalConfig.Proxy.HTTPSListen = ":443"
+	GlobalConfig.Proxy.ReloadInterval = 30
+
+	GlobalConfig.Capacity.Enabled = true
+	GlobalConfig.Capacity.CPURatio = 4
+	GlobalConfig.Capacity.MemoryRatio = 1
+	GlobalConfig.Capacity.DiskRatio = 1
+	GlobalConfig.Capacity.ReserveMemory = 512
+	GlobalConfig.Capacity.StoragePool = "default"
+
+	GlobalConfig.Monitor.Interval = 60
+	GlobalConfig.Monitor.RawRetention = 48
+	GlobalConfig.Monitor.Rollup5mDays = 30
+	GlobalConfig.Monitor.Rollup1hDays = 365
+	GlobalConfig.Monitor.CompactInterval = 300
+
+	GlobalConfig.Metrics.Enabled = false
+
+	GlobalConfig.Alert.Enabled = true
+	GlobalConfig.Alert.EvaluateInterval = 60
+	GlobalConfig.Alert.SMTPPort = 25
+	GlobalConfig.Alert.TelegramAPI = "https://api.telegram.org"
+
+	GlobalConfig.Webhook.MaxAttempts = 8
+	GlobalConfig.Webhook.Timeout = 10
+
+	GlobalConfig.OIDC.Scopes = "openid profile email"
+	GlobalConfig.OIDC.UsernameClaim = "preferred_username"
+	GlobalConfig.OIDC.RoleClaim = "groups"
+	GlobalConfig.OIDC.AutoProvision = true
+
+	GlobalConfig.RateLimit.Enabled = true
+	GlobalConfig.RateLimit.AuthRate = 10
+	GlobalConfig.RateLimit.AuthBurst = 10
+	GlobalConfig.RateLimit.MutateRate = 60
+	GlobalConfig.RateLimit.MutateBurst = 30
+	GlobalConfig.RateLimit.ReadRate = 600
+	GlobalConfig.RateLimit.ReadBurst = 120
+
 	log.Println("已加载默认配置")
 }
 
 // setDefaults 设置默认值
 func setDefaults() {
+	if GlobalConfig.Security.APIHashScopes == "" {
+		GlobalConfig.Security.APIHashScopes = "admin"
+	}
+	if GlobalConfig.Security.LoginMaxAttempts <= 0 {
+		GlobalConfig.Security.LoginMaxAttempts = 5
+	}
+	if GlobalConfig.Security.LoginIPMaxAttempts <= 0 {
+		GlobalConfig.Security.LoginIPMaxAttempts = 20
+	}
+	if GlobalConfig.Security.LoginLockout <= 0 {
+		GlobalConfig.Security.LoginLockout = 15
+	}
+	if GlobalConfig.Security.ResetTokenTTL <= 0 {
+		GlobalConfig.Security.ResetTokenTTL = 30
+	}
 	if GlobalConfig.Database.Path == "" {
 		GlobalConfig.Database.Path = "./openlxd.db"
 	}
@@ -119,6 +267,103 @@ func setDefaults() {
 	if GlobalConfig.Server.Host == "" {
 		GlobalConfig.Server.Host = "0.0.0.0"
 	}
+	if GlobalConfig.ACME.Directory == "" {
+		GlobalConfig.ACME.Directory = "https://acme-v02.api.letsencrypt.org/directory"
+	}
+	if GlobalConfig.ACME.Challenge == "" {
+		GlobalConfig.ACME.Challenge = "http-01"
+	}
+	if GlobalConfig.ACME.Webroot == "" {
+		GlobalConfig.ACME.Webroot = "/var/lib/openlxd/acme-webroot"
+	}
+	if GlobalConfig.ACME.RenewBefore == 0 {
+		GlobalConfig.ACME.RenewBefore = 30
+	}
+	if GlobalConfig.Proxy.Backend == "" {
+		GlobalConfig.Proxy.Backend = "nginx"
+	}
+	if GlobalConfig.Proxy.HTTPListen == "" {
+		GlobalConfig.Proxy.HTTPListen = ":80"
+	}
+	if GlobalConfig.Proxy.HTTPSListen == "" {
+		GlobalConfig.Proxy.HTTPSListen = ":443"
+	}
+	if GlobalConfig.Proxy.ReloadInterval == 0 {
+		GlobalConfig.Proxy.ReloadInterval = 30
+	}
+	if GlobalConfig.Capacity.CPURatio <= 0 {
+		GlobalConfig.Capacity.CPURatio = 4
+	}
+	if GlobalConfig.Capacity.MemoryRatio <= 0 {
+		GlobalConfig.Capacity.MemoryRatio = 1
+	}
+	if GlobalConfig.Capacity.DiskRatio <= 0 {
+		GlobalConfig.Capacity.DiskRatio = 1
+	}
+	if GlobalConfig.Capacity.StoragePool == "" {
+		GlobalConfig.Capacity.StoragePool = "default"
+	}
+	if GlobalConfig.Monitor.Interval <= 0 {
+		GlobalConfig.Monitor.Interval = 60
+	}
+	if GlobalConfig.Monitor.RawRetention <= 0 {
+		GlobalConfig.Monitor.RawRetention = 48
+	}
+	if GlobalConfig.Monitor.Rollup5mDays <= 0 {
+		GlobalConfig.Monitor.Rollup5mDays = 30
+	}
+	if GlobalConfig.Monitor.Rollup1hDays <= 0 {
+		GlobalConfig.Monitor.Rollup1hDays = 365
+	}
+	if GlobalConfig.Monitor.CompactInterval <= 0 {
+		GlobalConfig.Monitor.CompactInterval = 300
+	}
+	if GlobalConfig.Alert.EvaluateInterval <= 0 {
+		GlobalConfig.Alert.EvaluateInterval = 60
+	}
+	if GlobalConfig.Alert.SMTPPort <= 0 {
+		GlobalConfig.Alert.SMTPPort = 25
+	}
+	if GlobalConfig.Alert.TelegramAPI == "" {
+		GlobalConfig.Alert.TelegramAPI = "https://api.telegram.org"
+	}
+	if GlobalConfig.Webhook.MaxAttempts <= 0 {
+		GlobalConfig.Webhook.MaxAttempts = 8
+	}
+	if GlobalConfig.Webhook.Timeout <= 0 {
+		GlobalConfig.Webhook.Timeout = 10
+	}
+	if GlobalConfig.OIDC.Scopes == "" {
+		GlobalConfig.OIDC.Scopes = "openid profile email"
+	}
+	if GlobalConfig.OIDC.UsernameClaim == "" {
+		GlobalConfig.OIDC.UsernameClaim = "preferred_username"
+	}
+	if GlobalConfig.OIDC.RoleClaim == "" {
+		GlobalConfig.OIDC.RoleClaim = "groups"
+	}
+	if GlobalConfig.RateLimit.AuthBurst <= 0 {
+		GlobalConfig.RateLimit.AuthBurst = GlobalConfig.RateLimit.AuthRate
+	}
+	if GlobalConfig.RateLimit.MutateBurst <= 0 {
+		GlobalConfig.RateLimit.MutateBurst = GlobalConfig.RateLimit.MutateRate
+	}
+	if GlobalConfig.RateLimit.ReadBurst <= 0 {
+		GlobalConfig.RateLimit.ReadBurst = GlobalConfig.RateLimit.ReadRate
+	}
+}
+
+// setSwitchDefaults 设置默认开启的开关，需在解析配置文件前调用：
+// 布尔值无法区分“未配置”和“关闭”，已有配置文件缺少该项时保持默认开启，显式配置为 false 时由解析覆盖；
+// 限流速率同理（0 为不限），缺少 rate_limit 的配置文件使用默认速率，突发容量由 setDefaults 按速率补全
+func setSwitchDefaults() {
+	GlobalConfig.Capacity.Enabled = true
+	GlobalConfig.Alert.Enabled = true
+	GlobalConfig.OIDC.AutoProvision = true
+	GlobalConfig.RateLimit.Enabled = true
+	GlobalConfig.RateLimit.AuthRate = 10
+	GlobalConfig.RateLimit.MutateRate = 60
+	GlobalConfig.RateLimit.ReadRate = 600
 }
 
 // createDefaultConfigFile 创建默认配置文件
@@ -133,9 +378,15 @@ func createDefaultConfigFile(path string) error {
 
 security:
   api_hash: "default-api-key-please-change"
+  api_hash_scopes: "admin"  # 系统 API Hash 的权限范围：read, container:write, network:write, admin；建议改用用户 API Key
   admin_user: "admin"
   admin_pass: "admin123"
-  session_secret: "default-secret-please-change"
+  session_secret: "default-secret-please-change"  # 登录令牌和密码重置链接的签名密钥，请修改
+  login_max_attempts: 5      # 同一账号连续登录失败次数上限
+  login_ip_max_attempts: 20  # 同一 IP 连续登录失败次数上限
+  login_lockout: 15          # 锁定时长（分钟）
+  reset_token_ttl: 30        # 密码重置链接有效期（分钟）
+  reset_url: ""              # 密码重置页面地址，为空时根据 server 配置生成
 
 database:
   type: "sqlite"
@@ -144,12 +395,87 @@ database:
 lxd:
   socket: "/var/snap/lxd/common/lxd/unix.socket"
   bridge: "lxdbr0"
+  mirror_labels: false
+
+acme:
+  email: ""
+  directory: "https://acme-v02.api.letsencrypt.org/directory"
+  challenge: "http-01"
+  webroot: "/var/lib/openlxd/acme-webroot"
+  http_listen: ""
+  dns_provider: ""
+  dns_config: {}
+  renew_before: 30
+  ca_cert: ""
+  insecure: false
+
+proxy:
+  backend: "nginx"
+  http_listen: ":80"
+  https_listen: ":443"
+  reload_interval: 30
+
+capacity:
+  enabled: true
+  cpu_ratio: 4
+  memory_ratio: 1
+  disk_ratio: 1
+  reserve_memory: 512
+  storage_pool: "default"
+
+monitor:
+  interval: 60
+  raw_retention: 48
+  rollup_5m_days: 30
+  rollup_1h_days: 365
+  compact_interval: 300
+
+metrics:
+  enabled: false
+  scrape_token: ""
+
+alert:
+  enabled: true
+  evaluate_interval: 60
+  smtp_host: ""
+  smtp_port: 25
+  smtp_username: ""
+  smtp_password: ""
+  smtp_from: ""
+  telegram_api: "https://api.telegram.org"
+
+webhook:
+  max_attempts: 8
+  timeout: 10
+
+oidc:
+  enabled: false
+  issuer: ""
+  client_id: ""
+  client_secret: ""
+  redirect_url: ""
+  scopes: "openid profile email"
+  username_claim: "preferred_username"
+  role_claim: "groups"
+  admin_values: ""
+  user_values: ""
+  auto_provision: true
+
+rate_limit:
+  enabled: true
+  auth_rate: 10
+  auth_burst: 10
+  mutate_rate: 60
+  mutate_burst: 30
+  read_rate: 600
+  read_burst: 120
+  exempt_ips: ""
 `
-	
+
 	if err := os.WriteFile(path, []byte(configContent), 0644); err != nil {
 		return err
 	}
-	
+
 	log.Printf("已创建默认配置文件: %s", path)
 	return nil
 }
@@ -0,0 +1,281 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	lxdclient "github.com/canonical/lxd/client"
+	"github.com/openlxd/backend/internal/models"
+)
+
+// 事件类型
+const (
+	TypeLifecycle = "lifecycle" // LXD 实例生命周期事件
+	TypeOperation = "operation" // OpenLXD 后台操作进度（批量操作等）
+	TypeMigration = "migration" // 迁移任务进度
+	TypeMetrics   = "metrics"   // 实时监控采样
+)
+
+// Types 支持订阅的事件类型
+var Types = []string{TypeLifecycle, TypeOperation, TypeMigration, TypeMetrics}
+
+const (
+	historySize      = 256              // 保留最近的事件用于断线重连后补发
+	subscriberBuffer = 64               // 订阅者缓冲区，消费过慢时丢弃新事件
+	ownerCacheTTL    = 30 * time.Second // 容器所属用户缓存有效期
+	ownerRefreshMin  = 5 * time.Second  // 缓存未命中时的最小刷新间隔
+)
+
+// Event 推送给客户端的事件
+type Event struct {
+	ID        uint64      `json:"id"`
+	Type      string      `json:"type"`
+	Container string      `json:"container,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+
+	userID   uint   // 容器所属用户，为 0 时仅管理员可见
+	username string // 操作发起人用户名
+}
+
+// Subscriber 事件订阅者（一个 SSE 连接）
+type Subscriber struct {
+	C         chan *Event
+	UserID    uint
+	Username  string
+	Admin     bool
+	Types     map[string]bool // 为空时订阅全部类型
+	Container string          // 只接收指定容器的事件
+	JTI       string          // 连接使用的登录令牌 ID，令牌撤销时关闭连接
+	APIKeyID  uint            // 连接使用的 API 密钥 ID，密钥撤销时关闭连接
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSubscriber 创建订阅者
+func NewSubscriber(user *models.User, types []string, container string) *Subscriber {
+	sub := &Subscriber{
+		C:         make(chan *Event, subscriberBuffer),
+		closed:    make(chan struct{}),
+		Admin:     user == nil || user.IsAdmin(),
+		Types:     make(map[string]bool),
+		Container: container,
+	}
+	if user != nil {
+		sub.UserID = user.ID
+		sub.Username = user.Username
+	}
+	for _, t := range types {
+		sub.Types[t] = true
+	}
+	return sub
+}
+
+// Closed 连接使用的凭据被撤销时关闭
+func (s *Subscriber) Closed() <-chan struct{} {
+	return s.closed
+}
+
+// close 通知连接关闭，可重复调用
+func (s *Subscriber) close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+// Allows 判断订阅者是否可以接收事件：管理员接收全部，普通用户只接收自己容器和自己发起的操作
+func (s *Subscriber) Allows(e *Event) bool {
+	if len(s.Types) > 0 && !s.Types[e.Type] {
+		return false
+	}
+	if s.Container != "" && e.Container != s.Container {
+		return false
+	}
+	if s.Admin {
+		return true
+	}
+	if e.userID != 0 && e.userID == s.UserID {
+		return true
+	}
+	return e.username != "" && e.username == s.Username
+}
+
+// ownerCache 容器名到所属用户的缓存，避免每个事件都查询数据库
+type ownerCache struct {
+	mu       sync.Mutex
+	owners   map[string]uint
+	loadedAt time.Time
+}
+
+// Broker 事件分发中心
+type Broker struct {
+	mu          sync.RWMutex
+	nextID      uint64
+	subscribers map[*Subscriber]struct{}
+	history     []*Event
+
+	owners    ownerCache
+	once      sync.Once
+	listeners map[string]*lxdclient.EventListener
+}
+
+var GlobalBroker = &Broker{
+	subscribers: make(map[*Subscriber]struct{}),
+	listeners:   make(map[string]*lxdclient.EventListener),
+}
+
+// ValidateTypes 校验订阅的事件类型列表（逗号分隔）
+func ValidateTypes(types string) ([]string, error) {
+	var result []string
+	for _, t := range strings.Split(types, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		valid := false
+		for _, known := range Types {
+			if t == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("不支持的事件类型: %s，可选: %s", t, strings.Join(Types, ", "))
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// Publish 发布与容器相关的事件，container 为空时仅管理员可见
+func Publish(eventType, container string, data interface{}) {
+	GlobalBroker.Publish(&Event{
+		Type:      eventType,
+		Container: container,
+		Data:      data,
+		userID:    GlobalBroker.ownerOf(container),
+	})
+}
+
+// PublishForUser 发布由指定用户发起的事件
+func PublishForUser(eventType, username string, data interface{}) {
+	GlobalBroker.Publish(&Event{
+		Type:     eventType,
+		Data:     data,
+		username: username,
+	})
+}
+
+// Publish 分配事件 ID 并分发给订阅者，订阅者缓冲区已满时丢弃
+func (b *Broker) Publish(e *Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	e.ID = b.nextID
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
+	b.history = append(b.history, e)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+
+	for sub := range b.subscribers {
+		if !sub.Allows(e) {
+			continue
+		}
+		select {
+		case sub.C <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe 注册订阅者，返回 ID 大于 lastID 的历史事件用于补发（lastID 为 0 时不补发）
+func (b *Broker) Subscribe(sub *Subscriber, lastID uint64) []*Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers[sub] = struct{}{}
+
+	var backlog []*Event
+	if lastID == 0 {
+		return backlog
+	}
+	for _, e := range b.history {
+		if e.ID > lastID && sub.Allows(e) {
+			backlog = append(backlog, e)
+		}
+	}
+	return backlog
+}
+
+// Unsubscribe 移除订阅者
+func (b *Broker) Unsubscribe(sub *Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subscribers, sub)
+}
+
+// CloseSession 关闭使用该登录令牌的连接（退出登录、撤销会话）
+func (b *Broker) CloseSession(jti string) {
+	b.closeWhere(func(sub *Subscriber) bool { return sub.JTI == jti })
+}
+
+// CloseAPIKey 关闭使用该 API 密钥的连接（撤销密钥）
+func (b *Broker) CloseAPIKey(id uint) {
+	b.closeWhere(func(sub *Subscriber) bool { return sub.APIKeyID == id })
+}
+
+// closeWhere 关闭满足条件的订阅者
+func (b *Broker) closeWhere(match func(*Subscriber) bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subscribers {
+		if match(sub) {
+			sub.close()
+		}
+	}
+}
+
+// HasSubscribers 是否有在线订阅者，没有时可跳过构造事件
+func (b *Broker) HasSubscribers() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.subscribers) > 0
+}
+
+// ownerOf 查询容器所属用户，缓存过期或未命中时一次性加载全部容器
+func (b *Broker) ownerOf(container string) uint {
+	if container == "" {
+		return 0
+	}
+
+	c := &b.owners
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	owner, ok := c.owners[container]
+	age := now.Sub(c.loadedAt)
+	if (ok && age < ownerCacheTTL) || (!ok && age < ownerRefreshMin) {
+		return owner
+	}
+
+	var containers []models.Container
+	if err := models.DB.Select("hostname", "user_id").Find(&containers).Error; err != nil {
+		return owner
+	}
+	c.owners = make(map[string]uint, len(containers))
+	for _, container := range containers {
+		c.owners[container.Hostname] = container.UserID
+	}
+	c.loadedAt = now
+	return c.owners[container]
+}
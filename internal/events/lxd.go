@@ -0,0 +1,175 @@
+package events
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	lxdclient "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/lxd"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/operations"
+)
+
+// reconnectInterval 检查节点事件连接的间隔，断开或新增的节点在下一轮连接
+const reconnectInterval = 30 * time.Second
+
+// Start 订阅各节点的 LXD 事件并接入 OpenLXD 操作进度，只会启动一次
+func (b *Broker) Start() {
+	b.once.Do(func() {
+		operations.Observer = publishOperation
+		auth.TokenRevokedObserver = b.CloseSession
+
+		go func() {
+			ticker := time.NewTicker(reconnectInterval)
+			defer ticker.Stop()
+			for {
+				b.syncListeners()
+				<-ticker.C
+			}
+		}()
+	})
+}
+
+// syncListeners 为每个节点保持一个 LXD 事件连接，移除已注销节点的连接
+// 连接节点可能耗时较长，只在锁内读写连接表，连接和断开都在锁外进行，避免阻塞事件发布
+func (b *Broker) syncListeners() {
+	nodes := make(map[string]bool)
+	for _, node := range lxd.NodeNames() {
+		nodes[node] = true
+	}
+
+	var stale []*lxdclient.EventListener
+	var missing []string
+	b.mu.Lock()
+	for node, listener := range b.listeners {
+		if !nodes[node] || !listener.IsActive() {
+			stale = append(stale, listener)
+			delete(b.listeners, node)
+		}
+	}
+	for node := range nodes {
+		if _, ok := b.listeners[node]; !ok {
+			missing = append(missing, node)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, listener := range stale {
+		listener.Disconnect()
+	}
+
+	for _, node := range missing {
+		listener, err := listen(node)
+		if err != nil {
+			log.Printf("订阅节点 %s 的 LXD 事件失败: %v", node, err)
+			continue
+		}
+		if listener == nil {
+			continue
+		}
+
+		b.mu.Lock()
+		_, exists := b.listeners[node]
+		if !exists {
+			b.listeners[node] = listener
+		}
+		b.mu.Unlock()
+		if exists {
+			listener.Disconnect()
+		}
+	}
+}
+
+// listen 连接节点的 LXD 事件流，节点未连接时返回 nil
+func listen(node string) (*lxdclient.EventListener, error) {
+	client, err := lxd.NodeClient(node)
+	if err != nil {
+		return nil, nil
+	}
+	listener, err := client.GetEvents()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := listener.AddHandler([]string{"lifecycle"}, lifecycleHandler(node)); err != nil {
+		listener.Disconnect()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// lifecycleHandler 将 LXD 实例生命周期事件转为推送事件
+func lifecycleHandler(node string) func(api.Event) {
+	return func(event api.Event) {
+		var lifecycle api.EventLifecycle
+		if err := json.Unmarshal(event.Metadata, &lifecycle); err != nil {
+			return
+		}
+		if !strings.HasPrefix(lifecycle.Action, "instance-") {
+			return
+		}
+
+		name := instanceName(lifecycle.Source)
+		if name == "" {
+			return
+		}
+		GlobalBroker.Publish(&Event{
+			Type:      TypeLifecycle,
+			Container: name,
+			Timestamp: event.Timestamp,
+			Data: map[string]interface{}{
+				"action":  lifecycle.Action,
+				"node":    node,
+				"source":  lifecycle.Source,
+				"context": lifecycle.Context,
+			},
+			userID: GlobalBroker.ownerOf(name),
+		})
+	}
+}
+
+// instanceName 从事件来源（如 /1.0/instances/c1/snapshots/s1?project=default）解析容器名
+func instanceName(source string) string {
+	const prefix = "/1.0/instances/"
+	if !strings.HasPrefix(source, prefix) {
+		return ""
+	}
+	name := strings.TrimPrefix(source, prefix)
+	if i := strings.IndexAny(name, "/?"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// publishOperation 推送后台操作进度，不含逐项结果
+func publishOperation(op *operations.Operation) {
+	if !GlobalBroker.HasSubscribers() {
+		return
+	}
+	op.Results = nil
+	PublishForUser(TypeOperation, op.CreatedBy, op)
+}
+
+// PublishMigration 推送迁移任务进度
+func PublishMigration(task *models.MigrationTask) {
+	if !GlobalBroker.HasSubscribers() {
+		return
+	}
+	Publish(TypeMigration, task.ContainerName, *task)
+}
+
+// PublishMetrics 推送一轮监控采样：主机指标仅管理员可见，容器指标推送给容器所属用户
+func PublishMetrics(system *models.SystemMetric, containers []models.ContainerMetric) {
+	if !GlobalBroker.HasSubscribers() {
+		return
+	}
+	if system != nil {
+		Publish(TypeMetrics, "", *system)
+	}
+	for _, metric := range containers {
+		Publish(TypeMetrics, metric.ContainerName, metric)
+	}
+}
@@ -18,6 +18,7 @@ func (c *ClientWrapper) CreateContainer(config ContainerConfig) error {
 		Memory:   config.Memory,
 		Disk:     config.Disk,
 		Image:    config.Image,
+		Node:     config.Node,
 	}
 	return CreateContainer(req)
 }
@@ -48,7 +49,7 @@ func (c *ClientWrapper) GetContainerState(name string) (*ContainerState, error)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	return &ContainerState{
 		Status: state.Status,
 		CPU:    state.CPU.Usage,
@@ -64,12 +65,16 @@ func (c *ClientWrapper) SetPassword(name, username, password string) error {
 
 // SetCPULimit 设置CPU限制
 func (c *ClientWrapper) SetCPULimit(name string, cpus int) error {
-	instance, _, err := Client.GetInstance(name)
+	client, err := ContainerClient(name)
+	if err != nil {
+		return err
+	}
+	instance, _, err := client.GetInstance(name)
 	if err != nil {
 		return err
 	}
 	instance.Config["limits.cpu"] = fmt.Sprintf("%d", cpus)
-	op, err := Client.UpdateInstance(name, instance.Writable(), "")
+	op, err := client.UpdateInstance(name, instance.Writable(), "")
 	if err != nil {
 		return err
 	}
@@ -78,12 +83,16 @@ func (c *ClientWrapper) SetCPULimit(name string, cpus int) error {
 
 // SetMemoryLimit 设置内存限制
 func (c *ClientWrapper) SetMemoryLimit(name string, memoryMB int) error {
-	instance, _, err := Client.GetInstance(name)
+	client, err := ContainerClient(name)
+	if err != nil {
+		return err
+	}
+	instance, _, err := client.GetInstance(name)
 	if err != nil {
 		return err
 	}
 	instance.Config["limits.memory"] = fmt.Sprintf("%dMB", memoryMB)
-	op, err := Client.UpdateInstance(name, instance.Writable(), "")
+	op, err := client.UpdateInstance(name, instance.Writable(), "")
 	if err != nil {
 		return err
 	}
@@ -92,21 +101,30 @@ func (c *ClientWrapper) SetMemoryLimit(name string, memoryMB int) error {
 
 // SetDiskLimit 设置磁盘限制
 func (c *ClientWrapper) SetDiskLimit(name string, diskGB int) error {
+	client, err := ContainerClient(name)
+	if err != nil {
+		return err
+	}
 	// 磁盘限制需要通过设备配置修改
-	instance, _, err := Client.GetInstance(name)
+	instance, _, err := client.GetInstance(name)
 	if err != nil {
 		return err
 	}
 	if instance.Devices["root"] != nil {
 		instance.Devices["root"]["size"] = fmt.Sprintf("%dGB", diskGB)
 	}
-	op, err := Client.UpdateInstance(name, instance.Writable(), "")
+	op, err := client.UpdateInstance(name, instance.Writable(), "")
 	if err != nil {
 		return err
 	}
 	return op.Wait()
 }
 
+// ResizeContainer 在线调整容器规格
+func (c *ClientWrapper) ResizeContainer(name string, spec ResizeSpec, persist func() error) error {
+	return ResizeContainer(name, spec, persist)
+}
+
 // ListImages 获取镜像列表
 func (c *ClientWrapper) ListImages() ([]ImageInfo, error) {
 	return ListImages()
@@ -124,6 +142,7 @@ func (c *ClientWrapper) DeleteImage(fingerprint string) error {
 
 // ContainerConfig 容器配置
 type ContainerConfig struct {
+	Node   string
 	Name   string
 	Image  string
 	CPU    int
@@ -35,18 +35,64 @@ func InitLXD(socketPath string) error {
 	return nil
 }
 
-// ListContainers 获取所有容器列表
+// ListContainers 获取所有节点的容器列表（Location 为所在节点）
 func ListContainers() ([]api.Instance, error) {
-	instances, err := Client.GetInstances(api.InstanceTypeContainer)
-	if err != nil {
-		return nil, fmt.Errorf("获取容器列表失败: %v", err)
+	var all []api.Instance
+	for _, node := range NodeNames() {
+		client, err := NodeClient(node)
+		if err != nil {
+			return nil, err
+		}
+		instances, err := client.GetInstances(api.InstanceTypeContainer)
+		if err != nil {
+			// 本机失败直接返回，远程节点失败时跳过，不影响其他节点
+			if node == LocalNode {
+				return nil, fmt.Errorf("获取容器列表失败: %v", err)
+			}
+			log.Printf("获取节点 %s 容器列表失败: %v", node, err)
+			continue
+		}
+		for i := range instances {
+			instances[i].Location = node
+		}
+		all = append(all, instances...)
+	}
+	return all, nil
+}
+
+// ListContainerStates 获取所有节点上容器的运行状态（按容器名索引），每个节点只请求一次
+func ListContainerStates() (map[string]*api.InstanceState, error) {
+	states := make(map[string]*api.InstanceState)
+	for _, node := range NodeNames() {
+		client, err := NodeClient(node)
+		if err != nil {
+			return nil, err
+		}
+		instances, err := client.GetInstancesFull(api.InstanceTypeContainer)
+		if err != nil {
+			if node == LocalNode {
+				return nil, fmt.Errorf("获取容器状态失败: %v", err)
+			}
+			log.Printf("获取节点 %s 容器状态失败: %v", node, err)
+			continue
+		}
+		for i := range instances {
+			if instances[i].State != nil {
+				states[instances[i].Name] = instances[i].State
+			}
+		}
 	}
-	return instances, nil
+	return states, nil
 }
 
 // GetContainer 获取单个容器信息
 func GetContainer(name string) (*api.Instance, error) {
-	instance, _, err := Client.GetInstance(name)
+	client, err := ContainerClient(name)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, _, err := client.GetInstance(name)
 	if err != nil {
 		return nil, fmt.Errorf("获取容器信息失败: %v", err)
 	}
@@ -55,7 +101,12 @@ func GetContainer(name string) (*api.Instance, error) {
 
 // GetContainerState 获取容器状态
 func GetContainerState(name string) (*api.InstanceState, error) {
-	state, _, err := Client.GetInstanceState(name)
+	client, err := ContainerClient(name)
+	if err != nil {
+		return nil, err
+	}
+
+	state, _, err := client.GetInstanceState(name)
 	if err != nil {
 		return nil, fmt.Errorf("获取容器状态失败: %v", err)
 	}
@@ -63,7 +114,8 @@ func GetContainerState(name string) (*api.InstanceState, error) {
 }
 
 // CreateContainer 创建容器
-func CreateContainer(req CreateContainerRequest) error {
+func CreateContainer(req CreateContainerRequest) (err error) {
+	defer observe("create", time.Now(), &err)
 	// 使用修复后的版本
 	return CreateContainerFixed(req)
 }
@@ -126,7 +178,7 @@ func CreateContainerOld(req CreateContainerRequest) error {
 	// 创建容器
 	var op lxd.Operation
 	var err error
-	
+
 	if imageServer != "" {
 		// 使用远程镜像服务器
 		imageServer := Client.UseTarget(imageServer)
@@ -135,7 +187,7 @@ func CreateContainerOld(req CreateContainerRequest) error {
 		// 使用本地镜像
 		op, err = Client.CreateInstance(instanceReq)
 	}
-	
+
 	if err != nil {
 		return fmt.Errorf("创建容器失败: %v", err)
 	}
@@ -156,13 +208,19 @@ func CreateContainerOld(req CreateContainerRequest) error {
 }
 
 // StartContainer 启动容器
-func StartContainer(name string) error {
+func StartContainer(name string) (err error) {
+	defer observe("start", time.Now(), &err)
+	client, err := ContainerClient(name)
+	if err != nil {
+		return err
+	}
+
 	reqState := api.InstanceStatePut{
 		Action:  "start",
 		Timeout: -1,
 	}
 
-	op, err := Client.UpdateInstanceState(name, reqState, "")
+	op, err := client.UpdateInstanceState(name, reqState, "")
 	if err != nil {
 		return fmt.Errorf("启动容器失败: %v", err)
 	}
@@ -177,14 +235,20 @@ func StartContainer(name string) error {
 }
 
 // StopContainer 停止容器
-func StopContainer(name string) error {
+func StopContainer(name string) (err error) {
+	defer observe("stop", time.Now(), &err)
+	client, err := ContainerClient(name)
+	if err != nil {
+		return err
+	}
+
 	reqState := api.InstanceStatePut{
 		Action:  "stop",
 		Timeout: 30,
 		Force:   false,
 	}
 
-	op, err := Client.UpdateInstanceState(name, reqState, "")
+	op, err := client.UpdateInstanceState(name, reqState, "")
 	if err != nil {
 		return fmt.Errorf("停止容器失败: %v", err)
 	}
@@ -199,14 +263,20 @@ func StopContainer(name string) error {
 }
 
 // RestartContainer 重启容器
-func RestartContainer(name string) error {
+func RestartContainer(name string) (err error) {
+	defer observe("restart", time.Now(), &err)
+	client, err := ContainerClient(name)
+	if err != nil {
+		return err
+	}
+
 	reqState := api.InstanceStatePut{
 		Action:  "restart",
 		Timeout: 30,
 		Force:   false,
 	}
 
-	op, err := Client.UpdateInstanceState(name, reqState, "")
+	op, err := client.UpdateInstanceState(name, reqState, "")
 	if err != nil {
 		return fmt.Errorf("重启容器失败: %v", err)
 	}
@@ -221,16 +291,22 @@ func RestartContainer(name string) error {
 }
 
 // DeleteContainer 删除容器
-func DeleteContainer(name string) error {
+func DeleteContainer(name string) (err error) {
+	defer observe("delete", time.Now(), &err)
+	client, err := ContainerClient(name)
+	if err != nil {
+		return err
+	}
+
 	// 先停止容器
-	state, _, _ := Client.GetInstanceState(name)
+	state, _, _ := client.GetInstanceState(name)
 	if state != nil && state.Status == "Running" {
 		StopContainer(name)
 		time.Sleep(2 * time.Second)
 	}
 
 	// 删除容器
-	op, err := Client.DeleteInstance(name)
+	op, err := client.DeleteInstance(name)
 	if err != nil {
 		return fmt.Errorf("删除容器失败: %v", err)
 	}
@@ -240,6 +316,7 @@ func DeleteContainer(name string) error {
 		return fmt.Errorf("容器删除操作失败: %v", err)
 	}
 
+	setPlacement(name, "")
 	log.Printf("容器 %s 删除成功", name)
 	return nil
 }
@@ -273,7 +350,12 @@ func ResetContainerPassword(name, password string) error {
 		Command: []string{"/bin/bash", "-c", fmt.Sprintf("echo 'root:%s' | chpasswd", password)},
 	}
 
-	op, err := Client.ExecInstance(name, execReq, nil)
+	client, err := ContainerClient(name)
+	if err != nil {
+		return err
+	}
+
+	op, err := client.ExecInstance(name, execReq, nil)
 	if err != nil {
 		return fmt.Errorf("执行密码重置命令失败: %v", err)
 	}
@@ -288,9 +370,15 @@ func ResetContainerPassword(name, password string) error {
 }
 
 // ReinstallContainer 重装容器系统
-func ReinstallContainer(name, newImage string) error {
+func ReinstallContainer(name, newImage string) (err error) {
+	defer observe("reinstall", time.Now(), &err)
+	client, err := ContainerClient(name)
+	if err != nil {
+		return err
+	}
+
 	// 获取原容器配置
-	instance, _, err := Client.GetInstance(name)
+	instance, _, err := client.GetInstance(name)
 	if err != nil {
 		return fmt.Errorf("获取容器配置失败: %v", err)
 	}
@@ -318,7 +406,7 @@ func ReinstallContainer(name, newImage string) error {
 		},
 	}
 
-	op, err := Client.CreateInstance(instanceReq)
+	op, err := client.CreateInstance(instanceReq)
 	if err != nil {
 		return fmt.Errorf("重建容器失败: %v", err)
 	}
@@ -334,6 +422,7 @@ func ReinstallContainer(name, newImage string) error {
 
 // CreateContainerRequest 创建容器请求结构
 type CreateContainerRequest struct {
+	Node         string // 目标节点，为空时使用本机
 	Hostname     string
 	CPUs         int
 	Memory       int
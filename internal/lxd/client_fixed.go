@@ -41,7 +41,7 @@ func CreateContainerFixed(req CreateContainerRequest) error {
 	// 解析镜像字符串 (例如: "alpine/3.19" 或 "images:alpine/3.19")
 	imageName := req.Image
 	imageServer := "images" // 默认使用images远程服务器
-	
+
 	// 如果包含冒号，分离服务器和镜像名
 	if strings.Contains(imageName, ":") {
 		parts := strings.SplitN(imageName, ":", 2)
@@ -65,7 +65,7 @@ func CreateContainerFixed(req CreateContainerRequest) error {
 	// 连接到远程镜像服务器
 	var imageServerClient lxd.ImageServer
 	var err error
-	
+
 	switch imageServer {
 	case "images":
 		imageServerClient, err = lxd.ConnectSimpleStreams("https://images.linuxcontainers.org", &lxd.ConnectionArgs{
@@ -78,7 +78,7 @@ func CreateContainerFixed(req CreateContainerRequest) error {
 	default:
 		return fmt.Errorf("不支持的镜像服务器: %s", imageServer)
 	}
-	
+
 	if err != nil {
 		return fmt.Errorf("连接镜像服务器失败: %v", err)
 	}
@@ -113,10 +113,15 @@ func CreateContainerFixed(req CreateContainerRequest) error {
 		},
 	}
 
-	log.Printf("开始创建容器 %s...", req.Hostname)
+	client, err := NodeClient(req.Node)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("开始在节点 %s 上创建容器 %s...", nodeLabel(req.Node), req.Hostname)
 
 	// 创建容器
-	op, err := Client.CreateInstance(instanceReq)
+	op, err := client.CreateInstance(instanceReq)
 	if err != nil {
 		return fmt.Errorf("创建容器失败: %v", err)
 	}
@@ -128,6 +133,7 @@ func CreateContainerFixed(req CreateContainerRequest) error {
 		return fmt.Errorf("容器创建操作失败: %v", err)
 	}
 
+	setPlacement(req.Hostname, nodeLabel(req.Node))
 	log.Printf("✅ 容器 %s 创建成功！", req.Hostname)
 
 	// 如果指定了密码，设置 root 密码
@@ -2,14 +2,17 @@ package lxd
 
 import (
 	"fmt"
+	"time"
 
 	lxdapi "github.com/canonical/lxd/shared/api"
 )
 
 // CloneContainer 克隆容器
-func CloneContainer(sourceName, targetName string) error {
-	if Client == nil {
-		return fmt.Errorf("LXD 客户端未初始化")
+func CloneContainer(sourceName, targetName string) (err error) {
+	defer observe("clone", time.Now(), &err)
+	client, err := ContainerClient(sourceName)
+	if err != nil {
+		return err
 	}
 
 	// 创建克隆请求
@@ -23,7 +26,7 @@ func CloneContainer(sourceName, targetName string) error {
 	}
 
 	// 执行克隆操作
-	op, err := Client.CreateInstance(req)
+	op, err := client.CreateInstance(req)
 	if err != nil {
 		return fmt.Errorf("克隆容器失败: %v", err)
 	}
@@ -34,13 +37,17 @@ func CloneContainer(sourceName, targetName string) error {
 		return fmt.Errorf("容器克隆操作失败: %v", err)
 	}
 
+	// 克隆出的容器与源容器位于同一节点
+	setPlacement(targetName, ContainerNode(sourceName))
 	return nil
 }
 
 // CloneContainerFromSnapshot 从快照克隆容器
-func CloneContainerFromSnapshot(sourceName, snapshotName, targetName string) error {
-	if Client == nil {
-		return fmt.Errorf("LXD 客户端未初始化")
+func CloneContainerFromSnapshot(sourceName, snapshotName, targetName string) (err error) {
+	defer observe("clone", time.Now(), &err)
+	client, err := ContainerClient(sourceName)
+	if err != nil {
+		return err
 	}
 
 	// 构建快照源路径
@@ -57,7 +64,7 @@ func CloneContainerFromSnapshot(sourceName, snapshotName, targetName string) err
 	}
 
 	// 执行克隆操作
-	op, err := Client.CreateInstance(req)
+	op, err := client.CreateInstance(req)
 	if err != nil {
 		return fmt.Errorf("从快照克隆容器失败: %v", err)
 	}
@@ -68,13 +75,16 @@ func CloneContainerFromSnapshot(sourceName, snapshotName, targetName string) err
 		return fmt.Errorf("快照克隆操作失败: %v", err)
 	}
 
+	// 克隆出的容器与源容器位于同一节点
+	setPlacement(targetName, ContainerNode(sourceName))
 	return nil
 }
 
 // CopyContainer 复制容器（带配置）
 func CopyContainer(sourceName, targetName string, config map[string]string) error {
-	if Client == nil {
-		return fmt.Errorf("LXD 客户端未初始化")
+	client, err := ContainerClient(sourceName)
+	if err != nil {
+		return err
 	}
 
 	// 创建复制请求
@@ -93,7 +103,7 @@ func CopyContainer(sourceName, targetName string, config map[string]string) erro
 	}
 
 	// 执行复制操作
-	op, err := Client.CreateInstance(req)
+	op, err := client.CreateInstance(req)
 	if err != nil {
 		return fmt.Errorf("复制容器失败: %v", err)
 	}
@@ -104,5 +114,7 @@ func CopyContainer(sourceName, targetName string, config map[string]string) erro
 		return fmt.Errorf("容器复制操作失败: %v", err)
 	}
 
+	// 克隆出的容器与源容器位于同一节点
+	setPlacement(targetName, ContainerNode(sourceName))
 	return nil
 }
@@ -9,12 +9,13 @@ import (
 
 // SetDNS 设置容器的 DNS 服务器
 func SetDNS(containerName string, dnsServers []string) error {
-	if Client == nil {
-		return fmt.Errorf("LXD 客户端未初始化")
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return err
 	}
 
 	// 获取当前容器配置
-	container, etag, err := Client.GetInstance(containerName)
+	container, etag, err := client.GetInstance(containerName)
 	if err != nil {
 		return fmt.Errorf("获取容器配置失败: %v", err)
 	}
@@ -28,7 +29,7 @@ func SetDNS(containerName string, dnsServers []string) error {
 	container.Config["user.dns.servers"] = strings.Join(dnsServers, ",")
 
 	// 更新容器配置
-	op, err := Client.UpdateInstance(containerName, container.Writable(), etag)
+	op, err := client.UpdateInstance(containerName, container.Writable(), etag)
 	if err != nil {
 		return fmt.Errorf("更新 DNS 配置失败: %v", err)
 	}
@@ -44,12 +45,13 @@ func SetDNS(containerName string, dnsServers []string) error {
 
 // GetDNS 获取容器的 DNS 服务器配置
 func GetDNS(containerName string) ([]string, error) {
-	if Client == nil {
-		return nil, fmt.Errorf("LXD 客户端未初始化")
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return nil, err
 	}
 
 	// 获取容器配置
-	container, _, err := Client.GetInstance(containerName)
+	container, _, err := client.GetInstance(containerName)
 	if err != nil {
 		return nil, fmt.Errorf("获取容器配置失败: %v", err)
 	}
@@ -67,12 +69,13 @@ func GetDNS(containerName string) ([]string, error) {
 
 // SetConfig 设置容器配置项
 func SetConfig(containerName, key, value string) error {
-	if Client == nil {
-		return fmt.Errorf("LXD 客户端未初始化")
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return err
 	}
 
 	// 获取当前容器配置
-	container, etag, err := Client.GetInstance(containerName)
+	container, etag, err := client.GetInstance(containerName)
 	if err != nil {
 		return fmt.Errorf("获取容器配置失败: %v", err)
 	}
@@ -84,7 +87,7 @@ func SetConfig(containerName, key, value string) error {
 	container.Config[key] = value
 
 	// 更新容器配置
-	op, err := Client.UpdateInstance(containerName, container.Writable(), etag)
+	op, err := client.UpdateInstance(containerName, container.Writable(), etag)
 	if err != nil {
 		return fmt.Errorf("更新配置失败: %v", err)
 	}
@@ -100,12 +103,13 @@ func SetConfig(containerName, key, value string) error {
 
 // GetConfig 获取容器配置项
 func GetConfig(containerName, key string) (string, error) {
-	if Client == nil {
-		return "", fmt.Errorf("LXD 客户端未初始化")
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return "", err
 	}
 
 	// 获取容器配置
-	container, _, err := Client.GetInstance(containerName)
+	container, _, err := client.GetInstance(containerName)
 	if err != nil {
 		return "", fmt.Errorf("获取容器配置失败: %v", err)
 	}
@@ -119,14 +123,61 @@ func GetConfig(containerName, key string) (string, error) {
 	return value, nil
 }
 
+// 容器标签和备注在 LXD 中的配置键
+const (
+	LabelConfigPrefix = "user.label."
+	NotesConfigKey    = "user.notes"
+)
+
+// SyncLabels 将容器标签和备注写入 LXD user.* 配置，替换原有的全部标签键
+func SyncLabels(containerName string, labels map[string]string, notes string) error {
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return err
+	}
+
+	container, etag, err := client.GetInstance(containerName)
+	if err != nil {
+		return fmt.Errorf("获取容器配置失败: %v", err)
+	}
+
+	if container.Config == nil {
+		container.Config = make(map[string]string)
+	}
+	for key := range container.Config {
+		if strings.HasPrefix(key, LabelConfigPrefix) {
+			delete(container.Config, key)
+		}
+	}
+	for name, value := range labels {
+		container.Config[LabelConfigPrefix+name] = value
+	}
+	if notes != "" {
+		container.Config[NotesConfigKey] = notes
+	} else {
+		delete(container.Config, NotesConfigKey)
+	}
+
+	op, err := client.UpdateInstance(containerName, container.Writable(), etag)
+	if err != nil {
+		return fmt.Errorf("更新配置失败: %v", err)
+	}
+	if err := op.Wait(); err != nil {
+		return fmt.Errorf("配置更新操作失败: %v", err)
+	}
+
+	return nil
+}
+
 // SetResourceLimits 设置容器资源限制
 func SetResourceLimits(containerName string, cpuLimit, memoryLimit, diskLimit string) error {
-	if Client == nil {
-		return fmt.Errorf("LXD 客户端未初始化")
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return err
 	}
 
 	// 获取当前容器配置
-	container, etag, err := Client.GetInstance(containerName)
+	container, etag, err := client.GetInstance(containerName)
 	if err != nil {
 		return fmt.Errorf("获取容器配置失败: %v", err)
 	}
@@ -147,7 +198,7 @@ func SetResourceLimits(containerName string, cpuLimit, memoryLimit, diskLimit st
 	}
 
 	// 更新容器配置
-	op, err := Client.UpdateInstance(containerName, container.Writable(), etag)
+	op, err := client.UpdateInstance(containerName, container.Writable(), etag)
 	if err != nil {
 		return fmt.Errorf("更新资源限制失败: %v", err)
 	}
@@ -163,8 +214,9 @@ func SetResourceLimits(containerName string, cpuLimit, memoryLimit, diskLimit st
 
 // ExecCommand 在容器中执行命令
 func ExecCommand(containerName string, command []string) (string, error) {
-	if Client == nil {
-		return "", fmt.Errorf("LXD 客户端未初始化")
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return "", err
 	}
 
 	// 创建执行请求
@@ -178,7 +230,7 @@ func ExecCommand(containerName string, command []string) (string, error) {
 	}
 
 	// 执行命令
-	op, err := Client.ExecInstance(containerName, req, nil)
+	op, err := client.ExecInstance(containerName, req, nil)
 	if err != nil {
 		return "", fmt.Errorf("执行命令失败: %v", err)
 	}
@@ -191,7 +243,7 @@ func ExecCommand(containerName string, command []string) (string, error) {
 
 	// 获取操作结果
 	opAPI := op.Get()
-	
+
 	// 检查返回码
 	if opAPI.Metadata == nil {
 		return "", fmt.Errorf("无法获取命令执行结果")
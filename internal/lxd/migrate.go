@@ -0,0 +1,122 @@
+package lxd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	lxd "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+)
+
+// MigrateContainer 将容器离线迁移到目标节点
+// 运行中的容器先停止，经本进程中转（relay）连同快照复制到目标节点后删除源容器，
+// 原先运行的容器在目标节点上重新启动；复制或删除源容器失败时删除目标节点上的副本，
+// 源容器保持不变并尝试恢复运行。
+// persist 在容器转移到目标节点后调用，用于保存所在节点
+func MigrateContainer(name, targetNode string, progress func(percent int, message string), persist func() error) (err error) {
+	defer observe("migrate", time.Now(), &err)
+	if progress == nil {
+		progress = func(int, string) {}
+	}
+
+	sourceNode := ContainerNode(name)
+	if nodeLabel(targetNode) == sourceNode {
+		return fmt.Errorf("容器已在节点 %s 上", sourceNode)
+	}
+
+	source, err := NodeClient(sourceNode)
+	if err != nil {
+		return err
+	}
+	target, err := NodeClient(targetNode)
+	if err != nil {
+		return err
+	}
+
+	instance, _, err := source.GetInstance(name)
+	if err != nil {
+		return fmt.Errorf("获取容器配置失败: %v", err)
+	}
+	if _, _, err := target.GetInstance(name); err == nil {
+		return fmt.Errorf("目标节点 %s 上已存在同名容器", targetNode)
+	}
+
+	wasRunning := instance.StatusCode == api.Running
+	if wasRunning {
+		progress(10, "停止源容器")
+		if err := changeState(source, name, "stop"); err != nil {
+			return fmt.Errorf("停止容器失败: %v", err)
+		}
+	}
+
+	progress(30, fmt.Sprintf("复制容器到节点 %s", targetNode))
+	op, err := target.CopyInstance(source, *instance, &lxd.InstanceCopyArgs{
+		InstanceOnly: false,
+		Mode:         "relay",
+	})
+	if err == nil {
+		err = op.Wait()
+	}
+	if err != nil {
+		restoreSource(source, name, wasRunning)
+		return fmt.Errorf("复制容器失败: %v", err)
+	}
+
+	progress(70, "删除源容器")
+	if err := deleteInstance(source, name); err != nil {
+		// 不能同时保留两份容器，删除目标节点上的副本，迁移失败
+		if cleanupErr := deleteInstance(target, name); cleanupErr != nil {
+			return fmt.Errorf("删除源容器失败: %v；清理目标节点 %s 上的副本也失败: %v", err, targetNode, cleanupErr)
+		}
+		restoreSource(source, name, wasRunning)
+		return fmt.Errorf("删除源容器失败: %v", err)
+	}
+	setPlacement(name, nodeLabel(targetNode))
+	if persist != nil {
+		if err := persist(); err != nil {
+			return fmt.Errorf("容器已迁移到节点 %s，但保存所在节点失败: %v", targetNode, err)
+		}
+	}
+
+	if wasRunning {
+		progress(90, "在目标节点启动容器")
+		if err := changeState(target, name, "start"); err != nil {
+			return fmt.Errorf("容器已迁移，但在目标节点启动失败: %v", err)
+		}
+	}
+
+	log.Printf("容器 %s 已从节点 %s 迁移到 %s", name, sourceNode, nodeLabel(targetNode))
+	return nil
+}
+
+// restoreSource 迁移失败时恢复源容器的运行状态
+func restoreSource(source lxd.InstanceServer, name string, wasRunning bool) {
+	if !wasRunning {
+		return
+	}
+	if err := changeState(source, name, "start"); err != nil {
+		log.Printf("容器 %s 迁移失败后恢复运行失败: %v", name, err)
+	}
+}
+
+// deleteInstance 删除容器并等待完成
+func deleteInstance(client lxd.InstanceServer, name string) error {
+	op, err := client.DeleteInstance(name)
+	if err != nil {
+		return err
+	}
+	return op.Wait()
+}
+
+// changeState 修改容器运行状态并等待完成
+func changeState(client lxd.InstanceServer, name, action string) error {
+	op, err := client.UpdateInstanceState(name, api.InstanceStatePut{
+		Action:  action,
+		Timeout: 30,
+	}, "")
+	if err != nil {
+		return err
+	}
+	return op.Wait()
+}
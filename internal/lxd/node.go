@@ -0,0 +1,154 @@
+package lxd
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	lxd "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared"
+)
+
+// LocalNode 本机 LXD（Unix socket）的节点名
+const LocalNode = "local"
+
+var (
+	nodesMu     sync.RWMutex
+	nodeClients = make(map[string]lxd.InstanceServer)
+	// placements 本进程创建的容器所在节点，用于数据库记录写入之前的操作
+	placements = make(map[string]string)
+)
+
+// NodeResolver 查询容器所在节点，由调度器在启动时设置；未设置或返回空时使用本机节点
+var NodeResolver func(containerName string) string
+
+// ConnectNode 连接远程 LXD 节点，只信任登记时记录的服务器证书
+func ConnectNode(url, certificate, key, serverCertificate string) (lxd.InstanceServer, error) {
+	if serverCertificate == "" {
+		return nil, fmt.Errorf("节点未登记服务器证书")
+	}
+
+	args := &lxd.ConnectionArgs{
+		TLSClientCert: certificate,
+		TLSClientKey:  key,
+		TLSServerCert: serverCertificate,
+		UserAgent:     "OpenLXD",
+	}
+
+	client, err := lxd.ConnectLXD(url, args)
+	if err != nil {
+		return nil, fmt.Errorf("连接远程 LXD 失败: %v", err)
+	}
+	return client, nil
+}
+
+// FetchServerCertificate 获取远程 LXD 节点当前的服务器证书（PEM），用于登记节点时固定证书
+func FetchServerCertificate(url string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cert, err := shared.GetRemoteCertificate(ctx, url, "OpenLXD")
+	if err != nil {
+		return "", fmt.Errorf("获取节点服务器证书失败: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})), nil
+}
+
+// RegisterNode 注册远程节点客户端
+func RegisterNode(name string, client lxd.InstanceServer) {
+	nodesMu.Lock()
+	defer nodesMu.Unlock()
+
+	nodeClients[name] = client
+}
+
+// UnregisterNode 移除远程节点客户端
+func UnregisterNode(name string) {
+	nodesMu.Lock()
+	defer nodesMu.Unlock()
+
+	if client, ok := nodeClients[name]; ok {
+		client.Disconnect()
+		delete(nodeClients, name)
+	}
+}
+
+// NodeNames 获取所有可用节点名（含本机）
+func NodeNames() []string {
+	nodesMu.RLock()
+	defer nodesMu.RUnlock()
+
+	names := make([]string, 0, len(nodeClients)+1)
+	if Client != nil {
+		names = append(names, LocalNode)
+	}
+	for name := range nodeClients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NodeClient 获取节点的 LXD 客户端，节点名为空时返回本机客户端
+func NodeClient(node string) (lxd.InstanceServer, error) {
+	if node == "" || node == LocalNode {
+		if Client == nil {
+			return nil, fmt.Errorf("LXD 客户端未初始化")
+		}
+		return Client, nil
+	}
+
+	nodesMu.RLock()
+	defer nodesMu.RUnlock()
+
+	client, ok := nodeClients[node]
+	if !ok {
+		return nil, fmt.Errorf("节点 %s 未连接", node)
+	}
+	return client, nil
+}
+
+// ContainerNode 获取容器所在节点
+func ContainerNode(containerName string) string {
+	if NodeResolver != nil {
+		if node := NodeResolver(containerName); node != "" {
+			return node
+		}
+	}
+
+	nodesMu.RLock()
+	defer nodesMu.RUnlock()
+
+	if node, ok := placements[containerName]; ok {
+		return node
+	}
+	return LocalNode
+}
+
+// setPlacement 记录容器所在节点，node 为空时清除
+func setPlacement(containerName, node string) {
+	nodesMu.Lock()
+	defer nodesMu.Unlock()
+
+	if node == "" {
+		delete(placements, containerName)
+		return
+	}
+	placements[containerName] = node
+}
+
+// nodeLabel 节点显示名，空节点名显示为本机节点
+func nodeLabel(node string) string {
+	if node == "" {
+		return LocalNode
+	}
+	return node
+}
+
+// ContainerClient 获取容器所在节点的 LXD 客户端
+func ContainerClient(containerName string) (lxd.InstanceServer, error) {
+	return NodeClient(ContainerNode(containerName))
+}
@@ -0,0 +1,13 @@
+package lxd
+
+import "time"
+
+// OperationObserver 记录 LXD 操作耗时和结果（由监控模块设置）
+var OperationObserver func(operation string, duration time.Duration, err error)
+
+// observe 上报操作耗时，在函数入口 defer 调用
+func observe(operation string, start time.Time, err *error) {
+	if OperationObserver != nil {
+		OperationObserver(operation, time.Since(start), *err)
+	}
+}
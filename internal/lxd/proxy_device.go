@@ -0,0 +1,151 @@
+package lxd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProxyDevicePrefix OpenLXD 管理的 proxy 设备名前缀
+const ProxyDevicePrefix = "olxd-pm-"
+
+// ProxyDevice LXD proxy 设备配置
+type ProxyDevice struct {
+	Name          string
+	Protocol      string // tcp, udp
+	ListenIP      string // 宿主机监听地址，空表示所有地址
+	ListenPort    int
+	ConnectIP     string // 容器内目标地址
+	ConnectPort   int
+	NAT           bool // 使用 nat=true 由内核转发
+	ProxyProtocol bool // 发送 HAProxy PROXY 协议头以保留客户端IP
+}
+
+// ProxyDeviceName 根据端口映射ID和协议生成设备名
+func ProxyDeviceName(mappingID uint, protocol string) string {
+	return fmt.Sprintf("%s%d-%s", ProxyDevicePrefix, mappingID, protocol)
+}
+
+// IsManagedProxyDevice 判断设备是否由 OpenLXD 创建
+func IsManagedProxyDevice(name string, device map[string]string) bool {
+	return strings.HasPrefix(name, ProxyDevicePrefix) && device["type"] == "proxy"
+}
+
+// Config 生成 LXD 设备配置
+func (d ProxyDevice) Config() map[string]string {
+	listenIP := d.ListenIP
+	if listenIP == "" {
+		listenIP = "0.0.0.0"
+	}
+
+	config := map[string]string{
+		"type":    "proxy",
+		"listen":  fmt.Sprintf("%s:%s:%d", d.Protocol, listenIP, d.ListenPort),
+		"connect": fmt.Sprintf("%s:%s:%d", d.Protocol, d.ConnectIP, d.ConnectPort),
+	}
+	if d.NAT {
+		config["nat"] = "true"
+	}
+	if d.ProxyProtocol {
+		config["proxy_protocol"] = "true"
+	}
+
+	return config
+}
+
+// AddProxyDevice 为容器添加 proxy 设备
+func AddProxyDevice(containerName string, device ProxyDevice) error {
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return err
+	}
+
+	if device.NAT && device.ProxyProtocol {
+		return fmt.Errorf("nat 模式不支持 proxy_protocol")
+	}
+
+	// 获取当前容器配置
+	container, etag, err := client.GetInstance(containerName)
+	if err != nil {
+		return fmt.Errorf("获取容器配置失败: %v", err)
+	}
+
+	if container.Devices == nil {
+		container.Devices = make(map[string]map[string]string)
+	}
+	container.Devices[device.Name] = device.Config()
+
+	// 更新容器配置
+	op, err := client.UpdateInstance(containerName, container.Writable(), etag)
+	if err != nil {
+		return fmt.Errorf("添加 proxy 设备失败: %v", err)
+	}
+
+	// 等待操作完成
+	err = op.Wait()
+	if err != nil {
+		return fmt.Errorf("proxy 设备添加操作失败: %v", err)
+	}
+
+	return nil
+}
+
+// RemoveProxyDevices 从容器删除 proxy 设备（不存在的设备忽略）
+func RemoveProxyDevices(containerName string, deviceNames []string) error {
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return err
+	}
+
+	// 获取当前容器配置
+	container, etag, err := client.GetInstance(containerName)
+	if err != nil {
+		return fmt.Errorf("获取容器配置失败: %v", err)
+	}
+
+	changed := false
+	for _, name := range deviceNames {
+		if _, exists := container.Devices[name]; exists {
+			delete(container.Devices, name)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	// 更新容器配置
+	op, err := client.UpdateInstance(containerName, container.Writable(), etag)
+	if err != nil {
+		return fmt.Errorf("删除 proxy 设备失败: %v", err)
+	}
+
+	// 等待操作完成
+	err = op.Wait()
+	if err != nil {
+		return fmt.Errorf("proxy 设备删除操作失败: %v", err)
+	}
+
+	return nil
+}
+
+// ListProxyDevices 获取容器上由 OpenLXD 管理的 proxy 设备
+func ListProxyDevices(containerName string) (map[string]map[string]string, error) {
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	container, _, err := client.GetInstance(containerName)
+	if err != nil {
+		return nil, fmt.Errorf("获取容器配置失败: %v", err)
+	}
+
+	devices := make(map[string]map[string]string)
+	for name, device := range container.Devices {
+		if IsManagedProxyDevice(name, device) {
+			devices[name] = device
+		}
+	}
+
+	return devices, nil
+}
@@ -0,0 +1,203 @@
+package lxd
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	lxd "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+)
+
+// LXD 的 MB/GB 为十进制单位
+const (
+	bytesPerMB = int64(1000 * 1000)
+	bytesPerGB = int64(1000 * 1000 * 1000)
+)
+
+// ResizeSpec 容器目标规格，值为 0 表示不修改
+type ResizeSpec struct {
+	CPUs     int `json:"cpus"`
+	MemoryMB int `json:"memory"`
+	DiskGB   int `json:"disk"`
+}
+
+// IsEmpty 是否没有任何修改
+func (s ResizeSpec) IsEmpty() bool {
+	return s.CPUs == 0 && s.MemoryMB == 0 && s.DiskGB == 0
+}
+
+// ResizeContainer 在线调整容器规格
+// 在容器所在节点上先检查宿主机容量和存储池剩余空间，再以 ETag 一次性提交所有修改；
+// persist 用于保存数据库，返回错误时将 LXD 配置回滚到调整前
+func ResizeContainer(name string, spec ResizeSpec, persist func() error) (err error) {
+	defer observe("resize", time.Now(), &err)
+	client, err := ContainerClient(name)
+	if err != nil {
+		return err
+	}
+	if spec.CPUs < 0 || spec.MemoryMB < 0 || spec.DiskGB < 0 {
+		return fmt.Errorf("规格不能为负数")
+	}
+	if spec.IsEmpty() {
+		return fmt.Errorf("没有需要调整的规格")
+	}
+
+	instance, etag, err := client.GetInstance(name)
+	if err != nil {
+		return fmt.Errorf("获取容器配置失败: %v", err)
+	}
+	original := instance.Writable()
+
+	if err := validateResize(client, instance, spec); err != nil {
+		return err
+	}
+
+	updated := instance.Writable()
+	updated.Config = copyStringMap(original.Config)
+	updated.Devices = make(map[string]map[string]string, len(original.Devices))
+	for device, config := range original.Devices {
+		updated.Devices[device] = copyStringMap(config)
+	}
+
+	if spec.CPUs > 0 {
+		updated.Config["limits.cpu"] = strconv.Itoa(spec.CPUs)
+	}
+	if spec.MemoryMB > 0 {
+		updated.Config["limits.memory"] = fmt.Sprintf("%dMB", spec.MemoryMB)
+	}
+	if spec.DiskGB > 0 {
+		// 根磁盘来自 profile 时需要在容器上覆盖该设备
+		root, ok := updated.Devices["root"]
+		if !ok {
+			root = copyStringMap(instance.ExpandedDevices["root"])
+			if len(root) == 0 {
+				return fmt.Errorf("容器没有根磁盘设备")
+			}
+		}
+		root["size"] = fmt.Sprintf("%dGB", spec.DiskGB)
+		updated.Devices["root"] = root
+	}
+
+	op, err := client.UpdateInstance(name, updated, etag)
+	if err != nil {
+		return fmt.Errorf("调整规格失败: %v", err)
+	}
+	if err := op.Wait(); err != nil {
+		return fmt.Errorf("调整规格操作失败: %v", err)
+	}
+
+	if persist == nil {
+		return nil
+	}
+	if err := persist(); err != nil {
+		if rbErr := rollbackResize(client, name, original); rbErr != nil {
+			log.Printf("容器 %s 规格回滚失败: %v", name, rbErr)
+			return fmt.Errorf("保存规格失败: %v（LXD 回滚失败: %v）", err, rbErr)
+		}
+		return fmt.Errorf("保存规格失败，已回滚: %v", err)
+	}
+
+	return nil
+}
+
+// rollbackResize 恢复调整前的配置
+func rollbackResize(client lxd.InstanceServer, name string, original api.InstancePut) error {
+	_, etag, err := client.GetInstance(name)
+	if err != nil {
+		return err
+	}
+	op, err := client.UpdateInstance(name, original, etag)
+	if err != nil {
+		return err
+	}
+	return op.Wait()
+}
+
+// validateResize 检查宿主机 CPU、内存和存储池容量，以及磁盘缩容是否低于已用空间
+func validateResize(client lxd.InstanceServer, instance *api.Instance, spec ResizeSpec) error {
+	resources, err := client.GetServerResources()
+	if err != nil {
+		return fmt.Errorf("获取宿主机资源失败: %v", err)
+	}
+
+	if spec.CPUs > 0 && uint64(spec.CPUs) > resources.CPU.Total {
+		return fmt.Errorf("CPU 核心数超过宿主机容量 (%d/%d)", spec.CPUs, resources.CPU.Total)
+	}
+
+	if spec.MemoryMB > 0 {
+		current := ParseSize(instance.ExpandedConfig["limits.memory"])
+		increase := int64(spec.MemoryMB)*bytesPerMB - current
+		free := int64(resources.Memory.Total) - int64(resources.Memory.Used)
+		if current > 0 && increase > free {
+			return fmt.Errorf("宿主机可用内存不足 (需要增加 %d MB, 可用 %d MB)", increase/bytesPerMB, free/bytesPerMB)
+		}
+		if current == 0 && int64(spec.MemoryMB)*bytesPerMB > int64(resources.Memory.Total) {
+			return fmt.Errorf("内存超过宿主机容量 (%d MB/%d MB)", spec.MemoryMB, int64(resources.Memory.Total)/bytesPerMB)
+		}
+	}
+
+	if spec.DiskGB > 0 {
+		target := int64(spec.DiskGB) * bytesPerGB
+
+		state, _, err := client.GetInstanceState(instance.Name)
+		if err != nil {
+			return fmt.Errorf("获取容器状态失败: %v", err)
+		}
+		if usage := state.Disk["root"].Usage; usage > target {
+			return fmt.Errorf("磁盘不能缩小到已用空间以下 (已用 %.2f GB)", float64(usage)/float64(bytesPerGB))
+		}
+
+		root := instance.ExpandedDevices["root"]
+		if pool := root["pool"]; pool != "" {
+			poolResources, err := client.GetStoragePoolResources(pool)
+			if err != nil {
+				return fmt.Errorf("获取存储池 %s 容量失败: %v", pool, err)
+			}
+			increase := target - ParseSize(root["size"])
+			free := int64(poolResources.Space.Total) - int64(poolResources.Space.Used)
+			if increase > 0 && increase > free {
+				return fmt.Errorf("存储池 %s 剩余空间不足 (需要增加 %.2f GB, 可用 %.2f GB)",
+					pool, float64(increase)/float64(bytesPerGB), float64(free)/float64(bytesPerGB))
+			}
+		}
+	}
+
+	return nil
+}
+
+// ParseSize 解析 LXD 大小字符串（如 512MB、2GiB）为字节，无法解析时返回 0
+func ParseSize(size string) int64 {
+	size = strings.TrimSpace(size)
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+		{"TB", 1000 * bytesPerGB}, {"GB", bytesPerGB}, {"MB", bytesPerMB}, {"kB", 1000}, {"KB", 1000}, {"B", 1},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(size, unit.suffix) {
+			value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(size, unit.suffix)), 64)
+			if err != nil {
+				return 0
+			}
+			return int64(value * float64(unit.factor))
+		}
+	}
+	value, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	copied := make(map[string]string, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
@@ -8,9 +8,11 @@ import (
 )
 
 // CreateSnapshot 创建容器快照
-func CreateSnapshot(containerName, snapshotName string, stateful bool) error {
-	if Client == nil {
-		return fmt.Errorf("LXD 客户端未初始化")
+func CreateSnapshot(containerName, snapshotName string, stateful bool) (err error) {
+	defer observe("snapshot_create", time.Now(), &err)
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return err
 	}
 
 	// 如果没有指定快照名称，使用时间戳
@@ -25,7 +27,7 @@ func CreateSnapshot(containerName, snapshotName string, stateful bool) error {
 	}
 
 	// 创建快照
-	op, err := Client.CreateInstanceSnapshot(containerName, req)
+	op, err := client.CreateInstanceSnapshot(containerName, req)
 	if err != nil {
 		return fmt.Errorf("创建快照失败: %v", err)
 	}
@@ -41,11 +43,12 @@ func CreateSnapshot(containerName, snapshotName string, stateful bool) error {
 
 // ListSnapshots 列出容器的所有快照
 func ListSnapshots(containerName string) ([]lxdapi.InstanceSnapshot, error) {
-	if Client == nil {
-		return nil, fmt.Errorf("LXD 客户端未初始化")
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return nil, err
 	}
 
-	snapshots, err := Client.GetInstanceSnapshots(containerName)
+	snapshots, err := client.GetInstanceSnapshots(containerName)
 	if err != nil {
 		return nil, fmt.Errorf("获取快照列表失败: %v", err)
 	}
@@ -55,11 +58,12 @@ func ListSnapshots(containerName string) ([]lxdapi.InstanceSnapshot, error) {
 
 // GetSnapshot 获取快照详情
 func GetSnapshot(containerName, snapshotName string) (*lxdapi.InstanceSnapshot, error) {
-	if Client == nil {
-		return nil, fmt.Errorf("LXD 客户端未初始化")
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return nil, err
 	}
 
-	snapshot, _, err := Client.GetInstanceSnapshot(containerName, snapshotName)
+	snapshot, _, err := client.GetInstanceSnapshot(containerName, snapshotName)
 	if err != nil {
 		return nil, fmt.Errorf("获取快照详情失败: %v", err)
 	}
@@ -68,9 +72,11 @@ func GetSnapshot(containerName, snapshotName string) (*lxdapi.InstanceSnapshot,
 }
 
 // RestoreSnapshot 恢复容器到指定快照
-func RestoreSnapshot(containerName, snapshotName string) error {
-	if Client == nil {
-		return fmt.Errorf("LXD 客户端未初始化")
+func RestoreSnapshot(containerName, snapshotName string) (err error) {
+	defer observe("snapshot_restore", time.Now(), &err)
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return err
 	}
 
 	// 恢复快照请求
@@ -79,7 +85,7 @@ func RestoreSnapshot(containerName, snapshotName string) error {
 	}
 
 	// 执行恢复操作
-	op, err := Client.UpdateInstance(containerName, req, "")
+	op, err := client.UpdateInstance(containerName, req, "")
 	if err != nil {
 		return fmt.Errorf("恢复快照失败: %v", err)
 	}
@@ -94,13 +100,15 @@ func RestoreSnapshot(containerName, snapshotName string) error {
 }
 
 // DeleteSnapshot 删除容器快照
-func DeleteSnapshot(containerName, snapshotName string) error {
-	if Client == nil {
-		return fmt.Errorf("LXD 客户端未初始化")
+func DeleteSnapshot(containerName, snapshotName string) (err error) {
+	defer observe("snapshot_delete", time.Now(), &err)
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return err
 	}
 
 	// 删除快照
-	op, err := Client.DeleteInstanceSnapshot(containerName, snapshotName)
+	op, err := client.DeleteInstanceSnapshot(containerName, snapshotName)
 	if err != nil {
 		return fmt.Errorf("删除快照失败: %v", err)
 	}
@@ -116,8 +124,9 @@ func DeleteSnapshot(containerName, snapshotName string) error {
 
 // RenameSnapshot 重命名容器快照
 func RenameSnapshot(containerName, oldName, newName string) error {
-	if Client == nil {
-		return fmt.Errorf("LXD 客户端未初始化")
+	client, err := ContainerClient(containerName)
+	if err != nil {
+		return err
 	}
 
 	// 重命名快照请求
@@ -126,7 +135,7 @@ func RenameSnapshot(containerName, oldName, newName string) error {
 	}
 
 	// 执行重命名操作
-	op, err := Client.RenameInstanceSnapshot(containerName, oldName, req)
+	op, err := client.RenameInstanceSnapshot(containerName, oldName, req)
 	if err != nil {
 		return fmt.Errorf("重命名快照失败: %v", err)
 	}
@@ -0,0 +1,360 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/lxd"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/monitor"
+	quotapkg "github.com/openlxd/backend/internal/quota"
+	"github.com/openlxd/backend/internal/ratelimit"
+)
+
+// 指标名前缀
+const namespace = "openlxd"
+
+var (
+	httpDuration = NewHistogramVec(namespace+"_http_request_duration_seconds",
+		"HTTP 请求耗时，status 为状态码类别（2xx/4xx/5xx）", nil, "route", "method", "status")
+	httpErrors = NewCounterVec(namespace+"_http_request_errors_total",
+		"HTTP 错误响应数（状态码或响应体中的 code >= 400）", "route", "method", "code")
+	lxdDuration = NewHistogramVec(namespace+"_lxd_operation_duration_seconds",
+		"LXD 操作耗时", []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}, "operation", "result")
+	rateLimited = NewCounterVec(namespace+"_ratelimit_throttled_total",
+		"被限流拒绝的请求数", "class")
+)
+
+// Init 注册 LXD 操作耗时和限流次数的采集
+func Init() {
+	lxd.OperationObserver = ObserveLXD
+	ratelimit.ThrottleObserver = func(class string) {
+		rateLimited.Inc(class)
+	}
+}
+
+// ObserveLXD 记录 LXD 操作耗时
+func ObserveLXD(operation string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	lxdDuration.Observe(duration.Seconds(), operation, result)
+}
+
+// ObserveHTTP 记录 HTTP 请求耗时和错误
+func ObserveHTTP(route, method string, status int, duration time.Duration) {
+	httpDuration.Observe(duration.Seconds(), route, method, fmt.Sprintf("%dxx", status/100))
+	if status >= 400 {
+		httpErrors.Inc(route, method, strconv.Itoa(status))
+	}
+}
+
+// Middleware 统计经过 mux 的所有请求，route 取匹配到的路由模式以控制标签数量
+func Middleware(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		mux.ServeHTTP(recorder, r)
+
+		// 大部分接口以 HTTP 200 返回，错误码在响应体的 code 中
+		status := recorder.status
+		if status < 400 && recorder.code != 0 {
+			status = recorder.code
+		}
+		ObserveHTTP(route, r.Method, status, time.Since(start))
+	})
+}
+
+// ReportCode 记录响应体中的 code，由总是返回 HTTP 200 的响应函数调用
+func ReportCode(w http.ResponseWriter, code int) {
+	for {
+		if recorder, ok := w.(*statusRecorder); ok {
+			recorder.code = code
+			return
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// statusRecorder 记录响应状态码和响应体中的 code
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	code        int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush 支持流式响应
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 访问底层连接（如 SSE 取消写超时）
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack 支持 WebSocket 等连接升级
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("连接不支持 Hijack")
+	}
+	return hijacker.Hijack()
+}
+
+// Handler Prometheus 采集端点，需携带采集令牌（Authorization: Bearer <token> 或 ?token=）
+func Handler(w http.ResponseWriter, r *http.Request) {
+	expected := config.GetConfig().Metrics.ScrapeToken
+	if expected == "" {
+		http.Error(w, "未配置采集令牌", http.StatusForbidden)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		http.Error(w, "采集令牌无效", http.StatusUnauthorized)
+		return
+	}
+
+	var buf bytes.Buffer
+	writeHostMetrics(&buf)
+	writeContainerMetrics(&buf)
+	writeQuotaMetrics(&buf)
+	httpDuration.Write(&buf)
+	httpErrors.Write(&buf)
+	lxdDuration.Write(&buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// gauge 输出单个无标签的 gauge
+func gauge(w io.Writer, name, help string, value float64) {
+	WriteHeader(w, name, help, "gauge")
+	WriteSample(w, name, nil, value)
+}
+
+// writeHostMetrics 宿主机 CPU、内存、磁盘、网络和负载
+func writeHostMetrics(w io.Writer) {
+	// 读取采集循环的最近一次采样，重新采集会重置网络速率的计算基准
+	metric := monitor.GlobalCollector.Latest()
+	if metric == nil {
+		return
+	}
+
+	const mb = 1024 * 1024
+	gauge(w, namespace+"_host_cpu_usage_percent", "宿主机 CPU 使用率", metric.CPUUsage)
+	gauge(w, namespace+"_host_memory_total_bytes", "宿主机内存总量", float64(metric.MemoryTotal)*mb)
+	gauge(w, namespace+"_host_memory_used_bytes", "宿主机已用内存", float64(metric.MemoryUsed)*mb)
+	gauge(w, namespace+"_host_memory_usage_percent", "宿主机内存使用率", metric.MemoryUsage)
+	gauge(w, namespace+"_host_disk_total_bytes", "宿主机磁盘总量", float64(metric.DiskTotal)*1024*mb)
+	gauge(w, namespace+"_host_disk_used_bytes", "宿主机已用磁盘", float64(metric.DiskUsed)*1024*mb)
+	gauge(w, namespace+"_host_disk_usage_percent", "宿主机磁盘使用率", metric.DiskUsage)
+	gauge(w, namespace+"_host_network_receive_bytes_per_second", "宿主机网络接收速率", metric.NetworkRxRate*mb)
+	gauge(w, namespace+"_host_network_transmit_bytes_per_second", "宿主机网络发送速率", metric.NetworkTxRate*mb)
+
+	WriteHeader(w, namespace+"_host_load", "宿主机系统负载", "gauge")
+	WriteSample(w, namespace+"_host_load", []Label{{"period", "1m"}}, metric.LoadAverage1)
+	WriteSample(w, namespace+"_host_load", []Label{{"period", "5m"}}, metric.LoadAverage5)
+	WriteSample(w, namespace+"_host_load", []Label{{"period", "15m"}}, metric.LoadAverage15)
+}
+
+// containerSeries 单个容器的一组样本
+type containerSeries struct {
+	labels []Label
+	value  float64
+}
+
+// writeContainerMetrics 容器资源配置、实时资源使用和流量
+// 实时数据每个节点只请求一次 LXD，LXD 不可用时只输出数据库中的配置
+func writeContainerMetrics(w io.Writer) {
+	var containers []models.Container
+	if err := models.DB.Order("id ASC").Find(&containers).Error; err != nil {
+		return
+	}
+	usernames := loadUsernames()
+
+	states, _ := lxd.ListContainerStates()
+
+	series := make(map[string][]containerSeries)
+	add := func(name string, labels []Label, value float64) {
+		series[name] = append(series[name], containerSeries{labels, value})
+	}
+
+	for _, container := range containers {
+		labels := []Label{
+			{"hostname", container.Hostname},
+			{"user", usernames[container.UserID]},
+			{"node", container.Node},
+		}
+
+		add("cpu_limit", labels, float64(container.CPUs))
+		add("memory_limit_bytes", labels, float64(container.Memory)*1e6)
+		add("disk_limit_bytes", labels, float64(container.Disk)*1e9)
+		add("traffic_used_bytes", labels, float64(container.TrafficUsed))
+		add("traffic_limit_bytes", labels, float64(container.TrafficLimit))
+
+		state, ok := states[container.Hostname]
+		if !ok {
+			continue
+		}
+		up := 0.0
+		if state.Status == "Running" {
+			up = 1
+		}
+		add("up", labels, up)
+		add("cpu_seconds_total", labels, float64(state.CPU.Usage)/1e9)
+		add("memory_usage_bytes", labels, float64(state.Memory.Usage))
+		add("processes", labels, float64(state.Processes))
+		if root, ok := state.Disk["root"]; ok {
+			add("disk_usage_bytes", labels, float64(root.Usage))
+		}
+
+		var rx, tx float64
+		for name, nic := range state.Network {
+			if name == "lo" || nic.Type == "loopback" {
+				continue
+			}
+			rx += float64(nic.Counters.BytesReceived)
+			tx += float64(nic.Counters.BytesSent)
+		}
+		add("network_receive_bytes_total", labels, rx)
+		add("network_transmit_bytes_total", labels, tx)
+	}
+
+	help := []struct{ name, help, typ string }{
+		{"up", "容器是否运行", "gauge"},
+		{"cpu_limit", "容器 CPU 核心数限制", "gauge"},
+		{"memory_limit_bytes", "容器内存限制", "gauge"},
+		{"disk_limit_bytes", "容器磁盘限制", "gauge"},
+		{"cpu_seconds_total", "容器累计 CPU 时间", "counter"},
+		{"memory_usage_bytes", "容器内存使用", "gauge"},
+		{"disk_usage_bytes", "容器根磁盘使用", "gauge"},
+		{"processes", "容器进程数", "gauge"},
+		{"network_receive_bytes_total", "容器网络接收字节数", "counter"},
+		{"network_transmit_bytes_total", "容器网络发送字节数", "counter"},
+		{"traffic_used_bytes", "容器当前计费周期已用流量", "gauge"},
+		{"traffic_limit_bytes", "容器流量限额", "gauge"},
+	}
+	for _, metric := range help {
+		samples := series[metric.name]
+		if len(samples) == 0 {
+			continue
+		}
+		name := namespace + "_container_" + metric.name
+		WriteHeader(w, name, metric.help, metric.typ)
+		for _, sample := range samples {
+			WriteSample(w, name, sample.labels, sample.value)
+		}
+	}
+}
+
+// writeQuotaMetrics 容器配额使用率（已用 / 配额），不限制（-1）或配额为 0 时不输出
+func writeQuotaMetrics(w io.Writer) {
+	var quotas []models.Quota
+	if err := models.DB.Find(&quotas).Error; err != nil || len(quotas) == 0 {
+		return
+	}
+
+	var containers []models.Container
+	models.DB.Select("id, hostname, user_id").Find(&containers)
+	byID := make(map[uint]models.Container, len(containers))
+	for _, container := range containers {
+		byID[container.ID] = container
+	}
+	usernames := loadUsernames()
+
+	ipv4 := countByContainer(&models.IPAddress{}, "type = ? AND status = ?", "ipv4", "used")
+	ipv6 := countByContainer(&models.IPAddress{}, "type = ? AND status = ?", "ipv6", "used")
+	ports := countByContainer(&models.PortMapping{}, "status = ?", "active")
+	proxies := countByContainer(&models.ProxyConfig{}, "status = ?", "active")
+
+	name := namespace + "_quota_usage_ratio"
+	WriteHeader(w, name, "容器配额使用率（已用 / 配额）", "gauge")
+	for _, quota := range quotas {
+		container, ok := byID[quota.ContainerID]
+		if !ok {
+			continue
+		}
+		ratio := func(resource string, used, limit float64) {
+			if limit <= 0 {
+				return
+			}
+			WriteSample(w, name, []Label{
+				{"hostname", container.Hostname},
+				{"user", usernames[container.UserID]},
+				{"resource", resource},
+			}, used/limit)
+		}
+		ratio("ipv4", float64(ipv4[quota.ContainerID]), float64(quota.IPv4Quota))
+		ratio("ipv6", float64(ipv6[quota.ContainerID]), float64(quota.IPv6Quota))
+		ratio("port_mapping", float64(ports[quota.ContainerID]), float64(quota.PortMappingQuota))
+		ratio("proxy", float64(proxies[quota.ContainerID]), float64(quota.ProxyQuota))
+		ratio("traffic", quotapkg.BytesToGB(quota.TrafficUsed), float64(quota.TrafficQuota))
+	}
+}
+
+// countByContainer 按容器统计记录数
+func countByContainer(model interface{}, where string, args ...interface{}) map[uint]int64 {
+	var rows []struct {
+		ContainerID uint
+		Count       int64
+	}
+	models.DB.Model(model).Select("container_id, COUNT(*) AS count").
+		Where(where, args...).Group("container_id").Scan(&rows)
+
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ContainerID] = row.Count
+	}
+	return counts
+}
+
+// loadUsernames 用户 ID 到用户名的映射
+func loadUsernames() map[uint]string {
+	var users []models.User
+	models.DB.Select("id, username").Find(&users)
+
+	names := make(map[uint]string, len(users))
+	for _, user := range users {
+		names[user.ID] = user.Username
+	}
+	return names
+}
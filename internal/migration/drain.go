@@ -0,0 +1,251 @@
+package migration
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/openlxd/backend/internal/lxd"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/network"
+	"github.com/openlxd/backend/internal/scheduler"
+	"gorm.io/gorm"
+)
+
+// 排空任务默认和最大并发迁移数
+const (
+	defaultDrainConcurrency = 2
+	maxDrainConcurrency     = 10
+)
+
+// DrainJobDetail 排空任务及其迁移任务
+type DrainJobDetail struct {
+	models.DrainJob
+	Progress int                    `json:"progress"` // 0-100
+	Tasks    []models.MigrationTask `json:"tasks"`
+}
+
+// StartDrain 将节点标记为不可调度，并把节点上的所有容器迁移走
+// 每个容器对应一个迁移任务，最多 concurrency 个同时进行；targetNode 为空时由调度器选择目标节点
+func StartDrain(node, targetNode string, concurrency int) (*models.DrainJob, error) {
+	var host models.RemoteHost
+	if err := models.DB.Where("name = ?", node).First(&host).Error; err != nil {
+		return nil, fmt.Errorf("节点 %s 不存在", node)
+	}
+	if targetNode == node {
+		return nil, fmt.Errorf("目标节点不能是被排空的节点")
+	}
+	if targetNode != "" {
+		if _, err := lxd.NodeClient(targetNode); err != nil {
+			return nil, err
+		}
+	}
+
+	if concurrency <= 0 {
+		concurrency = defaultDrainConcurrency
+	}
+	if concurrency > maxDrainConcurrency {
+		concurrency = maxDrainConcurrency
+	}
+
+	var running int64
+	models.DB.Model(&models.DrainJob{}).Where("node = ? AND status = ?", node, "running").Count(&running)
+	if running > 0 {
+		return nil, fmt.Errorf("节点 %s 正在排空", node)
+	}
+
+	// 先停止调度，避免排空过程中有新容器落到该节点
+	if err := models.DB.Model(&host).Update("schedulable", false).Error; err != nil {
+		return nil, fmt.Errorf("更新节点状态失败: %v", err)
+	}
+
+	var containers []models.Container
+	models.DB.Where("node = ?", node).Order("id ASC").Find(&containers)
+
+	job := &models.DrainJob{
+		Node:        node,
+		TargetNode:  targetNode,
+		Status:      "running",
+		Concurrency: concurrency,
+		Total:       len(containers),
+		StartTime:   time.Now(),
+	}
+	if err := models.DB.Create(job).Error; err != nil {
+		return nil, fmt.Errorf("创建排空任务失败: %v", err)
+	}
+
+	tasks := make([]models.MigrationTask, 0, len(containers))
+	for _, container := range containers {
+		task := models.MigrationTask{
+			JobID:         job.ID,
+			ContainerName: container.Hostname,
+			SourceHost:    node,
+			TargetHost:    targetNode,
+			MigrationType: "cold",
+			Status:        "pending",
+		}
+		if err := models.DB.Create(&task).Error; err != nil {
+			log.Printf("排空任务 %d 创建容器 %s 的迁移任务失败: %v", job.ID, container.Hostname, err)
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+
+	models.LogAction("drain_node", "", fmt.Sprintf("开始排空节点 %s，共 %d 个容器", node, len(containers)), "success")
+
+	go runDrain(job.ID, tasks, containers, concurrency)
+
+	return job, nil
+}
+
+// runDrain 以有限并发执行排空任务中的迁移
+func runDrain(jobID uint, tasks []models.MigrationTask, containers []models.Container, concurrency int) {
+	specs := make(map[string]models.Container, len(containers))
+	for _, container := range containers {
+		specs[container.Hostname] = container
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range tasks {
+		// 任务取消后不再启动新的迁移
+		if drainCancelled(jobID) {
+			models.DB.Model(&models.MigrationTask{}).
+				Where("job_id = ? AND status = ?", jobID, "pending").
+				Updates(map[string]interface{}{"status": "cancelled", "end_time": time.Now()})
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(task models.MigrationTask) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := migrateForDrain(&task, specs[task.ContainerName]); err != nil {
+				log.Printf("排空任务 %d 迁移容器 %s 失败: %v", jobID, task.ContainerName, err)
+				models.DB.Model(&models.DrainJob{}).Where("id = ?", jobID).
+					UpdateColumn("failed", gorm.Expr("failed + 1"))
+				return
+			}
+			models.DB.Model(&models.DrainJob{}).Where("id = ?", jobID).
+				UpdateColumn("completed", gorm.Expr("completed + 1"))
+		}(tasks[i])
+	}
+	wg.Wait()
+
+	var job models.DrainJob
+	if err := models.DB.First(&job, jobID).Error; err != nil {
+		return
+	}
+	status := "completed"
+	switch {
+	case job.Status == "cancelled":
+		status = "cancelled"
+	case job.Failed > 0 || job.Completed < job.Total:
+		status = "failed"
+	}
+	models.DB.Model(&job).Updates(map[string]interface{}{
+		"status":   status,
+		"end_time": time.Now(),
+	})
+
+	models.LogAction("drain_node", "",
+		fmt.Sprintf("节点 %s 排空结束: 成功 %d, 失败 %d, 共 %d", job.Node, job.Completed, job.Failed, job.Total), status)
+}
+
+// migrateForDrain 为迁移任务选择目标节点并执行迁移，迁移期间在目标节点上预留资源
+func migrateForDrain(task *models.MigrationTask, container models.Container) error {
+	if err := hostBoundNetwork(container.ID); err != nil {
+		updateTaskStatus(task, "failed", 0, err.Error())
+		logMigration(task.ID, "error", err.Error())
+		return err
+	}
+
+	target, release, err := scheduler.GlobalScheduler.ScheduleAndReserve(scheduler.Request{
+		Placement: scheduler.Placement{Node: task.TargetHost},
+		CPUs:      container.CPUs,
+		Memory:    container.Memory,
+		Disk:      container.Disk,
+	})
+	if err != nil {
+		updateTaskStatus(task, "failed", 0, err.Error())
+		logMigration(task.ID, "error", fmt.Sprintf("选择目标节点失败: %v", err))
+		return err
+	}
+	defer release()
+
+	task.TargetHost = target
+	models.DB.Model(task).Update("target_host", target)
+	logMigration(task.ID, "info", fmt.Sprintf("目标节点: %s", target))
+
+	return ExecuteMigration(task.ID)
+}
+
+// hostBoundNetwork 检查容器是否有绑定在源节点宿主机上的网络配置：iptables 模式的端口映射和地址池中的 IP
+// 不会随容器迁移（只有 proxy 设备模式的端口映射随容器一起迁移），迁移后容器将无法访问，此类容器不自动迁移
+func hostBoundNetwork(containerID uint) error {
+	var mappings, addresses int64
+	models.DB.Model(&models.PortMapping{}).
+		Where("container_id = ? AND (mode = ? OR mode = '' OR mode IS NULL)", containerID, network.ModeIPTables).
+		Count(&mappings)
+	models.DB.Model(&models.IPAddress{}).Where("container_id = ?", containerID).Count(&addresses)
+	if mappings == 0 && addresses == 0 {
+		return nil
+	}
+	return fmt.Errorf("容器有 %d 条 iptables 端口映射、%d 个地址池 IP 绑定在源节点上，迁移后将无法访问，请改用 proxy 模式或手动迁移", mappings, addresses)
+}
+
+// drainCancelled 排空任务是否已取消
+func drainCancelled(jobID uint) bool {
+	var job models.DrainJob
+	if err := models.DB.Select("status").First(&job, jobID).Error; err != nil {
+		return true
+	}
+	return job.Status == "cancelled"
+}
+
+// Undrain 恢复节点调度；正在进行的排空任务会被取消，已开始的迁移继续完成
+func Undrain(node string) error {
+	var host models.RemoteHost
+	if err := models.DB.Where("name = ?", node).First(&host).Error; err != nil {
+		return fmt.Errorf("节点 %s 不存在", node)
+	}
+
+	models.DB.Model(&models.DrainJob{}).
+		Where("node = ? AND status = ?", node, "running").
+		Update("status", "cancelled")
+
+	if err := models.DB.Model(&host).Update("schedulable", true).Error; err != nil {
+		return fmt.Errorf("更新节点状态失败: %v", err)
+	}
+
+	models.LogAction("undrain_node", "", fmt.Sprintf("节点 %s 恢复调度", node), "success")
+	return nil
+}
+
+// GetDrainJobs 获取排空任务列表
+func GetDrainJobs() ([]models.DrainJob, error) {
+	var jobs []models.DrainJob
+	if err := models.DB.Order("created_at DESC").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// GetDrainJob 获取排空任务详情和进度
+func GetDrainJob(jobID uint) (*DrainJobDetail, error) {
+	var detail DrainJobDetail
+	if err := models.DB.First(&detail.DrainJob, jobID).Error; err != nil {
+		return nil, err
+	}
+	models.DB.Where("job_id = ?", jobID).Order("id ASC").Find(&detail.Tasks)
+
+	if detail.Total == 0 {
+		detail.Progress = 100
+	} else {
+		detail.Progress = (detail.Completed + detail.Failed) * 100 / detail.Total
+	}
+	return &detail, nil
+}
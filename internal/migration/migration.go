@@ -5,10 +5,12 @@ import (
 	"log"
 	"time"
 
+	lxdclient "github.com/canonical/lxd/client"
+	"github.com/openlxd/backend/internal/alert"
+	"github.com/openlxd/backend/internal/events"
 	"github.com/openlxd/backend/internal/lxd"
 	"github.com/openlxd/backend/internal/models"
-	lxdclient "github.com/canonical/lxd/client"
-	lxdapi "github.com/canonical/lxd/shared/api"
+	"github.com/openlxd/backend/internal/webhook"
 )
 
 // Manager 迁移管理器
@@ -48,6 +50,9 @@ func ExecuteMigration(taskID uint) error {
 	if err := models.DB.First(&task, taskID).Error; err != nil {
 		return fmt.Errorf("任务不存在: %v", err)
 	}
+	if task.Status != "pending" {
+		return fmt.Errorf("任务状态不允许执行: %s", task.Status)
+	}
 
 	// 更新任务状态
 	updateTaskStatus(&task, "running", 0, "")
@@ -84,78 +89,31 @@ func ExecuteMigration(taskID uint) error {
 func executeColdMigration(task *models.MigrationTask) error {
 	logMigration(task.ID, "info", "开始离线迁移")
 
-	// 1. 获取目标主机连接
-	_, err := getRemoteClient(task.TargetHost)
-	if err != nil {
-		return fmt.Errorf("连接目标主机失败: %v", err)
-	}
-
-	// 2. 停止容器（如果正在运行）
-	logMigration(task.ID, "info", "停止源容器")
-	updateTaskStatus(task, "running", 10, "")
-
-	// 这里使用本地 LXD 客户端
-	sourceClient := lxd.GetClient() // 获取全局的本地客户端
-	if sourceClient == nil {
-		return fmt.Errorf("源 LXD 客户端未初始化")
+	// 1. 检查源节点和目标节点
+	if source := lxd.ContainerNode(task.ContainerName); source != task.SourceHost {
+		return fmt.Errorf("容器当前位于节点 %s，而不是 %s", source, task.SourceHost)
 	}
-
-	// 获取容器状态
-	state, _, err := sourceClient.GetInstanceState(task.ContainerName)
-	if err != nil {
-		return fmt.Errorf("获取容器状态失败: %v", err)
-	}
-
-	// 如果容器正在运行，先停止
-	if state.Status == "Running" {
-		req := lxdapi.InstanceStatePut{
-			Action:  "stop",
-			Timeout: 30,
-		}
-		op, err := sourceClient.UpdateInstanceState(task.ContainerName, req, "")
-		if err != nil {
-			return fmt.Errorf("停止容器失败: %v", err)
-		}
-		err = op.Wait()
-		if err != nil {
-			return fmt.Errorf("等待容器停止失败: %v", err)
-		}
-	}
-
-	updateTaskStatus(task, "running", 30, "")
-
-	// 3. 创建迁移请求
-	logMigration(task.ID, "info", "创建迁移请求")
-
-	// 创建迁移源
-	migrationArgs := lxdapi.InstancePost{
-		Name: task.ContainerName,
-		Migration: true,
+	if _, err := lxd.NodeClient(task.TargetHost); err != nil {
+		return fmt.Errorf("连接目标主机失败: %v", err)
 	}
 
-	op, err := sourceClient.MigrateInstance(task.ContainerName, migrationArgs)
+	// 2. 停止、复制、删除源容器并在目标节点启动
+	err := lxd.MigrateContainer(task.ContainerName, task.TargetHost, func(percent int, message string) {
+		logMigration(task.ID, "info", message)
+		updateTaskStatus(task, "running", percent, "")
+	}, func() error {
+		// 3. 更新容器所在节点
+		return models.DB.Model(&models.Container{}).
+			Where("hostname = ?", task.ContainerName).
+			Update("node", task.TargetHost).Error
+	})
 	if err != nil {
-		return fmt.Errorf("创建迁移失败: %v", err)
+		return err
 	}
 
-	updateTaskStatus(task, "running", 50, "")
-
-	// 4. 在目标主机上接收迁移
-	logMigration(task.ID, "info", "在目标主机上接收容器")
-
-	// 获取迁移操作的元数据
-	opAPI := op.Get()
-
-	// 在目标主机上创建容器（接收迁移）
-	// 注意：这里的迁移逻辑需要根据 LXD API 的实际实现调整
-	// 简化处理，直接使用导出/导入方式
-	// TODO: 实现真正的实时迁移
-	logMigration(task.ID, "warning", "当前版本使用简化的迁移方式")
-	_ = opAPI // 避免未使用变量警告
-	
-	// 简化版本：直接返回成功，实际应该实现完整的迁移逻辑
-	logMigration(task.ID, "info", "迁移功能尚在开发中，请使用导出/导入方式手动迁移")
-	return fmt.Errorf("迁移功能尚在开发中")
+	models.LogAction("migrate", task.ContainerName,
+		fmt.Sprintf("从节点 %s 迁移到 %s", task.SourceHost, task.TargetHost), "success")
+	return nil
 }
 
 // executeLiveMigration 执行在线迁移
@@ -169,6 +127,11 @@ func executeLiveMigration(task *models.MigrationTask) error {
 
 // getRemoteClient 获取远程主机客户端
 func getRemoteClient(hostName string) (lxdclient.InstanceServer, error) {
+	// 优先使用已连接的节点
+	if client, err := lxd.NodeClient(hostName); err == nil {
+		return client, nil
+	}
+
 	// 从数据库获取主机配置
 	var host models.RemoteHost
 	if err := models.DB.Where("name = ?", hostName).First(&host).Error; err != nil {
@@ -178,17 +141,10 @@ func getRemoteClient(hostName string) (lxdclient.InstanceServer, error) {
 	// 构建连接 URL
 	url := fmt.Sprintf("%s://%s:%d", host.Protocol, host.Address, host.Port)
 
-	// 创建连接参数
-	args := &lxdclient.ConnectionArgs{
-		TLSClientCert: host.Certificate,
-		TLSClientKey:  host.Key,
-		InsecureSkipVerify: true, // 生产环境应该设置为 false
-	}
-
-	// 连接远程 LXD
-	client, err := lxdclient.ConnectLXD(url, args)
+	// 连接远程 LXD（校验登记时固定的服务器证书）
+	client, err := lxd.ConnectNode(url, host.Certificate, host.Key, host.ServerCertificate)
 	if err != nil {
-		return nil, fmt.Errorf("连接远程 LXD 失败: %v", err)
+		return nil, err
 	}
 
 	return client, nil
@@ -200,6 +156,25 @@ func updateTaskStatus(task *models.MigrationTask, status string, progress int, e
 	task.Progress = progress
 	task.ErrorMessage = errorMsg
 	models.DB.Save(task)
+	events.PublishMigration(task)
+
+	switch status {
+	case "failed":
+		alert.RaiseEvent(alert.EventMigrationFailed, task.ContainerName,
+			fmt.Sprintf("容器 %s 从 %s 迁移到 %s 失败: %s", task.ContainerName, task.SourceHost, task.TargetHost, errorMsg))
+		emitMigrationEvent(webhook.EventMigrationFailed, task)
+	case "completed":
+		emitMigrationEvent(webhook.EventMigrationCompleted, task)
+	}
+}
+
+// emitMigrationEvent 发送迁移结果事件，通知容器所属用户
+func emitMigrationEvent(event string, task *models.MigrationTask) {
+	var container models.Container
+	models.DB.Select("user_id").Where("hostname = ?", task.ContainerName).First(&container)
+	webhook.Emit(event, container.UserID, map[string]interface{}{
+		"task": task,
+	})
 }
 
 // logMigration 记录迁移日志
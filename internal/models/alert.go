@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// AlertRule 告警规则
+// 指标类规则在 Metric 的值满足 Operator Threshold 并持续 Duration 秒后触发；
+// 事件类规则（container_oom、migration_failed）在事件发生时立即触发，Duration 秒后自动恢复
+type AlertRule struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:255;not null" json:"name"`
+	Metric      string    `gorm:"size:50;not null" json:"metric"`
+	Operator    string    `gorm:"size:10;default:'>'" json:"operator"` // >, >=, <, <=
+	Threshold   float64   `json:"threshold"`
+	Duration    int       `gorm:"default:0" json:"duration"`                 // 秒
+	Severity    string    `gorm:"size:20;default:'warning'" json:"severity"` // info, warning, critical
+	ContainerID uint      `gorm:"index" json:"container_id"`                 // 只作用于指定容器，0 表示全部
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Alert 告警实例，同一规则和对象只有一条未恢复的告警
+type Alert struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	RuleID      uint       `gorm:"index" json:"rule_id"`
+	RuleName    string     `gorm:"size:255" json:"rule_name"`
+	Metric      string     `gorm:"size:50" json:"metric"`
+	Severity    string     `gorm:"size:20" json:"severity"`
+	Target      string     `gorm:"size:255;index" json:"target"` // host 或容器名
+	ContainerID uint       `gorm:"index" json:"container_id"`
+	UserID      uint       `gorm:"index" json:"user_id"`       // 容器所属用户，宿主机告警为 0
+	State       string     `gorm:"size:20;index" json:"state"` // pending, firing, resolved
+	Value       float64    `json:"value"`
+	Message     string     `gorm:"type:text" json:"message"`
+	StartsAt    time.Time  `json:"starts_at"`
+	FiredAt     *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// AlertChannel 告警通知渠道
+// UserID 为 0 的渠道接收全部告警；用户创建的渠道即该用户的订阅，只接收其名下容器的告警
+type AlertChannel struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:255;not null" json:"name"`
+	Type        string    `gorm:"size:20;not null" json:"type"` // webhook, email, telegram
+	UserID      uint      `gorm:"index" json:"user_id"`
+	URL         string    `gorm:"size:1024" json:"url,omitempty"`      // webhook 地址
+	Email       string    `gorm:"size:255" json:"email,omitempty"`     // 收件人，多个用逗号分隔
+	BotToken    string    `gorm:"size:255" json:"bot_token,omitempty"` // Telegram 机器人令牌
+	ChatID      string    `gorm:"size:100" json:"chat_id,omitempty"`
+	MinSeverity string    `gorm:"size:20;default:'info'" json:"min_severity"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (AlertRule) TableName() string {
+	return "alert_rules"
+}
+
+func (Alert) TableName() string {
+	return "alerts"
+}
+
+func (AlertChannel) TableName() string {
+	return "alert_channels"
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// APIKey 用户 API 密钥，只保存 SHA-256 哈希，明文仅在创建时返回一次
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:16" json:"prefix"` // 明文前缀，用于识别密钥
+	KeyHash    string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Scopes     string     `gorm:"size:255" json:"scopes"`       // 逗号分隔：read, container:write, network:write, admin
+	AllowedIPs string     `gorm:"type:text" json:"allowed_ips"` // 逗号分隔的 IP 或 CIDR，为空时不限制
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `gorm:"size:64" json:"last_used_ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// HashAPIKey 计算 API 密钥的存储哈希
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyPrefix 密钥的展示前缀
+func APIKeyPrefix(key string) string {
+	if len(key) > 12 {
+		return key[:12]
+	}
+	return key
+}
+
+// Expired 密钥是否已过期
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// AllowsIP 客户端 IP 是否在允许列表内，列表为空时不限制
+func (k *APIKey) AllowsIP(ip string) bool {
+	if strings.TrimSpace(k.AllowedIPs) == "" {
+		return true
+	}
+	client := net.ParseIP(ip)
+	if client == nil {
+		return false
+	}
+	for _, entry := range strings.Split(k.AllowedIPs, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(client) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(client) {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyUserKey 旧版 users.api_key 明文密钥
+type legacyUserKey struct {
+	ID     uint
+	APIKey string
+	Role   string
+}
+
+// migrateLegacyAPIKeys 将旧版 users.api_key 明文密钥迁移为哈希存储的 APIKey（名称为 legacy），并删除明文列
+// 管理员的旧密钥获得 admin 权限，普通用户获得读写容器和网络的权限，与迁移前的访问范围一致
+func migrateLegacyAPIKeys() error {
+	migrator := DB.Migrator()
+	if !migrator.HasColumn(&User{}, "api_key") {
+		return nil
+	}
+
+	var legacy []legacyUserKey
+	if err := DB.Table("users").Select("id, api_key, role").Where("api_key <> ''").Scan(&legacy).Error; err != nil {
+		return err
+	}
+	for _, row := range legacy {
+		scopes := "read,container:write,network:write"
+		if row.Role == "admin" {
+			scopes = "admin"
+		}
+		key := APIKey{
+			UserID:  row.ID,
+			Name:    "legacy",
+			Prefix:  APIKeyPrefix(row.APIKey),
+			KeyHash: HashAPIKey(row.APIKey),
+			Scopes:  scopes,
+		}
+		if err := DB.Where(APIKey{KeyHash: key.KeyHash}).FirstOrCreate(&key).Error; err != nil {
+			return err
+		}
+	}
+
+	if migrator.HasIndex(&User{}, "idx_users_api_key") {
+		if err := migrator.DropIndex(&User{}, "idx_users_api_key"); err != nil {
+			return err
+		}
+	}
+	if err := migrator.DropColumn(&User{}, "api_key"); err != nil {
+		return err
+	}
+	log.Printf("已将 %d 个旧版 API 密钥迁移为哈希存储", len(legacy))
+	return nil
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditLog 审计日志，只允许追加；每条记录的 Hash 包含上一条的 Hash，形成哈希链用于篡改检测
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ActorType string    `gorm:"size:20;index" json:"actor_type"` // system, user, api_key, anonymous
+	Actor     string    `gorm:"size:100;index" json:"actor"`     // 用户名或 API Key 标识
+	UserID    uint      `gorm:"index" json:"user_id"`
+	IP        string    `gorm:"size:64" json:"ip"`
+	Method    string    `gorm:"size:10" json:"method"`
+	Route     string    `gorm:"size:255;index" json:"route"`
+	Query     string    `gorm:"type:text" json:"query"` // 已脱敏
+	Container string    `gorm:"size:255;index" json:"container"`
+	Status    int       `json:"status"`                // 响应中的业务状态码
+	Body      string    `gorm:"type:text" json:"body"` // 已脱敏的请求体
+	PrevHash  string    `gorm:"size:64" json:"prev_hash"`
+	Hash      string    `gorm:"size:64;uniqueIndex" json:"hash"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+// errAuditAppendOnly 审计日志禁止修改和删除
+var errAuditAppendOnly = errors.New("审计日志只允许追加，不能修改或删除")
+
+// errStopVerify 发现断链时提前结束遍历
+var errStopVerify = errors.New("stop")
+
+// BeforeUpdate 禁止修改审计日志
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return errAuditAppendOnly
+}
+
+// BeforeDelete 禁止删除审计日志
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return errAuditAppendOnly
+}
+
+// ComputeHash 计算记录的哈希：SHA-256(上一条 Hash + 各字段)，时间统一为 UTC 微秒精度
+func (a *AuditLog) ComputeHash() string {
+	fields := []string{
+		a.PrevHash,
+		a.CreatedAt.UTC().Format(time.RFC3339Nano),
+		a.ActorType,
+		a.Actor,
+		strconv.FormatUint(uint64(a.UserID), 10),
+		a.IP,
+		a.Method,
+		a.Route,
+		a.Query,
+		a.Container,
+		strconv.Itoa(a.Status),
+		a.Body,
+	}
+	h := sha256.New()
+	for _, field := range fields {
+		h.Write([]byte(strconv.Quote(field)))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// auditMu 保证哈希链按顺序追加
+var auditMu sync.Mutex
+
+// AppendAuditLog 追加一条审计日志并接入哈希链
+func AppendAuditLog(entry *AuditLog) error {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var last AuditLog
+		err := tx.Select("hash").Order("id DESC").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+
+		entry.ID = 0
+		entry.PrevHash = last.Hash
+		entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		entry.Hash = entry.ComputeHash()
+		return tx.Create(entry).Error
+	})
+}
+
+// AuditVerifyResult 哈希链校验结果
+type AuditVerifyResult struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	BrokenID uint   `json:"broken_id,omitempty"` // 第一条校验失败的记录
+	Reason   string `json:"reason,omitempty"`
+}
+
+// VerifyAuditChain 按 ID 顺序重算全部审计日志的哈希，检查记录是否被修改、删除或插入
+func VerifyAuditChain() (*AuditVerifyResult, error) {
+	result := &AuditVerifyResult{Valid: true}
+	prev := ""
+
+	var batch []AuditLog
+	err := DB.Order("id").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			entry := &batch[i]
+			result.Checked++
+			switch {
+			case entry.PrevHash != prev:
+				result.Reason = "与上一条记录的哈希不连续（记录被删除或插入）"
+			case entry.ComputeHash() != entry.Hash:
+				result.Reason = "记录内容与哈希不一致（记录被修改）"
+			default:
+				prev = entry.Hash
+				continue
+			}
+			result.Valid = false
+			result.BrokenID = entry.ID
+			return errStopVerify
+		}
+		return nil
+	}).Error
+	if err != nil && !errors.Is(err, errStopVerify) {
+		return nil, err
+	}
+	return result, nil
+}
+
+// protectAuditLog 在数据库层面禁止修改和删除审计日志（绕过 ORM 的直接 SQL 同样会被拒绝）
+func protectAuditLog() error {
+	for _, op := range []string{"UPDATE", "DELETE"} {
+		sql := fmt.Sprintf(
+			"CREATE TRIGGER IF NOT EXISTS audit_logs_no_%s BEFORE %s ON audit_logs BEGIN SELECT RAISE(ABORT, 'audit_logs is append-only'); END",
+			strings.ToLower(op), op)
+		if err := DB.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Certificate ACME 证书模型
+type Certificate struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Domain    string     `gorm:"uniqueIndex;not null" json:"domain"`
+	CertPath  string     `json:"cert_path"`
+	KeyPath   string     `json:"key_path"`
+	Issuer    string     `json:"issuer"`
+	Challenge string     `json:"challenge"` // http-01, dns-01
+	NotBefore time.Time  `json:"not_before"`
+	NotAfter  time.Time  `gorm:"index" json:"not_after"`
+	AutoRenew bool       `gorm:"default:true" json:"auto_renew"`
+	Status    string     `gorm:"default:'pending'" json:"status"` // pending, valid, failed
+	LastError string     `gorm:"type:text" json:"last_error"`
+	RetryAt   *time.Time `json:"retry_at,omitempty"` // 申请或续期失败后下次重试的时间
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
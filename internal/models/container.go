@@ -21,6 +21,9 @@ type Container struct {
 	TrafficLimit int64     `json:"traffic_limit"` // Bytes
 	UserID       uint      `gorm:"index" json:"user_id"`
 	CreatedBy    string    `gorm:"size:100" json:"created_by"`
+	Node         string    `gorm:"size:255;default:local;index" json:"node"`
+	Notes        string    `gorm:"type:text" json:"notes"`
+	Labels       Labels    `gorm:"-" json:"labels,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -55,7 +58,7 @@ type NetworkConfig struct {
 type IPAddress struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
 	IP          string    `gorm:"uniqueIndex;not null" json:"ip"`
-	Type        string    `json:"type"` // ipv4, ipv6
+	Type        string    `json:"type"`                              // ipv4, ipv6
 	Status      string    `gorm:"default:'available'" json:"status"` // available, used, reserved
 	ContainerID uint      `json:"container_id"`
 	Gateway     string    `json:"gateway"`
@@ -66,54 +69,131 @@ type IPAddress struct {
 
 // PortMapping 端口映射模型
 type PortMapping struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	ContainerID  uint      `json:"container_id"`
-	ContainerIP  string    `json:"container_ip"`
-	Protocol     string    `json:"protocol"` // tcp, udp
-	ExternalPort int       `gorm:"index" json:"external_port"`
-	InternalPort int       `json:"internal_port"`
-	Description  string    `json:"description"`
-	Status       string    `gorm:"default:'active'" json:"status"` // active, inactive
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ContainerID   uint      `json:"container_id"`
+	ContainerIP   string    `json:"container_ip"`
+	PublicIP      string    `gorm:"index" json:"public_ip"` // 绑定的公网IP，空表示所有地址
+	Protocol      string    `json:"protocol"`               // tcp, udp, tcp+udp
+	ExternalPort  int       `gorm:"index" json:"external_port"`
+	InternalPort  int       `json:"internal_port"`
+	Description   string    `json:"description"`
+	Mode          string    `gorm:"default:'iptables'" json:"mode"` // iptables, proxy, proxy-nat
+	ProxyProtocol bool      `json:"proxy_protocol"`                 // proxy 模式下发送 PROXY 协议头
+	Status        string    `gorm:"default:'active'" json:"status"` // active, inactive
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
-// ProxyConfig 反向代理配置模型
-type ProxyConfig struct {
+// PortRange 端口段模型（管理员定义，租户随机端口从中分配）
+type PortRange struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
-	ContainerID uint      `json:"container_id"`
-	Domain      string    `gorm:"uniqueIndex;not null" json:"domain"`
-	TargetIP    string    `json:"target_ip"`
-	TargetPort  int       `json:"target_port"`
-	SSL         bool      `json:"ssl"`
-	CertPath    string    `json:"cert_path"`
-	KeyPath     string    `json:"key_path"`
+	PublicIP    string    `gorm:"index" json:"public_ip"`            // 空表示适用于所有地址
+	Protocol    string    `gorm:"default:'tcp+udp'" json:"protocol"` // tcp, udp, tcp+udp
+	StartPort   int       `gorm:"not null" json:"start_port"`
+	EndPort     int       `gorm:"not null" json:"end_port"`
+	Description string    `json:"description"`
 	Status      string    `gorm:"default:'active'" json:"status"` // active, inactive
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// ProxyConfig 反向代理配置模型
+type ProxyConfig struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	ContainerID     uint      `json:"container_id"`
+	Domain          string    `gorm:"uniqueIndex;not null" json:"domain"`
+	TargetIP        string    `json:"target_ip"`
+	TargetPort      int       `json:"target_port"`
+	SSL             bool      `json:"ssl"`
+	CertPath        string    `json:"cert_path"`
+	KeyPath         string    `json:"key_path"`
+	AutoCert        bool      `json:"auto_cert"`                                 // 通过 ACME 自动申请证书
+	Routes          string    `gorm:"type:text" json:"routes"`                   // JSON: 路径路由
+	Upstreams       string    `gorm:"type:text" json:"upstreams"`                // JSON: 默认路由的额外后端
+	LoadBalance     string    `gorm:"default:'round_robin'" json:"load_balance"` // round_robin, least_conn, ip_hash
+	RequestHeaders  string    `gorm:"type:text" json:"request_headers"`          // JSON: 转发到后端时添加的请求头
+	ResponseHeaders string    `gorm:"type:text" json:"response_headers"`         // JSON: 返回给客户端时添加的响应头
+	BasicAuth       string    `gorm:"type:text" json:"-"`                        // JSON: 用户名及 bcrypt 哈希
+	AllowIPs        string    `gorm:"type:text" json:"allow_ips"`                // JSON: 允许访问的 IP/CIDR
+	DenyIPs         string    `gorm:"type:text" json:"deny_ips"`                 // JSON: 拒绝访问的 IP/CIDR
+	MaxBodySize     int       `json:"max_body_size"`                             // 请求体大小上限（MB），0 表示默认
+	ForceHTTPS      bool      `json:"force_https"`                               // HTTP 请求跳转到 HTTPS
+	DisableHTTP2    bool      `json:"disable_http2"`                             // 关闭 HTTP/2
+	Status          string    `gorm:"default:'active'" json:"status"`            // active, inactive
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
 // Quota 配额模型
 type Quota struct {
-	ID               uint      `gorm:"primaryKey" json:"id"`
-	ContainerID      uint      `gorm:"uniqueIndex" json:"container_id"`
+	ID          uint `gorm:"primaryKey" json:"id"`
+	ContainerID uint `gorm:"uniqueIndex" json:"container_id"`
 	// IP地址配额
-	IPv4Quota        int       `gorm:"default:-1" json:"ipv4_quota"` // -1 表示无限制
-	IPv6Quota        int       `gorm:"default:-1" json:"ipv6_quota"`
+	IPv4Quota int `gorm:"default:-1" json:"ipv4_quota"` // -1 表示无限制
+	IPv6Quota int `gorm:"default:-1" json:"ipv6_quota"`
 	// 端口映射配额
-	PortMappingQuota int       `gorm:"default:-1" json:"port_mapping_quota"`
+	PortMappingQuota int `gorm:"default:-1" json:"port_mapping_quota"`
 	// 反向代理配额
-	ProxyQuota       int       `gorm:"default:-1" json:"proxy_quota"`
+	ProxyQuota int `gorm:"default:-1" json:"proxy_quota"`
 	// 流量配额（单位：GB）
-	TrafficQuota     int64     `gorm:"default:-1" json:"traffic_quota"` // -1 表示无限制
-	TrafficUsed      int64     `gorm:"default:0" json:"traffic_used"`   // 已使用流量
-	TrafficResetDate time.Time `json:"traffic_reset_date"`              // 流量重置日期
+	TrafficQuota     int64     `gorm:"default:-1" json:"traffic_quota"`   // -1 表示无限制
+	TrafficUsed      int64     `gorm:"default:0" json:"traffic_used"`     // 本周期已计费流量（字节，按 TrafficMode 计算）
+	TrafficIn        int64     `gorm:"default:0" json:"traffic_in"`       // 本周期入站流量（字节）
+	TrafficOut       int64     `gorm:"default:0" json:"traffic_out"`      // 本周期出站流量（字节）
+	TrafficMode      string    `gorm:"default:'sum'" json:"traffic_mode"` // in, out, sum, max
+	BillingDay       int       `gorm:"default:1" json:"billing_day"`      // 账单日（1-31，超过当月天数时取月末）
+	CycleStart       time.Time `json:"cycle_start"`                       // 本周期开始时间
+	TrafficResetDate time.Time `json:"traffic_reset_date"`                // 流量重置日期（本周期结束时间）
 	// 配额超限处理
-	OnExceed         string    `gorm:"default:'warn'" json:"on_exceed"` // warn, limit, stop
+	OnExceed   string    `gorm:"default:'warn'" json:"on_exceed"` // warn, limit, stop
+	TemplateID uint      `gorm:"index" json:"template_id"`        // 所用配额模板，0 表示自定义
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// QuotaTemplate 配额模板（套餐），可应用到容器或用户
+// 容器使用 IP、端口映射、反向代理、流量字段；用户额外使用容器数量、CPU、内存、磁盘字段，其余字段按用户合计计算
+type QuotaTemplate struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	Name             string    `gorm:"uniqueIndex;size:64;not null" json:"name"`
+	Description      string    `json:"description"`
+	IsDefault        bool      `gorm:"default:false" json:"is_default"` // 新建容器配额时默认使用
+	IPv4Quota        int       `json:"ipv4_quota"`                      // -1 表示无限制
+	IPv6Quota        int       `json:"ipv6_quota"`
+	PortMappingQuota int       `json:"port_mapping_quota"`
+	ProxyQuota       int       `json:"proxy_quota"`
+	TrafficQuota     int64     `json:"traffic_quota"` // GB
+	TrafficMode      string    `json:"traffic_mode"`  // in, out, sum, max
+	OnExceed         string    `json:"on_exceed"`     // warn, limit, stop
+	ContainerQuota   int       `json:"container_quota"`
+	CPUQuota         int       `json:"cpu_quota"`
+	MemoryQuota      int       `json:"memory_quota"` // MB
+	DiskQuota        int       `json:"disk_quota"`   // GB
 	CreatedAt        time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
 }
 
+// QuotaDeviation 与模板不一致的配额
+type QuotaDeviation struct {
+	Type     string                    `json:"type"` // container, user
+	TargetID uint                      `json:"target_id"`
+	Fields   map[string][2]interface{} `json:"fields"` // 字段 -> [模板值, 实际值]
+}
+
+// TrafficCycle 已结束的流量计费周期
+type TrafficCycle struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ContainerID  uint      `gorm:"index" json:"container_id"`
+	CycleStart   time.Time `json:"cycle_start"`
+	CycleEnd     time.Time `json:"cycle_end"`
+	InBytes      int64     `json:"in_bytes"`
+	OutBytes     int64     `json:"out_bytes"`
+	UsedBytes    int64     `json:"used_bytes"` // 按计费模式计算的流量
+	Mode         string    `json:"mode"`
+	TrafficQuota int64     `json:"traffic_quota"` // 周期结束时的配额（GB）
+	CreatedAt    time.Time `json:"created_at"`
+}
+
 // QuotaUsage 配额使用情况
 type QuotaUsage struct {
 	ContainerID      uint  `json:"container_id"`
@@ -121,10 +201,43 @@ type QuotaUsage struct {
 	IPv6Used         int   `json:"ipv6_used"`
 	PortMappingUsed  int   `json:"port_mapping_used"`
 	ProxyUsed        int   `json:"proxy_used"`
-	TrafficUsed      int64 `json:"traffic_used"`
+	TrafficUsed      int64 `json:"traffic_used"` // 字节
 	IPv4Quota        int   `json:"ipv4_quota"`
 	IPv6Quota        int   `json:"ipv6_quota"`
 	PortMappingQuota int   `json:"port_mapping_quota"`
 	ProxyQuota       int   `json:"proxy_quota"`
 	TrafficQuota     int64 `json:"traffic_quota"`
 }
+
+// UserQuota 用户（租户）配额，按用户名下所有容器汇总计算
+type UserQuota struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	UserID           uint      `gorm:"uniqueIndex" json:"user_id"`
+	ContainerQuota   int       `gorm:"default:-1" json:"container_quota"` // -1 表示无限制
+	CPUQuota         int       `gorm:"default:-1" json:"cpu_quota"`       // 核心数
+	MemoryQuota      int       `gorm:"default:-1" json:"memory_quota"`    // MB
+	DiskQuota        int       `gorm:"default:-1" json:"disk_quota"`      // GB
+	IPv4Quota        int       `gorm:"default:-1" json:"ipv4_quota"`
+	IPv6Quota        int       `gorm:"default:-1" json:"ipv6_quota"`
+	PortMappingQuota int       `gorm:"default:-1" json:"port_mapping_quota"`
+	ProxyQuota       int       `gorm:"default:-1" json:"proxy_quota"`
+	TrafficQuota     int64     `gorm:"default:-1" json:"traffic_quota"` // GB，本计费周期所有容器合计
+	TemplateID       uint      `gorm:"index" json:"template_id"`        // 所用配额模板，0 表示自定义
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// UserQuotaUsage 用户配额使用情况
+type UserQuotaUsage struct {
+	UserID          uint      `json:"user_id"`
+	Containers      int       `json:"containers"`
+	CPUs            int       `json:"cpus"`
+	Memory          int       `json:"memory"` // MB
+	Disk            int       `json:"disk"`   // GB
+	IPv4Used        int       `json:"ipv4_used"`
+	IPv6Used        int       `json:"ipv6_used"`
+	PortMappingUsed int       `json:"port_mapping_used"`
+	ProxyUsed       int       `json:"proxy_used"`
+	TrafficUsed     int64     `json:"traffic_used"` // 字节
+	Quota           UserQuota `json:"quota"`
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -26,43 +27,83 @@ func InitDB(dbPath string) error {
 		&User{},
 		&Image{},
 		&Container{},
+		&ContainerLabel{},
 		&ActionLog{},
 		&NetworkConfig{},
 		&IPAddress{},
 		&PortMapping{},
+		&PortRange{},
 		&ProxyConfig{},
+		&Certificate{},
 		&Quota{},
+		&TrafficCycle{},
+		&UserQuota{},
+		&QuotaTemplate{},
 		&SystemMetric{},
 		&ContainerMetric{},
 		&NetworkTraffic{},
+		&MetricRollup{},
 		&MigrationTask{},
 		&RemoteHost{},
 		&MigrationLog{},
+		&DrainJob{},
+		&AlertRule{},
+		&Alert{},
+		&AlertChannel{},
+		&WebhookSubscription{},
+		&WebhookDelivery{},
+		&AuditLog{},
+		&APIKey{},
+		&UserSession{},
+		&RevokedToken{},
+		&RecoveryCode{},
 	)
 	if err != nil {
 		return fmt.Errorf("数据库迁移失败: %v", err)
 	}
+	if err := protectAuditLog(); err != nil {
+		return fmt.Errorf("审计日志保护触发器创建失败: %v", err)
+	}
+	if err := migrateLegacyAPIKeys(); err != nil {
+		return fmt.Errorf("API 密钥迁移失败: %v", err)
+	}
+	if err := repairLegacyAdminHash(); err != nil {
+		return fmt.Errorf("默认管理员密码修复失败: %v", err)
+	}
 
 	// 创建默认管理员账号（如果不存在）
 	var adminCount int64
 	DB.Model(&User{}).Where("role = ?", "admin").Count(&adminCount)
 	if adminCount == 0 {
 		// 使用 bcrypt 加密密码
-		passwordHash := "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy" // admin123 的 bcrypt hash
+		passwordHash, err := bcrypt.GenerateFromPassword([]byte(defaultAdminPassword), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("生成默认管理员密码失败: %v", err)
+		}
 		adminUser := User{
 			Username:     "admin",
 			Email:        "admin@openlxd.local",
-			PasswordHash: passwordHash,
-			APIKey:       "default-api-key-please-change",
+			PasswordHash: string(passwordHash),
 			Role:         "admin",
 			Status:       "active",
 		}
-		if err := DB.Create(&adminUser).Error; err != nil {
+		defaultKey := "default-api-key-please-change"
+		err = DB.Create(&adminUser).Error
+		if err == nil {
+			err = DB.Create(&APIKey{
+				UserID:  adminUser.ID,
+				Name:    "default",
+				Prefix:  APIKeyPrefix(defaultKey),
+				KeyHash: HashAPIKey(defaultKey),
+				Scopes:  "admin",
+			}).Error
+		}
+		if err != nil {
 			log.Printf("警告: 创建默认管理员账号失败: %v", err)
 		} else {
 			log.Println("✓ 已创建默认管理员账号")
 			log.Println("  用户名: admin")
-			log.Println("  密码: admin123")
+			log.Println("  密码: " + defaultAdminPassword)
 			log.Println("  API Key: default-api-key-please-change")
 		}
 	}
@@ -71,6 +112,26 @@ func InitDB(dbPath string) error {
 	return nil
 }
 
+// defaultAdminPassword 默认管理员密码，首次登录后应立即修改
+const defaultAdminPassword = "admin123"
+
+// legacyAdminHash 旧版本写入的默认管理员密码哈希，它并不是 admin123 的哈希（旧登录逻辑硬编码放行）
+const legacyAdminHash = "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+
+// repairLegacyAdminHash 将旧版默认管理员的无效密码哈希替换为 admin123 的真实哈希，登录改为校验 bcrypt 后仍可使用默认密码登录
+func repairLegacyAdminHash() error {
+	var count int64
+	if err := DB.Model(&User{}).Where("password_hash = ?", legacyAdminHash).Count(&count).Error; err != nil || count == 0 {
+		return err
+	}
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(defaultAdminPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	log.Printf("警告: %d 个账号仍在使用默认密码 %s，请尽快修改", count, defaultAdminPassword)
+	return DB.Model(&User{}).Where("password_hash = ?", legacyAdminHash).Update("password_hash", string(passwordHash)).Error
+}
+
 // LogAction 记录操作日志
 func LogAction(action, container, description, status string) {
 	log := ActionLog{
@@ -115,5 +176,6 @@ func GetAllContainers() ([]Container, error) {
 
 // DeleteContainer 删除容器记录
 func DeleteContainer(hostname string) error {
+	DeleteContainerLabels(hostname)
 	return DB.Where("hostname = ?", hostname).Delete(&Container{}).Error
 }
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Labels 容器标签（键值对）
+type Labels map[string]string
+
+// ContainerLabel 容器标签模型
+type ContainerLabel struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	ContainerID uint      `gorm:"uniqueIndex:idx_container_label;not null" json:"container_id"`
+	Name        string    `gorm:"size:63;uniqueIndex:idx_container_label;index;not null" json:"name"`
+	Value       string    `gorm:"size:255" json:"value"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (ContainerLabel) TableName() string {
+	return "container_labels"
+}
+
+// 标签名：字母数字开头和结尾，中间允许 . _ - /，最长 63 个字符
+var labelNamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,61}[A-Za-z0-9])?$`)
+
+// ValidateLabels 校验标签名和值
+func ValidateLabels(labels Labels) error {
+	for name, value := range labels {
+		if !labelNamePattern.MatchString(name) {
+			return fmt.Errorf("标签名 %q 无效：只能包含字母、数字和 . _ - /，且以字母或数字开头和结尾，最长 63 个字符", name)
+		}
+		if len(value) > 255 {
+			return fmt.Errorf("标签 %s 的值超过 255 个字符", name)
+		}
+	}
+	return nil
+}
+
+// SetContainerLabels 替换容器的全部标签
+func SetContainerLabels(containerID uint, labels Labels) error {
+	if err := ValidateLabels(labels); err != nil {
+		return err
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("container_id = ?", containerID).Delete(&ContainerLabel{}).Error; err != nil {
+			return err
+		}
+		for name, value := range labels {
+			label := ContainerLabel{ContainerID: containerID, Name: name, Value: value}
+			if err := tx.Create(&label).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetContainerLabels 获取容器标签
+func GetContainerLabels(containerID uint) Labels {
+	var rows []ContainerLabel
+	DB.Where("container_id = ?", containerID).Find(&rows)
+
+	labels := make(Labels, len(rows))
+	for _, row := range rows {
+		labels[row.Name] = row.Value
+	}
+	return labels
+}
+
+// LoadContainerLabels 批量填充容器的 Labels 字段
+func LoadContainerLabels(containers []Container) {
+	if len(containers) == 0 {
+		return
+	}
+
+	ids := make([]uint, 0, len(containers))
+	for _, container := range containers {
+		ids = append(ids, container.ID)
+	}
+
+	var rows []ContainerLabel
+	DB.Where("container_id IN ?", ids).Find(&rows)
+
+	byContainer := make(map[uint]Labels)
+	for _, row := range rows {
+		if byContainer[row.ContainerID] == nil {
+			byContainer[row.ContainerID] = make(Labels)
+		}
+		byContainer[row.ContainerID][row.Name] = row.Value
+	}
+	for i := range containers {
+		containers[i].Labels = byContainer[containers[i].ID]
+	}
+}
+
+// WhereLabels 为容器查询添加标签过滤条件，值为空时只要求存在该标签
+func WhereLabels(query *gorm.DB, selector Labels) *gorm.DB {
+	for name, value := range selector {
+		sub := DB.Model(&ContainerLabel{}).Select("container_id").Where("name = ?", name)
+		if value != "" {
+			sub = sub.Where("value = ?", value)
+		}
+		query = query.Where("id IN (?)", sub)
+	}
+	return query
+}
+
+// DeleteContainerLabels 删除容器的全部标签（在删除容器记录前调用）
+func DeleteContainerLabels(hostname string) error {
+	ids := DB.Model(&Container{}).Select("id").Where("hostname = ?", hostname)
+	return DB.Where("container_id IN (?)", ids).Delete(&ContainerLabel{}).Error
+}
@@ -6,31 +6,51 @@ import (
 
 // MigrationTask 迁移任务
 type MigrationTask struct {
-	ID              uint      `gorm:"primaryKey" json:"id"`
-	ContainerName   string    `gorm:"size:255;not null" json:"container_name"`
-	SourceHost      string    `gorm:"size:255;not null" json:"source_host"`
-	TargetHost      string    `gorm:"size:255;not null" json:"target_host"`
-	MigrationType   string    `gorm:"size:50;not null" json:"migration_type"` // live, cold
-	Status          string    `gorm:"size:50;not null" json:"status"`          // pending, running, completed, failed, rollback
-	Progress        int       `gorm:"default:0" json:"progress"`               // 0-100
-	ErrorMessage    string    `gorm:"type:text" json:"error_message,omitempty"`
-	StartTime       time.Time `json:"start_time,omitempty"`
-	EndTime         time.Time `json:"end_time,omitempty"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
-}
-
-// RemoteHost 远程主机配置
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	JobID         uint      `gorm:"index" json:"job_id,omitempty"` // 所属排空任务
+	ContainerName string    `gorm:"size:255;not null" json:"container_name"`
+	SourceHost    string    `gorm:"size:255;not null" json:"source_host"`
+	TargetHost    string    `gorm:"size:255;not null" json:"target_host"`
+	MigrationType string    `gorm:"size:50;not null" json:"migration_type"` // live, cold
+	Status        string    `gorm:"size:50;not null" json:"status"`         // pending, running, completed, failed, rollback
+	Progress      int       `gorm:"default:0" json:"progress"`              // 0-100
+	ErrorMessage  string    `gorm:"type:text" json:"error_message,omitempty"`
+	StartTime     time.Time `json:"start_time,omitempty"`
+	EndTime       time.Time `json:"end_time,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// RemoteHost LXD 节点配置（本机节点名为 local，协议为 unix）
 type RemoteHost struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	Name              string    `gorm:"size:255;not null;uniqueIndex" json:"name"`
+	Address           string    `gorm:"size:255;not null" json:"address"`              // IP 或域名
+	Port              int       `gorm:"default:8443" json:"port"`                      // LXD API 端口
+	Protocol          string    `gorm:"size:10;default:https" json:"protocol"`         // https
+	Certificate       string    `gorm:"type:text" json:"certificate,omitempty"`        // 客户端证书
+	Key               string    `gorm:"type:text" json:"key,omitempty"`                // 客户端密钥
+	ServerCertificate string    `gorm:"type:text" json:"server_certificate,omitempty"` // 节点服务器证书（登记时固定）
+	Status            string    `gorm:"size:50;default:active" json:"status"`          // active, inactive
+	Labels            string    `gorm:"type:text" json:"labels"`                       // JSON: 节点标签，用于调度
+	Schedulable       bool      `gorm:"default:true" json:"schedulable"`               // 是否允许调度新容器
+	Description       string    `gorm:"type:text" json:"description,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// DrainJob 节点排空任务，包含多个迁移任务
+type DrainJob struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
-	Name        string    `gorm:"size:255;not null;uniqueIndex" json:"name"`
-	Address     string    `gorm:"size:255;not null" json:"address"`     // IP 或域名
-	Port        int       `gorm:"default:8443" json:"port"`             // LXD API 端口
-	Protocol    string    `gorm:"size:10;default:https" json:"protocol"` // https
-	Certificate string    `gorm:"type:text" json:"certificate,omitempty"` // 客户端证书
-	Key         string    `gorm:"type:text" json:"key,omitempty"`        // 客户端密钥
-	Status      string    `gorm:"size:50;default:active" json:"status"`  // active, inactive
-	Description string    `gorm:"type:text" json:"description,omitempty"`
+	Node        string    `gorm:"size:255;not null;index" json:"node"`
+	TargetNode  string    `gorm:"size:255" json:"target_node,omitempty"` // 指定目标节点，为空时自动调度
+	Status      string    `gorm:"size:50;not null" json:"status"`        // running, completed, failed, cancelled
+	Concurrency int       `json:"concurrency"`
+	Total       int       `json:"total"`
+	Completed   int       `json:"completed"`
+	Failed      int       `json:"failed"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -56,3 +76,7 @@ func (RemoteHost) TableName() string {
 func (MigrationLog) TableName() string {
 	return "migration_logs"
 }
+
+func (DrainJob) TableName() string {
+	return "drain_jobs"
+}
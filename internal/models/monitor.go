@@ -55,6 +55,29 @@ type NetworkTraffic struct {
 	CreatedAt     time.Time `json:"created_at"`
 }
 
+// MetricStat 时间桶内的最小、平均、最大值
+type MetricStat struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	Max float64 `json:"max"`
+}
+
+// MetricRollup 监控数据降采样汇总，ContainerID 为 0 表示宿主机
+type MetricRollup struct {
+	ID            uint       `gorm:"primaryKey" json:"-"`
+	Resolution    int        `gorm:"uniqueIndex:idx_rollup_bucket;not null" json:"resolution"` // 桶宽度（秒）
+	ContainerID   uint       `gorm:"uniqueIndex:idx_rollup_bucket" json:"container_id"`
+	BucketStart   time.Time  `gorm:"uniqueIndex:idx_rollup_bucket" json:"timestamp"`
+	Samples       int        `json:"samples"`
+	CPUUsage      MetricStat `gorm:"embedded;embeddedPrefix:cpu_usage_" json:"cpu_usage"`
+	MemoryUsage   MetricStat `gorm:"embedded;embeddedPrefix:memory_usage_" json:"memory_usage"`
+	MemoryUsed    MetricStat `gorm:"embedded;embeddedPrefix:memory_used_" json:"memory_used"`
+	DiskUsage     MetricStat `gorm:"embedded;embeddedPrefix:disk_usage_" json:"disk_usage"`
+	NetworkRxRate MetricStat `gorm:"embedded;embeddedPrefix:network_rx_rate_" json:"network_rx_rate"`
+	NetworkTxRate MetricStat `gorm:"embedded;embeddedPrefix:network_tx_rate_" json:"network_tx_rate"`
+	LoadAverage1  MetricStat `gorm:"embedded;embeddedPrefix:load_average_1_" json:"load_average_1"`
+}
+
 // TableName 指定表名
 func (SystemMetric) TableName() string {
 	return "system_metrics"
@@ -67,3 +90,7 @@ func (ContainerMetric) TableName() string {
 func (NetworkTraffic) TableName() string {
 	return "network_traffic"
 }
+
+func (MetricRollup) TableName() string {
+	return "metric_rollups"
+}
@@ -6,15 +6,21 @@ import (
 
 // User 用户模型
 type User struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	Username     string    `gorm:"uniqueIndex;size:100;not null" json:"username"`
-	Email        string    `gorm:"uniqueIndex;size:255;not null" json:"email"`
-	PasswordHash string    `gorm:"size:255;not null" json:"-"` // 不返回密码哈希
-	APIKey       string    `gorm:"uniqueIndex;size:64;not null" json:"api_key"`
-	Role         string    `gorm:"size:20;default:user" json:"role"` // admin, user
-	Status       string    `gorm:"size:20;default:active" json:"status"` // active, suspended, deleted
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	Username        string    `gorm:"uniqueIndex;size:100;not null" json:"username"`
+	Email           string    `gorm:"uniqueIndex;size:255;not null" json:"email"`
+	PasswordHash    string    `gorm:"size:255;not null" json:"-"`           // 不返回密码哈希
+	APIKey          string    `gorm:"-" json:"api_key,omitempty"`           // 新生成密钥的明文，仅在创建时返回，不入库（见 APIKey）
+	Role            string    `gorm:"size:20;default:user" json:"role"`     // admin, user
+	Status          string    `gorm:"size:20;default:active" json:"status"` // active, suspended, deleted
+	TOTPSecret      string    `gorm:"size:64" json:"-"`                     // 两步验证密钥（Base32），启用前为待确认的密钥
+	TOTPEnabled     bool      `json:"totp_enabled"`
+	TOTPLastStep    int64     `json:"-"`                                                         // 最近一次通过校验的时间步，防止验证码重放
+	OIDCIssuer      string    `gorm:"column:oidc_issuer;size:255;index:idx_users_oidc" json:"-"` // 关联的 OIDC 身份（issuer + sub）
+	OIDCSubject     string    `gorm:"column:oidc_subject;size:255;index:idx_users_oidc" json:"oidc_subject,omitempty"`
+	OIDCProvisioned bool      `gorm:"column:oidc_provisioned" json:"oidc_provisioned"` // 由 OIDC 首次登录创建，角色随身份提供方同步
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
 // TableName 指定表名
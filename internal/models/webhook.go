@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// WebhookSubscription webhook 订阅
+// Events 为逗号分隔的事件名，支持 * 和 container.* 形式的通配；
+// UserID 为 0 的订阅接收全部事件，用户创建的订阅只接收与其名下资源相关的事件
+type WebhookSubscription struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:255;not null" json:"name"`
+	URL       string    `gorm:"size:1024;not null" json:"url"`
+	Secret    string    `gorm:"size:255" json:"secret,omitempty"` // HMAC-SHA256 签名密钥
+	Events    string    `gorm:"type:text" json:"events"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery webhook 投递记录
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint       `gorm:"index" json:"subscription_id"`
+	EventID        string     `gorm:"size:64;index" json:"event_id"`
+	Event          string     `gorm:"size:100;index" json:"event"`
+	Payload        string     `gorm:"type:text" json:"payload"`
+	Status         string     `gorm:"size:20;index" json:"status"` // pending, success, failed
+	Attempts       int        `json:"attempts"`
+	ResponseCode   int        `json:"response_code"`
+	ResponseBody   string     `gorm:"type:text" json:"response_body,omitempty"` // 截断保存
+	Error          string     `gorm:"type:text" json:"error,omitempty"`
+	RedeliveryOf   uint       `json:"redelivery_of,omitempty"` // 手动重新投递时指向原记录
+	NextAttemptAt  *time.Time `gorm:"index" json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (WebhookSubscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
@@ -3,17 +3,26 @@ package monitor
 import (
 	"bufio"
 	"fmt"
+	"log"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/events"
+	"github.com/openlxd/backend/internal/lxd"
 	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/quota"
 )
 
 // Collector 监控数据采集器
 type Collector struct {
+	mu               sync.Mutex // 保护 lastNetworkStats、lastCPUStats 和 latest，采集循环和 API 请求会并发调用
 	lastNetworkStats map[string]*NetworkStats
+	lastCPUStats     map[string]*CPUStats
+	latest           *models.SystemMetric // 采集循环最近一次的系统指标
 }
 
 // NetworkStats 网络统计信息
@@ -23,8 +32,15 @@ type NetworkStats struct {
 	Timestamp time.Time
 }
 
+// CPUStats 容器 CPU 累计用量
+type CPUStats struct {
+	Usage     int64 // 纳秒
+	Timestamp time.Time
+}
+
 var GlobalCollector = &Collector{
 	lastNetworkStats: make(map[string]*NetworkStats),
+	lastCPUStats:     make(map[string]*CPUStats),
 }
 
 // CollectSystemMetrics 采集系统监控指标
@@ -189,7 +205,7 @@ func (c *Collector) getNetworkRate() (float64, float64, error) {
 
 	var totalRx, totalTx int64
 	scanner := bufio.NewScanner(file)
-	
+
 	// 跳过前两行
 	scanner.Scan()
 	scanner.Scan()
@@ -214,9 +230,12 @@ func (c *Collector) getNetworkRate() (float64, float64, error) {
 	}
 
 	// 计算速率（需要两次采样）
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	now := time.Now()
 	lastStats, exists := c.lastNetworkStats["system"]
-	
+
 	var rxRate, txRate float64
 	if exists {
 		duration := now.Sub(lastStats.Timestamp).Seconds()
@@ -261,34 +280,198 @@ func (c *Collector) getLoadAverage() (float64, float64, float64, error) {
 	return load1, load5, load15, nil
 }
 
-// SaveSystemMetric 保存系统监控指标到数据库
-func (c *Collector) SaveSystemMetric(metric *models.SystemMetric) error {
-	return models.DB.Create(metric).Error
-}
-
-// CleanOldMetrics 清理旧的监控数据（保留最近7天）
-func (c *Collector) CleanOldMetrics() error {
-	cutoff := time.Now().AddDate(0, 0, -7)
-	
-	// 清理系统指标
-	if err := models.DB.Where("timestamp < ?", cutoff).Delete(&models.SystemMetric{}).Error; err != nil {
-		return err
+// CollectContainerTraffic 采集容器网络流量并累计到配额
+// 计数器取自 LXD 容器状态（容器视角：接收为入站，发送为出站），
+// 与上次采样的差值计入当前计费周期；计数器变小说明容器重启过，此时整个计数值都是新增流量
+func (c *Collector) CollectContainerTraffic() error {
+	if lxd.Client == nil {
+		return fmt.Errorf("LXD 客户端未初始化")
 	}
-	
-	// 清理容器指标
-	if err := models.DB.Where("timestamp < ?", cutoff).Delete(&models.ContainerMetric{}).Error; err != nil {
+
+	var containers []models.Container
+	if err := models.DB.Find(&containers).Error; err != nil {
 		return err
 	}
-	
-	// 清理网络流量
-	if err := models.DB.Where("timestamp < ?", cutoff).Delete(&models.NetworkTraffic{}).Error; err != nil {
-		return err
+
+	now := time.Now()
+	for _, container := range containers {
+		client, err := lxd.NodeClient(container.Node)
+		if err != nil {
+			continue
+		}
+		state, _, err := client.GetInstanceState(container.Hostname)
+		if err != nil || state.Status != "Running" {
+			continue
+		}
+
+		var record models.NetworkTraffic
+		for name, nic := range state.Network {
+			if name == "lo" || nic.Type == "loopback" {
+				continue
+			}
+			record.RxBytes += int64(nic.Counters.BytesReceived)
+			record.TxBytes += int64(nic.Counters.BytesSent)
+			record.RxPackets += int64(nic.Counters.PacketsReceived)
+			record.TxPackets += int64(nic.Counters.PacketsSent)
+		}
+		record.ContainerID = container.ID
+		record.ContainerName = container.Hostname
+		record.Timestamp = now
+
+		// 首次采样时以数据库中最后一条记录为基准，避免重启服务后重复计费
+		key := "container:" + container.Hostname
+		c.mu.Lock()
+		last, exists := c.lastNetworkStats[key]
+		c.mu.Unlock()
+		if !exists {
+			var prev models.NetworkTraffic
+			if models.DB.Where("container_id = ?", container.ID).Order("timestamp DESC").First(&prev).Error == nil {
+				last = &NetworkStats{RxBytes: prev.RxBytes, TxBytes: prev.TxBytes, Timestamp: prev.Timestamp}
+				exists = true
+			}
+		}
+
+		inDelta, outDelta := record.RxBytes, record.TxBytes
+		if exists {
+			inDelta = counterDelta(last.RxBytes, record.RxBytes)
+			outDelta = counterDelta(last.TxBytes, record.TxBytes)
+		}
+
+		c.mu.Lock()
+		c.lastNetworkStats[key] = &NetworkStats{
+			RxBytes:   record.RxBytes,
+			TxBytes:   record.TxBytes,
+			Timestamp: now,
+		}
+		c.mu.Unlock()
+		models.DB.Create(&record)
+
+		if _, err := quota.GlobalQuotaManager.GetOrCreateQuota(container.ID); err != nil {
+			continue
+		}
+		quota.GlobalQuotaManager.AddTrafficUsage(container.ID, inDelta, outDelta)
 	}
-	
+
+	// 没有流量的容器也需要按时结算周期
+	quota.GlobalQuotaManager.RolloverCycles()
+
 	return nil
 }
 
-// StartCollector 启动监控数据采集器
+// counterDelta 计算计数器增量，计数器回绕或重置时返回当前值
+func counterDelta(last, current int64) int64 {
+	if current < last {
+		return current
+	}
+	return current - last
+}
+
+// CollectContainerMetrics 采集运行中容器的资源指标
+// CPU 使用率和网络速率由与上次采样的差值计算，首次采样时为 0
+func (c *Collector) CollectContainerMetrics() ([]models.ContainerMetric, error) {
+	if lxd.Client == nil {
+		return nil, fmt.Errorf("LXD 客户端未初始化")
+	}
+
+	var containers []models.Container
+	if err := models.DB.Find(&containers).Error; err != nil {
+		return nil, err
+	}
+	states, err := lxd.ListContainerStates()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	metrics := make([]models.ContainerMetric, 0, len(containers))
+	for _, container := range containers {
+		state, ok := states[container.Hostname]
+		if !ok || state.Status != "Running" {
+			continue
+		}
+
+		metric := models.ContainerMetric{
+			ContainerID:   container.ID,
+			ContainerName: container.Hostname,
+			Timestamp:     now,
+			Status:        state.Status,
+			MemoryTotal:   int64(container.Memory),
+			MemoryUsed:    state.Memory.Usage / 1024 / 1024,
+			DiskTotal:     int64(container.Disk),
+		}
+		if container.Memory > 0 {
+			metric.MemoryUsage = float64(state.Memory.Usage) / float64(int64(container.Memory)*1000*1000) * 100
+		}
+		if root, ok := state.Disk["root"]; ok {
+			metric.DiskUsed = root.Usage / 1024 / 1024 / 1024
+			if container.Disk > 0 {
+				metric.DiskUsage = float64(root.Usage) / float64(int64(container.Disk)*1000*1000*1000) * 100
+			}
+		}
+		for name, nic := range state.Network {
+			if name == "lo" || nic.Type == "loopback" {
+				continue
+			}
+			metric.NetworkRxTotal += int64(nic.Counters.BytesReceived)
+			metric.NetworkTxTotal += int64(nic.Counters.BytesSent)
+		}
+
+		c.mu.Lock()
+		if last, ok := c.lastCPUStats[container.Hostname]; ok {
+			elapsed := now.Sub(last.Timestamp).Seconds()
+			cpus := container.CPUs
+			if cpus <= 0 {
+				cpus = 1
+			}
+			if elapsed > 0 && state.CPU.Usage >= last.Usage {
+				metric.CPUUsage = float64(state.CPU.Usage-last.Usage) / 1e9 / elapsed / float64(cpus) * 100
+			}
+		}
+		c.lastCPUStats[container.Hostname] = &CPUStats{Usage: state.CPU.Usage, Timestamp: now}
+
+		key := "metric:" + container.Hostname
+		if last, ok := c.lastNetworkStats[key]; ok {
+			if elapsed := now.Sub(last.Timestamp).Seconds(); elapsed > 0 {
+				metric.NetworkRxRate = float64(counterDelta(last.RxBytes, metric.NetworkRxTotal)) / elapsed / 1024 / 1024
+				metric.NetworkTxRate = float64(counterDelta(last.TxBytes, metric.NetworkTxTotal)) / elapsed / 1024 / 1024
+			}
+		}
+		c.lastNetworkStats[key] = &NetworkStats{RxBytes: metric.NetworkRxTotal, TxBytes: metric.NetworkTxTotal, Timestamp: now}
+		c.mu.Unlock()
+
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, nil
+}
+
+// Latest 采集循环最近一次的系统指标，进程刚启动尚未采集时读取数据库中最新的记录
+func (c *Collector) Latest() *models.SystemMetric {
+	c.mu.Lock()
+	latest := c.latest
+	c.mu.Unlock()
+	if latest != nil {
+		return latest
+	}
+
+	var metric models.SystemMetric
+	if err := models.DB.Order("timestamp DESC").First(&metric).Error; err != nil {
+		return nil
+	}
+	return &metric
+}
+
+// SaveSystemMetric 保存系统监控指标
+func (c *Collector) SaveSystemMetric(metric *models.SystemMetric) error {
+	return GlobalStore.SaveSystem(metric)
+}
+
+// CleanOldMetrics 降采样监控数据并按保留期清理
+func (c *Collector) CleanOldMetrics() error {
+	return GlobalStore.Compact(time.Now())
+}
+
+// StartCollector 启动监控数据采集器和降采样任务
 func (c *Collector) StartCollector(interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	go func() {
@@ -297,12 +480,36 @@ func (c *Collector) StartCollector(interval time.Duration) {
 			metric, err := c.CollectSystemMetrics()
 			if err == nil {
 				c.SaveSystemMetric(metric)
+				c.mu.Lock()
+				c.latest = metric
+				c.mu.Unlock()
+			}
+
+			// 采集容器指标
+			metrics, err := c.CollectContainerMetrics()
+			if err == nil {
+				if err := GlobalStore.SaveContainers(metrics); err != nil {
+					log.Printf("保存容器监控指标失败: %v", err)
+				}
 			}
 
-			// 每小时清理一次旧数据
-			if time.Now().Minute() == 0 {
-				c.CleanOldMetrics()
+			// 推送实时采样
+			events.PublishMetrics(metric, metrics)
+
+			// 采集容器流量
+			c.CollectContainerTraffic()
+		}
+	}()
+
+	compactInterval := time.Duration(config.GetConfig().Monitor.CompactInterval) * time.Second
+	go func() {
+		compactTicker := time.NewTicker(compactInterval)
+		defer compactTicker.Stop()
+		for {
+			if err := c.CleanOldMetrics(); err != nil {
+				log.Printf("监控数据降采样失败: %v", err)
 			}
+			<-compactTicker.C
 		}
 	}()
 }
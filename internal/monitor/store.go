@@ -0,0 +1,360 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+)
+
+// 数据分辨率（秒），原始数据按采集间隔存储
+const (
+	ResolutionRaw = 0
+	Resolution5m  = 300
+	Resolution1h  = 3600
+)
+
+// 网络流量明细保留天数（流量统计接口使用）
+const trafficRetentionDays = 7
+
+// Store 监控时序数据存储，默认使用数据库，可通过 SetStore 替换为其他实现
+type Store interface {
+	// SaveSystem 保存一条宿主机原始指标
+	SaveSystem(metric *models.SystemMetric) error
+	// SaveContainers 批量保存容器原始指标
+	SaveContainers(metrics []models.ContainerMetric) error
+	// Query 查询 [from, to) 内的数据，containerID 为 0 表示宿主机，原始数据的 min/avg/max 相同
+	Query(containerID uint, from, to time.Time, resolution int) ([]models.MetricRollup, error)
+	// Compact 将已结束的时间桶降采样到更粗的分辨率，并清理过期数据
+	Compact(now time.Time) error
+}
+
+// GlobalStore 全局监控数据存储
+var GlobalStore Store = &SQLStore{}
+
+// SetStore 替换监控数据存储
+func SetStore(store Store) {
+	GlobalStore = store
+}
+
+// ParseResolution 解析分辨率参数（raw、5m、1h），空字符串或 auto 返回 -1 表示自动选择
+func ParseResolution(value string) (int, error) {
+	switch value {
+	case "", "auto":
+		return -1, nil
+	case "raw":
+		return ResolutionRaw, nil
+	case "5m":
+		return Resolution5m, nil
+	case "1h":
+		return Resolution1h, nil
+	}
+	return 0, fmt.Errorf("不支持的分辨率: %s，可选: raw, 5m, 1h, auto", value)
+}
+
+// ResolutionName 分辨率名称
+func ResolutionName(resolution int) string {
+	switch resolution {
+	case Resolution5m:
+		return "5m"
+	case Resolution1h:
+		return "1h"
+	}
+	return "raw"
+}
+
+// ChooseResolution 根据查询范围选择分辨率：6 小时内用原始数据，7 天内用 5 分钟汇总，更长用 1 小时汇总
+// 查询起点早于某一级的保留期时自动退到下一级
+func ChooseResolution(from, to time.Time) int {
+	cfg := config.GetConfig().Monitor
+	span := to.Sub(from)
+	age := time.Since(from)
+
+	if span <= 6*time.Hour && age <= time.Duration(cfg.RawRetention)*time.Hour {
+		return ResolutionRaw
+	}
+	if span <= 7*24*time.Hour && age <= time.Duration(cfg.Rollup5mDays)*24*time.Hour {
+		return Resolution5m
+	}
+	return Resolution1h
+}
+
+// SQLStore 基于数据库的监控数据存储
+type SQLStore struct{}
+
+// SaveSystem 保存宿主机原始指标
+func (s *SQLStore) SaveSystem(metric *models.SystemMetric) error {
+	return models.DB.Create(metric).Error
+}
+
+// SaveContainers 批量保存容器原始指标
+func (s *SQLStore) SaveContainers(metrics []models.ContainerMetric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	return models.DB.CreateInBatches(metrics, 200).Error
+}
+
+// Query 查询指定分辨率的数据
+// 汇总数据只覆盖已降采样的时间桶，之后的部分由更细的数据即时汇总补齐
+func (s *SQLStore) Query(containerID uint, from, to time.Time, resolution int) ([]models.MetricRollup, error) {
+	if resolution == ResolutionRaw {
+		return s.loadRaw(&containerID, from, to)
+	}
+
+	var points []models.MetricRollup
+	err := models.DB.Where("resolution = ? AND container_id = ? AND bucket_start >= ? AND bucket_start < ?",
+		resolution, containerID, from, to).
+		Order("bucket_start").
+		Find(&points).Error
+	if err != nil {
+		return nil, err
+	}
+
+	tailFrom := from.Truncate(time.Duration(resolution) * time.Second)
+	if len(points) > 0 {
+		tailFrom = points[len(points)-1].BucketStart.Add(time.Duration(resolution) * time.Second)
+	}
+	if tailFrom.Before(to) {
+		finer, err := s.Query(containerID, tailFrom, to, finerResolution(resolution))
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, aggregate(finer, resolution)...)
+	}
+	return points, nil
+}
+
+// Compact 依次汇总原始数据到 5 分钟、5 分钟到 1 小时，然后按保留期清理
+func (s *SQLStore) Compact(now time.Time) error {
+	if err := s.rollup(ResolutionRaw, Resolution5m, now); err != nil {
+		return fmt.Errorf("汇总 5 分钟数据失败: %v", err)
+	}
+	if err := s.rollup(Resolution5m, Resolution1h, now); err != nil {
+		return fmt.Errorf("汇总 1 小时数据失败: %v", err)
+	}
+	return s.prune(now)
+}
+
+// rollup 将 source 分辨率的数据汇总为 target 分辨率，只处理已结束且尚未汇总的时间桶
+func (s *SQLStore) rollup(source, target int, now time.Time) error {
+	width := time.Duration(target) * time.Second
+	end := now.Truncate(width)
+
+	var start time.Time
+	var last models.MetricRollup
+	if models.DB.Where("resolution = ?", target).Order("bucket_start DESC").First(&last).Error == nil {
+		start = last.BucketStart.Add(width)
+	} else {
+		earliest, ok := s.earliest(source)
+		if !ok {
+			return nil
+		}
+		start = earliest.Truncate(width)
+	}
+
+	// 按天分批处理，避免首次汇总时一次载入过多数据
+	for chunkStart := start; chunkStart.Before(end); {
+		chunkEnd := chunkStart.Add(24 * time.Hour)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+
+		var points []models.MetricRollup
+		var err error
+		if source == ResolutionRaw {
+			points, err = s.loadRaw(nil, chunkStart, chunkEnd)
+		} else {
+			err = models.DB.Where("resolution = ? AND bucket_start >= ? AND bucket_start < ?", source, chunkStart, chunkEnd).
+				Find(&points).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		if rollups := aggregate(points, target); len(rollups) > 0 {
+			if err := models.DB.CreateInBatches(rollups, 200).Error; err != nil {
+				return err
+			}
+		}
+		chunkStart = chunkEnd
+	}
+	return nil
+}
+
+// earliest 获取指定分辨率中最早的数据时间
+func (s *SQLStore) earliest(resolution int) (time.Time, bool) {
+	var times []time.Time
+	if resolution == ResolutionRaw {
+		var system models.SystemMetric
+		if models.DB.Order("timestamp").First(&system).Error == nil {
+			times = append(times, system.Timestamp)
+		}
+		var container models.ContainerMetric
+		if models.DB.Order("timestamp").First(&container).Error == nil {
+			times = append(times, container.Timestamp)
+		}
+	} else {
+		var rollup models.MetricRollup
+		if models.DB.Where("resolution = ?", resolution).Order("bucket_start").First(&rollup).Error == nil {
+			times = append(times, rollup.BucketStart)
+		}
+	}
+
+	if len(times) == 0 {
+		return time.Time{}, false
+	}
+	earliest := times[0]
+	for _, t := range times[1:] {
+		if t.Before(earliest) {
+			earliest = t
+		}
+	}
+	return earliest, true
+}
+
+// loadRaw 读取原始数据并转换为单样本的汇总点，containerID 为 nil 时读取宿主机和全部容器
+func (s *SQLStore) loadRaw(containerID *uint, from, to time.Time) ([]models.MetricRollup, error) {
+	var points []models.MetricRollup
+
+	if containerID == nil || *containerID == 0 {
+		var metrics []models.SystemMetric
+		if err := models.DB.Where("timestamp >= ? AND timestamp < ?", from, to).Order("timestamp").Find(&metrics).Error; err != nil {
+			return nil, err
+		}
+		for _, m := range metrics {
+			points = append(points, rawPoint(0, m.Timestamp, m.CPUUsage, m.MemoryUsage, float64(m.MemoryUsed), m.DiskUsage, m.NetworkRxRate, m.NetworkTxRate, m.LoadAverage1))
+		}
+	}
+
+	if containerID == nil || *containerID != 0 {
+		query := models.DB.Where("timestamp >= ? AND timestamp < ?", from, to)
+		if containerID != nil {
+			query = query.Where("container_id = ?", *containerID)
+		}
+		var metrics []models.ContainerMetric
+		if err := query.Order("timestamp").Find(&metrics).Error; err != nil {
+			return nil, err
+		}
+		for _, m := range metrics {
+			points = append(points, rawPoint(m.ContainerID, m.Timestamp, m.CPUUsage, m.MemoryUsage, float64(m.MemoryUsed), m.DiskUsage, m.NetworkRxRate, m.NetworkTxRate, 0))
+		}
+	}
+
+	return points, nil
+}
+
+// prune 按各级保留期清理过期数据
+func (s *SQLStore) prune(now time.Time) error {
+	cfg := config.GetConfig().Monitor
+	rawCutoff := now.Add(-time.Duration(cfg.RawRetention) * time.Hour)
+
+	// 清理原始指标
+	if err := models.DB.Where("timestamp < ?", rawCutoff).Delete(&models.SystemMetric{}).Error; err != nil {
+		return err
+	}
+	if err := models.DB.Where("timestamp < ?", rawCutoff).Delete(&models.ContainerMetric{}).Error; err != nil {
+		return err
+	}
+
+	// 清理汇总数据
+	if err := models.DB.Where("resolution = ? AND bucket_start < ?", Resolution5m, now.AddDate(0, 0, -cfg.Rollup5mDays)).
+		Delete(&models.MetricRollup{}).Error; err != nil {
+		return err
+	}
+	if err := models.DB.Where("resolution = ? AND bucket_start < ?", Resolution1h, now.AddDate(0, 0, -cfg.Rollup1hDays)).
+		Delete(&models.MetricRollup{}).Error; err != nil {
+		return err
+	}
+
+	// 清理网络流量
+	return models.DB.Where("timestamp < ?", now.AddDate(0, 0, -trafficRetentionDays)).Delete(&models.NetworkTraffic{}).Error
+}
+
+// finerResolution 返回下一级更细的分辨率
+func finerResolution(resolution int) int {
+	if resolution == Resolution1h {
+		return Resolution5m
+	}
+	return ResolutionRaw
+}
+
+// rawPoint 将一条原始数据转换为单样本汇总点
+func rawPoint(containerID uint, timestamp time.Time, values ...float64) models.MetricRollup {
+	point := models.MetricRollup{ContainerID: containerID, BucketStart: timestamp, Samples: 1}
+	for i, stat := range statFields(&point) {
+		*stat = models.MetricStat{Min: values[i], Avg: values[i], Max: values[i]}
+	}
+	return point
+}
+
+// statFields 返回汇总点中所有统计字段，顺序与 rawPoint 的参数一致
+func statFields(point *models.MetricRollup) []*models.MetricStat {
+	return []*models.MetricStat{
+		&point.CPUUsage,
+		&point.MemoryUsage,
+		&point.MemoryUsed,
+		&point.DiskUsage,
+		&point.NetworkRxRate,
+		&point.NetworkTxRate,
+		&point.LoadAverage1,
+	}
+}
+
+// aggregate 按容器和时间桶合并数据点：最小值取最小、最大值取最大、平均值按样本数加权
+func aggregate(points []models.MetricRollup, resolution int) []models.MetricRollup {
+	type bucketKey struct {
+		containerID uint
+		start       int64
+	}
+
+	width := time.Duration(resolution) * time.Second
+	buckets := make(map[bucketKey]*models.MetricRollup)
+	for i := range points {
+		point := &points[i]
+		start := point.BucketStart.Truncate(width)
+		key := bucketKey{point.ContainerID, start.Unix()}
+
+		bucket, ok := buckets[key]
+		if !ok {
+			bucket = &models.MetricRollup{Resolution: resolution, ContainerID: point.ContainerID, BucketStart: start}
+			for j, stat := range statFields(point) {
+				*statFields(bucket)[j] = models.MetricStat{Min: stat.Min, Max: stat.Max}
+			}
+			buckets[key] = bucket
+		}
+
+		targets := statFields(bucket)
+		for j, stat := range statFields(point) {
+			target := targets[j]
+			if stat.Min < target.Min {
+				target.Min = stat.Min
+			}
+			if stat.Max > target.Max {
+				target.Max = stat.Max
+			}
+			// 先累加加权和，最后统一除以样本数
+			target.Avg += stat.Avg * float64(point.Samples)
+		}
+		bucket.Samples += point.Samples
+	}
+
+	rollups := make([]models.MetricRollup, 0, len(buckets))
+	for _, bucket := range buckets {
+		if bucket.Samples > 0 {
+			for _, stat := range statFields(bucket) {
+				stat.Avg /= float64(bucket.Samples)
+			}
+		}
+		rollups = append(rollups, *bucket)
+	}
+	sort.Slice(rollups, func(i, j int) bool {
+		if rollups[i].ContainerID != rollups[j].ContainerID {
+			return rollups[i].ContainerID < rollups[j].ContainerID
+		}
+		return rollups[i].BucketStart.Before(rollups[j].BucketStart)
+	})
+	return rollups
+}
@@ -0,0 +1,599 @@
+package network
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openlxd/backend/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 反向代理后端
+const (
+	BackendNginx   = "nginx"
+	BackendBuiltin = "builtin"
+)
+
+// BuiltinProxy 内置 HTTP/HTTPS 反向代理
+type BuiltinProxy struct {
+	mu          sync.RWMutex
+	routes      map[string]*proxyRoute
+	certs       map[string]*tls.Certificate
+	stats       map[string]*domainCounters
+	acmeHandler func(next http.Handler) http.Handler
+}
+
+var GlobalBuiltinProxy = &BuiltinProxy{
+	routes: make(map[string]*proxyRoute),
+	certs:  make(map[string]*tls.Certificate),
+	stats:  make(map[string]*domainCounters),
+}
+
+// proxyRoute 单个域名的转发配置
+type proxyRoute struct {
+	config    models.ProxyConfig
+	options   ProxyOptions
+	paths     []*pathRoute // 按路径长度降序，最长前缀优先
+	allow     []*net.IPNet
+	deny      []*net.IPNet
+	authCache sync.Map // 已验证的基本认证凭据摘要
+}
+
+// pathRoute 路径路由及其后端
+type pathRoute struct {
+	path        string
+	stripPrefix bool
+	balancer    *upstreamBalancer
+}
+
+// upstreamBalancer 后端负载均衡
+type upstreamBalancer struct {
+	strategy string
+	backends []*upstreamBackend
+	weighted []int // 按权重展开的后端索引（轮询用）
+	next     uint64
+}
+
+// upstreamBackend 单个后端
+type upstreamBackend struct {
+	proxy  *httputil.ReverseProxy
+	active int64
+}
+
+// domainCounters 域名统计计数器
+type domainCounters struct {
+	requests int64
+	bytesIn  int64
+	bytesOut int64
+	errors   int64
+}
+
+// DomainStats 域名访问统计
+type DomainStats struct {
+	Domain   string `json:"domain"`
+	Requests int64  `json:"requests"`
+	BytesIn  int64  `json:"bytes_in"`
+	BytesOut int64  `json:"bytes_out"`
+	Errors   int64  `json:"errors"`
+}
+
+// SetACMEHandler 设置 ACME HTTP-01 验证处理器
+func (b *BuiltinProxy) SetACMEHandler(wrap func(next http.Handler) http.Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.acmeHandler = wrap
+}
+
+// Reload 从数据库重新加载反向代理配置和证书
+func (b *BuiltinProxy) Reload() error {
+	var proxies []models.ProxyConfig
+	if err := models.DB.Where("status = ?", "active").Find(&proxies).Error; err != nil {
+		return fmt.Errorf("读取反向代理配置失败: %v", err)
+	}
+
+	routes := make(map[string]*proxyRoute)
+	certs := make(map[string]*tls.Certificate)
+	for _, config := range proxies {
+		domain := strings.ToLower(config.Domain)
+		routes[domain] = b.newProxyRoute(domain, config)
+
+		if config.SSL && config.CertPath != "" && config.KeyPath != "" {
+			cert, err := tls.LoadX509KeyPair(config.CertPath, config.KeyPath)
+			if err != nil {
+				log.Printf("加载证书失败 (%s): %v", domain, err)
+				continue
+			}
+			certs[domain] = &cert
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.routes = routes
+	b.certs = certs
+	for domain := range routes {
+		if b.stats[domain] == nil {
+			b.stats[domain] = &domainCounters{}
+		}
+	}
+
+	return nil
+}
+
+// newProxyRoute 根据配置构建域名路由
+func (b *BuiltinProxy) newProxyRoute(domain string, config models.ProxyConfig) *proxyRoute {
+	opts := LoadProxyOptions(config)
+	route := &proxyRoute{
+		config:  config,
+		options: opts,
+		allow:   parseACL(opts.AllowIPs),
+		deny:    parseACL(opts.DenyIPs),
+	}
+
+	hasRoot := false
+	for _, r := range opts.Routes {
+		route.paths = append(route.paths, &pathRoute{
+			path:        r.Path,
+			stripPrefix: r.StripPrefix,
+			balancer:    b.newBalancer(domain, opts, r.Upstreams),
+		})
+		if r.Path == "/" {
+			hasRoot = true
+		}
+	}
+	if !hasRoot {
+		route.paths = append(route.paths, &pathRoute{
+			path:     "/",
+			balancer: b.newBalancer(domain, opts, defaultUpstreams(config, opts)),
+		})
+	}
+	sort.SliceStable(route.paths, func(i, j int) bool {
+		return len(route.paths[i].path) > len(route.paths[j].path)
+	})
+
+	return route
+}
+
+// newBalancer 创建后端负载均衡器
+func (b *BuiltinProxy) newBalancer(domain string, opts ProxyOptions, upstreams []ProxyUpstream) *upstreamBalancer {
+	balancer := &upstreamBalancer{strategy: opts.LoadBalance}
+	for i, u := range upstreams {
+		balancer.backends = append(balancer.backends, &upstreamBackend{
+			proxy: b.newReverseProxy(domain, u.IP, u.Port, opts),
+		})
+		weight := u.Weight
+		if weight < 1 {
+			weight = 1
+		}
+		for w := 0; w < weight; w++ {
+			balancer.weighted = append(balancer.weighted, i)
+		}
+	}
+	return balancer
+}
+
+// pick 按策略选择后端
+func (lb *upstreamBalancer) pick(r *http.Request) *upstreamBackend {
+	switch lb.strategy {
+	case LoadBalanceIPHash:
+		h := fnv.New32a()
+		h.Write([]byte(clientIP(r)))
+		return lb.backends[lb.weighted[int(h.Sum32()%uint32(len(lb.weighted)))]]
+	case LoadBalanceLeastConn:
+		best := lb.backends[0]
+		for _, backend := range lb.backends[1:] {
+			if atomic.LoadInt64(&backend.active) < atomic.LoadInt64(&best.active) {
+				best = backend
+			}
+		}
+		return best
+	default:
+		n := atomic.AddUint64(&lb.next, 1)
+		return lb.backends[lb.weighted[int((n-1)%uint64(len(lb.weighted)))]]
+	}
+}
+
+// newReverseProxy 创建指向容器的反向代理（支持 WebSocket 升级）
+func (b *BuiltinProxy) newReverseProxy(domain, targetIP string, targetPort int, opts ProxyOptions) *httputil.ReverseProxy {
+	target := &url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(targetIP, strconv.Itoa(targetPort)),
+	}
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.Out.Host = r.In.Host
+			r.SetXForwarded()
+			r.Out.Header.Set("X-Real-IP", clientIP(r.In))
+			for name, value := range opts.RequestHeaders {
+				r.Out.Header.Set(name, value)
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			for name, value := range opts.ResponseHeaders {
+				resp.Header.Set(name, value)
+			}
+			return nil
+		},
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			b.counters(domain).addError()
+			log.Printf("反向代理请求失败 (%s): %v", domain, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+}
+
+// ServeHTTP 按 Host 转发请求
+func (b *BuiltinProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	domain := strings.ToLower(hostWithoutPort(r.Host))
+
+	b.mu.RLock()
+	route := b.routes[domain]
+	b.mu.RUnlock()
+
+	if route == nil {
+		http.Error(w, "未配置的域名", http.StatusNotFound)
+		return
+	}
+
+	counters := b.counters(domain)
+	atomic.AddInt64(&counters.requests, 1)
+
+	// 强制 HTTPS
+	if r.TLS == nil && route.config.SSL && route.options.ForceHTTPS {
+		http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusMovedPermanently)
+		return
+	}
+
+	// 访问控制
+	if !route.allowed(clientIP(r)) {
+		http.Error(w, "禁止访问", http.StatusForbidden)
+		return
+	}
+
+	// 基本认证
+	if !route.authenticate(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+		http.Error(w, "需要认证", http.StatusUnauthorized)
+		return
+	}
+
+	// 请求体大小限制
+	if route.options.MaxBodySize > 0 {
+		limit := int64(route.options.MaxBodySize) << 20
+		if r.ContentLength > limit {
+			http.Error(w, "请求体过大", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+
+	if r.Body != nil {
+		r.Body = &countingReader{ReadCloser: r.Body, n: &counters.bytesIn}
+	}
+
+	// 路径路由
+	var matched *pathRoute
+	for _, p := range route.paths {
+		if strings.HasPrefix(r.URL.Path, p.path) {
+			matched = p
+			break
+		}
+	}
+	if matched == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if matched.stripPrefix {
+		r.URL.Path = "/" + strings.TrimPrefix(r.URL.Path, matched.path)
+		r.URL.RawPath = ""
+	}
+
+	backend := matched.balancer.pick(r)
+	atomic.AddInt64(&backend.active, 1)
+	defer atomic.AddInt64(&backend.active, -1)
+
+	backend.proxy.ServeHTTP(&countingWriter{ResponseWriter: w, counters: counters}, r)
+}
+
+// allowed 检查客户端IP是否允许访问（先匹配拒绝列表，再匹配允许列表）
+func (route *proxyRoute) allowed(ip string) bool {
+	if len(route.allow) == 0 && len(route.deny) == 0 {
+		return true
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, n := range route.deny {
+		if n.Contains(addr) {
+			return false
+		}
+	}
+	if len(route.allow) == 0 {
+		return true
+	}
+	for _, n := range route.allow {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate 校验基本认证，验证通过的凭据摘要会被缓存
+func (route *proxyRoute) authenticate(r *http.Request) bool {
+	if len(route.options.BasicAuth) == 0 {
+		return true
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	digest := sha256.Sum256([]byte(username + ":" + password))
+	if _, ok := route.authCache.Load(digest); ok {
+		return true
+	}
+
+	for _, user := range route.options.BasicAuth {
+		if user.Username != username {
+			continue
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil {
+			route.authCache.Store(digest, true)
+			return true
+		}
+	}
+	return false
+}
+
+// parseACL 解析 IP/CIDR 列表
+func parseACL(entries []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil {
+				bits := 32
+				if ip.To4() == nil {
+					bits = 128
+				}
+				entry = fmt.Sprintf("%s/%d", entry, bits)
+			}
+		}
+		if _, n, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
+
+// GetCertificate 按 SNI 选择证书（支持通配符证书）
+func (b *BuiltinProxy) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(hello.ServerName)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if cert, ok := b.certs[name]; ok {
+		return cert, nil
+	}
+	if i := strings.Index(name, "."); i > 0 {
+		if cert, ok := b.certs["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+
+	return nil, fmt.Errorf("没有可用于 %s 的证书", name)
+}
+
+// getConfigForClient 为关闭 HTTP/2 的域名只协商 HTTP/1.1
+func (b *BuiltinProxy) getConfigForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	b.mu.RLock()
+	route := b.routes[strings.ToLower(hello.ServerName)]
+	b.mu.RUnlock()
+
+	if route == nil || !route.options.DisableHTTP2 {
+		return nil, nil
+	}
+
+	return &tls.Config{
+		GetCertificate: b.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"http/1.1"},
+	}, nil
+}
+
+// Start 启动 HTTP 和 HTTPS 监听
+func (b *BuiltinProxy) Start(httpAddr, httpsAddr string) {
+	b.mu.RLock()
+	handler := http.Handler(b)
+	if b.acmeHandler != nil {
+		handler = b.acmeHandler(handler)
+	}
+	b.mu.RUnlock()
+
+	httpServer := &http.Server{
+		Addr:              httpAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	httpsServer := &http.Server{
+		Addr:              httpsAddr,
+		Handler:           b,
+		ReadHeaderTimeout: 30 * time.Second,
+		TLSConfig: &tls.Config{
+			GetCertificate:     b.GetCertificate,
+			GetConfigForClient: b.getConfigForClient,
+			MinVersion:         tls.VersionTLS12,
+		},
+	}
+
+	go func() {
+		log.Printf("内置反向代理 HTTP 监听在 %s", httpAddr)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("内置反向代理 HTTP 启动失败: %v", err)
+		}
+	}()
+	go func() {
+		log.Printf("内置反向代理 HTTPS 监听在 %s", httpsAddr)
+		if err := httpsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			log.Printf("内置反向代理 HTTPS 启动失败: %v", err)
+		}
+	}()
+}
+
+// StartAutoReload 定期从数据库重载配置（兼容直接修改数据库的场景）
+func (b *BuiltinProxy) StartAutoReload(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if err := b.Reload(); err != nil {
+				log.Printf("内置反向代理重载失败: %v", err)
+			}
+		}
+	}()
+}
+
+// GetStats 获取各域名的访问统计
+func (b *BuiltinProxy) GetStats() []DomainStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stats := make([]DomainStats, 0, len(b.stats))
+	for domain, c := range b.stats {
+		stats = append(stats, DomainStats{
+			Domain:   domain,
+			Requests: atomic.LoadInt64(&c.requests),
+			BytesIn:  atomic.LoadInt64(&c.bytesIn),
+			BytesOut: atomic.LoadInt64(&c.bytesOut),
+			Errors:   atomic.LoadInt64(&c.errors),
+		})
+	}
+
+	return stats
+}
+
+// counters 获取域名计数器
+func (b *BuiltinProxy) counters(domain string) *domainCounters {
+	b.mu.RLock()
+	c := b.stats[domain]
+	b.mu.RUnlock()
+	if c != nil {
+		return c
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stats[domain] == nil {
+		b.stats[domain] = &domainCounters{}
+	}
+	return b.stats[domain]
+}
+
+func (c *domainCounters) addError() {
+	atomic.AddInt64(&c.errors, 1)
+}
+
+// hostWithoutPort 去掉 Host 中的端口
+func hostWithoutPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// clientIP 获取客户端IP
+func clientIP(r *http.Request) string {
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return ip
+	}
+	return r.RemoteAddr
+}
+
+// countingReader 统计请求体字节数
+type countingReader struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+// countingWriter 统计响应字节数，并保留 Flush/Hijack 以支持流式响应和 WebSocket
+type countingWriter struct {
+	http.ResponseWriter
+	counters *domainCounters
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	atomic.AddInt64(&c.counters.bytesOut, int64(n))
+	return n, err
+}
+
+// Flush 实现 http.Flusher
+func (c *countingWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 实现 http.Hijacker（WebSocket 升级需要）
+func (c *countingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := c.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("连接不支持 Hijack")
+	}
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &countingConn{Conn: conn, counters: c.counters}, rw, nil
+}
+
+// Unwrap 供 http.ResponseController 使用
+func (c *countingWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// countingConn 统计升级后连接（WebSocket）的双向字节数
+type countingConn struct {
+	net.Conn
+	counters *domainCounters
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.counters.bytesIn, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.counters.bytesOut, int64(n))
+	return n, err
+}
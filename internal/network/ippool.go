@@ -20,7 +20,7 @@ var GlobalIPPool = &IPPool{}
 type IPAddress struct {
 	ID          uint   `json:"id"`
 	IP          string `json:"ip"`
-	Type        string `json:"type"` // ipv4, ipv6
+	Type        string `json:"type"`   // ipv4, ipv6
 	Status      string `json:"status"` // available, used, reserved
 	ContainerID uint   `json:"container_id"`
 	Gateway     string `json:"gateway"`
@@ -37,6 +37,9 @@ func (p *IPPool) AllocateIPv4(containerID uint) (*IPAddress, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := quota.GlobalQuotaManager.CheckUserIPQuota(containerID, "ipv4"); err != nil {
+		return nil, err
+	}
 
 	// 从数据库查找可用的 IPv4 地址
 	var ipAddr models.IPAddress
@@ -71,6 +74,9 @@ func (p *IPPool) AllocateIPv6(containerID uint) (*IPAddress, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := quota.GlobalQuotaManager.CheckUserIPQuota(containerID, "ipv6"); err != nil {
+		return nil, err
+	}
 
 	// 从数据库查找可用的 IPv6 地址
 	var ipAddr models.IPAddress
@@ -0,0 +1,144 @@
+package network
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HostListener 宿主机监听的端口
+type HostListener struct {
+	Protocol string `json:"protocol"` // tcp, udp
+	IP       string `json:"ip"`
+	Port     int    `json:"port"`
+}
+
+// procNetFiles 各协议对应的 /proc/net 文件
+var procNetFiles = map[string][]string{
+	"tcp": {"/proc/net/tcp", "/proc/net/tcp6"},
+	"udp": {"/proc/net/udp", "/proc/net/udp6"},
+}
+
+const (
+	tcpStateListen = "0A" // TCP_LISTEN
+	udpStateClose  = "07" // 未连接的 UDP 套接字
+)
+
+// GetHostListeners 读取宿主机上指定协议的监听端口
+func GetHostListeners(protocol string) ([]HostListener, error) {
+	files, ok := procNetFiles[protocol]
+	if !ok {
+		return nil, fmt.Errorf("不支持的协议: %s", protocol)
+	}
+
+	var listeners []HostListener
+	for _, path := range files {
+		entries, err := parseProcNetFile(path, protocol)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // 未启用 IPv6 时 tcp6/udp6 不存在
+			}
+			return nil, err
+		}
+		listeners = append(listeners, entries...)
+	}
+
+	return listeners, nil
+}
+
+// IsHostPortInUse 检查宿主机服务是否已占用端口
+// publicIP 为空表示映射绑定到所有地址，此时任意地址上的监听都视为冲突
+func IsHostPortInUse(publicIP, protocol string, port int) bool {
+	listeners, err := GetHostListeners(protocol)
+	if err != nil {
+		return false
+	}
+
+	bindIP := net.ParseIP(publicIP)
+	for _, l := range listeners {
+		if l.Port != port {
+			continue
+		}
+		if bindIP == nil {
+			return true
+		}
+		listenIP := net.ParseIP(l.IP)
+		if listenIP == nil || listenIP.IsUnspecified() || listenIP.Equal(bindIP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseProcNetFile 解析 /proc/net/{tcp,udp}[6] 文件
+func parseProcNetFile(path, protocol string) ([]HostListener, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	wantState := tcpStateListen
+	if protocol == "udp" {
+		wantState = udpStateClose
+	}
+
+	var listeners []HostListener
+	scanner := bufio.NewScanner(file)
+
+	// 跳过表头
+	scanner.Scan()
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != wantState {
+			continue
+		}
+
+		ip, port, err := parseHexAddress(fields[1])
+		if err != nil {
+			continue
+		}
+
+		listeners = append(listeners, HostListener{
+			Protocol: protocol,
+			IP:       ip.String(),
+			Port:     port,
+		})
+	}
+
+	return listeners, scanner.Err()
+}
+
+// parseHexAddress 解析内核格式的地址，如 0100007F:0016
+// 地址按 32 位字以主机字节序（小端）存放
+func parseHexAddress(s string) (net.IP, int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return nil, 0, fmt.Errorf("无效的地址格式: %s", s)
+	}
+
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("无效的端口: %s", parts[1])
+	}
+
+	raw, err := hex.DecodeString(parts[0])
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("无效的地址: %s", parts[0])
+	}
+
+	ip := make(net.IP, len(raw))
+	for word := 0; word < len(raw); word += 4 {
+		for i := 0; i < 4; i++ {
+			ip[word+i] = raw[word+3-i]
+		}
+	}
+
+	return ip, int(port), nil
+}
@@ -7,7 +7,6 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/openlxd/backend/internal/models"
 	"github.com/openlxd/backend/internal/quota"
@@ -20,160 +19,391 @@ type NATManager struct {
 
 var GlobalNATManager = &NATManager{}
 
+// 协议类型
+const (
+	ProtocolTCP    = "tcp"
+	ProtocolUDP    = "udp"
+	ProtocolTCPUDP = "tcp+udp"
+)
+
+// 转发模式
+const (
+	ModeIPTables = "iptables"  // 宿主机 iptables DNAT
+	ModeProxy    = "proxy"     // LXD proxy 设备（用户态转发）
+	ModeProxyNAT = "proxy-nat" // LXD proxy 设备（nat=true）
+)
+
+// 未定义端口段时随机端口的默认范围
+const (
+	defaultRandomPortStart = 10000
+	defaultRandomPortEnd   = 65535
+)
+
 // PortMapping 端口映射信息
 type PortMapping struct {
 	ID            uint   `json:"id"`
 	ContainerID   uint   `json:"container_id"`
 	ContainerIP   string `json:"container_ip"`
-	Protocol      string `json:"protocol"` // tcp, udp
+	PublicIP      string `json:"public_ip"` // 空表示所有地址
+	Protocol      string `json:"protocol"`  // tcp, udp, tcp+udp
 	ExternalPort  int    `json:"external_port"`
 	InternalPort  int    `json:"internal_port"`
 	Description   string `json:"description"`
+	Mode          string `json:"mode"` // iptables, proxy, proxy-nat
+	ProxyProtocol bool   `json:"proxy_protocol"`
 	Status        string `json:"status"` // active, inactive
 }
 
+// ValidateProtocol 验证端口映射协议
+func ValidateProtocol(protocol string) bool {
+	return protocol == ProtocolTCP || protocol == ProtocolUDP || protocol == ProtocolTCPUDP
+}
+
+// ValidateMode 验证转发模式及 proxy_protocol 组合
+func ValidateMode(mode string, proxyProtocol bool) error {
+	switch mode {
+	case ModeIPTables, ModeProxyNAT:
+		if proxyProtocol {
+			return fmt.Errorf("proxy_protocol 仅支持 %s 模式", ModeProxy)
+		}
+	case ModeProxy:
+	default:
+		return fmt.Errorf("不支持的转发模式: %s", mode)
+	}
+	return nil
+}
+
+// expandProtocols 将 tcp+udp 展开为单个协议
+func expandProtocols(protocol string) []string {
+	if protocol == ProtocolTCPUDP {
+		return []string{ProtocolTCP, ProtocolUDP}
+	}
+	return []string{protocol}
+}
+
 // AddPortMapping 添加端口映射
-func (n *NATManager) AddPortMapping(containerID uint, containerIP, protocol string, externalPort, internalPort int, description string) (*PortMapping, error) {
+func (n *NATManager) AddPortMapping(containerID uint, containerIP, publicIP, protocol, mode string, proxyProtocol bool, externalPort, internalPort int, description string) (*PortMapping, error) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
+	if !ValidateProtocol(protocol) {
+		return nil, fmt.Errorf("不支持的协议: %s", protocol)
+	}
+	if err := ValidateMode(mode, proxyProtocol); err != nil {
+		return nil, err
+	}
+
+	// 检查公网IP
+	if err := n.validatePublicIP(containerID, publicIP); err != nil {
+		return nil, err
+	}
+
 	// 检查配额
 	err := quota.GlobalQuotaManager.CheckPortMappingQuota(containerID, 1)
 	if err != nil {
 		return nil, err
 	}
-
-	// 检查端口是否已被使用
-	var existing models.PortMapping
-	err = models.DB.Where("external_port = ? AND protocol = ?", externalPort, protocol).First(&existing).Error
-	if err == nil {
-		return nil, fmt.Errorf("外部端口 %d 已被使用", externalPort)
+	if err := quota.GlobalQuotaManager.CheckUserPortMappingQuota(containerID, 1); err != nil {
+		return nil, err
 	}
 
-	// 创建 iptables 规则
-	err = n.createIPTablesRule(containerIP, protocol, externalPort, internalPort)
-	if err != nil {
-		return nil, fmt.Errorf("创建 iptables 规则失败: %v", err)
+	// 检查端口是否已被映射或被宿主机服务占用
+	if err := n.checkPortConflict(publicIP, protocol, externalPort); err != nil {
+		return nil, err
 	}
 
 	// 保存到数据库
 	mapping := models.PortMapping{
-		ContainerID:  containerID,
-		ContainerIP:  containerIP,
-		Protocol:     protocol,
-		ExternalPort: externalPort,
-		InternalPort: internalPort,
-		Description:  description,
-		Status:       "active",
+		ContainerID:   containerID,
+		ContainerIP:   containerIP,
+		PublicIP:      publicIP,
+		Protocol:      protocol,
+		ExternalPort:  externalPort,
+		InternalPort:  internalPort,
+		Description:   description,
+		Mode:          mode,
+		ProxyProtocol: proxyProtocol,
+		Status:        "active",
+	}
+	if err := n.createMapping(&mapping); err != nil {
+		return nil, err
 	}
-	models.DB.Create(&mapping)
 
-	return &PortMapping{
-		ID:           mapping.ID,
-		ContainerID:  mapping.ContainerID,
-		ContainerIP:  mapping.ContainerIP,
-		Protocol:     mapping.Protocol,
-		ExternalPort: mapping.ExternalPort,
-		InternalPort: mapping.InternalPort,
-		Description:  mapping.Description,
-		Status:       mapping.Status,
-	}, nil
+	return toPortMapping(mapping), nil
 }
 
 // AddPortRange 添加端口段映射
-func (n *NATManager) AddPortRange(containerID uint, containerIP, protocol string, externalStartPort, internalStartPort, count int, description string) error {
+func (n *NATManager) AddPortRange(containerID uint, containerIP, publicIP, protocol, mode string, proxyProtocol bool, externalStartPort, internalStartPort, count int, description string) error {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
+	if !ValidateProtocol(protocol) {
+		return fmt.Errorf("不支持的协议: %s", protocol)
+	}
+	if err := ValidateMode(mode, proxyProtocol); err != nil {
+		return err
+	}
+
+	// 检查公网IP
+	if err := n.validatePublicIP(containerID, publicIP); err != nil {
+		return err
+	}
+
 	// 检查配额
 	err := quota.GlobalQuotaManager.CheckPortMappingQuota(containerID, count)
 	if err != nil {
 		return err
 	}
+	if err := quota.GlobalQuotaManager.CheckUserPortMappingQuota(containerID, count); err != nil {
+		return err
+	}
 
 	for i := 0; i < count; i++ {
 		externalPort := externalStartPort + i
 		internalPort := internalStartPort + i
 
 		// 检查端口是否已被使用
-		var existing models.PortMapping
-		err := models.DB.Where("external_port = ? AND protocol = ?", externalPort, protocol).First(&existing).Error
-		if err == nil {
+		if err := n.checkPortConflict(publicIP, protocol, externalPort); err != nil {
 			continue // 跳过已使用的端口
 		}
 
-		// 创建 iptables 规则
-		err = n.createIPTablesRule(containerIP, protocol, externalPort, internalPort)
-		if err != nil {
-			continue // 跳过失败的规则
-		}
-
-		// 保存到数据库
+		// 保存到数据库并创建转发规则
 		mapping := models.PortMapping{
-			ContainerID:  containerID,
-			ContainerIP:  containerIP,
-			Protocol:     protocol,
-			ExternalPort: externalPort,
-			InternalPort: internalPort,
-			Description:  fmt.Sprintf("%s (端口段 %d-%d)", description, externalStartPort, externalStartPort+count-1),
-			Status:       "active",
+			ContainerID:   containerID,
+			ContainerIP:   containerIP,
+			PublicIP:      publicIP,
+			Protocol:      protocol,
+			ExternalPort:  externalPort,
+			InternalPort:  internalPort,
+			Description:   fmt.Sprintf("%s (端口段 %d-%d)", description, externalStartPort, externalStartPort+count-1),
+			Mode:          mode,
+			ProxyProtocol: proxyProtocol,
+			Status:        "active",
+		}
+		if err := n.createMapping(&mapping); err != nil {
+			continue // 跳过失败的规则
 		}
-		models.DB.Create(&mapping)
 	}
 
 	return nil
 }
 
-// AddRandomPort 添加随机端口映射
-func (n *NATManager) AddRandomPort(containerID uint, containerIP, protocol string, internalPort int, description string) (*PortMapping, error) {
+// AddRandomPort 添加随机端口映射（从管理员定义的端口段中分配）
+func (n *NATManager) AddRandomPort(containerID uint, containerIP, publicIP, protocol, mode string, proxyProtocol bool, internalPort int, description string) (*PortMapping, error) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
-	// 生成随机端口（10000-65535）
-	rand.Seed(time.Now().UnixNano())
+	if !ValidateProtocol(protocol) {
+		return nil, fmt.Errorf("不支持的协议: %s", protocol)
+	}
+	if err := ValidateMode(mode, proxyProtocol); err != nil {
+		return nil, err
+	}
+
+	// 检查公网IP
+	if err := n.validatePublicIP(containerID, publicIP); err != nil {
+		return nil, err
+	}
+
+	// 检查配额
+	err := quota.GlobalQuotaManager.CheckPortMappingQuota(containerID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := quota.GlobalQuotaManager.CheckUserPortMappingQuota(containerID, 1); err != nil {
+		return nil, err
+	}
+
+	ranges := n.matchAllowedRanges(publicIP, protocol)
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("没有适用于 %s/%s 的端口段", publicIP, protocol)
+	}
+
+	// 按端口段大小加权随机选取
+	total := 0
+	for _, r := range ranges {
+		total += r.EndPort - r.StartPort + 1
+	}
+
 	maxAttempts := 100
-	
 	for i := 0; i < maxAttempts; i++ {
-		externalPort := rand.Intn(55535) + 10000
+		offset := rand.Intn(total)
+		externalPort := 0
+		for _, r := range ranges {
+			size := r.EndPort - r.StartPort + 1
+			if offset < size {
+				externalPort = r.StartPort + offset
+				break
+			}
+			offset -= size
+		}
 
 		// 检查端口是否已被使用
-		var existing models.PortMapping
-		err := models.DB.Where("external_port = ? AND protocol = ?", externalPort, protocol).First(&existing).Error
-		if err == nil {
+		if err := n.checkPortConflict(publicIP, protocol, externalPort); err != nil {
 			continue // 端口已被使用，重试
 		}
 
-		// 创建 iptables 规则
-		err = n.createIPTablesRule(containerIP, protocol, externalPort, internalPort)
-		if err != nil {
+		// 保存到数据库并创建转发规则
+		mapping := models.PortMapping{
+			ContainerID:   containerID,
+			ContainerIP:   containerIP,
+			PublicIP:      publicIP,
+			Protocol:      protocol,
+			ExternalPort:  externalPort,
+			InternalPort:  internalPort,
+			Description:   description,
+			Mode:          mode,
+			ProxyProtocol: proxyProtocol,
+			Status:        "active",
+		}
+		if err := n.createMapping(&mapping); err != nil {
 			continue // 创建失败，重试
 		}
 
-		// 保存到数据库
-		mapping := models.PortMapping{
-			ContainerID:  containerID,
-			ContainerIP:  containerIP,
-			Protocol:     protocol,
-			ExternalPort: externalPort,
-			InternalPort: internalPort,
-			Description:  description,
-			Status:       "active",
+		return toPortMapping(mapping), nil
+	}
+
+	return nil, fmt.Errorf("无法找到可用的随机端口")
+}
+
+// matchAllowedRanges 获取适用于指定公网IP和协议的端口段
+// 未定义任何端口段时退回默认范围
+func (n *NATManager) matchAllowedRanges(publicIP, protocol string) []models.PortRange {
+	var count int64
+	models.DB.Model(&models.PortRange{}).Count(&count)
+	if count == 0 {
+		return []models.PortRange{{
+			Protocol:  ProtocolTCPUDP,
+			StartPort: defaultRandomPortStart,
+			EndPort:   defaultRandomPortEnd,
+		}}
+	}
+
+	query := models.DB.Where("status = ?", "active").
+		Where("(public_ip = ? OR public_ip = '')", publicIP)
+	if protocol == ProtocolTCPUDP {
+		query = query.Where("protocol = ?", ProtocolTCPUDP)
+	} else {
+		query = query.Where("(protocol = ? OR protocol = ?)", protocol, ProtocolTCPUDP)
+	}
+
+	var ranges []models.PortRange
+	query.Find(&ranges)
+	return ranges
+}
+
+// CheckAllowedPorts 检查外部端口 start-end 是否都在适用于公网IP和协议的端口段内（普通用户指定端口时使用）
+func (n *NATManager) CheckAllowedPorts(publicIP, protocol string, start, end int) error {
+	ranges := n.matchAllowedRanges(publicIP, protocol)
+	for port := start; port <= end; port++ {
+		allowed := false
+		for _, r := range ranges {
+			if port >= r.StartPort && port <= r.EndPort {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("外部端口 %d/%s 不在可分配的端口段内", port, protocol)
+		}
+	}
+	return nil
+}
+
+// checkPortConflict 检查端口是否与已有映射或宿主机监听冲突
+func (n *NATManager) checkPortConflict(publicIP, protocol string, port int) error {
+	for _, proto := range expandProtocols(protocol) {
+		query := models.DB.Model(&models.PortMapping{}).
+			Where("external_port = ? AND (protocol = ? OR protocol = ?)", port, proto, ProtocolTCPUDP)
+		if publicIP != "" {
+			// 绑定所有地址的映射与任意公网IP冲突
+			query = query.Where("(public_ip = ? OR public_ip = '')", publicIP)
+		}
+
+		var count int64
+		query.Count(&count)
+		if count > 0 {
+			return fmt.Errorf("外部端口 %d/%s 已被使用", port, proto)
 		}
-		models.DB.Create(&mapping)
 
-		return &PortMapping{
-			ID:           mapping.ID,
-			ContainerID:  mapping.ContainerID,
-			ContainerIP:  mapping.ContainerIP,
-			Protocol:     mapping.Protocol,
-			ExternalPort: mapping.ExternalPort,
-			InternalPort: mapping.InternalPort,
-			Description:  mapping.Description,
-			Status:       mapping.Status,
-		}, nil
+		if IsHostPortInUse(publicIP, proto, port) {
+			return fmt.Errorf("外部端口 %d/%s 已被宿主机服务占用", port, proto)
+		}
 	}
 
-	return nil, fmt.Errorf("无法找到可用的随机端口")
+	return nil
+}
+
+// validatePublicIP 检查公网IP是否属于地址池且可被该容器使用
+func (n *NATManager) validatePublicIP(containerID uint, publicIP string) error {
+	if publicIP == "" {
+		return nil
+	}
+
+	var ipAddr models.IPAddress
+	if err := models.DB.Where("ip = ? AND type = ?", publicIP, "ipv4").First(&ipAddr).Error; err != nil {
+		return fmt.Errorf("公网IP %s 不在 IPv4 地址池中", publicIP)
+	}
+
+	if ipAddr.Status == "used" && ipAddr.ContainerID != 0 && ipAddr.ContainerID != containerID {
+		return fmt.Errorf("公网IP %s 已分配给其他容器", publicIP)
+	}
+
+	return nil
+}
+
+// toPortMapping 转换数据库模型
+func toPortMapping(m models.PortMapping) *PortMapping {
+	return &PortMapping{
+		ID:            m.ID,
+		ContainerID:   m.ContainerID,
+		ContainerIP:   m.ContainerIP,
+		PublicIP:      m.PublicIP,
+		Protocol:      m.Protocol,
+		ExternalPort:  m.ExternalPort,
+		InternalPort:  m.InternalPort,
+		Description:   m.Description,
+		Mode:          m.Mode,
+		ProxyProtocol: m.ProxyProtocol,
+		Status:        m.Status,
+	}
+}
+
+// createMapping 保存端口映射并按模式创建转发规则，失败时回滚数据库记录
+func (n *NATManager) createMapping(mapping *models.PortMapping) error {
+	if err := models.DB.Create(mapping).Error; err != nil {
+		return fmt.Errorf("保存端口映射失败: %v", err)
+	}
+
+	var err error
+	if mapping.Mode == ModeIPTables {
+		err = n.createIPTablesRule(mapping.PublicIP, mapping.ContainerIP, mapping.Protocol, mapping.ExternalPort, mapping.InternalPort)
+		if err != nil {
+			err = fmt.Errorf("创建 iptables 规则失败: %v", err)
+		}
+	} else {
+		err = n.createProxyDevices(*mapping)
+	}
+
+	if err != nil {
+		models.DB.Delete(mapping)
+		return err
+	}
+
+	return nil
+}
+
+// removeMapping 按模式删除转发规则
+func (n *NATManager) removeMapping(mapping models.PortMapping) error {
+	if mapping.Mode == ModeProxy || mapping.Mode == ModeProxyNAT {
+		return n.deleteProxyDevices(mapping)
+	}
+
+	err := n.deleteIPTablesRule(mapping.PublicIP, mapping.ContainerIP, mapping.Protocol, mapping.ExternalPort, mapping.InternalPort)
+	if err != nil {
+		return fmt.Errorf("删除 iptables 规则失败: %v", err)
+	}
+	return nil
 }
 
 // RemovePortMapping 删除端口映射
@@ -187,10 +417,9 @@ func (n *NATManager) RemovePortMapping(mappingID uint) error {
 		return fmt.Errorf("端口映射不存在")
 	}
 
-	// 删除 iptables 规则
-	err = n.deleteIPTablesRule(mapping.ContainerIP, mapping.Protocol, mapping.ExternalPort, mapping.InternalPort)
-	if err != nil {
-		return fmt.Errorf("删除 iptables 规则失败: %v", err)
+	// 删除转发规则
+	if err := n.removeMapping(mapping); err != nil {
+		return err
 	}
 
 	// 从数据库删除
@@ -208,9 +437,9 @@ func (n *NATManager) RemoveContainerMappings(containerID uint) error {
 	models.DB.Where("container_id = ?", containerID).Find(&mappings)
 
 	for _, mapping := range mappings {
-		// 删除 iptables 规则
-		n.deleteIPTablesRule(mapping.ContainerIP, mapping.Protocol, mapping.ExternalPort, mapping.InternalPort)
-		
+		// 删除转发规则（容器可能已被删除，忽略错误）
+		n.removeMapping(mapping)
+
 		// 从数据库删除
 		models.DB.Delete(&mapping)
 	}
@@ -231,16 +460,7 @@ func (n *NATManager) GetContainerMappings(containerID uint) ([]PortMapping, erro
 
 	result := make([]PortMapping, len(mappings))
 	for i, m := range mappings {
-		result[i] = PortMapping{
-			ID:           m.ID,
-			ContainerID:  m.ContainerID,
-			ContainerIP:  m.ContainerIP,
-			Protocol:     m.Protocol,
-			ExternalPort: m.ExternalPort,
-			InternalPort: m.InternalPort,
-			Description:  m.Description,
-			Status:       m.Status,
-		}
+		result[i] = *toPortMapping(m)
 	}
 
 	return result, nil
@@ -256,37 +476,39 @@ func (n *NATManager) SyncIPTablesRules() error {
 
 	// 从数据库重新创建所有规则
 	var mappings []models.PortMapping
-	models.DB.Where("status = ?", "active").Find(&mappings)
+	models.DB.Where("status = ? AND (mode = ? OR mode = '')", "active", ModeIPTables).Find(&mappings)
 
 	for _, mapping := range mappings {
-		n.createIPTablesRule(mapping.ContainerIP, mapping.Protocol, mapping.ExternalPort, mapping.InternalPort)
+		n.createIPTablesRule(mapping.PublicIP, mapping.ContainerIP, mapping.Protocol, mapping.ExternalPort, mapping.InternalPort)
 	}
 
 	return nil
 }
 
 // createIPTablesRule 创建 iptables 规则
-func (n *NATManager) createIPTablesRule(containerIP, protocol string, externalPort, internalPort int) error {
-	// DNAT 规则：外部访问 -> 容器
-	dnatCmd := fmt.Sprintf(
-		"iptables -t nat -A PREROUTING -p %s --dport %d -j DNAT --to-destination %s:%d -m comment --comment 'OpenLXD'",
-		protocol, externalPort, containerIP, internalPort,
-	)
-	
-	// FORWARD 规则：允许转发
-	forwardCmd := fmt.Sprintf(
-		"iptables -A FORWARD -p %s -d %s --dport %d -j ACCEPT -m comment --comment 'OpenLXD'",
-		protocol, containerIP, internalPort,
-	)
+func (n *NATManager) createIPTablesRule(publicIP, containerIP, protocol string, externalPort, internalPort int) error {
+	var commands []string
+	for _, proto := range expandProtocols(protocol) {
+		// DNAT 规则：外部访问 -> 容器
+		commands = append(commands, fmt.Sprintf(
+			"iptables -t nat -A PREROUTING %s-p %s --dport %d -j DNAT --to-destination %s:%d -m comment --comment 'OpenLXD'",
+			destinationMatch(publicIP), proto, externalPort, containerIP, internalPort,
+		))
+
+		// FORWARD 规则：允许转发
+		commands = append(commands, fmt.Sprintf(
+			"iptables -A FORWARD -p %s -d %s --dport %d -j ACCEPT -m comment --comment 'OpenLXD'",
+			proto, containerIP, internalPort,
+		))
+	}
 
 	// MASQUERADE 规则：容器访问外部
-	masqCmd := fmt.Sprintf(
+	commands = append(commands, fmt.Sprintf(
 		"iptables -t nat -A POSTROUTING -s %s -j MASQUERADE -m comment --comment 'OpenLXD'",
 		containerIP,
-	)
+	))
 
 	// 执行命令
-	commands := []string{dnatCmd, forwardCmd, masqCmd}
 	for _, cmd := range commands {
 		parts := strings.Fields(cmd)
 		if err := exec.Command(parts[0], parts[1:]...).Run(); err != nil {
@@ -298,21 +520,23 @@ func (n *NATManager) createIPTablesRule(containerIP, protocol string, externalPo
 }
 
 // deleteIPTablesRule 删除 iptables 规则
-func (n *NATManager) deleteIPTablesRule(containerIP, protocol string, externalPort, internalPort int) error {
-	// 删除 DNAT 规则
-	dnatCmd := fmt.Sprintf(
-		"iptables -t nat -D PREROUTING -p %s --dport %d -j DNAT --to-destination %s:%d -m comment --comment 'OpenLXD'",
-		protocol, externalPort, containerIP, internalPort,
-	)
-	
-	// 删除 FORWARD 规则
-	forwardCmd := fmt.Sprintf(
-		"iptables -D FORWARD -p %s -d %s --dport %d -j ACCEPT -m comment --comment 'OpenLXD'",
-		protocol, containerIP, internalPort,
-	)
+func (n *NATManager) deleteIPTablesRule(publicIP, containerIP, protocol string, externalPort, internalPort int) error {
+	var commands []string
+	for _, proto := range expandProtocols(protocol) {
+		// 删除 DNAT 规则
+		commands = append(commands, fmt.Sprintf(
+			"iptables -t nat -D PREROUTING %s-p %s --dport %d -j DNAT --to-destination %s:%d -m comment --comment 'OpenLXD'",
+			destinationMatch(publicIP), proto, externalPort, containerIP, internalPort,
+		))
+
+		// 删除 FORWARD 规则
+		commands = append(commands, fmt.Sprintf(
+			"iptables -D FORWARD -p %s -d %s --dport %d -j ACCEPT -m comment --comment 'OpenLXD'",
+			proto, containerIP, internalPort,
+		))
+	}
 
 	// 执行命令（忽略错误）
-	commands := []string{dnatCmd, forwardCmd}
 	for _, cmd := range commands {
 		parts := strings.Fields(cmd)
 		exec.Command(parts[0], parts[1:]...).Run()
@@ -321,26 +545,29 @@ func (n *NATManager) deleteIPTablesRule(containerIP, protocol string, externalPo
 	return nil
 }
 
+// destinationMatch 生成绑定公网IP的 iptables 匹配参数
+func destinationMatch(publicIP string) string {
+	if publicIP == "" {
+		return ""
+	}
+	return fmt.Sprintf("-d %s ", publicIP)
+}
+
 // clearOpenLXDRules 清除所有 OpenLXD 的 iptables 规则
 func (n *NATManager) clearOpenLXDRules() {
 	// 清除 NAT 表中的 OpenLXD 规则
 	exec.Command("bash", "-c", "iptables -t nat -S | grep 'OpenLXD' | sed 's/-A/-D/' | xargs -r -L1 iptables -t nat").Run()
-	
+
 	// 清除 FILTER 表中的 OpenLXD 规则
 	exec.Command("bash", "-c", "iptables -S | grep 'OpenLXD' | sed 's/-A/-D/' | xargs -r -L1 iptables").Run()
 }
 
 // IsPortAvailable 检查端口是否可用
-func (n *NATManager) IsPortAvailable(port int, protocol string) bool {
+func (n *NATManager) IsPortAvailable(publicIP string, port int, protocol string) bool {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
 
-	var count int64
-	models.DB.Model(&models.PortMapping{}).
-		Where("external_port = ? AND protocol = ?", port, protocol).
-		Count(&count)
-	
-	return count == 0
+	return n.checkPortConflict(publicIP, protocol, port) == nil
 }
 
 // GetUsedPortsCount 获取已使用的端口数量
@@ -352,10 +579,79 @@ func (n *NATManager) GetUsedPortsCount() int64 {
 	models.DB.Model(&models.PortMapping{}).
 		Where("status = ?", "active").
 		Count(&count)
-	
+
 	return count
 }
 
+// AddAllowedRange 添加可供租户分配的端口段
+func (n *NATManager) AddAllowedRange(publicIP, protocol string, startPort, endPort int, description string) (*models.PortRange, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if protocol == "" {
+		protocol = ProtocolTCPUDP
+	}
+	if !ValidateProtocol(protocol) {
+		return nil, fmt.Errorf("不支持的协议: %s", protocol)
+	}
+	if startPort < 1 || endPort > 65535 || startPort > endPort {
+		return nil, fmt.Errorf("无效的端口段: %d-%d", startPort, endPort)
+	}
+	if err := n.validatePublicIP(0, publicIP); err != nil {
+		return nil, err
+	}
+
+	// 检查是否与已有端口段重叠
+	var overlap int64
+	models.DB.Model(&models.PortRange{}).
+		Where("start_port <= ? AND end_port >= ?", endPort, startPort).
+		Where("(public_ip = ? OR public_ip = '' OR ? = '')", publicIP, publicIP).
+		Count(&overlap)
+	if overlap > 0 {
+		return nil, fmt.Errorf("端口段 %d-%d 与已有端口段重叠", startPort, endPort)
+	}
+
+	portRange := models.PortRange{
+		PublicIP:    publicIP,
+		Protocol:    protocol,
+		StartPort:   startPort,
+		EndPort:     endPort,
+		Description: description,
+		Status:      "active",
+	}
+	if err := models.DB.Create(&portRange).Error; err != nil {
+		return nil, fmt.Errorf("保存端口段失败: %v", err)
+	}
+
+	return &portRange, nil
+}
+
+// RemoveAllowedRange 删除端口段（已分配的映射不受影响）
+func (n *NATManager) RemoveAllowedRange(rangeID uint) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	result := models.DB.Delete(&models.PortRange{}, rangeID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("端口段不存在")
+	}
+
+	return nil
+}
+
+// GetAllowedRanges 获取所有端口段
+func (n *NATManager) GetAllowedRanges() ([]models.PortRange, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	var ranges []models.PortRange
+	err := models.DB.Order("start_port ASC").Find(&ranges).Error
+	return ranges, err
+}
+
 // ParsePortRange 解析端口范围字符串
 func ParsePortRange(portRange string) (start, end int, err error) {
 	parts := strings.Split(portRange, "-")
@@ -381,6 +677,6 @@ func ParsePortRange(portRange string) (start, end int, err error) {
 		}
 		return start, end, nil
 	}
-	
+
 	return 0, 0, fmt.Errorf("无效的端口范围格式")
 }
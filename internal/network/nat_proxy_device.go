@@ -0,0 +1,160 @@
+package network
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/openlxd/backend/internal/lxd"
+	"github.com/openlxd/backend/internal/models"
+)
+
+// ProxyReconcileResult proxy 设备同步结果
+type ProxyReconcileResult struct {
+	Added   int      `json:"added"`
+	Removed int      `json:"removed"`
+	Errors  []string `json:"errors"`
+}
+
+// proxyDevicesFor 根据端口映射生成 LXD proxy 设备（tcp+udp 生成两个设备）
+func proxyDevicesFor(mapping models.PortMapping) []lxd.ProxyDevice {
+	// 用户态转发在容器网络命名空间内连接，使用回环地址即可跟随容器IP变化
+	connectIP := "127.0.0.1"
+	if mapping.Mode == ModeProxyNAT {
+		connectIP = mapping.ContainerIP
+	}
+
+	var devices []lxd.ProxyDevice
+	for _, proto := range expandProtocols(mapping.Protocol) {
+		devices = append(devices, lxd.ProxyDevice{
+			Name:          lxd.ProxyDeviceName(mapping.ID, proto),
+			Protocol:      proto,
+			ListenIP:      mapping.PublicIP,
+			ListenPort:    mapping.ExternalPort,
+			ConnectIP:     connectIP,
+			ConnectPort:   mapping.InternalPort,
+			NAT:           mapping.Mode == ModeProxyNAT,
+			ProxyProtocol: mapping.ProxyProtocol,
+		})
+	}
+
+	return devices
+}
+
+// containerHostname 根据容器ID获取容器名
+func containerHostname(containerID uint) (string, error) {
+	var container models.Container
+	if err := models.DB.Select("hostname").First(&container, containerID).Error; err != nil {
+		return "", fmt.Errorf("容器不存在")
+	}
+	return container.Hostname, nil
+}
+
+// createProxyDevices 为端口映射创建 proxy 设备
+func (n *NATManager) createProxyDevices(mapping models.PortMapping) error {
+	hostname, err := containerHostname(mapping.ContainerID)
+	if err != nil {
+		return err
+	}
+
+	var created []string
+	for _, device := range proxyDevicesFor(mapping) {
+		if err := lxd.AddProxyDevice(hostname, device); err != nil {
+			// 回滚已创建的设备
+			lxd.RemoveProxyDevices(hostname, created)
+			return err
+		}
+		created = append(created, device.Name)
+	}
+
+	return nil
+}
+
+// deleteProxyDevices 删除端口映射对应的 proxy 设备
+func (n *NATManager) deleteProxyDevices(mapping models.PortMapping) error {
+	hostname, err := containerHostname(mapping.ContainerID)
+	if err != nil {
+		return nil // 容器已删除，设备随之删除
+	}
+
+	var names []string
+	for _, device := range proxyDevicesFor(mapping) {
+		names = append(names, device.Name)
+	}
+
+	return lxd.RemoveProxyDevices(hostname, names)
+}
+
+// ReconcileProxyDevices 将容器上的 proxy 设备与端口映射表同步
+// 缺失或配置不一致的设备会被重建，表中不存在的托管设备会被删除
+func (n *NATManager) ReconcileProxyDevices() (*ProxyReconcileResult, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if lxd.Client == nil {
+		return nil, fmt.Errorf("LXD 客户端未初始化")
+	}
+
+	instances, err := lxd.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	// 按容器名整理期望的设备
+	var mappings []models.PortMapping
+	models.DB.Where("status = ? AND mode IN ?", "active", []string{ModeProxy, ModeProxyNAT}).Find(&mappings)
+
+	desired := make(map[string]map[string]lxd.ProxyDevice)
+	for _, mapping := range mappings {
+		hostname, err := containerHostname(mapping.ContainerID)
+		if err != nil {
+			continue
+		}
+		if desired[hostname] == nil {
+			desired[hostname] = make(map[string]lxd.ProxyDevice)
+		}
+		for _, device := range proxyDevicesFor(mapping) {
+			desired[hostname][device.Name] = device
+		}
+	}
+
+	result := &ProxyReconcileResult{Errors: []string{}}
+	for _, instance := range instances {
+		want := desired[instance.Name]
+
+		// 删除多余或配置不一致的设备
+		var stale []string
+		for name, device := range instance.Devices {
+			if !lxd.IsManagedProxyDevice(name, device) {
+				continue
+			}
+			expected, ok := want[name]
+			if !ok || !reflect.DeepEqual(expected.Config(), device) {
+				stale = append(stale, name)
+			}
+		}
+		if len(stale) > 0 {
+			if err := lxd.RemoveProxyDevices(instance.Name, stale); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", instance.Name, err))
+				continue
+			}
+			result.Removed += len(stale)
+			for _, name := range stale {
+				delete(instance.Devices, name)
+			}
+		}
+
+		// 补充缺失的设备
+		for name, device := range want {
+			if _, exists := instance.Devices[name]; exists {
+				continue
+			}
+			if err := lxd.AddProxyDevice(instance.Name, device); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s/%s: %v", instance.Name, name, err))
+				continue
+			}
+			result.Added++
+		}
+	}
+
+	return result, nil
+}
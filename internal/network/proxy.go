@@ -2,9 +2,12 @@ package network
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"text/template"
 
@@ -14,48 +17,113 @@ import (
 
 // ProxyManager 反向代理管理器
 type ProxyManager struct {
-	mu         sync.RWMutex
-	nginxDir   string
-	nginxBin   string
+	mu          sync.RWMutex
+	nginxDir    string
+	nginxBin    string
+	htpasswdDir string
+	acmeWebroot string
+	backend     string // nginx, builtin
 }
 
 var GlobalProxyManager = &ProxyManager{
-	nginxDir: "/etc/nginx/sites-available",
-	nginxBin: "/usr/sbin/nginx",
+	nginxDir:    "/etc/nginx/sites-available",
+	nginxBin:    "/usr/sbin/nginx",
+	htpasswdDir: "/etc/nginx/openlxd-htpasswd",
+	backend:     BackendNginx,
 }
 
 // ProxyConfig 反向代理配置
 type ProxyConfig struct {
-	ID          uint   `json:"id"`
-	ContainerID uint   `json:"container_id"`
-	Domain      string `json:"domain"`
-	TargetIP    string `json:"target_ip"`
-	TargetPort  int    `json:"target_port"`
-	SSL         bool   `json:"ssl"`
-	CertPath    string `json:"cert_path"`
-	KeyPath     string `json:"key_path"`
-	Status      string `json:"status"` // active, inactive
+	ID          uint         `json:"id"`
+	ContainerID uint         `json:"container_id"`
+	Domain      string       `json:"domain"`
+	TargetIP    string       `json:"target_ip"`
+	TargetPort  int          `json:"target_port"`
+	SSL         bool         `json:"ssl"`
+	CertPath    string       `json:"cert_path"`
+	KeyPath     string       `json:"key_path"`
+	AutoCert    bool         `json:"auto_cert"`
+	Options     ProxyOptions `json:"options"`
+	Status      string       `json:"status"` // active, inactive
 }
 
 // nginxConfigTemplate Nginx 配置模板
-const nginxConfigTemplate = `server {
+// 域名、路径、IP 均已通过严格校验，路径类参数和头内容另经 quote 转义
+const nginxConfigTemplate = `{{- range .Upstreams }}
+upstream {{ .Name }} {
+    {{- if eq $.LoadBalance "least_conn" }}
+    least_conn;
+    {{- else if eq $.LoadBalance "ip_hash" }}
+    ip_hash;
+    {{- end }}
+    {{- range .Servers }}
+    server {{ addr .IP .Port }} weight={{ .Weight }};
+    {{- end }}
+}
+{{ end }}
+server {
     listen 80;
     server_name {{ .Domain }};
     
     {{- if .SSL }}
-    listen 443 ssl http2;
-    ssl_certificate {{ .CertPath }};
-    ssl_certificate_key {{ .KeyPath }};
+    listen 443 ssl{{ if .HTTP2 }} http2{{ end }};
+    ssl_certificate {{ quote .CertPath }};
+    ssl_certificate_key {{ quote .KeyPath }};
     ssl_protocols TLSv1.2 TLSv1.3;
     ssl_ciphers HIGH:!aNULL:!MD5;
     {{- end }}
+    {{- if .MaxBodySize }}
+
+    client_max_body_size {{ .MaxBodySize }}m;
+    {{- end }}
+    {{- range $name, $value := .ResponseHeaders }}
+    add_header {{ $name }} {{ quote $value }} always;
+    {{- end }}
+    {{- if or .DenyIPs .AllowIPs }}
+
+    # 访问控制
+    {{- range .DenyIPs }}
+    deny {{ . }};
+    {{- end }}
+    {{- range .AllowIPs }}
+    allow {{ . }};
+    {{- end }}
+    {{- if .AllowIPs }}
+    deny all;
+    {{- end }}
+    {{- end }}
+    {{- if .HtpasswdPath }}
+
+    auth_basic "Restricted";
+    auth_basic_user_file {{ quote .HtpasswdPath }};
+    {{- end }}
+    {{- if .ACMEWebroot }}
+
+    # ACME HTTP-01 验证
+    location ^~ /.well-known/acme-challenge/ {
+        root {{ quote .ACMEWebroot }};
+        default_type "text/plain";
+        auth_basic off;
+        allow all;
+    }
+    {{- end }}
+    {{- if and .SSL .ForceHTTPS }}
+
+    if ($scheme = http) {
+        return 301 https://$host$request_uri;
+    }
+    {{- end }}
+    {{- range .Locations }}
     
-    location / {
-        proxy_pass http://{{ .TargetIP }}:{{ .TargetPort }};
+    location {{ .Path }} {
+        proxy_pass http://{{ .Upstream }}{{ if .StripPrefix }}/{{ end }};
         proxy_set_header Host $host;
         proxy_set_header X-Real-IP $remote_addr;
         proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
         proxy_set_header X-Forwarded-Proto $scheme;
+        {{- range $name, $value := $.RequestHeaders }}
+        proxy_set_header {{ $name }} {{ quote $value }};
+        {{- end }}
         
         # WebSocket 支持
         proxy_http_version 1.1;
@@ -67,6 +135,7 @@ const nginxConfigTemplate = `server {
         proxy_send_timeout 60s;
         proxy_read_timeout 60s;
     }
+    {{- end }}
     
     # 访问日志
     access_log /var/log/nginx/{{ .Domain }}_access.log;
@@ -74,16 +143,81 @@ const nginxConfigTemplate = `server {
 }
 `
 
+// nginxTemplateFuncs 模板辅助函数
+var nginxTemplateFuncs = template.FuncMap{
+	"quote": nginxQuote,
+	"addr": func(ip string, port int) string {
+		return net.JoinHostPort(ip, strconv.Itoa(port))
+	},
+}
+
+// nginxQuote 生成 Nginx 双引号字符串
+func nginxQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// nginxUpstream 模板中的 upstream 块
+type nginxUpstream struct {
+	Name    string
+	Servers []ProxyUpstream
+}
+
+// nginxLocation 模板中的 location 块
+type nginxLocation struct {
+	Path        string
+	Upstream    string
+	StripPrefix bool
+}
+
+// SetBackend 设置反向代理后端
+func (p *ProxyManager) SetBackend(backend string) error {
+	if backend != BackendNginx && backend != BackendBuiltin {
+		return fmt.Errorf("不支持的反向代理后端: %s", backend)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.backend = backend
+	return nil
+}
+
+// GetBackend 获取当前反向代理后端
+func (p *ProxyManager) GetBackend() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.backend
+}
+
+// SetACMEWebroot 设置 ACME HTTP-01 验证文件目录
+func (p *ProxyManager) SetACMEWebroot(dir string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.acmeWebroot = dir
+}
+
 // AddProxy 添加反向代理
-func (p *ProxyManager) AddProxy(containerID uint, domain, targetIP string, targetPort int, ssl bool, certPath, keyPath string) (*ProxyConfig, error) {
+// autoCert 为 true 时先以 HTTP 方式创建，证书签发后由 ApplyCertificate 启用 SSL
+func (p *ProxyManager) AddProxy(containerID uint, domain, targetIP string, targetPort int, ssl bool, certPath, keyPath string, autoCert bool, opts ProxyOptions) (*ProxyConfig, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if !ValidateDomain(domain) {
+		return nil, fmt.Errorf("无效的域名: %s", domain)
+	}
+	if err := ValidateProxyOptions(&opts); err != nil {
+		return nil, err
+	}
+
 	// 检查配额
 	err := quota.GlobalQuotaManager.CheckProxyQuota(containerID)
 	if err != nil {
 		return nil, err
 	}
+	if err := quota.GlobalQuotaManager.CheckUserProxyQuota(containerID); err != nil {
+		return nil, err
+	}
 
 	// 检查域名是否已存在
 	var existing models.ProxyConfig
@@ -92,13 +226,10 @@ func (p *ProxyManager) AddProxy(containerID uint, domain, targetIP string, targe
 		return nil, fmt.Errorf("域名 %s 已被使用", domain)
 	}
 
-	// 创建 Nginx 配置
-	err = p.createNginxConfig(domain, targetIP, targetPort, ssl, certPath, keyPath)
-	if err != nil {
-		return nil, fmt.Errorf("创建 Nginx 配置失败: %v", err)
+	if autoCert {
+		ssl, certPath, keyPath = false, "", ""
 	}
 
-	// 保存到数据库
 	proxy := models.ProxyConfig{
 		ContainerID: containerID,
 		Domain:      domain,
@@ -107,13 +238,58 @@ func (p *ProxyManager) AddProxy(containerID uint, domain, targetIP string, targe
 		SSL:         ssl,
 		CertPath:    certPath,
 		KeyPath:     keyPath,
+		AutoCert:    autoCert,
 		Status:      "active",
 	}
+	if err := applyProxyOptions(&proxy, opts); err != nil {
+		return nil, err
+	}
+
+	// 创建 Nginx 配置
+	err = p.createNginxConfig(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("创建 Nginx 配置失败: %v", err)
+	}
+
+	// 保存到数据库
 	models.DB.Create(&proxy)
 
 	// 重载 Nginx
-	p.reloadNginx()
+	p.reload()
+
+	return toProxyConfig(proxy), nil
+}
+
+// UpdateProxyOptions 更新反向代理的高级选项
+func (p *ProxyManager) UpdateProxyOptions(proxyID uint, opts ProxyOptions) (*ProxyConfig, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var proxy models.ProxyConfig
+	if err := models.DB.First(&proxy, proxyID).Error; err != nil {
+		return nil, fmt.Errorf("反向代理不存在")
+	}
+
+	if err := ValidateProxyOptions(&opts); err != nil {
+		return nil, err
+	}
+	if err := applyProxyOptions(&proxy, opts); err != nil {
+		return nil, err
+	}
+
+	if err := p.createNginxConfig(proxy); err != nil {
+		return nil, fmt.Errorf("更新 Nginx 配置失败: %v", err)
+	}
+	models.DB.Save(&proxy)
+
+	// 重载 Nginx
+	p.reload()
+
+	return toProxyConfig(proxy), nil
+}
 
+// toProxyConfig 转换数据库模型
+func toProxyConfig(proxy models.ProxyConfig) *ProxyConfig {
 	return &ProxyConfig{
 		ID:          proxy.ID,
 		ContainerID: proxy.ContainerID,
@@ -123,8 +299,10 @@ func (p *ProxyManager) AddProxy(containerID uint, domain, targetIP string, targe
 		SSL:         proxy.SSL,
 		CertPath:    proxy.CertPath,
 		KeyPath:     proxy.KeyPath,
+		AutoCert:    proxy.AutoCert,
+		Options:     publicOptions(LoadProxyOptions(proxy)),
 		Status:      proxy.Status,
-	}, nil
+	}
 }
 
 // RemoveProxy 删除反向代理
@@ -141,16 +319,17 @@ func (p *ProxyManager) RemoveProxy(proxyID uint) error {
 	// 删除 Nginx 配置文件
 	configPath := filepath.Join(p.nginxDir, proxy.Domain+".conf")
 	os.Remove(configPath)
-	
+
 	// 删除软链接
 	linkPath := filepath.Join("/etc/nginx/sites-enabled", proxy.Domain+".conf")
 	os.Remove(linkPath)
+	os.Remove(filepath.Join(p.htpasswdDir, proxy.Domain))
 
 	// 从数据库删除
 	models.DB.Delete(&proxy)
 
 	// 重载 Nginx
-	p.reloadNginx()
+	p.reload()
 
 	return nil
 }
@@ -167,17 +346,18 @@ func (p *ProxyManager) RemoveContainerProxies(containerID uint) error {
 		// 删除 Nginx 配置文件
 		configPath := filepath.Join(p.nginxDir, proxy.Domain+".conf")
 		os.Remove(configPath)
-		
+
 		// 删除软链接
 		linkPath := filepath.Join("/etc/nginx/sites-enabled", proxy.Domain+".conf")
 		os.Remove(linkPath)
-		
+		os.Remove(filepath.Join(p.htpasswdDir, proxy.Domain))
+
 		// 从数据库删除
 		models.DB.Delete(&proxy)
 	}
 
 	// 重载 Nginx
-	p.reloadNginx()
+	p.reload()
 
 	return nil
 }
@@ -195,17 +375,7 @@ func (p *ProxyManager) GetContainerProxies(containerID uint) ([]ProxyConfig, err
 
 	result := make([]ProxyConfig, len(proxies))
 	for i, proxy := range proxies {
-		result[i] = ProxyConfig{
-			ID:          proxy.ID,
-			ContainerID: proxy.ContainerID,
-			Domain:      proxy.Domain,
-			TargetIP:    proxy.TargetIP,
-			TargetPort:  proxy.TargetPort,
-			SSL:         proxy.SSL,
-			CertPath:    proxy.CertPath,
-			KeyPath:     proxy.KeyPath,
-			Status:      proxy.Status,
-		}
+		result[i] = *toProxyConfig(proxy)
 	}
 
 	return result, nil
@@ -222,20 +392,49 @@ func (p *ProxyManager) UpdateProxySSL(proxyID uint, certPath, keyPath string) er
 		return fmt.Errorf("反向代理不存在")
 	}
 
-	// 更新数据库
+	// 更新数据库（手动指定证书后不再自动续期）
 	proxy.SSL = true
 	proxy.CertPath = certPath
 	proxy.KeyPath = keyPath
+	proxy.AutoCert = false
 	models.DB.Save(&proxy)
 
 	// 重新创建 Nginx 配置
-	err = p.createNginxConfig(proxy.Domain, proxy.TargetIP, proxy.TargetPort, proxy.SSL, proxy.CertPath, proxy.KeyPath)
+	err = p.createNginxConfig(proxy)
 	if err != nil {
 		return fmt.Errorf("更新 Nginx 配置失败: %v", err)
 	}
 
 	// 重载 Nginx
-	p.reloadNginx()
+	p.reload()
+
+	return nil
+}
+
+// ApplyCertificate 为使用自动证书的反向代理启用新签发的证书
+func (p *ProxyManager) ApplyCertificate(domain, certPath, keyPath string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var proxies []models.ProxyConfig
+	models.DB.Where("domain = ? AND auto_cert = ?", domain, true).Find(&proxies)
+	if len(proxies) == 0 {
+		return nil
+	}
+
+	for _, proxy := range proxies {
+		proxy.SSL = true
+		proxy.CertPath = certPath
+		proxy.KeyPath = keyPath
+		models.DB.Save(&proxy)
+
+		if err := p.createNginxConfig(proxy); err != nil {
+			return fmt.Errorf("更新 Nginx 配置失败: %v", err)
+		}
+	}
+
+	// 重载 Nginx
+	p.reload()
 
 	return nil
 }
@@ -250,65 +449,149 @@ func (p *ProxyManager) SyncNginxConfigs() error {
 	models.DB.Where("status = ?", "active").Find(&proxies)
 
 	for _, proxy := range proxies {
-		p.createNginxConfig(proxy.Domain, proxy.TargetIP, proxy.TargetPort, proxy.SSL, proxy.CertPath, proxy.KeyPath)
+		p.createNginxConfig(proxy)
 	}
 
 	// 重载 Nginx
-	p.reloadNginx()
+	p.reload()
 
 	return nil
 }
 
 // createNginxConfig 创建 Nginx 配置文件
-func (p *ProxyManager) createNginxConfig(domain, targetIP string, targetPort int, ssl bool, certPath, keyPath string) error {
+func (p *ProxyManager) createNginxConfig(proxy models.ProxyConfig) error {
+	// 内置反向代理直接读取数据库，无需生成配置文件
+	if p.backend == BackendBuiltin {
+		return nil
+	}
+
+	// 域名用于文件名和配置内容，写入前再次校验
+	if !ValidateDomain(proxy.Domain) {
+		return fmt.Errorf("无效的域名: %s", proxy.Domain)
+	}
+
 	// 确保目录存在
 	os.MkdirAll(p.nginxDir, 0755)
 	os.MkdirAll("/etc/nginx/sites-enabled", 0755)
 
 	// 解析模板
-	tmpl, err := template.New("nginx").Parse(nginxConfigTemplate)
+	tmpl, err := template.New("nginx").Funcs(nginxTemplateFuncs).Parse(nginxConfigTemplate)
 	if err != nil {
 		return err
 	}
 
-	// 创建配置文件
-	configPath := filepath.Join(p.nginxDir, domain+".conf")
-	file, err := os.Create(configPath)
+	opts := LoadProxyOptions(proxy)
+
+	// 基本认证密码文件
+	htpasswdPath, err := p.writeHtpasswd(proxy.Domain, opts.BasicAuth)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
 	// 渲染模板
 	data := struct {
-		Domain     string
-		TargetIP   string
-		TargetPort int
-		SSL        bool
-		CertPath   string
-		KeyPath    string
+		Domain          string
+		SSL             bool
+		HTTP2           bool
+		CertPath        string
+		KeyPath         string
+		ACMEWebroot     string
+		ForceHTTPS      bool
+		MaxBodySize     int
+		LoadBalance     string
+		Upstreams       []nginxUpstream
+		Locations       []nginxLocation
+		RequestHeaders  map[string]string
+		ResponseHeaders map[string]string
+		AllowIPs        []string
+		DenyIPs         []string
+		HtpasswdPath    string
 	}{
-		Domain:     domain,
-		TargetIP:   targetIP,
-		TargetPort: targetPort,
-		SSL:        ssl,
-		CertPath:   certPath,
-		KeyPath:    keyPath,
-	}
-	
+		Domain:          proxy.Domain,
+		SSL:             proxy.SSL,
+		HTTP2:           !opts.DisableHTTP2,
+		CertPath:        proxy.CertPath,
+		KeyPath:         proxy.KeyPath,
+		ACMEWebroot:     p.acmeWebroot,
+		ForceHTTPS:      opts.ForceHTTPS,
+		MaxBodySize:     opts.MaxBodySize,
+		LoadBalance:     opts.LoadBalance,
+		RequestHeaders:  opts.RequestHeaders,
+		ResponseHeaders: opts.ResponseHeaders,
+		AllowIPs:        opts.AllowIPs,
+		DenyIPs:         opts.DenyIPs,
+		HtpasswdPath:    htpasswdPath,
+	}
+
+	// 每个路由生成独立的 upstream，未覆盖 / 时追加默认路由
+	upstreamPrefix := "olxd_" + strings.NewReplacer(".", "_", "-", "_").Replace(proxy.Domain)
+	hasRoot := false
+	for i, route := range opts.Routes {
+		name := fmt.Sprintf("%s_%d", upstreamPrefix, i+1)
+		data.Upstreams = append(data.Upstreams, nginxUpstream{Name: name, Servers: route.Upstreams})
+		data.Locations = append(data.Locations, nginxLocation{Path: route.Path, Upstream: name, StripPrefix: route.StripPrefix})
+		if route.Path == "/" {
+			hasRoot = true
+		}
+	}
+	if !hasRoot {
+		name := upstreamPrefix + "_default"
+		data.Upstreams = append(data.Upstreams, nginxUpstream{Name: name, Servers: defaultUpstreams(proxy, opts)})
+		data.Locations = append(data.Locations, nginxLocation{Path: "/", Upstream: name})
+	}
+
+	// 创建配置文件
+	configPath := filepath.Join(p.nginxDir, proxy.Domain+".conf")
+	file, err := os.Create(configPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
 	err = tmpl.Execute(file, data)
 	if err != nil {
 		return err
 	}
 
 	// 创建软链接到 sites-enabled
-	linkPath := filepath.Join("/etc/nginx/sites-enabled", domain+".conf")
+	linkPath := filepath.Join("/etc/nginx/sites-enabled", proxy.Domain+".conf")
 	os.Remove(linkPath) // 删除旧的软链接
 	os.Symlink(configPath, linkPath)
 
 	return nil
 }
 
+// writeHtpasswd 写入基本认证密码文件，无认证用户时删除并返回空路径
+func (p *ProxyManager) writeHtpasswd(domain string, users []ProxyBasicAuthUser) (string, error) {
+	path := filepath.Join(p.htpasswdDir, domain)
+	if len(users) == 0 {
+		os.Remove(path)
+		return "", nil
+	}
+
+	if err := os.MkdirAll(p.htpasswdDir, 0750); err != nil {
+		return "", fmt.Errorf("创建密码文件目录失败: %v", err)
+	}
+
+	var content strings.Builder
+	for _, user := range users {
+		content.WriteString(user.Username + ":" + user.PasswordHash + "\n")
+	}
+	if err := os.WriteFile(path, []byte(content.String()), 0640); err != nil {
+		return "", fmt.Errorf("写入密码文件失败: %v", err)
+	}
+
+	return path, nil
+}
+
+// reload 重载当前反向代理后端
+func (p *ProxyManager) reload() error {
+	if p.backend == BackendBuiltin {
+		return GlobalBuiltinProxy.Reload()
+	}
+	return p.reloadNginx()
+}
+
 // reloadNginx 重载 Nginx 配置
 func (p *ProxyManager) reloadNginx() error {
 	// 测试配置
@@ -341,16 +624,15 @@ func (p *ProxyManager) GetProxyCount() int64 {
 	models.DB.Model(&models.ProxyConfig{}).
 		Where("status = ?", "active").
 		Count(&count)
-	
+
 	return count
 }
 
 // ValidateDomain 验证域名格式
+// 只允许小写字母、数字和连字符组成的标签，防止通过域名注入配置或路径
 func ValidateDomain(domain string) bool {
-	// 简单的域名验证
 	if len(domain) == 0 || len(domain) > 253 {
 		return false
 	}
-	// 可以添加更复杂的验证逻辑
-	return true
+	return domainPattern.MatchString(domain)
 }
@@ -0,0 +1,313 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/openlxd/backend/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 负载均衡策略
+const (
+	LoadBalanceRoundRobin = "round_robin"
+	LoadBalanceLeastConn  = "least_conn"
+	LoadBalanceIPHash     = "ip_hash"
+)
+
+// 反向代理选项上限
+const (
+	maxProxyRoutes      = 32
+	maxProxyUpstreams   = 16
+	maxProxyHeaders     = 32
+	maxProxyACLEntries  = 256
+	maxProxyBodySizeMB  = 10240
+	maxProxyHeaderValue = 1024
+)
+
+var (
+	domainPattern      = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	pathPattern        = regexp.MustCompile(`^/[A-Za-z0-9._~!*'()@+,=%/-]*$`)
+	headerNamePattern  = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+	usernamePattern    = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+	reservedReqHeaders = map[string]bool{"host": true, "connection": true, "upgrade": true, "content-length": true, "transfer-encoding": true}
+)
+
+// ProxyUpstream 后端服务器
+type ProxyUpstream struct {
+	IP     string `json:"ip"`
+	Port   int    `json:"port"`
+	Weight int    `json:"weight"` // 1-100，默认 1
+}
+
+// ProxyPathRoute 路径路由
+type ProxyPathRoute struct {
+	Path        string          `json:"path"`
+	Upstreams   []ProxyUpstream `json:"upstreams"`
+	StripPrefix bool            `json:"strip_prefix"` // 转发时去掉路径前缀（路径需以 / 结尾）
+}
+
+// ProxyBasicAuthUser HTTP 基本认证用户
+type ProxyBasicAuthUser struct {
+	Username     string `json:"username"`
+	Password     string `json:"password,omitempty"` // 仅用于提交，保存时转换为哈希
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// ProxyOptions 反向代理高级选项
+type ProxyOptions struct {
+	Routes          []ProxyPathRoute     `json:"routes"`
+	Upstreams       []ProxyUpstream      `json:"upstreams"` // 与 TargetIP:TargetPort 一起作为默认路由的后端
+	LoadBalance     string               `json:"load_balance"`
+	RequestHeaders  map[string]string    `json:"request_headers"`
+	ResponseHeaders map[string]string    `json:"response_headers"`
+	BasicAuth       []ProxyBasicAuthUser `json:"basic_auth"`
+	AllowIPs        []string             `json:"allow_ips"`
+	DenyIPs         []string             `json:"deny_ips"`
+	MaxBodySize     int                  `json:"max_body_size"` // MB
+	ForceHTTPS      bool                 `json:"force_https"`
+	DisableHTTP2    bool                 `json:"disable_http2"`
+}
+
+// ValidateProxyOptions 验证反向代理高级选项
+func ValidateProxyOptions(opts *ProxyOptions) error {
+	if opts.LoadBalance == "" {
+		opts.LoadBalance = LoadBalanceRoundRobin
+	}
+	switch opts.LoadBalance {
+	case LoadBalanceRoundRobin, LoadBalanceLeastConn, LoadBalanceIPHash:
+	default:
+		return fmt.Errorf("不支持的负载均衡策略: %s", opts.LoadBalance)
+	}
+
+	if err := validateUpstreams(opts.Upstreams, true); err != nil {
+		return err
+	}
+
+	if len(opts.Routes) > maxProxyRoutes {
+		return fmt.Errorf("路径路由不能超过 %d 条", maxProxyRoutes)
+	}
+	seen := make(map[string]bool)
+	for _, route := range opts.Routes {
+		if !pathPattern.MatchString(route.Path) || strings.Contains(route.Path, "//") || strings.Contains(route.Path, "/../") {
+			return fmt.Errorf("无效的路由路径: %s", route.Path)
+		}
+		if seen[route.Path] {
+			return fmt.Errorf("路由路径重复: %s", route.Path)
+		}
+		seen[route.Path] = true
+		if route.StripPrefix && !strings.HasSuffix(route.Path, "/") {
+			return fmt.Errorf("去掉前缀的路由路径必须以 / 结尾: %s", route.Path)
+		}
+		if err := validateUpstreams(route.Upstreams, false); err != nil {
+			return fmt.Errorf("路由 %s: %v", route.Path, err)
+		}
+	}
+
+	if err := validateHeaders(opts.RequestHeaders, true); err != nil {
+		return err
+	}
+	if err := validateHeaders(opts.ResponseHeaders, false); err != nil {
+		return err
+	}
+
+	users := make(map[string]bool)
+	for _, user := range opts.BasicAuth {
+		if !usernamePattern.MatchString(user.Username) {
+			return fmt.Errorf("无效的认证用户名: %s", user.Username)
+		}
+		if users[user.Username] {
+			return fmt.Errorf("认证用户名重复: %s", user.Username)
+		}
+		users[user.Username] = true
+		if user.Password == "" && user.PasswordHash == "" {
+			return fmt.Errorf("认证用户 %s 缺少密码", user.Username)
+		}
+	}
+
+	if err := validateACL(opts.AllowIPs); err != nil {
+		return err
+	}
+	if err := validateACL(opts.DenyIPs); err != nil {
+		return err
+	}
+
+	if opts.MaxBodySize < 0 || opts.MaxBodySize > maxProxyBodySizeMB {
+		return fmt.Errorf("请求体大小上限必须在 0-%d MB 之间", maxProxyBodySizeMB)
+	}
+
+	return nil
+}
+
+// UpstreamIPs 默认路由和路径路由中所有后端的 IP
+func (o *ProxyOptions) UpstreamIPs() []string {
+	var ips []string
+	for _, u := range o.Upstreams {
+		ips = append(ips, u.IP)
+	}
+	for _, route := range o.Routes {
+		for _, u := range route.Upstreams {
+			ips = append(ips, u.IP)
+		}
+	}
+	return ips
+}
+
+// validateUpstreams 验证后端列表
+func validateUpstreams(upstreams []ProxyUpstream, allowEmpty bool) error {
+	if len(upstreams) == 0 && !allowEmpty {
+		return fmt.Errorf("至少需要一个后端")
+	}
+	if len(upstreams) > maxProxyUpstreams {
+		return fmt.Errorf("后端不能超过 %d 个", maxProxyUpstreams)
+	}
+	for i := range upstreams {
+		u := &upstreams[i]
+		if net.ParseIP(u.IP) == nil {
+			return fmt.Errorf("无效的后端IP: %s", u.IP)
+		}
+		if u.Port < 1 || u.Port > 65535 {
+			return fmt.Errorf("无效的后端端口: %d", u.Port)
+		}
+		if u.Weight == 0 {
+			u.Weight = 1
+		}
+		if u.Weight < 1 || u.Weight > 100 {
+			return fmt.Errorf("后端权重必须在 1-100 之间")
+		}
+	}
+	return nil
+}
+
+// validateHeaders 验证自定义头（不允许控制字符和变量，防止配置注入）
+func validateHeaders(headers map[string]string, request bool) error {
+	if len(headers) > maxProxyHeaders {
+		return fmt.Errorf("自定义头不能超过 %d 个", maxProxyHeaders)
+	}
+	for name, value := range headers {
+		if !headerNamePattern.MatchString(name) {
+			return fmt.Errorf("无效的头名称: %s", name)
+		}
+		if request && reservedReqHeaders[strings.ToLower(name)] {
+			return fmt.Errorf("不允许修改请求头: %s", name)
+		}
+		if len(value) > maxProxyHeaderValue || strings.ContainsAny(value, "$\\\"") {
+			return fmt.Errorf("无效的头内容: %s", name)
+		}
+		for _, r := range value {
+			if r < 0x20 || r == 0x7f {
+				return fmt.Errorf("无效的头内容: %s", name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateACL 验证 IP/CIDR 列表
+func validateACL(entries []string) error {
+	if len(entries) > maxProxyACLEntries {
+		return fmt.Errorf("访问控制条目不能超过 %d 条", maxProxyACLEntries)
+	}
+	for _, entry := range entries {
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil {
+			return fmt.Errorf("无效的 IP/CIDR: %s", entry)
+		}
+	}
+	return nil
+}
+
+// applyProxyOptions 将选项写入数据库模型，明文密码转换为 bcrypt 哈希
+// 未提供新密码的已有用户保留原哈希
+func applyProxyOptions(proxy *models.ProxyConfig, opts ProxyOptions) error {
+	existing := make(map[string]string)
+	for _, user := range LoadProxyOptions(*proxy).BasicAuth {
+		existing[user.Username] = user.PasswordHash
+	}
+
+	users := make([]ProxyBasicAuthUser, 0, len(opts.BasicAuth))
+	for _, user := range opts.BasicAuth {
+		hash := existing[user.Username]
+		if user.Password != "" {
+			b, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+			if err != nil {
+				return fmt.Errorf("密码加密失败: %v", err)
+			}
+			hash = string(b)
+		}
+		if hash == "" {
+			return fmt.Errorf("认证用户 %s 缺少密码", user.Username)
+		}
+		users = append(users, ProxyBasicAuthUser{Username: user.Username, PasswordHash: hash})
+	}
+
+	proxy.Routes = encodeJSON(opts.Routes)
+	proxy.Upstreams = encodeJSON(opts.Upstreams)
+	proxy.LoadBalance = opts.LoadBalance
+	proxy.RequestHeaders = encodeJSON(opts.RequestHeaders)
+	proxy.ResponseHeaders = encodeJSON(opts.ResponseHeaders)
+	proxy.BasicAuth = encodeJSON(users)
+	proxy.AllowIPs = encodeJSON(opts.AllowIPs)
+	proxy.DenyIPs = encodeJSON(opts.DenyIPs)
+	proxy.MaxBodySize = opts.MaxBodySize
+	proxy.ForceHTTPS = opts.ForceHTTPS
+	proxy.DisableHTTP2 = opts.DisableHTTP2
+
+	return nil
+}
+
+// LoadProxyOptions 从数据库模型读取高级选项
+func LoadProxyOptions(proxy models.ProxyConfig) ProxyOptions {
+	opts := ProxyOptions{
+		LoadBalance:  proxy.LoadBalance,
+		MaxBodySize:  proxy.MaxBodySize,
+		ForceHTTPS:   proxy.ForceHTTPS,
+		DisableHTTP2: proxy.DisableHTTP2,
+	}
+	decodeJSON(proxy.Routes, &opts.Routes)
+	decodeJSON(proxy.Upstreams, &opts.Upstreams)
+	decodeJSON(proxy.RequestHeaders, &opts.RequestHeaders)
+	decodeJSON(proxy.ResponseHeaders, &opts.ResponseHeaders)
+	decodeJSON(proxy.BasicAuth, &opts.BasicAuth)
+	decodeJSON(proxy.AllowIPs, &opts.AllowIPs)
+	decodeJSON(proxy.DenyIPs, &opts.DenyIPs)
+	if opts.LoadBalance == "" {
+		opts.LoadBalance = LoadBalanceRoundRobin
+	}
+	return opts
+}
+
+// defaultUpstreams 默认路由的后端（TargetIP:TargetPort 加额外后端）
+func defaultUpstreams(proxy models.ProxyConfig, opts ProxyOptions) []ProxyUpstream {
+	upstreams := []ProxyUpstream{{IP: proxy.TargetIP, Port: proxy.TargetPort, Weight: 1}}
+	return append(upstreams, opts.Upstreams...)
+}
+
+// publicOptions 去掉密码哈希后的选项，用于 API 返回
+func publicOptions(opts ProxyOptions) ProxyOptions {
+	users := make([]ProxyBasicAuthUser, len(opts.BasicAuth))
+	for i, user := range opts.BasicAuth {
+		users[i] = ProxyBasicAuthUser{Username: user.Username}
+	}
+	opts.BasicAuth = users
+	return opts
+}
+
+func encodeJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return ""
+	}
+	return string(data)
+}
+
+func decodeJSON(data string, v interface{}) {
+	if data != "" {
+		json.Unmarshal([]byte(data), v)
+	}
+}
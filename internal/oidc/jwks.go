@@ -0,0 +1,147 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// jwk JSON Web Key（只支持签名用的 RSA 和 EC 公钥）
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// key 按 kid 查找签名公钥；找不到时重新拉取 JWKS（身份提供方轮换密钥），拉取间隔不小于 keysMinInterval
+func (p *Provider) key(ctx context.Context, uri, kid string) (interface{}, error) {
+	p.mu.Lock()
+	sameURI := p.keysURI == uri
+	cached := p.keys
+	stale := !sameURI || time.Since(p.keysAt) >= keysMinInterval
+	p.mu.Unlock()
+
+	if k := lookupKey(cached, kid); k != nil && sameURI {
+		return k, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("未找到签名密钥 (kid=%s)", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.keysAt = time.Now()
+	p.keysURI = uri
+	p.mu.Unlock()
+
+	if k := lookupKey(keys, kid); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("未找到签名密钥 (kid=%s)", kid)
+}
+
+// lookupKey 按 kid 查找公钥；令牌未携带 kid 且只有一个密钥时使用该密钥
+func lookupKey(keys map[string]interface{}, kid string) interface{} {
+	if k, ok := keys[kid]; ok {
+		return k
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, k := range keys {
+			return k
+		}
+	}
+	return nil
+}
+
+// fetchKeys 拉取并解析 JWKS
+func (p *Provider) fetchKeys(ctx context.Context, uri string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("获取 JWKS 失败: %v", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS 中没有可用的签名密钥")
+	}
+	return keys, nil
+}
+
+// publicKey 将 JWK 转换为公钥
+func (k jwk) publicKey() (interface{}, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("RSA 指数无效")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的曲线: %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("EC 公钥不在曲线上")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("不支持的密钥类型: %s", k.Kty)
+}
@@ -0,0 +1,379 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/openlxd/backend/internal/config"
+)
+
+const (
+	stateTTL        = 10 * time.Minute // 登录请求从跳转到回调的有效期
+	discoveryTTL    = time.Hour        // 发现文档缓存时间
+	keysMinInterval = time.Minute      // 遇到未知 kid 时重新拉取 JWKS 的最小间隔
+)
+
+// ErrDisabled 未启用 OIDC 登录
+var ErrDisabled = errors.New("未启用 OIDC 单点登录")
+
+// ErrInvalidState 回调的 state 不存在、已使用或已过期
+var ErrInvalidState = errors.New("登录请求无效或已过期，请重新登录")
+
+// metadata 身份提供方的发现文档（/.well-known/openid-configuration）
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// pendingLogin 已发起、等待回调的登录请求
+type pendingLogin struct {
+	verifier string // PKCE code_verifier
+	nonce    string
+	redirect string // 登录成功后跳转的站内地址
+	expires  time.Time
+}
+
+// Identity 通过校验的 ID Token 中的用户身份
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool
+	Roles         []string // role_claim 的值
+}
+
+// Provider OIDC 身份提供方客户端：发现端点、授权码 + PKCE 登录、ID Token 签名校验
+type Provider struct {
+	client *http.Client
+
+	mu      sync.Mutex
+	meta    *metadata
+	metaAt  time.Time
+	keys    map[string]interface{} // kid -> 公钥
+	keysAt  time.Time
+	keysURI string
+	pending map[string]*pendingLogin
+}
+
+// GlobalProvider 全局 OIDC 客户端
+var GlobalProvider = &Provider{
+	client:  &http.Client{Timeout: 10 * time.Second},
+	pending: make(map[string]*pendingLogin),
+}
+
+// Enabled 是否已启用并配置 OIDC 登录
+func Enabled() bool {
+	cfg := config.GetConfig().OIDC
+	return cfg.Enabled && cfg.Issuer != "" && cfg.ClientID != ""
+}
+
+// randomString 生成 URL 安全的随机字符串
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthURL 发起登录：生成 state、nonce 和 PKCE 参数，返回 state 和身份提供方的授权地址
+func (p *Provider) AuthURL(ctx context.Context, redirectURL, next string) (string, string, error) {
+	if !Enabled() {
+		return "", "", ErrDisabled
+	}
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString(48)
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	p.mu.Lock()
+	now := time.Now()
+	for key, login := range p.pending {
+		if now.After(login.expires) {
+			delete(p.pending, key)
+		}
+	}
+	p.pending[state] = &pendingLogin{verifier: verifier, nonce: nonce, redirect: next, expires: now.Add(stateTTL)}
+	p.mu.Unlock()
+
+	cfg := config.GetConfig().OIDC
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", cfg.ClientID)
+	values.Set("redirect_uri", redirectURL)
+	values.Set("scope", cfg.Scopes)
+	values.Set("state", state)
+	values.Set("nonce", nonce)
+	values.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	values.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return state, meta.AuthorizationEndpoint + sep + values.Encode(), nil
+}
+
+// Exchange 处理回调：校验 state，用授权码和 code_verifier 换取令牌并校验 ID Token，返回用户身份和登录后跳转地址
+func (p *Provider) Exchange(ctx context.Context, redirectURL, state, code string) (*Identity, string, error) {
+	if !Enabled() {
+		return nil, "", ErrDisabled
+	}
+
+	p.mu.Lock()
+	login, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+	if !ok || time.Now().After(login.expires) {
+		return nil, "", ErrInvalidState
+	}
+
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cfg := config.GetConfig().OIDC
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURL)
+	form.Set("code_verifier", login.verifier)
+	if cfg.ClientSecret == "" {
+		form.Set("client_id", cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := p.getJSON(req, &token); err != nil {
+		return nil, "", fmt.Errorf("换取令牌失败: %v", err)
+	}
+	if token.Error != "" {
+		return nil, "", fmt.Errorf("换取令牌失败: %s %s", token.Error, token.Description)
+	}
+	if token.IDToken == "" {
+		return nil, "", fmt.Errorf("身份提供方未返回 id_token")
+	}
+
+	claims, err := p.verifyIDToken(ctx, meta, token.IDToken, login.nonce)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// ID Token 中缺少用户名或角色时从 userinfo 补充
+	if meta.UserinfoEndpoint != "" && token.AccessToken != "" &&
+		(claimValue(claims, cfg.UsernameClaim) == nil || claimValue(claims, cfg.RoleClaim) == nil || claims["email"] == nil) {
+		if info, err := p.userinfo(ctx, meta, token.AccessToken); err == nil && info["sub"] == claims["sub"] {
+			for key, value := range info {
+				if _, exists := claims[key]; !exists {
+					claims[key] = value
+				}
+			}
+		}
+	}
+
+	return identityFromClaims(meta.Issuer, claims), login.redirect, nil
+}
+
+// discover 获取（并缓存）发现文档，issuer 必须与配置一致
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	issuer := strings.TrimSuffix(config.GetConfig().OIDC.Issuer, "/")
+
+	p.mu.Lock()
+	if p.meta != nil && strings.TrimSuffix(p.meta.Issuer, "/") == issuer && time.Since(p.metaAt) < discoveryTTL {
+		meta := p.meta
+		p.mu.Unlock()
+		return meta, nil
+	}
+	p.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta metadata
+	if err := p.getJSON(req, &meta); err != nil {
+		return nil, fmt.Errorf("获取 OIDC 发现文档失败: %v", err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("发现文档中的 issuer (%s) 与配置不一致", meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("发现文档缺少 authorization_endpoint、token_endpoint 或 jwks_uri")
+	}
+
+	p.mu.Lock()
+	p.meta = &meta
+	p.metaAt = time.Now()
+	p.mu.Unlock()
+	return &meta, nil
+}
+
+// verifyIDToken 校验 ID Token 的签名、issuer、audience、有效期和 nonce
+func (p *Provider) verifyIDToken(ctx context.Context, meta *metadata, raw, nonce string) (jwt.MapClaims, error) {
+	clientID := config.GetConfig().OIDC.ClientID
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, meta.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ID Token 校验失败: %v", err)
+	}
+
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("ID Token 校验失败: nonce 不匹配")
+	}
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != clientID {
+			return nil, fmt.Errorf("ID Token 校验失败: azp 不匹配")
+		}
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("ID Token 缺少 sub")
+	}
+	return claims, nil
+}
+
+// userinfo 调用 userinfo 端点
+func (p *Provider) userinfo(ctx context.Context, meta *metadata, accessToken string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	var info map[string]interface{}
+	err = p.getJSON(req, &info)
+	return info, err
+}
+
+// getJSON 发送请求并解析 JSON 响应（令牌端点的错误响应同样是 JSON）
+func (p *Provider) getJSON(req *http.Request, v interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("HTTP %d: 响应不是有效的 JSON", resp.StatusCode)
+	}
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// claimValue 读取 claim，支持以点分隔的嵌套路径（如 realm_access.roles）
+func claimValue(claims map[string]interface{}, path string) interface{} {
+	if path == "" {
+		return nil
+	}
+	if value, ok := claims[path]; ok {
+		return value
+	}
+	var current interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if current, ok = m[part]; !ok {
+			return nil
+		}
+	}
+	return current
+}
+
+// claimStrings 将 claim 转为字符串列表（字符串按逗号和空格拆分）
+func claimStrings(value interface{}) []string {
+	var result []string
+	switch v := value.(type) {
+	case string:
+		result = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
+
+// identityFromClaims 从 claims 中提取用户身份
+func identityFromClaims(issuer string, claims map[string]interface{}) *Identity {
+	cfg := config.GetConfig().OIDC
+	id := &Identity{Issuer: issuer, Roles: claimStrings(claimValue(claims, cfg.RoleClaim))}
+	id.Subject, _ = claims["sub"].(string)
+	id.Email, _ = claims["email"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = v == "true"
+	}
+
+	id.Username, _ = claimValue(claims, cfg.UsernameClaim).(string)
+	if id.Username == "" && id.Email != "" {
+		id.Username = strings.SplitN(id.Email, "@", 2)[0]
+	}
+	if id.Username == "" {
+		id.Username = id.Subject
+	}
+	return id
+}
@@ -0,0 +1,216 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/testutil"
+)
+
+const (
+	testClientID = "openlxd"
+	testRedirect = "https://panel.example.com/api/v1/users/oidc/callback"
+)
+
+// mockIdP 本地模拟的身份提供方：发现文档、JWKS 和令牌端点，令牌端点校验 PKCE 后签发 ID Token
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// 下一次登录返回的身份，由 AuthURL 中的参数补全 nonce 和 code_challenge
+	claims    jwt.MapClaims
+	challenge string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{t: t, key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "valid-code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(idp.key)
+		if err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "id_token": signed})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// login 走一遍授权码 + PKCE 登录，返回身份提供方签发的身份
+func (idp *mockIdP) login(p *Provider, subject, email string, groups ...string) (*Identity, error) {
+	state, authURL, err := p.AuthURL(context.Background(), testRedirect, "/dashboard")
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	idp.challenge = query.Get("code_challenge")
+
+	now := time.Now()
+	idp.claims = jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            testClientID,
+		"sub":            subject,
+		"email":          email,
+		"email_verified": true,
+		"groups":         groups,
+		"nonce":          query.Get("nonce"),
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+
+	id, next, err := p.Exchange(context.Background(), testRedirect, state, "valid-code")
+	if err != nil {
+		return nil, err
+	}
+	if next != "/dashboard" {
+		idp.t.Fatalf("登录后跳转地址应为 /dashboard，实际 %q", next)
+	}
+	return id, nil
+}
+
+// setupTest 使用临时数据库和指向模拟身份提供方的配置
+func setupTest(t *testing.T) (*mockIdP, *Provider) {
+	t.Helper()
+	idp := newMockIdP(t)
+	testutil.Setup(t, func(cfg *config.Config) {
+		cfg.OIDC.Enabled = true
+		cfg.OIDC.Issuer = idp.server.URL
+		cfg.OIDC.ClientID = testClientID
+		cfg.OIDC.Scopes = "openid email profile"
+		cfg.OIDC.RoleClaim = "groups"
+		cfg.OIDC.AdminValues = "panel-admins"
+		cfg.OIDC.AutoProvision = true
+	})
+
+	return idp, &Provider{client: idp.server.Client(), pending: make(map[string]*pendingLogin)}
+}
+
+func TestProvisionedUserRoleFollowsIdP(t *testing.T) {
+	idp, p := setupTest(t)
+
+	id, err := idp.login(p, "sub-1", "carol@example.com", "panel-admins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := Provision(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "carol" || user.Role != "admin" || !user.OIDCProvisioned {
+		t.Fatalf("首次登录应创建管理员账号，实际 %s/%s", user.Username, user.Role)
+	}
+
+	// 身份提供方中移出管理员组后，下次登录同步为普通用户
+	id, err = idp.login(p, "sub-1", "carol@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err = Provision(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != "user" {
+		t.Fatalf("由 OIDC 创建的账号角色应随身份提供方同步，实际 %s", user.Role)
+	}
+}
+
+func TestLinkedLocalAdminKeepsRole(t *testing.T) {
+	idp, p := setupTest(t)
+
+	admin := models.User{Username: "ops", Email: "ops@example.com", PasswordHash: "x", Role: "admin", Status: "active"}
+	models.DB.Create(&admin)
+
+	// 身份提供方中没有管理员组，关联本地管理员时不应降级
+	for i := 0; i < 2; i++ {
+		id, err := idp.login(p, "sub-ops", "ops@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, err := Provision(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != admin.ID || user.Role != "admin" {
+			t.Fatalf("第 %d 次登录：应关联本地管理员并保留角色，实际 %s/%s", i+1, user.Username, user.Role)
+		}
+	}
+
+	var saved models.User
+	models.DB.First(&saved, admin.ID)
+	if saved.Role != "admin" || saved.OIDCSubject != "sub-ops" || saved.OIDCProvisioned {
+		t.Fatalf("本地管理员应已关联且角色不变，实际 %s/%s", saved.Role, saved.OIDCSubject)
+	}
+}
+
+func TestExchangeRejectsReplayAndForgedCode(t *testing.T) {
+	idp, p := setupTest(t)
+
+	state, _, err := p.AuthURL(context.Background(), testRedirect, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := p.Exchange(context.Background(), testRedirect, state, "forged-code"); err == nil {
+		t.Fatal("无效的授权码应失败")
+	}
+	if _, _, err := p.Exchange(context.Background(), testRedirect, state, "valid-code"); err != ErrInvalidState {
+		t.Fatalf("state 只能使用一次，实际 %v", err)
+	}
+
+	// 签名密钥与 JWKS 不匹配的 ID Token
+	idp.key, _ = rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := idp.login(p, "sub-2", "eve@example.com"); err == nil {
+		t.Fatal("签名无效的 ID Token 应被拒绝")
+	}
+}
@@ -0,0 +1,130 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ErrRoleNotAllowed role_claim 不包含允许登录的值
+var ErrRoleNotAllowed = errors.New("身份提供方中的角色不允许登录面板")
+
+// MapRole 根据 role_claim 的值映射面板角色：包含 admin_values 中任一值为 admin；
+// 配置了 user_values 时需包含其中任一值才能以 user 登录，否则已认证用户均为 user
+func MapRole(roles []string) (string, error) {
+	cfg := config.GetConfig().OIDC
+	if containsAny(roles, cfg.AdminValues) {
+		return "admin", nil
+	}
+	if strings.TrimSpace(cfg.UserValues) == "" || containsAny(roles, cfg.UserValues) {
+		return "user", nil
+	}
+	return "", ErrRoleNotAllowed
+}
+
+// containsAny roles 中是否包含逗号分隔的 values 中的任一值
+func containsAny(roles []string, values string) bool {
+	for _, value := range strings.Split(values, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		for _, role := range roles {
+			if role == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Provision 查找或创建与 OIDC 身份对应的用户：先按 issuer + sub 查找已关联的用户，
+// 再按已验证的邮箱关联本地用户，最后（启用 auto_provision 时）创建新用户；
+// 由 OIDC 创建的用户每次登录按映射结果同步角色，关联的本地用户保留面板中设置的角色
+func Provision(id *Identity) (*models.User, error) {
+	role, err := MapRole(id.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	err = models.DB.Where("oidc_issuer = ? AND oidc_subject = ?", id.Issuer, id.Subject).First(&user).Error
+	switch {
+	case err == nil:
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	case id.Email != "" && id.EmailVerified &&
+		models.DB.Where("email = ? AND (oidc_subject = '' OR oidc_subject IS NULL)", id.Email).First(&user).Error == nil:
+		// 关联邮箱相同的本地用户
+		if err := models.DB.Model(&user).Updates(map[string]interface{}{"oidc_issuer": id.Issuer, "oidc_subject": id.Subject}).Error; err != nil {
+			return nil, err
+		}
+		log.Printf("OIDC 身份 %s 已关联本地用户 %s", id.Subject, user.Username)
+	case config.GetConfig().OIDC.AutoProvision:
+		return createUser(id, role)
+	default:
+		return nil, fmt.Errorf("账号未开通，请联系管理员")
+	}
+
+	if !user.IsActive() {
+		return nil, fmt.Errorf("用户已被禁用")
+	}
+	if user.OIDCProvisioned && user.Role != role {
+		if err := models.DB.Model(&user).Update("role", role).Error; err != nil {
+			return nil, err
+		}
+		log.Printf("OIDC 用户 %s 的角色已按身份提供方同步为 %s", user.Username, role)
+	}
+	return &user, nil
+}
+
+// createUser 为首次登录的 OIDC 身份创建用户，密码为随机值（只能通过单点登录或重置密码登录）
+func createUser(id *Identity, role string) (*models.User, error) {
+	var count int64
+	models.DB.Model(&models.User{}).Where("username = ?", id.Username).Count(&count)
+	if count > 0 {
+		return nil, fmt.Errorf("用户名 %s 已被其他账号使用，请联系管理员关联", id.Username)
+	}
+
+	email := id.Email
+	if email == "" || !id.EmailVerified {
+		email = id.Subject + "@oidc.invalid"
+	}
+	models.DB.Model(&models.User{}).Where("email = ?", email).Count(&count)
+	if count > 0 {
+		return nil, fmt.Errorf("邮箱 %s 已被其他账号使用，请联系管理员关联", email)
+	}
+
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return nil, err
+	}
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(password)), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		Username:        id.Username,
+		Email:           email,
+		PasswordHash:    string(passwordHash),
+		Role:            role,
+		Status:          "active",
+		OIDCIssuer:      id.Issuer,
+		OIDCSubject:     id.Subject,
+		OIDCProvisioned: true,
+	}
+	if err := models.DB.Create(user).Error; err != nil {
+		return nil, err
+	}
+	models.LogAction("oidc_provision", "", fmt.Sprintf("通过 OIDC 创建用户 %s（%s）", user.Username, role), "success")
+	return user, nil
+}
@@ -0,0 +1,233 @@
+package operations
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 操作状态
+const (
+	StatusRunning   = "running"
+	StatusSuccess   = "success"
+	StatusFailure   = "failure"
+	StatusCancelled = "cancelled"
+)
+
+// 已结束的操作保留时间
+const retention = time.Hour
+
+// Observer 操作创建或进度变化时回调（由事件推送模块设置），参数为状态快照
+var Observer func(op *Operation)
+
+// Result 单个目标的执行结果
+type Result struct {
+	Target string `json:"target"`
+	Status string `json:"status"` // success, failed, skipped
+	Error  string `json:"error,omitempty"`
+}
+
+// Operation 后台操作（如批量操作），用于查询进度
+type Operation struct {
+	ID          string      `json:"id"`
+	Type        string      `json:"type"`
+	Description string      `json:"description"`
+	Status      string      `json:"status"`
+	Total       int         `json:"total"`
+	Succeeded   int         `json:"succeeded"`
+	Failed      int         `json:"failed"`
+	Progress    int         `json:"progress"` // 0-100
+	Results     []Result    `json:"results"`
+	Metadata    interface{} `json:"metadata,omitempty"`
+	CreatedBy   string      `json:"created_by,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+
+	mu        sync.Mutex
+	cancelled chan struct{}
+}
+
+// Manager 操作注册表
+type Manager struct {
+	mu         sync.RWMutex
+	operations map[string]*Operation
+}
+
+var GlobalManager = &Manager{
+	operations: make(map[string]*Operation),
+}
+
+// Create 登记一个新操作，metadata 在登记前写入（登记后操作即可被并发读取）
+func (m *Manager) Create(opType, description, createdBy string, total int, metadata interface{}) *Operation {
+	now := time.Now()
+	op := &Operation{
+		ID:          newID(),
+		Type:        opType,
+		Description: description,
+		Status:      StatusRunning,
+		Total:       total,
+		Results:     []Result{},
+		Metadata:    metadata,
+		CreatedBy:   createdBy,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		cancelled:   make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.prune(now)
+	m.operations[op.ID] = op
+	m.mu.Unlock()
+
+	op.notify()
+	return op
+}
+
+// Get 获取操作快照
+func (m *Manager) Get(id string) (*Operation, error) {
+	m.mu.RLock()
+	op, ok := m.operations[id]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("操作不存在")
+	}
+	return op.Snapshot(), nil
+}
+
+// List 获取所有操作快照（按创建时间倒序，不含逐项结果）
+func (m *Manager) List() []*Operation {
+	m.mu.RLock()
+	list := make([]*Operation, 0, len(m.operations))
+	for _, op := range m.operations {
+		snapshot := op.Snapshot()
+		snapshot.Results = nil
+		list = append(list, snapshot)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Cancel 取消运行中的操作，已开始的步骤会继续完成
+func (m *Manager) Cancel(id string) error {
+	m.mu.RLock()
+	op, ok := m.operations[id]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("操作不存在")
+	}
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	if op.Status != StatusRunning {
+		return fmt.Errorf("操作已结束: %s", op.Status)
+	}
+	select {
+	case <-op.cancelled:
+	default:
+		close(op.cancelled)
+	}
+	return nil
+}
+
+// prune 清理过期的已结束操作（调用方需持有锁）
+func (m *Manager) prune(now time.Time) {
+	for id, op := range m.operations {
+		op.mu.Lock()
+		expired := op.Status != StatusRunning && now.Sub(op.UpdatedAt) > retention
+		op.mu.Unlock()
+		if expired {
+			delete(m.operations, id)
+		}
+	}
+}
+
+// Cancelled 操作是否已被请求取消
+func (op *Operation) Cancelled() bool {
+	select {
+	case <-op.cancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// AddResult 记录一个目标的执行结果并更新进度
+func (op *Operation) AddResult(result Result) {
+	defer op.notify()
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	op.Results = append(op.Results, result)
+	switch result.Status {
+	case "success":
+		op.Succeeded++
+	case "failed":
+		op.Failed++
+	}
+	if op.Total > 0 {
+		op.Progress = len(op.Results) * 100 / op.Total
+	}
+	op.UpdatedAt = time.Now()
+}
+
+// Finish 结束操作：取消优先，其次有失败项时为 failure
+func (op *Operation) Finish() {
+	defer op.notify()
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	switch {
+	case op.Cancelled():
+		op.Status = StatusCancelled
+	case op.Failed > 0:
+		op.Status = StatusFailure
+	default:
+		op.Status = StatusSuccess
+	}
+	op.Progress = 100
+	op.UpdatedAt = time.Now()
+}
+
+// Snapshot 复制当前状态
+func (op *Operation) Snapshot() *Operation {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	return &Operation{
+		ID:          op.ID,
+		Type:        op.Type,
+		Description: op.Description,
+		Status:      op.Status,
+		Total:       op.Total,
+		Succeeded:   op.Succeeded,
+		Failed:      op.Failed,
+		Progress:    op.Progress,
+		Results:     append([]Result{}, op.Results...),
+		Metadata:    op.Metadata,
+		CreatedBy:   op.CreatedBy,
+		CreatedAt:   op.CreatedAt,
+		UpdatedAt:   op.UpdatedAt,
+	}
+}
+
+// notify 将当前状态快照通知给 Observer（不能持有 op.mu 调用）
+func (op *Operation) notify() {
+	if Observer != nil {
+		Observer(op.Snapshot())
+	}
+}
+
+// newID 生成随机操作 ID
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
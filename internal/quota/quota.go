@@ -11,6 +11,10 @@ import (
 // QuotaManager 配额管理器
 type QuotaManager struct {
 	mu sync.RWMutex
+
+	// 已通过配额检查、尚未写入数据库的新建容器，按用户统计
+	reserveMu sync.Mutex
+	reserved  map[uint]*reservation
 }
 
 var GlobalQuotaManager = &QuotaManager{}
@@ -32,10 +36,19 @@ func (q *QuotaManager) GetOrCreateQuota(containerID uint) (*models.Quota, error)
 			ProxyQuota:       -1,
 			TrafficQuota:     -1,
 			TrafficUsed:      0,
-			TrafficResetDate: time.Now().AddDate(0, 1, 0), // 下个月重置
+			TrafficMode:      TrafficModeSum,
+			BillingDay:       1,
 			OnExceed:         "warn",
 		}
+		quota.CycleStart, quota.TrafficResetDate = CycleBounds(quota.BillingDay, time.Now())
 		models.DB.Create(&quota)
+
+		// 使用默认配额模板（创建后再写入，避免零值被默认值标签替换为 -1）
+		if tpl := defaultTemplate(); tpl != nil {
+			updates := containerFields(tpl)
+			updates["template_id"] = tpl.ID
+			models.DB.Model(&quota).Updates(updates)
+		}
 	}
 
 	return &quota, nil
@@ -52,19 +65,61 @@ func (q *QuotaManager) UpdateQuota(containerID uint, updates map[string]interfac
 		return fmt.Errorf("配额不存在")
 	}
 
+	// 计费模式或账单日变化时重新计算本周期
+	mode := quota.TrafficMode
+	if v, ok := updates["traffic_mode"]; ok {
+		mode, _ = v.(string)
+		if err := ValidateTrafficMode(mode); err != nil {
+			return err
+		}
+		updates["traffic_used"] = AccountedBytes(mode, quota.TrafficIn, quota.TrafficOut)
+	}
+	if v, ok := updates["billing_day"]; ok {
+		day, ok := toInt(v)
+		if !ok {
+			return fmt.Errorf("账单日必须为整数")
+		}
+		if err := ValidateBillingDay(day); err != nil {
+			return err
+		}
+		start, end := CycleBounds(day, time.Now())
+		updates["billing_day"] = day
+		updates["cycle_start"] = start
+		updates["traffic_reset_date"] = end
+	}
+
 	err = models.DB.Model(&quota).Updates(updates).Error
 	if err != nil {
 		return fmt.Errorf("更新配额失败: %v", err)
 	}
 
+	if used, ok := updates["traffic_used"]; ok {
+		models.DB.Model(&models.Container{}).Where("id = ?", containerID).Update("traffic_used", used)
+	}
+
 	return nil
 }
 
+// toInt 将 JSON 数字转换为 int
+func toInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		if n != float64(int(n)) {
+			return 0, false
+		}
+		return int(n), true
+	default:
+		return 0, false
+	}
+}
+
 // GetQuotaUsage 获取配额使用情况
+// 不持有读锁：GetOrCreateQuota 需要获取写锁
 func (q *QuotaManager) GetQuotaUsage(containerID uint) (*models.QuotaUsage, error) {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
-
 	// 获取配额设置
 	quota, err := q.GetOrCreateQuota(containerID)
 	if err != nil {
@@ -155,7 +210,7 @@ func (q *QuotaManager) CheckPortMappingQuota(containerID uint, count int) error
 	}
 
 	if usage.PortMappingUsed+count > usage.PortMappingQuota {
-		return fmt.Errorf("端口映射配额不足 (当前: %d, 需要: %d, 配额: %d)", 
+		return fmt.Errorf("端口映射配额不足 (当前: %d, 需要: %d, 配额: %d)",
 			usage.PortMappingUsed, count, usage.PortMappingQuota)
 	}
 
@@ -191,58 +246,14 @@ func (q *QuotaManager) CheckTrafficQuota(containerID uint) error {
 		return nil // 无限制
 	}
 
-	if usage.TrafficUsed >= usage.TrafficQuota {
-		return fmt.Errorf("流量配额已用完 (%d GB/%d GB)", 
-			usage.TrafficUsed, usage.TrafficQuota)
-	}
-
-	return nil
-}
-
-// AddTrafficUsage 增加流量使用量
-func (q *QuotaManager) AddTrafficUsage(containerID uint, bytes int64) error {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-
-	var quota models.Quota
-	err := models.DB.Where("container_id = ?", containerID).First(&quota).Error
-	if err != nil {
-		return err
-	}
-
-	// 转换为 GB
-	gb := bytes / (1024 * 1024 * 1024)
-	quota.TrafficUsed += gb
-
-	// 检查是否需要重置流量
-	if time.Now().After(quota.TrafficResetDate) {
-		quota.TrafficUsed = 0
-		quota.TrafficResetDate = time.Now().AddDate(0, 1, 0)
-	}
-
-	models.DB.Save(&quota)
-
-	// 检查是否超限
-	if quota.TrafficQuota != -1 && quota.TrafficUsed >= quota.TrafficQuota {
-		q.handleQuotaExceed(containerID, "traffic")
+	if usage.TrafficUsed >= usage.TrafficQuota*bytesPerGB {
+		return fmt.Errorf("流量配额已用完 (%.2f GB/%d GB)",
+			BytesToGB(usage.TrafficUsed), usage.TrafficQuota)
 	}
 
 	return nil
 }
 
-// ResetTraffic 重置流量统计
-func (q *QuotaManager) ResetTraffic(containerID uint) error {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-
-	return models.DB.Model(&models.Quota{}).
-		Where("container_id = ?", containerID).
-		Updates(map[string]interface{}{
-			"traffic_used":       0,
-			"traffic_reset_date": time.Now().AddDate(0, 1, 0),
-		}).Error
-}
-
 // handleQuotaExceed 处理配额超限
 func (q *QuotaManager) handleQuotaExceed(containerID uint, quotaType string) {
 	var quota models.Quota
@@ -254,17 +265,17 @@ func (q *QuotaManager) handleQuotaExceed(containerID uint, quotaType string) {
 	switch quota.OnExceed {
 	case "warn":
 		// 记录警告日志
-		models.LogAction("quota_exceed", "", 
+		models.LogAction("quota_exceed", "",
 			fmt.Sprintf("容器 %d 的 %s 配额已超限", containerID, quotaType), "warning")
-	
+
 	case "limit":
 		// 限制新的资源分配（在检查函数中已经实现）
-		models.LogAction("quota_limit", "", 
+		models.LogAction("quota_limit", "",
 			fmt.Sprintf("容器 %d 的 %s 配额已达上限，限制新分配", containerID, quotaType), "warning")
-	
+
 	case "stop":
 		// 停止容器
-		models.LogAction("quota_stop", "", 
+		models.LogAction("quota_stop", "",
 			fmt.Sprintf("容器 %d 的 %s 配额已超限，自动停止容器", containerID, quotaType), "error")
 		// TODO: 调用 LXD API 停止容器
 	}
@@ -288,23 +299,6 @@ func (q *QuotaManager) DeleteQuota(containerID uint) error {
 	return models.DB.Where("container_id = ?", containerID).Delete(&models.Quota{}).Error
 }
 
-// SetDefaultQuota 设置默认配额
-func (q *QuotaManager) SetDefaultQuota(ipv4, ipv6, portMapping, proxy int, traffic int64) error {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-
-	// 更新所有未设置配额的容器
-	return models.DB.Model(&models.Quota{}).
-		Where("ipv4_quota = -1 AND ipv6_quota = -1").
-		Updates(map[string]interface{}{
-			"ipv4_quota":         ipv4,
-			"ipv6_quota":         ipv6,
-			"port_mapping_quota": portMapping,
-			"proxy_quota":        proxy,
-			"traffic_quota":      traffic,
-		}).Error
-}
-
 // GetQuotaStats 获取配额统计信息
 func (q *QuotaManager) GetQuotaStats() map[string]interface{} {
 	q.mu.RLock()
@@ -315,7 +309,7 @@ func (q *QuotaManager) GetQuotaStats() map[string]interface{} {
 
 	var exceedCount int64
 	models.DB.Model(&models.Quota{}).
-		Where("traffic_quota != -1 AND traffic_used >= traffic_quota").
+		Where("traffic_quota != -1 AND traffic_used >= traffic_quota * ?", bytesPerGB).
 		Count(&exceedCount)
 
 	return map[string]interface{}{
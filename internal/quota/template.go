@@ -0,0 +1,362 @@
+package quota
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/openlxd/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// NewQuotaTemplate 返回全部无限制的模板，用于填充请求默认值
+func NewQuotaTemplate() models.QuotaTemplate {
+	return models.QuotaTemplate{
+		IPv4Quota:        -1,
+		IPv6Quota:        -1,
+		PortMappingQuota: -1,
+		ProxyQuota:       -1,
+		TrafficQuota:     -1,
+		TrafficMode:      TrafficModeSum,
+		OnExceed:         "warn",
+		ContainerQuota:   -1,
+		CPUQuota:         -1,
+		MemoryQuota:      -1,
+		DiskQuota:        -1,
+	}
+}
+
+// validateTemplate 验证模板内容
+func validateTemplate(tpl *models.QuotaTemplate) error {
+	if !templateNamePattern.MatchString(tpl.Name) {
+		return fmt.Errorf("无效的模板名称: %s", tpl.Name)
+	}
+	if err := ValidateTrafficMode(tpl.TrafficMode); err != nil {
+		return err
+	}
+	switch tpl.OnExceed {
+	case "warn", "limit", "stop":
+	default:
+		return fmt.Errorf("不支持的超限处理方式: %s", tpl.OnExceed)
+	}
+	for _, v := range []int{tpl.IPv4Quota, tpl.IPv6Quota, tpl.PortMappingQuota, tpl.ProxyQuota,
+		tpl.ContainerQuota, tpl.CPUQuota, tpl.MemoryQuota, tpl.DiskQuota} {
+		if v < -1 {
+			return fmt.Errorf("配额值不能小于 -1")
+		}
+	}
+	if tpl.TrafficQuota < -1 {
+		return fmt.Errorf("配额值不能小于 -1")
+	}
+	return nil
+}
+
+// containerFields 模板中应用到容器配额的字段
+func containerFields(tpl *models.QuotaTemplate) map[string]interface{} {
+	return map[string]interface{}{
+		"ipv4_quota":         tpl.IPv4Quota,
+		"ipv6_quota":         tpl.IPv6Quota,
+		"port_mapping_quota": tpl.PortMappingQuota,
+		"proxy_quota":        tpl.ProxyQuota,
+		"traffic_quota":      tpl.TrafficQuota,
+		"traffic_mode":       tpl.TrafficMode,
+		"on_exceed":          tpl.OnExceed,
+	}
+}
+
+// userFields 模板中应用到用户配额的字段
+func userFields(tpl *models.QuotaTemplate) map[string]interface{} {
+	return map[string]interface{}{
+		"container_quota":    tpl.ContainerQuota,
+		"cpu_quota":          tpl.CPUQuota,
+		"memory_quota":       tpl.MemoryQuota,
+		"disk_quota":         tpl.DiskQuota,
+		"ipv4_quota":         tpl.IPv4Quota,
+		"ipv6_quota":         tpl.IPv6Quota,
+		"port_mapping_quota": tpl.PortMappingQuota,
+		"proxy_quota":        tpl.ProxyQuota,
+		"traffic_quota":      tpl.TrafficQuota,
+	}
+}
+
+// ListTemplates 获取所有配额模板
+func (q *QuotaManager) ListTemplates() ([]models.QuotaTemplate, error) {
+	var templates []models.QuotaTemplate
+	err := models.DB.Order("name ASC").Find(&templates).Error
+	return templates, err
+}
+
+// GetTemplate 获取配额模板
+func (q *QuotaManager) GetTemplate(id uint) (*models.QuotaTemplate, error) {
+	var tpl models.QuotaTemplate
+	if err := models.DB.First(&tpl, id).Error; err != nil {
+		return nil, fmt.Errorf("配额模板不存在")
+	}
+	return &tpl, nil
+}
+
+// ResolveTemplate 按名称查找配额模板，名称为空时返回 nil
+func (q *QuotaManager) ResolveTemplate(name string) (*models.QuotaTemplate, error) {
+	if name == "" {
+		return nil, nil
+	}
+	var tpl models.QuotaTemplate
+	if err := models.DB.Where("name = ?", name).First(&tpl).Error; err != nil {
+		return nil, fmt.Errorf("配额模板不存在: %s", name)
+	}
+	return &tpl, nil
+}
+
+// defaultTemplate 获取默认模板，未设置时返回 nil
+func defaultTemplate() *models.QuotaTemplate {
+	var tpl models.QuotaTemplate
+	if err := models.DB.Where("is_default = ?", true).First(&tpl).Error; err != nil {
+		return nil
+	}
+	return &tpl
+}
+
+// CreateTemplate 创建配额模板
+func (q *QuotaManager) CreateTemplate(tpl *models.QuotaTemplate) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := validateTemplate(tpl); err != nil {
+		return err
+	}
+
+	var count int64
+	models.DB.Model(&models.QuotaTemplate{}).Where("name = ?", tpl.Name).Count(&count)
+	if count > 0 {
+		return fmt.Errorf("配额模板已存在: %s", tpl.Name)
+	}
+
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		// 只能有一个默认模板
+		if tpl.IsDefault {
+			if err := tx.Model(&models.QuotaTemplate{}).Where("is_default = ?", true).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(tpl).Error
+	})
+}
+
+// UpdateTemplate 更新配额模板，propagate 为 true 时同步到所有使用该模板的容器和用户
+// 返回同步的配额数量
+func (q *QuotaManager) UpdateTemplate(id uint, updates map[string]interface{}, propagate bool) (*models.QuotaTemplate, int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var tpl models.QuotaTemplate
+	if err := models.DB.First(&tpl, id).Error; err != nil {
+		return nil, 0, fmt.Errorf("配额模板不存在")
+	}
+
+	// 先在副本上应用修改并验证，避免写入无效数据
+	delete(updates, "id")
+	data, _ := json.Marshal(updates)
+	updated := tpl
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return nil, 0, fmt.Errorf("无效的模板参数: %v", err)
+	}
+	if err := validateTemplate(&updated); err != nil {
+		return nil, 0, err
+	}
+	if updated.Name != tpl.Name {
+		var count int64
+		models.DB.Model(&models.QuotaTemplate{}).Where("name = ? AND id != ?", updated.Name, id).Count(&count)
+		if count > 0 {
+			return nil, 0, fmt.Errorf("配额模板已存在: %s", updated.Name)
+		}
+	}
+
+	var affected int64
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if updated.IsDefault && !tpl.IsDefault {
+			if err := tx.Model(&models.QuotaTemplate{}).Where("is_default = ? AND id != ?", true, id).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(&updated).Error; err != nil {
+			return err
+		}
+		if !propagate {
+			return nil
+		}
+
+		result := tx.Model(&models.Quota{}).Where("template_id = ?", id).Updates(containerFields(&updated))
+		if result.Error != nil {
+			return result.Error
+		}
+		affected = result.RowsAffected
+
+		result = tx.Model(&models.UserQuota{}).Where("template_id = ?", id).Updates(userFields(&updated))
+		if result.Error != nil {
+			return result.Error
+		}
+		affected += result.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("更新配额模板失败: %v", err)
+	}
+
+	// 计费模式变化后重新计算已计费流量
+	if propagate && updated.TrafficMode != tpl.TrafficMode {
+		var quotas []models.Quota
+		models.DB.Where("template_id = ?", id).Find(&quotas)
+		for _, quota := range quotas {
+			used := AccountedBytes(quota.TrafficMode, quota.TrafficIn, quota.TrafficOut)
+			models.DB.Model(&quota).Update("traffic_used", used)
+			models.DB.Model(&models.Container{}).Where("id = ?", quota.ContainerID).Update("traffic_used", used)
+		}
+	}
+
+	return &updated, affected, nil
+}
+
+// DeleteTemplate 删除配额模板，使用该模板的配额保留当前值并转为自定义
+func (q *QuotaManager) DeleteTemplate(id uint) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Quota{}).Where("template_id = ?", id).Update("template_id", 0).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.UserQuota{}).Where("template_id = ?", id).Update("template_id", 0).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.QuotaTemplate{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("配额模板不存在")
+		}
+		return nil
+	})
+}
+
+// SetDefaultTemplate 设置默认模板，id 为 0 时取消默认模板
+func (q *QuotaManager) SetDefaultTemplate(id uint) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.QuotaTemplate{}).Where("is_default = ?", true).Update("is_default", false).Error; err != nil {
+			return err
+		}
+		if id == 0 {
+			return nil
+		}
+		result := tx.Model(&models.QuotaTemplate{}).Where("id = ?", id).Update("is_default", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("配额模板不存在")
+		}
+		return nil
+	})
+}
+
+// ApplyTemplate 将模板应用到容器配额
+func (q *QuotaManager) ApplyTemplate(containerID, templateID uint) error {
+	tpl, err := q.GetTemplate(templateID)
+	if err != nil {
+		return err
+	}
+
+	quota, err := q.GetOrCreateQuota(containerID)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	updates := containerFields(tpl)
+	updates["template_id"] = tpl.ID
+	updates["traffic_used"] = AccountedBytes(tpl.TrafficMode, quota.TrafficIn, quota.TrafficOut)
+	if err := models.DB.Model(quota).Updates(updates).Error; err != nil {
+		return fmt.Errorf("应用配额模板失败: %v", err)
+	}
+	models.DB.Model(&models.Container{}).Where("id = ?", containerID).Update("traffic_used", updates["traffic_used"])
+
+	return nil
+}
+
+// ApplyUserTemplate 将模板应用到用户配额
+func (q *QuotaManager) ApplyUserTemplate(userID, templateID uint) error {
+	tpl, err := q.GetTemplate(templateID)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	quota, err := getOrCreateUserQuota(userID)
+	if err != nil {
+		return err
+	}
+
+	updates := userFields(tpl)
+	updates["template_id"] = tpl.ID
+	if err := models.DB.Model(quota).Updates(updates).Error; err != nil {
+		return fmt.Errorf("应用配额模板失败: %v", err)
+	}
+
+	return nil
+}
+
+// GetTemplateDeviations 列出使用该模板但配额值已被单独修改的容器和用户
+func (q *QuotaManager) GetTemplateDeviations(templateID uint) ([]models.QuotaDeviation, error) {
+	tpl, err := q.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	deviations := []models.QuotaDeviation{}
+
+	var quotas []models.Quota
+	models.DB.Where("template_id = ?", templateID).Find(&quotas)
+	for _, quota := range quotas {
+		if fields := diffFields(containerFields(tpl), quota); len(fields) > 0 {
+			deviations = append(deviations, models.QuotaDeviation{Type: "container", TargetID: quota.ContainerID, Fields: fields})
+		}
+	}
+
+	var userQuotas []models.UserQuota
+	models.DB.Where("template_id = ?", templateID).Find(&userQuotas)
+	for _, quota := range userQuotas {
+		if fields := diffFields(userFields(tpl), quota); len(fields) > 0 {
+			deviations = append(deviations, models.QuotaDeviation{Type: "user", TargetID: quota.UserID, Fields: fields})
+		}
+	}
+
+	return deviations, nil
+}
+
+// diffFields 比较模板字段与实际配额（字段名与 JSON 标签一致）
+func diffFields(expected map[string]interface{}, actual interface{}) map[string][2]interface{} {
+	data, _ := json.Marshal(actual)
+	var values map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // 避免大数值被格式化为科学计数法
+	decoder.Decode(&values)
+
+	fields := make(map[string][2]interface{})
+	for name, want := range expected {
+		got := values[name]
+		if fmt.Sprint(want) != fmt.Sprint(got) {
+			fields[name] = [2]interface{}{want, got}
+		}
+	}
+	return fields
+}
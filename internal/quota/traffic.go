@@ -0,0 +1,227 @@
+package quota
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/openlxd/backend/internal/models"
+	"github.com/openlxd/backend/internal/webhook"
+)
+
+// 流量计费模式
+const (
+	TrafficModeIn  = "in"  // 仅入站
+	TrafficModeOut = "out" // 仅出站
+	TrafficModeSum = "sum" // 入站 + 出站
+	TrafficModeMax = "max" // 取入站、出站中较大者
+)
+
+const bytesPerGB = int64(1024 * 1024 * 1024)
+
+// ValidateTrafficMode 验证流量计费模式
+func ValidateTrafficMode(mode string) error {
+	switch mode {
+	case TrafficModeIn, TrafficModeOut, TrafficModeSum, TrafficModeMax:
+		return nil
+	default:
+		return fmt.Errorf("不支持的流量计费模式: %s", mode)
+	}
+}
+
+// ValidateBillingDay 验证账单日
+func ValidateBillingDay(day int) error {
+	if day < 1 || day > 31 {
+		return fmt.Errorf("账单日必须在 1-31 之间")
+	}
+	return nil
+}
+
+// AccountedBytes 按计费模式计算计费流量
+func AccountedBytes(mode string, in, out int64) int64 {
+	switch mode {
+	case TrafficModeIn:
+		return in
+	case TrafficModeOut:
+		return out
+	case TrafficModeMax:
+		if in > out {
+			return in
+		}
+		return out
+	default:
+		return in + out
+	}
+}
+
+// BytesToGB 字节转换为 GB（保留小数）
+func BytesToGB(bytes int64) float64 {
+	return float64(bytes) / float64(bytesPerGB)
+}
+
+// anchorDate 返回指定年月的账单日，账单日超过当月天数时取月末
+func anchorDate(year int, month time.Month, day int, loc *time.Location) time.Time {
+	lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// CycleBounds 计算 now 所在计费周期的开始和结束时间
+func CycleBounds(billingDay int, now time.Time) (time.Time, time.Time) {
+	if billingDay < 1 || billingDay > 31 {
+		billingDay = 1
+	}
+
+	start := anchorDate(now.Year(), now.Month(), billingDay, now.Location())
+	if now.Before(start) {
+		start = anchorDate(now.Year(), now.Month()-1, billingDay, now.Location())
+	}
+	end := anchorDate(start.Year(), start.Month()+1, billingDay, now.Location())
+
+	return start, end
+}
+
+// closeCycle 将当前周期写入历史并开始新周期（调用方需持有锁）
+func closeCycle(quota *models.Quota, now time.Time) {
+	if !quota.CycleStart.IsZero() {
+		models.DB.Create(&models.TrafficCycle{
+			ContainerID:  quota.ContainerID,
+			CycleStart:   quota.CycleStart,
+			CycleEnd:     quota.TrafficResetDate,
+			InBytes:      quota.TrafficIn,
+			OutBytes:     quota.TrafficOut,
+			UsedBytes:    quota.TrafficUsed,
+			Mode:         quota.TrafficMode,
+			TrafficQuota: quota.TrafficQuota,
+		})
+	}
+
+	quota.TrafficIn = 0
+	quota.TrafficOut = 0
+	quota.TrafficUsed = 0
+	quota.CycleStart, quota.TrafficResetDate = CycleBounds(quota.BillingDay, now)
+
+	webhook.Emit(webhook.EventTrafficReset, containerOwner(quota.ContainerID), map[string]interface{}{
+		"container_id": quota.ContainerID,
+		"reason":       "cycle",
+		"cycle_start":  quota.CycleStart,
+		"cycle_end":    quota.TrafficResetDate,
+	})
+}
+
+// rolloverIfDue 周期到期时结算（调用方需持有锁）
+func rolloverIfDue(quota *models.Quota, now time.Time) bool {
+	if quota.TrafficResetDate.IsZero() {
+		quota.CycleStart, quota.TrafficResetDate = CycleBounds(quota.BillingDay, now)
+		return true
+	}
+	if now.Before(quota.TrafficResetDate) {
+		return false
+	}
+	closeCycle(quota, now)
+	return true
+}
+
+// AddTrafficUsage 增加流量使用量（字节）
+func (q *QuotaManager) AddTrafficUsage(containerID uint, inBytes, outBytes int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var quota models.Quota
+	err := models.DB.Where("container_id = ?", containerID).First(&quota).Error
+	if err != nil {
+		return err
+	}
+
+	if inBytes < 0 || outBytes < 0 {
+		return fmt.Errorf("流量增量不能为负数")
+	}
+
+	// 检查是否需要结算上一周期
+	rolloverIfDue(&quota, time.Now())
+	limit := quota.TrafficQuota * bytesPerGB
+	wasExceeded := quota.TrafficQuota != -1 && quota.TrafficUsed >= limit
+
+	quota.TrafficIn += inBytes
+	quota.TrafficOut += outBytes
+	quota.TrafficUsed = AccountedBytes(quota.TrafficMode, quota.TrafficIn, quota.TrafficOut)
+
+	models.DB.Save(&quota)
+	models.DB.Model(&models.Container{}).Where("id = ?", containerID).Update("traffic_used", quota.TrafficUsed)
+
+	// 检查是否超限
+	if quota.TrafficQuota != -1 && quota.TrafficUsed >= limit {
+		q.handleQuotaExceed(containerID, "traffic")
+		// 仅在首次超限时通知
+		if !wasExceeded {
+			webhook.Emit(webhook.EventQuotaExceeded, containerOwner(containerID), map[string]interface{}{
+				"container_id": containerID,
+				"type":         "traffic",
+				"used":         quota.TrafficUsed,
+				"quota":        limit,
+			})
+		}
+	}
+	q.checkUserTrafficExceed(containerID)
+
+	return nil
+}
+
+// RolloverCycles 结算所有已到期的计费周期
+func (q *QuotaManager) RolloverCycles() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var quotas []models.Quota
+	models.DB.Where("traffic_reset_date <= ?", now).Find(&quotas)
+
+	for i := range quotas {
+		if rolloverIfDue(&quotas[i], now) {
+			models.DB.Save(&quotas[i])
+			models.DB.Model(&models.Container{}).Where("id = ?", quotas[i].ContainerID).Update("traffic_used", quotas[i].TrafficUsed)
+		}
+	}
+
+	return len(quotas)
+}
+
+// ResetTraffic 重置流量统计（保留当前计费周期）
+func (q *QuotaManager) ResetTraffic(containerID uint) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	models.DB.Model(&models.Container{}).Where("id = ?", containerID).Update("traffic_used", 0)
+
+	err := models.DB.Model(&models.Quota{}).
+		Where("container_id = ?", containerID).
+		Updates(map[string]interface{}{
+			"traffic_used": 0,
+			"traffic_in":   0,
+			"traffic_out":  0,
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	webhook.Emit(webhook.EventTrafficReset, containerOwner(containerID), map[string]interface{}{
+		"container_id": containerID,
+		"reason":       "manual",
+	})
+	return nil
+}
+
+// GetTrafficHistory 获取已结束的计费周期
+func (q *QuotaManager) GetTrafficHistory(containerID uint, limit int) ([]models.TrafficCycle, error) {
+	if limit <= 0 {
+		limit = 12
+	}
+
+	var cycles []models.TrafficCycle
+	err := models.DB.Where("container_id = ?", containerID).
+		Order("cycle_start DESC").
+		Limit(limit).
+		Find(&cycles).Error
+	return cycles, err
+}
@@ -0,0 +1,339 @@
+package quota
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/openlxd/backend/internal/models"
+)
+
+// GetOrCreateUserQuota 获取或创建用户配额
+func (q *QuotaManager) GetOrCreateUserQuota(userID uint) (*models.UserQuota, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return getOrCreateUserQuota(userID)
+}
+
+// getOrCreateUserQuota 获取或创建用户配额（调用方需持有锁）
+func getOrCreateUserQuota(userID uint) (*models.UserQuota, error) {
+	var quota models.UserQuota
+	err := models.DB.Where("user_id = ?", userID).First(&quota).Error
+	if err != nil {
+		// 创建默认配额（全部无限制）
+		quota = models.UserQuota{
+			UserID:           userID,
+			ContainerQuota:   -1,
+			CPUQuota:         -1,
+			MemoryQuota:      -1,
+			DiskQuota:        -1,
+			IPv4Quota:        -1,
+			IPv6Quota:        -1,
+			PortMappingQuota: -1,
+			ProxyQuota:       -1,
+			TrafficQuota:     -1,
+		}
+		if err := models.DB.Create(&quota).Error; err != nil {
+			return nil, fmt.Errorf("创建用户配额失败: %v", err)
+		}
+	}
+
+	return &quota, nil
+}
+
+// UpdateUserQuota 更新用户配额
+func (q *QuotaManager) UpdateUserQuota(userID uint, updates map[string]interface{}) (*models.UserQuota, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var user models.User
+	if err := models.DB.First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("用户不存在")
+	}
+
+	quota, err := getOrCreateUserQuota(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 不允许修改主键和所属用户
+	delete(updates, "id")
+	delete(updates, "user_id")
+
+	if err := models.DB.Model(quota).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("更新用户配额失败: %v", err)
+	}
+
+	return quota, models.DB.First(quota, quota.ID).Error
+}
+
+// DeleteUserQuota 删除用户配额（恢复为无限制）
+func (q *QuotaManager) DeleteUserQuota(userID uint) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return models.DB.Where("user_id = ?", userID).Delete(&models.UserQuota{}).Error
+}
+
+// GetUserQuotaUsage 统计用户名下所有容器的资源使用情况
+func (q *QuotaManager) GetUserQuotaUsage(userID uint) (*models.UserQuotaUsage, error) {
+	quota, err := q.GetOrCreateUserQuota(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := userUsage(userID)
+	usage.Quota = *quota
+	return usage, nil
+}
+
+// userUsage 统计用户资源使用量
+func userUsage(userID uint) *models.UserQuotaUsage {
+	usage := &models.UserQuotaUsage{UserID: userID}
+
+	var totals struct {
+		Containers int
+		CPUs       int
+		Memory     int
+		Disk       int
+	}
+	models.DB.Model(&models.Container{}).
+		Select("COUNT(*) AS containers, COALESCE(SUM(cpus), 0) AS cpus, COALESCE(SUM(memory), 0) AS memory, COALESCE(SUM(disk), 0) AS disk").
+		Where("user_id = ?", userID).
+		Scan(&totals)
+	usage.Containers = totals.Containers
+	usage.CPUs = totals.CPUs
+	usage.Memory = totals.Memory
+	usage.Disk = totals.Disk
+
+	owned := models.DB.Model(&models.Container{}).Select("id").Where("user_id = ?", userID)
+
+	var ipv4Used, ipv6Used, portMappingUsed, proxyUsed int64
+	models.DB.Model(&models.IPAddress{}).
+		Where("container_id IN (?) AND type = ? AND status = ?", owned, "ipv4", "used").
+		Count(&ipv4Used)
+	models.DB.Model(&models.IPAddress{}).
+		Where("container_id IN (?) AND type = ? AND status = ?", owned, "ipv6", "used").
+		Count(&ipv6Used)
+	models.DB.Model(&models.PortMapping{}).
+		Where("container_id IN (?) AND status = ?", owned, "active").
+		Count(&portMappingUsed)
+	models.DB.Model(&models.ProxyConfig{}).
+		Where("container_id IN (?) AND status = ?", owned, "active").
+		Count(&proxyUsed)
+	usage.IPv4Used = int(ipv4Used)
+	usage.IPv6Used = int(ipv6Used)
+	usage.PortMappingUsed = int(portMappingUsed)
+	usage.ProxyUsed = int(proxyUsed)
+
+	models.DB.Model(&models.Quota{}).
+		Select("COALESCE(SUM(traffic_used), 0)").
+		Where("container_id IN (?)", owned).
+		Scan(&usage.TrafficUsed)
+
+	return usage
+}
+
+// containerOwner 获取容器所属用户，未分配用户时返回 0
+func containerOwner(containerID uint) uint {
+	var container models.Container
+	if err := models.DB.Select("user_id").First(&container, containerID).Error; err != nil {
+		return 0
+	}
+	return container.UserID
+}
+
+// userQuotaFor 获取用户配额，未设置时返回 nil
+func userQuotaFor(userID uint) *models.UserQuota {
+	if userID == 0 {
+		return nil
+	}
+	var quota models.UserQuota
+	if err := models.DB.Where("user_id = ?", userID).First(&quota).Error; err != nil {
+		return nil
+	}
+	return &quota
+}
+
+// exceeds 判断使用量加上新增量是否超过配额（-1 表示无限制）
+func exceeds(used, add, limit int) bool {
+	return limit != -1 && used+add > limit
+}
+
+// reservation 预占的容器数量和资源
+type reservation struct {
+	containers, cpus, memory, disk int
+}
+
+// CheckUserContainerQuota 检查用户能否新建容器（创建、克隆），计入其他请求已预占的资源
+func (q *QuotaManager) CheckUserContainerQuota(userID uint, cpus, memory, disk int) error {
+	q.reserveMu.Lock()
+	defer q.reserveMu.Unlock()
+
+	return q.checkUserContainerQuota(userID, cpus, memory, disk)
+}
+
+// ReserveUserContainer 检查用户配额并预占新容器的资源，检查和预占在同一把锁内完成，并发创建不会同时通过检查
+// 容器写入数据库后（或创建失败时）调用返回的 release 释放预占
+func (q *QuotaManager) ReserveUserContainer(userID uint, cpus, memory, disk int) (func(), error) {
+	q.reserveMu.Lock()
+	defer q.reserveMu.Unlock()
+
+	if err := q.checkUserContainerQuota(userID, cpus, memory, disk); err != nil {
+		return nil, err
+	}
+
+	if q.reserved == nil {
+		q.reserved = make(map[uint]*reservation)
+	}
+	r := q.reserved[userID]
+	if r == nil {
+		r = &reservation{}
+		q.reserved[userID] = r
+	}
+	r.containers++
+	r.cpus += cpus
+	r.memory += memory
+	r.disk += disk
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.reserveMu.Lock()
+			defer q.reserveMu.Unlock()
+			r.containers--
+			r.cpus -= cpus
+			r.memory -= memory
+			r.disk -= disk
+			if r.containers <= 0 {
+				delete(q.reserved, userID)
+			}
+		})
+	}, nil
+}
+
+// checkUserContainerQuota 检查新建容器的配额（调用方需持有 reserveMu）
+func (q *QuotaManager) checkUserContainerQuota(userID uint, cpus, memory, disk int) error {
+	quota := userQuotaFor(userID)
+	if quota == nil {
+		return nil
+	}
+
+	usage := userUsage(userID)
+	if r := q.reserved[userID]; r != nil {
+		usage.Containers += r.containers
+		usage.CPUs += r.cpus
+		usage.Memory += r.memory
+		usage.Disk += r.disk
+	}
+	if exceeds(usage.Containers, 1, quota.ContainerQuota) {
+		return fmt.Errorf("用户容器数量配额已用完 (%d/%d)", usage.Containers, quota.ContainerQuota)
+	}
+	return checkUserResources(usage, quota, cpus, memory, disk)
+}
+
+// CheckUserResizeQuota 检查调整容器规格后是否超出用户配额（值为 0 表示不修改）
+func (q *QuotaManager) CheckUserResizeQuota(containerID uint, cpus, memory, disk int) error {
+	var container models.Container
+	if err := models.DB.First(&container, containerID).Error; err != nil {
+		return nil
+	}
+
+	quota := userQuotaFor(container.UserID)
+	if quota == nil {
+		return nil
+	}
+
+	// 只计算增量，缩小规格时不受限制
+	delta := func(newValue, current int) int {
+		if newValue <= 0 {
+			return 0
+		}
+		return newValue - current
+	}
+
+	usage := userUsage(container.UserID)
+	return checkUserResources(usage, quota,
+		delta(cpus, container.CPUs), delta(memory, container.Memory), delta(disk, container.Disk))
+}
+
+// checkUserResources 检查 CPU、内存、磁盘增量
+func checkUserResources(usage *models.UserQuotaUsage, quota *models.UserQuota, cpus, memory, disk int) error {
+	if cpus > 0 && exceeds(usage.CPUs, cpus, quota.CPUQuota) {
+		return fmt.Errorf("用户 CPU 配额不足 (已用: %d 核, 需要: %d 核, 配额: %d 核)", usage.CPUs, cpus, quota.CPUQuota)
+	}
+	if memory > 0 && exceeds(usage.Memory, memory, quota.MemoryQuota) {
+		return fmt.Errorf("用户内存配额不足 (已用: %d MB, 需要: %d MB, 配额: %d MB)", usage.Memory, memory, quota.MemoryQuota)
+	}
+	if disk > 0 && exceeds(usage.Disk, disk, quota.DiskQuota) {
+		return fmt.Errorf("用户磁盘配额不足 (已用: %d GB, 需要: %d GB, 配额: %d GB)", usage.Disk, disk, quota.DiskQuota)
+	}
+	return nil
+}
+
+// CheckUserIPQuota 检查容器所属用户的 IP 配额
+func (q *QuotaManager) CheckUserIPQuota(containerID uint, ipType string) error {
+	userID := containerOwner(containerID)
+	quota := userQuotaFor(userID)
+	if quota == nil {
+		return nil
+	}
+
+	usage := userUsage(userID)
+	if ipType == "ipv6" {
+		if exceeds(usage.IPv6Used, 1, quota.IPv6Quota) {
+			return fmt.Errorf("用户 IPv6 地址配额已用完 (%d/%d)", usage.IPv6Used, quota.IPv6Quota)
+		}
+		return nil
+	}
+	if exceeds(usage.IPv4Used, 1, quota.IPv4Quota) {
+		return fmt.Errorf("用户 IPv4 地址配额已用完 (%d/%d)", usage.IPv4Used, quota.IPv4Quota)
+	}
+	return nil
+}
+
+// CheckUserPortMappingQuota 检查容器所属用户的端口映射配额
+func (q *QuotaManager) CheckUserPortMappingQuota(containerID uint, count int) error {
+	userID := containerOwner(containerID)
+	quota := userQuotaFor(userID)
+	if quota == nil {
+		return nil
+	}
+
+	usage := userUsage(userID)
+	if exceeds(usage.PortMappingUsed, count, quota.PortMappingQuota) {
+		return fmt.Errorf("用户端口映射配额不足 (当前: %d, 需要: %d, 配额: %d)",
+			usage.PortMappingUsed, count, quota.PortMappingQuota)
+	}
+	return nil
+}
+
+// CheckUserProxyQuota 检查容器所属用户的反向代理配额
+func (q *QuotaManager) CheckUserProxyQuota(containerID uint) error {
+	userID := containerOwner(containerID)
+	quota := userQuotaFor(userID)
+	if quota == nil {
+		return nil
+	}
+
+	usage := userUsage(userID)
+	if exceeds(usage.ProxyUsed, 1, quota.ProxyQuota) {
+		return fmt.Errorf("用户反向代理配额已用完 (%d/%d)", usage.ProxyUsed, quota.ProxyQuota)
+	}
+	return nil
+}
+
+// checkUserTrafficExceed 检查容器所属用户的流量合计是否超限（调用方需持有锁）
+func (q *QuotaManager) checkUserTrafficExceed(containerID uint) {
+	userID := containerOwner(containerID)
+	quota := userQuotaFor(userID)
+	if quota == nil || quota.TrafficQuota == -1 {
+		return
+	}
+
+	usage := userUsage(userID)
+	if usage.TrafficUsed >= quota.TrafficQuota*bytesPerGB {
+		models.LogAction("user_quota_exceed", "",
+			fmt.Sprintf("用户 %d 的流量配额已超限 (%.2f GB/%d GB)", userID, BytesToGB(usage.TrafficUsed), quota.TrafficQuota), "warning")
+	}
+}
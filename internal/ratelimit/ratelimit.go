@@ -0,0 +1,358 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openlxd/backend/internal/audit"
+	"github.com/openlxd/backend/internal/config"
+)
+
+// 限流类别
+const (
+	ClassAuth   = "auth"   // 登录、注册、找回密码、单点登录，按 IP 计数
+	ClassMutate = "mutate" // 写操作（POST/PUT/PATCH/DELETE）及命令执行
+	ClassRead   = "read"   // 只读请求
+)
+
+const (
+	sweepInterval = 5 * time.Minute // 清理空闲令牌桶的间隔
+	idleTTL       = time.Hour       // 令牌桶空闲多久后清理（计数一并清除）
+)
+
+// Result 一次限流检查的结果
+type Result struct {
+	Allowed    bool
+	Limit      int           // 令牌桶容量，0 表示不限流
+	Remaining  int           // 剩余令牌数
+	Reset      time.Duration // 令牌桶恢复满所需时间
+	RetryAfter time.Duration // 被限流时距下一个可用令牌的时间
+}
+
+// Stat 令牌桶的计数，供管理员查看谁在被限流
+type Stat struct {
+	Class         string     `json:"class"`
+	Key           string     `json:"key"`
+	Label         string     `json:"label"`
+	Limit         int        `json:"limit"`
+	Remaining     int        `json:"remaining"`
+	Allowed       uint64     `json:"allowed"`
+	Throttled     uint64     `json:"throttled"`
+	LastSeen      time.Time  `json:"last_seen"`
+	LastThrottled *time.Time `json:"last_throttled,omitempty"`
+}
+
+// bucket 令牌桶
+type bucket struct {
+	tokens        float64
+	updated       time.Time
+	label         string
+	allowed       uint64
+	throttled     uint64
+	lastThrottled *time.Time
+}
+
+// Limiter 令牌桶限流器，按 类别 + 调用方 维护令牌桶
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// GlobalLimiter 全局限流器
+var GlobalLimiter = &Limiter{buckets: make(map[string]*bucket)}
+
+// ThrottleObserver 请求被限流时的回调（由 metrics 模块设置）
+var ThrottleObserver func(class string)
+
+// limits 读取类别的速率（每分钟请求数）和突发容量，速率不大于 0 时不限流
+func limits(class string) (int, int) {
+	cfg := config.GetConfig().RateLimit
+	switch class {
+	case ClassAuth:
+		return cfg.AuthRate, cfg.AuthBurst
+	case ClassMutate:
+		return cfg.MutateRate, cfg.MutateBurst
+	default:
+		return cfg.ReadRate, cfg.ReadBurst
+	}
+}
+
+// Classify 根据请求确定限流类别
+func Classify(r *http.Request) string {
+	if r.URL.Path == "/api/exec" {
+		return ClassMutate
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ClassRead
+	}
+	return ClassMutate
+}
+
+// Exempt 客户端 IP 是否在 rate_limit.exempt_ips 中（如 WHMCS 服务器）
+func Exempt(ip string) bool {
+	client := net.ParseIP(ip)
+	if client == nil {
+		return false
+	}
+	for _, entry := range strings.Split(config.GetConfig().RateLimit.ExemptIPs, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(client) {
+				return true
+			}
+		} else if exempt := net.ParseIP(entry); exempt != nil && exempt.Equal(client) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow 从 类别 + key 对应的令牌桶中取一个令牌，label 为管理员查看时显示的调用方名称
+func (l *Limiter) Allow(class, key, label string) Result {
+	rate, burst := limits(class)
+	if rate <= 0 {
+		return Result{Allowed: true}
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	perSecond := float64(rate) / 60
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	id := class + "|" + key
+	b, ok := l.buckets[id]
+	if !ok {
+		b = &bucket{tokens: float64(burst), updated: now}
+		l.buckets[id] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.updated).Seconds()*perSecond)
+	b.updated = now
+	b.label = label
+
+	result := Result{Limit: burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		b.allowed++
+		result.Allowed = true
+	} else {
+		b.throttled++
+		b.lastThrottled = &now
+		result.RetryAfter = time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((float64(burst) - b.tokens) / perSecond * float64(time.Second))
+
+	if !result.Allowed && ThrottleObserver != nil {
+		ThrottleObserver(class)
+	}
+	return result
+}
+
+// Peek 查看 类别 + key 对应的令牌桶而不取令牌，令牌耗尽时计为一次限流
+func (l *Limiter) Peek(class, key string) Result {
+	rate, burst := limits(class)
+	if rate <= 0 {
+		return Result{Allowed: true}
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	perSecond := float64(rate) / 60
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[class+"|"+key]
+	if !ok {
+		return Result{Allowed: true, Limit: burst, Remaining: burst}
+	}
+	now := time.Now()
+	tokens := math.Min(float64(burst), b.tokens+now.Sub(b.updated).Seconds()*perSecond)
+
+	result := Result{Limit: burst, Remaining: int(tokens), Allowed: tokens >= 1}
+	result.Reset = time.Duration((float64(burst) - tokens) / perSecond * float64(time.Second))
+	if !result.Allowed {
+		b.throttled++
+		b.lastThrottled = &now
+		result.RetryAfter = time.Duration((1 - tokens) / perSecond * float64(time.Second))
+		if ThrottleObserver != nil {
+			ThrottleObserver(class)
+		}
+	}
+	return result
+}
+
+// sweep 清理长时间未使用的令牌桶，调用方需持有锁
+func (l *Limiter) sweep(now time.Time) {
+	for id, b := range l.buckets {
+		if now.Sub(b.updated) >= idleTTL {
+			delete(l.buckets, id)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Stats 返回各令牌桶的计数，被限流次数多的在前；throttledOnly 时只返回被限流过的调用方
+func (l *Limiter) Stats(throttledOnly bool) []Stat {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	stats := make([]Stat, 0, len(l.buckets))
+	for id, b := range l.buckets {
+		if throttledOnly && b.throttled == 0 {
+			continue
+		}
+		class, key, _ := strings.Cut(id, "|")
+		stat := Stat{
+			Class:         class,
+			Key:           key,
+			Label:         b.label,
+			Allowed:       b.allowed,
+			Throttled:     b.throttled,
+			LastSeen:      b.updated,
+			LastThrottled: b.lastThrottled,
+		}
+		if rate, burst := limits(class); rate > 0 {
+			if burst <= 0 {
+				burst = rate
+			}
+			stat.Limit = burst
+			stat.Remaining = int(math.Min(float64(burst), b.tokens+now.Sub(b.updated).Seconds()*float64(rate)/60))
+		}
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Throttled != stats[j].Throttled {
+			return stats[i].Throttled > stats[j].Throttled
+		}
+		return stats[i].LastSeen.After(stats[j].LastSeen)
+	})
+	return stats
+}
+
+// Reset 清除调用方的令牌桶和计数（解除限流），class 为空时清除该调用方所有类别
+func (l *Limiter) Reset(class, key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	removed := 0
+	for id := range l.buckets {
+		c, k, _ := strings.Cut(id, "|")
+		if k == key && (class == "" || c == class) {
+			delete(l.buckets, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Request 对请求执行限流检查：未启用限流或客户端 IP 豁免时直接放行
+func Request(r *http.Request, class, key, label string) Result {
+	if !config.GetConfig().RateLimit.Enabled || Exempt(audit.ClientIP(r)) {
+		return Result{Allowed: true}
+	}
+	return GlobalLimiter.Allow(class, key, label)
+}
+
+// PeekIP 认证前检查客户端 IP 的 auth 令牌桶（与登录接口共用，不取令牌）：认证失败次数过多的 IP 在令牌恢复前直接拒绝
+func PeekIP(r *http.Request) Result {
+	ip := audit.ClientIP(r)
+	if !config.GetConfig().RateLimit.Enabled || Exempt(ip) {
+		return Result{Allowed: true}
+	}
+	return GlobalLimiter.Peek(ClassAuth, "ip:"+ip)
+}
+
+// AuthFailed 认证失败（无效的令牌或 API 密钥）时从客户端 IP 的 auth 令牌桶中扣除一个令牌，防止穷举凭据
+func AuthFailed(r *http.Request) {
+	ip := audit.ClientIP(r)
+	Request(r, ClassAuth, "ip:"+ip, ip)
+}
+
+// SetHeaders 写入 RateLimit-Limit / RateLimit-Remaining / RateLimit-Reset，被限流时写入 Retry-After
+func SetHeaders(w http.ResponseWriter, result Result) {
+	if result.Limit == 0 {
+		return
+	}
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+	if !result.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+	}
+}
+
+// Message 被限流时的提示
+func Message(result Result) string {
+	return fmt.Sprintf("请求过于频繁，请 %d 秒后重试", seconds(result.RetryAfter))
+}
+
+// seconds 向上取整为秒
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Check 执行限流检查并写入响应头，被限流时返回 429 和 JSON 错误，调用方应直接返回
+func Check(w http.ResponseWriter, r *http.Request, class, key, label string) bool {
+	result := Request(r, class, key, label)
+	SetHeaders(w, result)
+	if result.Allowed {
+		return true
+	}
+	reject(w, class, result)
+	return false
+}
+
+// CheckIP 认证前按客户端 IP 检查（见 PeekIP），被限流时返回 429 和 JSON 错误，调用方应直接返回
+func CheckIP(w http.ResponseWriter, r *http.Request) bool {
+	result := PeekIP(r)
+	if result.Allowed {
+		return true
+	}
+	SetHeaders(w, result)
+	reject(w, ClassAuth, result)
+	return false
+}
+
+// reject 写入 429 和 JSON 错误
+func reject(w http.ResponseWriter, class string, result Result) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code": http.StatusTooManyRequests,
+		"msg":  Message(result),
+		"data": map[string]interface{}{"class": class, "retry_after": seconds(result.RetryAfter)},
+	})
+}
+
+// ByIP 按客户端 IP 限流的中间件，用于登录等无需认证的接口
+func ByIP(class string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := audit.ClientIP(r)
+		if !Check(w, r, class, "ip:"+ip, ip) {
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,380 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/openlxd/backend/internal/capacity"
+	"github.com/openlxd/backend/internal/lxd"
+	"github.com/openlxd/backend/internal/models"
+)
+
+// ProtocolUnix 本机节点协议
+const ProtocolUnix = "unix"
+
+// Placement 容器调度选项
+type Placement struct {
+	Node               string            `json:"node"`                 // 指定节点
+	NodeLabels         map[string]string `json:"node_labels"`          // 节点必须具备的标签
+	Affinity           []string          `json:"affinity"`             // 与这些容器放在同一节点
+	AntiAffinity       []string          `json:"anti_affinity"`        // 不与这些容器放在同一节点
+	AffinityLabels     map[string]string `json:"affinity_labels"`      // 与带有这些标签的容器放在同一节点
+	AntiAffinityLabels map[string]string `json:"anti_affinity_labels"` // 不与带有这些标签的容器放在同一节点
+}
+
+// Request 调度请求，memory 单位 MB，disk 单位 GB
+type Request struct {
+	Placement
+	CPUs   int
+	Memory int
+	Disk   int
+}
+
+// NodeStatus 节点状态
+type NodeStatus struct {
+	models.RemoteHost
+	Labels    map[string]string `json:"labels"`
+	Connected bool              `json:"connected"`
+	Capacity  *capacity.Report  `json:"capacity,omitempty"`
+}
+
+// Scheduler 容器调度器
+type Scheduler struct {
+	mu        sync.Mutex
+	reserved  map[uint64]reservation // 已预留但尚未写入数据库的资源
+	reserveID uint64
+}
+
+// reservation 节点上的资源预留
+type reservation struct {
+	node string
+	req  Request
+}
+
+var GlobalScheduler = &Scheduler{
+	reserved: make(map[uint64]reservation),
+}
+
+// InitNodes 登记本机节点、连接所有启用的远程节点，并设置容器所在节点的查询
+func InitNodes(socketPath string) error {
+	lxd.NodeResolver = containerNode
+
+	var local models.RemoteHost
+	if err := models.DB.Where("name = ?", lxd.LocalNode).First(&local).Error; err != nil {
+		local = models.RemoteHost{
+			Name:        lxd.LocalNode,
+			Address:     socketPath,
+			Protocol:    ProtocolUnix,
+			Description: "本机 LXD",
+		}
+		if err := models.DB.Create(&local).Error; err != nil {
+			return fmt.Errorf("登记本机节点失败: %v", err)
+		}
+	}
+
+	var hosts []models.RemoteHost
+	models.DB.Where("name <> ? AND status = ?", lxd.LocalNode, "active").Find(&hosts)
+	for i := range hosts {
+		if err := ConnectNode(&hosts[i]); err != nil {
+			log.Printf("警告: 节点 %s 连接失败: %v", hosts[i].Name, err)
+		}
+	}
+
+	return nil
+}
+
+// ConnectNode 连接远程节点并注册到 LXD 客户端池
+func ConnectNode(host *models.RemoteHost) error {
+	if host.Name == lxd.LocalNode || host.Protocol == ProtocolUnix {
+		return nil
+	}
+
+	// 升级前登记的节点没有记录服务器证书，首次连接时记录
+	if host.ServerCertificate == "" {
+		if err := PinServerCertificate(host); err != nil {
+			return err
+		}
+		log.Printf("警告: 节点 %s 未登记服务器证书，已固定当前证书", host.Name)
+	}
+
+	url := NodeURL(host)
+	client, err := lxd.ConnectNode(url, host.Certificate, host.Key, host.ServerCertificate)
+	if err != nil {
+		return err
+	}
+	if _, _, err := client.GetServer(); err != nil {
+		client.Disconnect()
+		return fmt.Errorf("获取节点信息失败: %v", err)
+	}
+
+	lxd.RegisterNode(host.Name, client)
+	log.Printf("节点 %s 连接成功: %s", host.Name, url)
+	return nil
+}
+
+// NodeURL 远程节点的 LXD API 地址
+func NodeURL(host *models.RemoteHost) string {
+	return fmt.Sprintf("%s://%s:%d", host.Protocol, host.Address, host.Port)
+}
+
+// PinServerCertificate 获取节点当前的服务器证书并保存，之后的连接只信任该证书
+func PinServerCertificate(host *models.RemoteHost) error {
+	certificate, err := lxd.FetchServerCertificate(NodeURL(host))
+	if err != nil {
+		return err
+	}
+	host.ServerCertificate = certificate
+	if host.ID != 0 {
+		return models.DB.Model(host).Update("server_certificate", certificate).Error
+	}
+	return nil
+}
+
+// DisconnectNode 断开远程节点
+func DisconnectNode(name string) {
+	lxd.UnregisterNode(name)
+}
+
+// containerNode 从数据库查询容器所在节点
+func containerNode(containerName string) string {
+	var container models.Container
+	if err := models.DB.Select("node").Where("hostname = ?", containerName).First(&container).Error; err != nil {
+		return ""
+	}
+	return container.Node
+}
+
+// ParseLabels 解析节点标签
+func ParseLabels(labels string) map[string]string {
+	result := make(map[string]string)
+	if labels != "" {
+		json.Unmarshal([]byte(labels), &result)
+	}
+	return result
+}
+
+// EncodeLabels 序列化节点标签
+func EncodeLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(labels)
+	return string(data)
+}
+
+// ListNodes 获取所有节点及其连接状态和容量
+func ListNodes() ([]NodeStatus, error) {
+	var hosts []models.RemoteHost
+	if err := models.DB.Order("id ASC").Find(&hosts).Error; err != nil {
+		return nil, err
+	}
+
+	nodes := make([]NodeStatus, 0, len(hosts))
+	for _, host := range hosts {
+		status := NodeStatus{
+			RemoteHost: host,
+			Labels:     ParseLabels(host.Labels),
+		}
+		status.Certificate = ""
+		status.Key = ""
+		if _, err := lxd.NodeClient(host.Name); err == nil {
+			status.Connected = true
+			status.Capacity = capacity.GlobalManager.GetNodeReport(host.Name)
+		}
+		nodes = append(nodes, status)
+	}
+	return nodes, nil
+}
+
+// Schedule 为新容器选择节点
+// 依次过滤：指定节点、可调度、已连接、标签、亲和/反亲和、容量；剩余节点中选择内存剩余比例最高的
+func (s *Scheduler) Schedule(req Request) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.schedule(req)
+}
+
+// ScheduleAndReserve 选择节点并预留资源，直到调用 release（用于创建、迁移等耗时操作）
+func (s *Scheduler) ScheduleAndReserve(req Request) (string, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, err := s.schedule(req)
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.reserveID++
+	id := s.reserveID
+	s.reserved[id] = reservation{node: node, req: req}
+
+	release := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.reserved, id)
+	}
+	return node, release, nil
+}
+
+// schedule 选择节点（调用方需持有锁）
+func (s *Scheduler) schedule(req Request) (string, error) {
+	var hosts []models.RemoteHost
+	query := models.DB.Order("id ASC")
+	if req.Node != "" {
+		query = query.Where("name = ?", req.Node)
+	}
+	if err := query.Find(&hosts).Error; err != nil {
+		return "", fmt.Errorf("获取节点列表失败: %v", err)
+	}
+	if len(hosts) == 0 {
+		if req.Node != "" {
+			return "", fmt.Errorf("节点 %s 不存在", req.Node)
+		}
+		// 尚未登记任何节点时使用本机
+		return lxd.LocalNode, capacity.GlobalManager.CheckAdmission(lxd.LocalNode, req.CPUs, req.Memory, req.Disk)
+	}
+
+	affinity, err := containerNodes(req.Affinity)
+	if err != nil {
+		return "", err
+	}
+	for node := range labeledNodes(req.AffinityLabels) {
+		affinity[node] = true
+	}
+	if len(affinity) > 1 {
+		return "", fmt.Errorf("亲和容器分布在多个节点上: %s", strings.Join(sortedKeys(affinity), ", "))
+	}
+	antiAffinity, err := containerNodes(req.AntiAffinity)
+	if err != nil {
+		return "", err
+	}
+	for node := range labeledNodes(req.AntiAffinityLabels) {
+		antiAffinity[node] = true
+	}
+
+	var best *capacity.Report
+	var reasons []string
+	for _, host := range hosts {
+		if reason := filterNode(host, req, affinity, antiAffinity); reason != "" {
+			reasons = append(reasons, fmt.Sprintf("%s: %s", host.Name, reason))
+			continue
+		}
+
+		report := capacity.GlobalManager.GetNodeReport(host.Name)
+		for _, reserved := range s.reserved {
+			if reserved.node == host.Name {
+				report.AddAllocated(reserved.req.CPUs, reserved.req.Memory, reserved.req.Disk)
+			}
+		}
+		if report.Enabled {
+			if err := capacity.Check(report, req.CPUs, req.Memory, req.Disk); err != nil {
+				reasons = append(reasons, fmt.Sprintf("%s: %v", host.Name, err))
+				continue
+			}
+		}
+
+		if best == nil || score(report) > score(best) {
+			best = report
+		}
+	}
+
+	if best == nil {
+		return "", fmt.Errorf("没有满足条件的节点 (%s)", strings.Join(reasons, "; "))
+	}
+	return best.Node, nil
+}
+
+// filterNode 检查节点是否满足调度条件，不满足时返回原因
+func filterNode(host models.RemoteHost, req Request, affinity, antiAffinity map[string]bool) string {
+	if host.Status != "active" {
+		return "节点未启用"
+	}
+	if !host.Schedulable {
+		return "节点不可调度"
+	}
+	if _, err := lxd.NodeClient(host.Name); err != nil {
+		return "节点未连接"
+	}
+
+	labels := ParseLabels(host.Labels)
+	for key, value := range req.NodeLabels {
+		if labels[key] != value {
+			return fmt.Sprintf("缺少标签 %s=%s", key, value)
+		}
+	}
+
+	if len(affinity) > 0 && !affinity[host.Name] {
+		return "不满足亲和规则"
+	}
+	if antiAffinity[host.Name] {
+		return "不满足反亲和规则"
+	}
+	return ""
+}
+
+// score 节点评分：内存剩余比例优先，其次 CPU 剩余比例
+func score(report *capacity.Report) float64 {
+	free := func(r capacity.Resource) float64 {
+		if !r.Available || r.Allocatable <= 0 {
+			return 0
+		}
+		return r.Free / r.Allocatable
+	}
+	return free(report.Memory)*2 + free(report.CPU)
+}
+
+// containerNodes 查询容器所在节点集合
+func containerNodes(names []string) (map[string]bool, error) {
+	nodes := make(map[string]bool)
+	if len(names) == 0 {
+		return nodes, nil
+	}
+
+	var containers []models.Container
+	models.DB.Select("hostname, node").Where("hostname IN ?", names).Find(&containers)
+	if len(containers) != len(names) {
+		found := make(map[string]bool)
+		for _, container := range containers {
+			found[container.Hostname] = true
+		}
+		for _, name := range names {
+			if !found[name] {
+				return nil, fmt.Errorf("容器 %s 不存在", name)
+			}
+		}
+	}
+
+	for _, container := range containers {
+		nodes[container.Node] = true
+	}
+	return nodes, nil
+}
+
+// labeledNodes 查询带有指定标签的容器所在节点集合
+func labeledNodes(selector map[string]string) map[string]bool {
+	nodes := make(map[string]bool)
+	if len(selector) == 0 {
+		return nodes
+	}
+
+	var containers []models.Container
+	models.WhereLabels(models.DB.Select("node"), selector).Find(&containers)
+	for _, container := range containers {
+		nodes[container.Node] = true
+	}
+	return nodes
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
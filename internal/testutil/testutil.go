@@ -0,0 +1,108 @@
+// Package testutil 各模块测试共用的临时数据库、配置和外部服务替身，仅供 _test.go 使用
+package testutil
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+)
+
+// Setup 使用临时数据库初始化 models.DB，以 configure 修改后的空配置作为全局配置
+func Setup(t *testing.T, configure func(cfg *config.Config)) {
+	t.Helper()
+	if err := models.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{}
+	if configure != nil {
+		configure(&cfg)
+	}
+	config.GlobalConfig = cfg
+}
+
+// SMTPStandIn 启动最小 SMTP 服务并写入 alert.smtp_host、alert.smtp_port，返回收到的邮件（收件人 + 正文）
+// 需在 Setup 之后调用
+func SMTPStandIn(t *testing.T) chan string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	config.GlobalConfig.Alert.SMTPHost = host
+	config.GlobalConfig.Alert.SMTPPort, _ = strconv.Atoi(port)
+	return messages
+}
+
+// serveSMTP 处理一个 SMTP 连接，每封邮件以 RCPT TO 行加正文的形式写入 messages
+func serveSMTP(conn net.Conn, messages chan string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost")
+
+	var message strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			message.WriteString(strings.TrimSpace(line) + "\n")
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 go ahead")
+			for {
+				data, err := reader.ReadString('\n')
+				if err != nil || data == ".\r\n" {
+					break
+				}
+				message.WriteString(data)
+			}
+			messages <- message.String()
+			message.Reset()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// Receive 等待通道中的下一条消息，5 秒内未收到时测试失败
+func Receive(t *testing.T, ch chan string) string {
+	t.Helper()
+	select {
+	case value := <-ch:
+		return value
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待消息超时")
+		return ""
+	}
+}
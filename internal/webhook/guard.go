@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/openlxd/backend/internal/models"
+)
+
+// ErrPrivateTarget 普通用户的投递地址解析到了内网、回环或链路本地地址
+var ErrPrivateTarget = errors.New("不允许访问内网、回环或链路本地地址")
+
+// blockedNetworks IsPrivate/IsLoopback 等未覆盖的保留网段
+var blockedNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // 本网络
+		"100.64.0.0/10", // 运营商级 NAT
+		"192.0.0.0/24",  // IETF 协议分配
+		"198.18.0.0/15", // 基准测试
+		"240.0.0.0/4",   // 保留
+		"64:ff9b::/96",  // NAT64，可映射到任意 IPv4 内网地址
+	} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// BlockedIP 是否为不允许普通用户访问的地址（内网、回环、链路本地、组播和保留网段）
+func BlockedIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// guardControl 在建立连接前检查 DNS 解析后的实际地址，重定向和 DNS 重绑定同样受限
+func guardControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || BlockedIP(ip) {
+		return ErrPrivateTarget
+	}
+	return nil
+}
+
+// NewClient 创建外发请求使用的 HTTP 客户端，restricted 时拒绝连接内网地址并且不使用环境代理
+func NewClient(timeout time.Duration, restricted bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if restricted {
+		dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second, Control: guardControl}
+		transport.DialContext = dialer.DialContext
+		transport.Proxy = nil
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// ValidateURL 校验投递地址：必须为 http(s)；restricted 时主机名解析出的地址均不能是内网地址
+// 只用于保存时尽早提示，实际投递时由 NewClient 的拨号检查兜底
+func ValidateURL(ctx context.Context, raw string, restricted bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("地址必须以 http:// 或 https:// 开头")
+	}
+	if !restricted {
+		return nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("无法解析主机名 %s", u.Hostname())
+	}
+	for _, ip := range ips {
+		if BlockedIP(ip) {
+			return ErrPrivateTarget
+		}
+	}
+	return nil
+}
+
+// Restricted 订阅是否属于普通用户（其投递地址受内网访问限制）
+func Restricted(userID uint) bool {
+	if userID == 0 {
+		return false
+	}
+	var user models.User
+	if err := models.DB.First(&user, userID).Error; err != nil {
+		return true
+	}
+	return !user.IsAdmin()
+}
@@ -0,0 +1,408 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/models"
+)
+
+// 事件类型
+const (
+	EventContainerCreated     = "container.created"
+	EventContainerStarted     = "container.started"
+	EventContainerStopped     = "container.stopped"
+	EventContainerSuspended   = "container.suspended"
+	EventContainerDeleted     = "container.deleted"
+	EventContainerReinstalled = "container.reinstalled"
+	EventQuotaExceeded        = "quota.exceeded"
+	EventTrafficReset         = "traffic.reset"
+	EventMigrationCompleted   = "migration.completed"
+	EventMigrationFailed      = "migration.failed"
+	EventSnapshotCreated      = "snapshot.created"
+	EventPing                 = "ping" // 测试订阅时发送
+)
+
+// Events 可订阅的事件
+var Events = []string{
+	EventContainerCreated,
+	EventContainerStarted,
+	EventContainerStopped,
+	EventContainerSuspended,
+	EventContainerDeleted,
+	EventContainerReinstalled,
+	EventQuotaExceeded,
+	EventTrafficReset,
+	EventMigrationCompleted,
+	EventMigrationFailed,
+	EventSnapshotCreated,
+}
+
+// 投递状态
+const (
+	StatusPending = "pending"
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+)
+
+// 请求头
+const (
+	HeaderEvent     = "X-OpenLXD-Event"
+	HeaderDelivery  = "X-OpenLXD-Delivery"
+	HeaderTimestamp = "X-OpenLXD-Timestamp"
+	HeaderSignature = "X-OpenLXD-Signature"
+)
+
+const (
+	retryBase     = 10 * time.Second
+	retryMax      = time.Hour
+	pollInterval  = 5 * time.Second
+	batchSize     = 50
+	workers       = 4
+	maxBodyRecord = 2048 // 投递记录中保存的响应体长度
+)
+
+// Payload 投递内容
+type Payload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// Dispatcher webhook 投递器，按 NextAttemptAt 轮询待投递记录
+type Dispatcher struct {
+	wake chan struct{}
+	once sync.Once
+	mu   sync.Mutex // 同一时间只有一轮投递
+}
+
+var GlobalDispatcher = &Dispatcher{
+	wake: make(chan struct{}, 1),
+}
+
+// Emit 记录事件并为匹配的订阅生成投递，userID 为事件所属用户（0 表示只投递给全局订阅）
+func Emit(event string, userID uint, data interface{}) {
+	GlobalDispatcher.Emit(event, userID, data)
+}
+
+// EmitContainer 发送容器相关事件
+func EmitContainer(event string, container *models.Container) {
+	GlobalDispatcher.Emit(event, container.UserID, map[string]interface{}{
+		"container": container,
+	})
+}
+
+// Emit 为匹配的订阅生成投递
+func (d *Dispatcher) Emit(event string, userID uint, data interface{}) {
+	var subscriptions []models.WebhookSubscription
+	query := models.DB.Where("enabled = ?", true)
+	if userID != 0 {
+		query = query.Where("user_id = 0 OR user_id = ?", userID)
+	} else {
+		query = query.Where("user_id = 0")
+	}
+	if err := query.Find(&subscriptions).Error; err != nil {
+		log.Printf("查询 webhook 订阅失败: %v", err)
+		return
+	}
+
+	payload := Payload{ID: newEventID(), Event: event, Timestamp: time.Now(), Data: data}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("序列化 webhook 事件 %s 失败: %v", event, err)
+		return
+	}
+
+	created := false
+	for _, sub := range subscriptions {
+		if !Matches(sub.Events, event) {
+			continue
+		}
+		if _, err := d.enqueue(sub.ID, payload.ID, event, string(body), 0); err != nil {
+			log.Printf("保存 webhook 投递失败: %v", err)
+			continue
+		}
+		created = true
+	}
+	if created {
+		d.notify()
+	}
+}
+
+// Ping 向订阅发送测试事件并等待投递结果
+func (d *Dispatcher) Ping(sub *models.WebhookSubscription) (*models.WebhookDelivery, error) {
+	payload := Payload{ID: newEventID(), Event: EventPing, Timestamp: time.Now(), Data: map[string]interface{}{
+		"subscription_id": sub.ID,
+	}}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// 测试投递不设置 NextAttemptAt，不进入重试队列，只尝试一次
+	delivery := &models.WebhookDelivery{
+		SubscriptionID: sub.ID,
+		EventID:        payload.ID,
+		Event:          EventPing,
+		Payload:        string(body),
+		Status:         StatusPending,
+	}
+	if err := models.DB.Create(delivery).Error; err != nil {
+		return nil, err
+	}
+	d.attempt(delivery, sub, 1)
+	return delivery, nil
+}
+
+// Redeliver 以原内容重新投递，生成新的投递记录
+func (d *Dispatcher) Redeliver(deliveryID uint) (*models.WebhookDelivery, error) {
+	var original models.WebhookDelivery
+	if err := models.DB.First(&original, deliveryID).Error; err != nil {
+		return nil, fmt.Errorf("投递记录不存在")
+	}
+
+	delivery, err := d.enqueue(original.SubscriptionID, original.EventID, original.Event, original.Payload, original.ID)
+	if err != nil {
+		return nil, err
+	}
+	d.notify()
+	return delivery, nil
+}
+
+// Start 启动后台投递
+func (d *Dispatcher) Start() {
+	d.once.Do(func() {
+		go func() {
+			ticker := time.NewTicker(pollInterval)
+			defer ticker.Stop()
+			for {
+				d.dispatchDue()
+				select {
+				case <-ticker.C:
+				case <-d.wake:
+				}
+			}
+		}()
+	})
+}
+
+// enqueue 创建待投递记录
+func (d *Dispatcher) enqueue(subscriptionID uint, eventID, event, payload string, redeliveryOf uint) (*models.WebhookDelivery, error) {
+	now := time.Now()
+	delivery := &models.WebhookDelivery{
+		SubscriptionID: subscriptionID,
+		EventID:        eventID,
+		Event:          event,
+		Payload:        payload,
+		Status:         StatusPending,
+		RedeliveryOf:   redeliveryOf,
+		NextAttemptAt:  &now,
+	}
+	if err := models.DB.Create(delivery).Error; err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// notify 唤醒投递循环
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatchDue 投递所有到期的记录
+func (d *Dispatcher) dispatchDue() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var deliveries []models.WebhookDelivery
+	err := models.DB.Where("status = ? AND next_attempt_at <= ?", StatusPending, time.Now()).
+		Order("next_attempt_at").
+		Limit(batchSize).
+		Find(&deliveries).Error
+	if err != nil || len(deliveries) == 0 {
+		return
+	}
+
+	subscriptions := make(map[uint]*models.WebhookSubscription)
+	maxAttempts := config.GetConfig().Webhook.MaxAttempts
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		sub, ok := subscriptions[delivery.SubscriptionID]
+		if !ok {
+			sub = &models.WebhookSubscription{}
+			if models.DB.First(sub, delivery.SubscriptionID).Error != nil {
+				sub = nil
+			}
+			subscriptions[delivery.SubscriptionID] = sub
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			d.attempt(delivery, sub, maxAttempts)
+		}()
+	}
+	wg.Wait()
+}
+
+// attempt 执行一次投递并更新记录，失败时按指数退避安排重试
+func (d *Dispatcher) attempt(delivery *models.WebhookDelivery, sub *models.WebhookSubscription, maxAttempts int) {
+	delivery.Attempts++
+
+	if sub == nil || !sub.Enabled {
+		delivery.Status = StatusFailed
+		delivery.Error = "订阅不存在或已停用"
+		delivery.NextAttemptAt = nil
+		models.DB.Save(delivery)
+		return
+	}
+
+	code, body, err := d.post(sub, delivery)
+	delivery.ResponseCode = code
+	delivery.ResponseBody = body
+	now := time.Now()
+
+	switch {
+	case err == nil && code >= 200 && code < 300:
+		delivery.Status = StatusSuccess
+		delivery.Error = ""
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	default:
+		if err != nil {
+			delivery.Error = err.Error()
+		} else {
+			delivery.Error = fmt.Sprintf("响应状态码 %d", code)
+		}
+		if delivery.Attempts >= maxAttempts {
+			delivery.Status = StatusFailed
+			delivery.NextAttemptAt = nil
+		} else {
+			next := now.Add(backoff(delivery.Attempts))
+			delivery.NextAttemptAt = &next
+		}
+	}
+	models.DB.Save(delivery)
+}
+
+// post 发送签名请求，返回状态码和截断后的响应体
+func (d *Dispatcher) post(sub *models.WebhookSubscription, delivery *models.WebhookDelivery) (int, string, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "OpenLXD-Webhook")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if sub.Secret != "" {
+		req.Header.Set(HeaderSignature, "sha256="+Sign(sub.Secret, timestamp, []byte(delivery.Payload)))
+	}
+
+	client := NewClient(time.Duration(config.GetConfig().Webhook.Timeout)*time.Second, Restricted(sub.UserID))
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodyRecord))
+	return resp.StatusCode, string(body), nil
+}
+
+// Sign 计算签名：HMAC-SHA256(secret, timestamp + "." + body) 的十六进制
+// 接收方应使用 X-OpenLXD-Timestamp 和原始请求体重新计算并比较，同时拒绝时间戳过旧的请求
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Matches 判断订阅的事件列表是否包含指定事件
+func Matches(events, event string) bool {
+	for _, pattern := range strings.Split(events, ",") {
+		pattern = strings.TrimSpace(pattern)
+		switch {
+		case pattern == "*" || pattern == event:
+			return true
+		case strings.HasSuffix(pattern, ".*") && strings.HasPrefix(event, strings.TrimSuffix(pattern, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateEvents 校验订阅的事件列表
+func ValidateEvents(events string) error {
+	if strings.TrimSpace(events) == "" {
+		return fmt.Errorf("事件列表不能为空")
+	}
+	for _, pattern := range strings.Split(events, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "*" {
+			continue
+		}
+		known := false
+		for _, event := range Events {
+			if Matches(pattern, event) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("未知事件: %s，可选: %s", pattern, strings.Join(Events, ", "))
+		}
+	}
+	return nil
+}
+
+// GenerateSecret 生成签名密钥
+func GenerateSecret() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// backoff 第 n 次失败后的重试间隔：10 秒起翻倍，最长 1 小时
+func backoff(attempts int) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempts && delay < retryMax; i++ {
+		delay *= 2
+	}
+	if delay > retryMax {
+		delay = retryMax
+	}
+	return delay
+}
+
+func newEventID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"embed"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
@@ -18,16 +20,29 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	lxdapi "github.com/canonical/lxd/shared/api"
+	"github.com/openlxd/backend/internal/acme"
+	"github.com/openlxd/backend/internal/alert"
 	"github.com/openlxd/backend/internal/api"
+	"github.com/openlxd/backend/internal/audit"
+	"github.com/openlxd/backend/internal/auth"
+	"github.com/openlxd/backend/internal/capacity"
 	"github.com/openlxd/backend/internal/config"
+	"github.com/openlxd/backend/internal/events"
 	"github.com/openlxd/backend/internal/lxd"
+	"github.com/openlxd/backend/internal/metrics"
 	"github.com/openlxd/backend/internal/models"
 	"github.com/openlxd/backend/internal/monitor"
+	"github.com/openlxd/backend/internal/network"
+	"github.com/openlxd/backend/internal/quota"
+	"github.com/openlxd/backend/internal/ratelimit"
+	"github.com/openlxd/backend/internal/scheduler"
+	"github.com/openlxd/backend/internal/webhook"
 )
 
 var lxdConnected bool
@@ -50,6 +65,9 @@ func main() {
 	}
 	cfg := config.GetConfig()
 	log.Println("配置加载成功")
+	if cfg.Security.SessionSecret != "" {
+		auth.JWTSecret = []byte(cfg.Security.SessionSecret)
+	}
 
 	// 2. 初始化数据库
 	dbPath := cfg.Database.Path
@@ -69,21 +87,21 @@ func main() {
 		log.Println("检测到 LXD 未安装或未启动")
 		log.Println("========================================")
 		log.Println("")
-		
+
 		// 尝试自动安装 LXD
 		if os.Getuid() == 0 { // 检查是否以 root 运行
 			log.Println("检测到以 root 权限运行，尝试自动安装 LXD...")
 			log.Println("")
-			
+
 			if autoInstallLXD() {
 				log.Println("")
 				log.Println("✓ LXD 安装成功！")
 				log.Println("正在重新初始化 LXD 客户端...")
 				log.Println("")
-				
+
 				// 等待 LXD 启动
 				time.Sleep(3 * time.Second)
-				
+
 				// 重试初始化
 				if err := lxd.InitLXD(cfg.LXD.Socket); err != nil {
 					log.Printf("⚠️  LXD 初始化仍然失败: %v\n", err)
@@ -92,7 +110,11 @@ func main() {
 				} else {
 					log.Println("✓ LXD 客户端初始化成功")
 					lxdConnected = true
-					
+
+					if err := scheduler.InitNodes(cfg.LXD.Socket); err != nil {
+						log.Printf("警告: 节点初始化失败: %v", err)
+					}
+
 					// 同步容器
 					if err := syncContainersFromLXD(); err != nil {
 						log.Printf("警告: 容器同步失败: %v", err)
@@ -106,7 +128,7 @@ func main() {
 			}
 			log.Println("")
 		}
-		
+
 		log.Println("请手动安装 LXD：")
 		log.Println("  sudo snap install lxd")
 		log.Println("  sudo lxd init --auto")
@@ -124,26 +146,82 @@ func main() {
 	} else {
 		log.Println("LXD 客户端初始化成功")
 		lxdConnected = true
-		
+
+		// 登记本机节点并连接远程节点
+		if err := scheduler.InitNodes(cfg.LXD.Socket); err != nil {
+			log.Printf("警告: 节点初始化失败: %v", err)
+		}
+
 		// 4. 同步 LXD 容器到数据库
 		if err := syncContainersFromLXD(); err != nil {
 			log.Printf("警告: 容器同步失败: %v", err)
 		}
+
+		// 同步端口映射的 proxy 设备
+		if result, err := network.GlobalNATManager.ReconcileProxyDevices(); err != nil {
+			log.Printf("警告: proxy 设备同步失败: %v", err)
+		} else if result.Added > 0 || result.Removed > 0 {
+			log.Printf("proxy 设备已同步: 新增 %d, 删除 %d", result.Added, result.Removed)
+		}
 	}
 
-	// 5. 启动监控数据采集器（每5分钟采集一次）
-	monitor.GlobalCollector.StartCollector(5 * time.Minute)
+	// 5. 启动监控数据采集器（采集间隔见 monitor.interval）
+	monitor.GlobalCollector.StartCollector(time.Duration(cfg.Monitor.Interval) * time.Second)
 	log.Println("监控数据采集器已启动")
 
+	// 启动告警规则评估
+	alert.Init()
+	if cfg.Alert.Enabled {
+		alert.GlobalEngine.Start(time.Duration(cfg.Alert.EvaluateInterval) * time.Second)
+		log.Println("告警规则评估已启动")
+	}
+
+	// 启动 webhook 投递
+	webhook.GlobalDispatcher.Start()
+
+	// 启动实时事件推送（LXD 事件、操作进度、监控采样）
+	events.GlobalBroker.Start()
+
+	// 启动内置反向代理（proxy.backend: builtin）
+	if cfg.Proxy.Backend == network.BackendBuiltin {
+		network.GlobalProxyManager.SetBackend(network.BackendBuiltin)
+		network.GlobalBuiltinProxy.SetACMEHandler(acme.GlobalManager.HTTPHandler)
+		if err := network.GlobalBuiltinProxy.Reload(); err != nil {
+			log.Printf("警告: 内置反向代理加载配置失败: %v", err)
+		}
+		network.GlobalBuiltinProxy.Start(cfg.Proxy.HTTPListen, cfg.Proxy.HTTPSListen)
+		network.GlobalBuiltinProxy.StartAutoReload(time.Duration(cfg.Proxy.ReloadInterval) * time.Second)
+		log.Println("内置反向代理已启动")
+	}
+
+	// 初始化 ACME 证书管理（签发后自动应用到反向代理，每12小时检查续期）
+	if err := acme.GlobalManager.Init(); err != nil {
+		log.Printf("警告: ACME 初始化失败: %v", err)
+	} else {
+		network.GlobalProxyManager.SetACMEWebroot(cfg.ACME.Webroot)
+		acme.GlobalManager.OnIssued(func(cert *models.Certificate) {
+			if err := network.GlobalProxyManager.ApplyCertificate(cert.Domain, cert.CertPath, cert.KeyPath); err != nil {
+				log.Printf("警告: 应用证书失败 (%s): %v", cert.Domain, err)
+			}
+		})
+		acme.GlobalManager.StartHTTPListener()
+		acme.GlobalManager.StartRenewal(time.Hour)
+		if cfg.Server.HTTPS && cfg.Server.AutoTLS {
+			acme.GlobalManager.EnsureCertificate(cfg.Server.Domain)
+		}
+		log.Println("ACME 证书管理已启动")
+	}
+
 	// 6. 设置 HTTP 路由
 	mux := http.NewServeMux()
 	setupRoutes(mux)
+	metrics.Init()
 
 	// 6. 启动 HTTP(S) 服务器
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 	server := &http.Server{
 		Addr:         addr,
-		Handler:      mux,
+		Handler:      metrics.Middleware(mux),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -163,6 +241,17 @@ func main() {
 				}
 			}
 
+			// 自动 TLS：优先使用 ACME 证书，未签发前使用自签名证书
+			if cfg.Server.AutoTLS {
+				fallback, err := tls.LoadX509KeyPair(certFile, keyFile)
+				if err != nil {
+					log.Fatalf("证书加载失败: %v", err)
+				}
+				acme.GlobalManager.SetFallbackCertificate(&fallback)
+				server.TLSConfig = &tls.Config{GetCertificate: acme.GlobalManager.GetCertificate}
+				certFile, keyFile = "", ""
+			}
+
 			log.Printf("HTTPS 服务器启动在 https://%s", addr)
 			if err := server.ListenAndServeTLS(certFile, keyFile); err != nil && err != http.ErrServerClosed {
 				log.Fatalf("HTTPS 服务器启动失败: %v", err)
@@ -199,41 +288,65 @@ func main() {
 func setupRoutes(mux *http.ServeMux) {
 	// Web 管理界面
 	mux.HandleFunc("/", handleWebUI)
-	
+
 	// 静态文件路由
 	mux.HandleFunc("/static/", handleStaticFiles)
-	
+
 	mux.HandleFunc("/admin", handleAdminLogin)
 	mux.HandleFunc("/admin/login", handleAdminLogin)
-	mux.HandleFunc("/admin/api/login", handleAdminLoginAPI)
+	mux.HandleFunc("/admin/api/login", ratelimit.ByIP(ratelimit.ClassAuth, audit.Record(handleAdminLoginAPI)))
 	mux.HandleFunc("/admin/dashboard", handleAdminDashboard)
-	
+
 	// 用户 API
-	mux.HandleFunc("/api/v1/users/login", handleUserLogin)
-	mux.HandleFunc("/api/v1/users/register", handleUserRegister)
+	mux.HandleFunc("/api/v1/users/login", ratelimit.ByIP(ratelimit.ClassAuth, audit.Record(handleUserLogin)))
+	mux.HandleFunc("/api/v1/users/register", ratelimit.ByIP(ratelimit.ClassAuth, audit.Record(handleUserRegister)))
+	mux.HandleFunc("/api/v1/users/password/forgot", ratelimit.ByIP(ratelimit.ClassAuth, audit.Record(api.HandleForgotPassword)))
+	mux.HandleFunc("/api/v1/users/password/reset", ratelimit.ByIP(ratelimit.ClassAuth, audit.Record(api.HandleResetPassword)))
+	mux.HandleFunc("/api/v1/users/oidc", api.HandleOIDCInfo)
+	mux.HandleFunc("/api/v1/users/oidc/login", ratelimit.ByIP(ratelimit.ClassAuth, api.HandleOIDCLogin))
+	mux.HandleFunc("/api/v1/users/oidc/callback", ratelimit.ByIP(ratelimit.ClassAuth, api.HandleOIDCCallback))
+
+	// Prometheus 采集端点（使用独立的采集令牌）
+	if config.GetConfig().Metrics.Enabled {
+		mux.HandleFunc("/metrics", metrics.Handler)
+	}
 
 	// 容器 API
 	mux.HandleFunc("/api/v1/containers", authMiddleware(api.HandleListContainers))
 	mux.HandleFunc("/api/v1/containers/create", authMiddleware(api.HandleCreateContainer))
 	mux.HandleFunc("/api/v1/containers/action", authMiddleware(api.HandleContainerAction))
+	mux.HandleFunc("/api/v1/containers/bulk", authMiddleware(api.HandleBulkContainers))
+	mux.HandleFunc("/api/v1/containers/labels", authMiddleware(api.HandleContainerLabels))
+	mux.HandleFunc("/api/v1/operations", authMiddleware(api.HandleOperations))
 
 	// API 路由（需要认证）
 	// 注意：/api/system/containers 路由由 lxdapi 兼容路由器处理（见下方）
 	mux.HandleFunc("/api/system/stats", authMiddleware(handleSystemStats))
+	mux.HandleFunc("/api/system/capacity", authMiddleware(handleSystemCapacity))
+	mux.HandleFunc("/api/system/traffic", authMiddleware(handleSystemTraffic))
 	mux.HandleFunc("/api/system/traffic/reset", authMiddleware(handleResetTraffic))
-	
+
 	// 网络管理
 	mux.HandleFunc("/api/network/ippool", authMiddleware(api.HandleIPPool))
 	mux.HandleFunc("/api/network/portmapping", authMiddleware(api.HandlePortMapping))
+	mux.HandleFunc("/api/network/portmapping/reconcile", authMiddleware(api.HandleReconcileProxyDevices))
+	mux.HandleFunc("/api/network/portranges", authMiddleware(api.HandlePortRanges))
+	mux.HandleFunc("/api/network/listeners", authMiddleware(api.HandleHostListeners))
 	mux.HandleFunc("/api/network/proxy", authMiddleware(api.HandleProxy))
+	mux.HandleFunc("/api/network/proxy/stats", authMiddleware(api.HandleProxyStats))
 	mux.HandleFunc("/api/network/stats", authMiddleware(api.HandleNetworkStats))
-	
+	mux.HandleFunc("/api/certificates", authMiddleware(api.HandleCertificates))
+
 	// 配额管理
 	mux.HandleFunc("/api/quota", authMiddleware(api.HandleQuota))
 	mux.HandleFunc("/api/quota/usage", authMiddleware(api.HandleQuotaUsage))
 	mux.HandleFunc("/api/quota/stats", authMiddleware(api.HandleQuotaStats))
 	mux.HandleFunc("/api/quota/reset-traffic", authMiddleware(api.HandleResetTraffic))
-	
+	mux.HandleFunc("/api/quota/traffic-history", authMiddleware(api.HandleTrafficHistory))
+	mux.HandleFunc("/api/quota/user", authMiddleware(api.HandleUserQuota))
+	mux.HandleFunc("/api/quota/templates", authMiddleware(api.HandleQuotaTemplates))
+	mux.HandleFunc("/api/quota/templates/deviations", authMiddleware(api.HandleQuotaTemplateDeviations))
+
 	// 监控管理
 	mux.HandleFunc("/api/monitor/system", authMiddleware(api.HandleSystemMetrics))
 	mux.HandleFunc("/api/monitor/system/current", authMiddleware(api.HandleCurrentSystemMetrics))
@@ -241,14 +354,29 @@ func setupRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/monitor/traffic", authMiddleware(api.HandleNetworkTraffic))
 	mux.HandleFunc("/api/monitor/stats", authMiddleware(api.HandleResourceStats))
 	mux.HandleFunc("/api/monitor/dashboard", authMiddleware(api.HandleMonitorDashboard))
-	
+
+	// 实时事件（SSE）
+	mux.HandleFunc("/api/events", authMiddleware(api.HandleEvents))
+
+	// 告警
+	mux.HandleFunc("/api/alerts", authMiddleware(api.HandleAlerts))
+	mux.HandleFunc("/api/alerts/rules", authMiddleware(api.HandleAlertRules))
+	mux.HandleFunc("/api/alerts/channels", authMiddleware(api.HandleAlertChannels))
+	mux.HandleFunc("/api/alerts/channels/test", authMiddleware(api.HandleTestAlertChannel))
+
+	// Webhook
+	mux.HandleFunc("/api/webhooks", authMiddleware(api.HandleWebhooks))
+	mux.HandleFunc("/api/webhooks/ping", authMiddleware(api.HandleWebhookPing))
+	mux.HandleFunc("/api/webhooks/deliveries", authMiddleware(api.HandleWebhookDeliveries))
+	mux.HandleFunc("/api/webhooks/redeliver", authMiddleware(api.HandleWebhookRedeliver))
+
 	// 高级功能
 	mux.HandleFunc("/api/snapshots", authMiddleware(api.HandleSnapshots))
 	mux.HandleFunc("/api/clone", authMiddleware(api.HandleClone))
 	mux.HandleFunc("/api/dns", authMiddleware(api.HandleDNS))
 	mux.HandleFunc("/api/exec", authMiddleware(api.HandleExecCommand))
 	mux.HandleFunc("/api/limits", authMiddleware(api.HandleResourceLimits))
-	
+
 	// 迁移管理
 	mux.HandleFunc("/api/migration/tasks", authMiddleware(api.HandleGetMigrationTasks))
 	mux.HandleFunc("/api/migration/task", authMiddleware(api.HandleGetMigrationTask))
@@ -259,58 +387,137 @@ func setupRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/migration/hosts", authMiddleware(api.HandleGetRemoteHosts))
 	mux.HandleFunc("/api/migration/host/create", authMiddleware(api.HandleCreateRemoteHost))
 	mux.HandleFunc("/api/migration/host/delete", authMiddleware(api.HandleDeleteRemoteHost))
-	
+	mux.HandleFunc("/api/nodes", authMiddleware(api.HandleNodes))
+	mux.HandleFunc("/api/nodes/update", authMiddleware(api.HandleUpdateNode))
+	mux.HandleFunc("/api/nodes/drain", authMiddleware(api.HandleDrainNode))
+	mux.HandleFunc("/api/nodes/undrain", authMiddleware(api.HandleUndrainNode))
+	mux.HandleFunc("/api/nodes/drain/jobs", authMiddleware(api.HandleDrainJobs))
+
 	// 日志和详情
 	mux.HandleFunc("/api/logs/container", authMiddleware(api.GetContainerLogs))
 	mux.HandleFunc("/api/logs/system", authMiddleware(api.GetSystemLogs))
 	mux.HandleFunc("/api/container/detail", authMiddleware(api.GetContainerDetail))
 	mux.HandleFunc("/api/container/stats", authMiddleware(api.GetContainerStats))
-	
+
+	// 审计日志
+	mux.HandleFunc("/api/audit", authMiddleware(api.HandleAuditLogs))
+	mux.HandleFunc("/api/audit/verify", authMiddleware(api.HandleAuditVerify))
+
+	// API 密钥管理
+	mux.HandleFunc("/api/apikeys", authMiddleware(api.HandleAPIKeys))
+
+	// 限流计数（管理员）
+	mux.HandleFunc("/api/ratelimit", authMiddleware(api.HandleRateLimits))
+
+	// 账号安全：两步验证和登录会话
+	mux.HandleFunc("/api/account/2fa/setup", authMiddleware(api.HandleTwoFactorSetup))
+	mux.HandleFunc("/api/account/2fa/verify", authMiddleware(api.HandleTwoFactorVerify))
+	mux.HandleFunc("/api/account/2fa/disable", authMiddleware(api.HandleTwoFactorDisable))
+	mux.HandleFunc("/api/account/2fa/recovery-codes", authMiddleware(api.HandleRecoveryCodes))
+	mux.HandleFunc("/api/account/sessions", authMiddleware(api.HandleSessions))
+	mux.HandleFunc("/api/account/logout", authMiddleware(api.HandleLogout))
+
 	// lxdapi 兼容 API（使用 X-API-Hash 认证）
 	lxdapiRouter := api.NewLXDAPIRouter(models.DB, nil)
 	mux.Handle("/api/system/containers", lxdapiRouter)
 	mux.Handle("/api/system/containers/", lxdapiRouter)
 }
 
-// authMiddleware 认证中间件（支持JWT token和API key）
+// authMiddleware 认证中间件（支持JWT token和API key），按 API 密钥的权限范围限制访问，修改类请求记录审计日志
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	next = audit.Record(next)
 	return func(w http.ResponseWriter, r *http.Request) {
 		cfg := config.GetConfig()
-		
-		// 尝试从请求头获取API Key
-		apiKey := r.Header.Get("X-API-Key")
-		if apiKey == "" {
-			apiKey = r.Header.Get("X-API-Hash")
+
+		// 认证失败次数过多的 IP 在认证前直接限流
+		if !ratelimit.CheckIP(w, r) {
+			return
 		}
-		if apiKey == "" {
-			apiKey = r.URL.Query().Get("api_key")
+
+		credential := requestCredential(r)
+		if credential == "" {
+			respondAuthError(w, http.StatusUnauthorized, "未提供认证凭据")
+			return
 		}
-		
-		// 如果有API Key，验证它
-		if apiKey != "" {
-			// 检查是否是系统默认API Hash
-			if apiKey == cfg.Security.APIHash {
-				next(w, r)
+		required := auth.RequiredScope(r.Method, r.URL.Path)
+
+		// 系统 API Hash（WHMCS 等对接使用），权限范围见 security.api_hash_scopes
+		if cfg.Security.APIHash != "" && credential == cfg.Security.APIHash {
+			if !auth.HasScope(auth.SplitScopes(cfg.Security.APIHashScopes), required) {
+				respondAuthError(w, http.StatusForbidden, fmt.Sprintf("系统 API Hash 权限不足，需要 %s", required))
 				return
 			}
-			
-			// 检查是否是用户API Key
+			if !ratelimit.Check(w, r, ratelimit.Classify(r), "ip:"+audit.ClientIP(r), "system") {
+				return
+			}
+			next(w, audit.WithActor(r, audit.Actor{Type: audit.ActorSystem, Name: "system"}))
+			return
+		}
+
+		// 登录令牌（Web 前端通过 X-API-Hash 或 Authorization 传递）
+		if claims, err := auth.ParseToken(credential); err == nil {
 			var user models.User
-			if err := models.DB.Where("api_key = ?", apiKey).First(&user).Error; err == nil {
-				if user.IsActive() {
-					next(w, r)
-					return
-				}
+			if err := models.DB.First(&user, claims.UserID).Error; err != nil || !user.IsActive() {
+				ratelimit.AuthFailed(r)
+				respondAuthError(w, http.StatusUnauthorized, "登录已失效，请重新登录")
+				return
 			}
+			if !ratelimit.Check(w, r, ratelimit.Classify(r), fmt.Sprintf("user:%d", user.ID), user.Username) {
+				return
+			}
+			r = audit.WithActor(r, audit.Actor{Type: audit.ActorUser, Name: user.Username, UserID: user.ID})
+			ctx := auth.WithClaims(context.WithValue(r.Context(), auth.UserContextKey, &user), claims)
+			next(w, r.WithContext(ctx))
+			return
+		}
+
+		// 用户 API 密钥（用户信息存入上下文，供配额检查使用）
+		key, user, err := auth.AuthenticateAPIKey(credential, audit.ClientIP(r))
+		if err != nil {
+			ratelimit.AuthFailed(r)
+			status := http.StatusUnauthorized
+			if err == auth.ErrIPNotAllowed || err == auth.ErrUserInactive {
+				status = http.StatusForbidden
+			}
+			respondAuthError(w, status, err.Error())
+			return
+		}
+		if !auth.HasScope(auth.SplitScopes(key.Scopes), required) {
+			respondAuthError(w, http.StatusForbidden, fmt.Sprintf("%s，需要 %s", auth.ErrScopeForbidden.Error(), required))
+			return
+		}
+		if !ratelimit.Check(w, r, ratelimit.Classify(r), "apikey:"+key.Prefix, user.Username+"/"+key.Prefix) {
+			return
 		}
-		
-		// 如果API Key验证失败，尝试JWT token
-		// 这里为了简单，我们直接接受任何请求（因为前端已经有了token检查）
-		// 实际生产环境应该验证JWT token
-		next(w, r)
+		r = audit.WithActor(r, audit.Actor{Type: audit.ActorAPIKey, Name: user.Username + "/" + key.Prefix, UserID: user.ID})
+		ctx := auth.WithAPIKey(context.WithValue(r.Context(), auth.UserContextKey, user), key)
+		next(w, r.WithContext(ctx))
 	}
 }
 
+// requestCredential 获取请求携带的凭据：Authorization Bearer、X-API-Key、X-API-Hash 或 api_key 参数（EventSource 无法设置请求头）
+func requestCredential(r *http.Request) string {
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" && token != r.Header.Get("Authorization") {
+		return token
+	}
+	for _, header := range []string{"X-API-Key", "X-API-Hash"} {
+		if value := r.Header.Get(header); value != "" {
+			return value
+		}
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+// respondAuthError 返回认证失败，使用真实的 HTTP 状态码（前端据 401 跳转登录页）
+func respondAuthError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(APIResponse{
+		Code:    status,
+		Message: message,
+	})
+}
+
 // respondJSON 返回 JSON 响应
 func respondJSON(w http.ResponseWriter, code int, message string, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -363,6 +570,7 @@ func handleAdminLoginAPI(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		OTP      string `json:"otp"` // 启用两步验证时必填：验证码或恢复码
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -370,28 +578,19 @@ func handleAdminLoginAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 从数据库查找用户
-	var user models.User
-	if err := models.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		respondJSON(w, 401, "用户名或密码错误", nil)
-		return
-	}
-
-	// 验证密码（简单比对，实际应该使用 bcrypt）
-	if req.Password != "admin123" && user.PasswordHash != "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy" {
-		respondJSON(w, 401, "用户名或密码错误", nil)
-		return
-	}
-
-	// 检查用户状态
-	if user.Status != "active" {
-		respondJSON(w, 403, "用户已被禁用", nil)
+	// 校验密码、两步验证码和登录失败锁定
+	user, token, status, err := loginUser(r, req.Username, req.Password, req.OTP)
+	if err != nil {
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", retryAfter(err))
+		}
+		respondJSON(w, status, err.Error(), loginErrorData(err))
 		return
 	}
 
 	respondJSON(w, 200, "登录成功", map[string]interface{}{
-		"token":   user.APIKey,
-		"api_key": user.APIKey,
+		"token":   token,
+		"api_key": token,
 		"user": map[string]interface{}{
 			"id":       user.ID,
 			"username": user.Username,
@@ -416,6 +615,7 @@ func handleUserLogin(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		OTP      string `json:"otp"` // 启用两步验证时必填：验证码或恢复码
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -428,36 +628,18 @@ func handleUserLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 从数据库查找用户
-	var user models.User
-	if err := models.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "用户名或密码错误",
-		})
-		return
-	}
-
-	// 验证密码
-	if req.Password != "admin123" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "用户名或密码错误",
-		})
-		return
-	}
-
-	// 检查用户状态
-	if user.Status != "active" {
+	// 校验密码、两步验证码和登录失败锁定
+	user, token, status, err := loginUser(r, req.Username, req.Password, req.OTP)
+	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", retryAfter(err))
+		}
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"message": "用户已被禁用",
+			"message": err.Error(),
+			"data":    loginErrorData(err),
 		})
 		return
 	}
@@ -468,8 +650,8 @@ func handleUserLogin(w http.ResponseWriter, r *http.Request) {
 		"success": true,
 		"message": "登录成功",
 		"data": map[string]interface{}{
-			"token":   user.APIKey,
-			"api_key": user.APIKey,
+			"token":   token,
+			"api_key": token,
 			"user": map[string]interface{}{
 				"id":       user.ID,
 				"username": user.Username,
@@ -480,6 +662,45 @@ func handleUserLogin(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// loginUser 校验登录并签发会话令牌，失败时返回对应的 HTTP 状态码
+func loginUser(r *http.Request, username, password, otp string) (*models.User, string, int, error) {
+	user, method, err := auth.Login(username, password, otp, audit.ClientIP(r))
+	if err != nil {
+		var locked *auth.LockedError
+		switch {
+		case errors.As(err, &locked):
+			return nil, "", http.StatusTooManyRequests, err
+		case err == auth.ErrUserInactive:
+			return nil, "", http.StatusForbidden, errors.New("用户已被禁用")
+		default:
+			return nil, "", http.StatusUnauthorized, err
+		}
+	}
+
+	token, _, err := auth.NewSession(user, audit.ClientIP(r), r.UserAgent(), method)
+	if err != nil {
+		return nil, "", http.StatusInternalServerError, errors.New("生成登录令牌失败")
+	}
+	return user, token, http.StatusOK, nil
+}
+
+// loginErrorData 登录失败时附带的数据，前端据 two_factor_required 显示验证码输入框
+func loginErrorData(err error) map[string]interface{} {
+	if err == auth.ErrTwoFactorRequired || err == auth.ErrInvalidOTP {
+		return map[string]interface{}{"two_factor_required": true}
+	}
+	return nil
+}
+
+// retryAfter 锁定剩余时间（秒），用于 Retry-After 响应头
+func retryAfter(err error) string {
+	var locked *auth.LockedError
+	if errors.As(err, &locked) {
+		return strconv.Itoa(int(locked.RetryAfter.Seconds()) + 1)
+	}
+	return "60"
+}
+
 // handleUserRegister 处理用户注册 API
 func handleUserRegister(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
@@ -629,6 +850,7 @@ func handleCreateContainer(w http.ResponseWriter, r *http.Request) {
 		TrafficLimit: int64(req["traffic_limit"].(float64)) * 1024 * 1024 * 1024,
 	}
 	models.DB.Create(&container)
+	webhook.EmitContainer(webhook.EventContainerCreated, &container)
 
 	models.LogAction("create", hostname, fmt.Sprintf("创建容器: %s", hostname), "success")
 
@@ -697,6 +919,13 @@ func handleGetContainer(w http.ResponseWriter, r *http.Request, containerName st
 	})
 }
 
+// legacyActionEvents 容器操作对应的 webhook 事件
+var legacyActionEvents = map[string]string{
+	"start":     webhook.EventContainerStarted,
+	"stop":      webhook.EventContainerStopped,
+	"reinstall": webhook.EventContainerReinstalled,
+}
+
 // handleContainerAction 处理容器操作
 func handleContainerAction(w http.ResponseWriter, r *http.Request, containerName, action string) {
 	var err error
@@ -736,6 +965,12 @@ func handleContainerAction(w http.ResponseWriter, r *http.Request, containerName
 		return
 	}
 
+	if event, ok := legacyActionEvents[action]; ok {
+		if container, err := models.GetContainerByHostname(containerName); err == nil {
+			webhook.EmitContainer(event, container)
+		}
+	}
+
 	models.LogAction(action, containerName, fmt.Sprintf("%s 容器", action), "success")
 	respondJSON(w, 200, fmt.Sprintf("%s 操作成功", action), nil)
 }
@@ -748,6 +983,9 @@ func handleDeleteContainer(w http.ResponseWriter, r *http.Request, containerName
 		return
 	}
 
+	if container, err := models.GetContainerByHostname(containerName); err == nil {
+		webhook.EmitContainer(webhook.EventContainerDeleted, container)
+	}
 	models.DeleteContainer(containerName)
 	models.LogAction("delete", containerName, "删除容器", "success")
 
@@ -771,10 +1009,68 @@ func handleSystemStats(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleSystemCapacity 获取各节点已分配资源与物理容量
+func handleSystemCapacity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondJSON(w, 405, "不支持的请求方法", nil)
+		return
+	}
+
+	respondJSON(w, 200, "成功", capacity.GlobalManager.GetReports())
+}
+
+// handleSystemTraffic 获取容器本计费周期的流量（ZJMF 插件读取 data.TotalGB）
+func handleSystemTraffic(w http.ResponseWriter, r *http.Request) {
+	containerName := r.URL.Query().Get("name")
+
+	var container models.Container
+	if err := models.DB.Where("hostname = ?", containerName).First(&container).Error; err != nil {
+		respondJSON(w, 404, "容器不存在", nil)
+		return
+	}
+
+	q, err := quota.GlobalQuotaManager.GetOrCreateQuota(container.ID)
+	if err != nil {
+		respondJSON(w, 500, fmt.Sprintf("获取配额失败: %v", err), nil)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Name":       container.Hostname,
+		"Mode":       q.TrafficMode,
+		"InBytes":    q.TrafficIn,
+		"OutBytes":   q.TrafficOut,
+		"TotalBytes": q.TrafficUsed,
+		"InGB":       quota.BytesToGB(q.TrafficIn),
+		"OutGB":      quota.BytesToGB(q.TrafficOut),
+		"TotalGB":    quota.BytesToGB(q.TrafficUsed),
+		"QuotaGB":    q.TrafficQuota,
+		"BillingDay": q.BillingDay,
+		"CycleStart": q.CycleStart,
+		"CycleEnd":   q.TrafficResetDate,
+	}
+	if r.URL.Query().Get("history") != "" {
+		history, _ := quota.GlobalQuotaManager.GetTrafficHistory(container.ID, 12)
+		data["History"] = history
+	}
+
+	respondJSON(w, 200, "成功", data)
+}
+
 // handleResetTraffic 重置流量
 func handleResetTraffic(w http.ResponseWriter, r *http.Request) {
 	containerName := r.URL.Query().Get("name")
-	models.DB.Model(&models.Container{}).Where("hostname = ?", containerName).Update("traffic_used", 0)
+
+	var container models.Container
+	if err := models.DB.Where("hostname = ?", containerName).First(&container).Error; err != nil {
+		respondJSON(w, 404, "容器不存在", nil)
+		return
+	}
+
+	if err := quota.GlobalQuotaManager.ResetTraffic(container.ID); err != nil {
+		respondJSON(w, 500, fmt.Sprintf("重置流量失败: %v", err), nil)
+		return
+	}
 	models.LogAction("reset_traffic", containerName, "重置流量", "success")
 	respondJSON(w, 200, "流量重置成功", nil)
 }
@@ -822,7 +1118,10 @@ func syncContainersFromLXD() error {
 
 		if err != nil {
 			// 不存在，创建新记录
-			state, _ := lxd.GetContainerState(inst.Name)
+			var state *lxdapi.InstanceState
+			if client, err := lxd.NodeClient(inst.Location); err == nil {
+				state, _, _ = client.GetInstanceState(inst.Name)
+			}
 			ipv4, ipv6 := "", ""
 			if state != nil {
 				ipv4, ipv6 = extractIPFromState(state)
@@ -837,12 +1136,16 @@ func syncContainersFromLXD() error {
 				CPUs:     extractCPUs(inst.Config),
 				Memory:   extractMemory(inst.Config),
 				Disk:     extractDisk(inst.Devices),
+				Node:     inst.Location,
 			}
 			models.DB.Create(&container)
-			log.Printf("同步容器: %s", inst.Name)
+			log.Printf("同步容器: %s (节点: %s)", inst.Name, inst.Location)
 		} else {
-			// 已存在，更新状态
+			// 已存在，更新状态和所在节点
 			models.UpdateContainerStatus(inst.Name, inst.Status)
+			if existing.Node != inst.Location {
+				models.DB.Model(&existing).Update("node", inst.Location)
+			}
 		}
 	}
 
@@ -972,11 +1275,11 @@ func generateSelfSignedCert(certFile, keyFile string) error {
 // autoInstallLXD 自动安装 LXD
 func autoInstallLXD() bool {
 	log.Println("正在检测系统...")
-	
+
 	// 检查是否有 snap
 	if _, err := exec.LookPath("snap"); err == nil {
 		log.Println("检测到 snap，使用 snap 安装 LXD...")
-		
+
 		// 安装 LXD
 		cmd := exec.Command("snap", "install", "lxd")
 		cmd.Stdout = os.Stdout
@@ -985,9 +1288,9 @@ func autoInstallLXD() bool {
 			log.Printf("snap install lxd 失败: %v", err)
 			return false
 		}
-		
+
 		log.Println("正在初始化 LXD...")
-		
+
 		// 初始化 LXD
 		cmd = exec.Command("/snap/bin/lxd", "init", "--auto")
 		cmd.Stdout = os.Stdout
@@ -996,14 +1299,14 @@ func autoInstallLXD() bool {
 			log.Printf("lxd init 失败: %v", err)
 			return false
 		}
-		
+
 		return true
 	}
-	
+
 	// 检查是否有 apt
 	if _, err := exec.LookPath("apt-get"); err == nil {
 		log.Println("检测到 apt，使用 apt 安装 LXD...")
-		
+
 		// 更新包列表（忽略过期错误）
 		log.Println("正在更新包列表...")
 		cmd := exec.Command("apt-get", "update", "-o", "Acquire::Check-Valid-Until=false")
@@ -1013,7 +1316,7 @@ func autoInstallLXD() bool {
 		if err := cmd.Run(); err != nil {
 			log.Printf("警告: apt-get update 失败: %v，尝试继续安装...", err)
 		}
-		
+
 		// 尝试安装 LXD
 		log.Println("正在安装 LXD...")
 		cmd = exec.Command("apt-get", "install", "-y", "lxd", "lxd-client")
@@ -1022,7 +1325,7 @@ func autoInstallLXD() bool {
 		if err := cmd.Run(); err != nil {
 			log.Printf("警告: apt-get install lxd 失败: %v", err)
 			log.Println("尝试安装 snapd 并使用 snap 安装 LXD...")
-			
+
 			// 安装 snapd
 			cmd = exec.Command("apt-get", "install", "-y", "snapd")
 			cmd.Stdout = os.Stdout
@@ -1031,17 +1334,17 @@ func autoInstallLXD() bool {
 				log.Printf("apt-get install snapd 失败: %v", err)
 				return false
 			}
-			
+
 			log.Println("正在启动 snapd 服务...")
 			cmd = exec.Command("systemctl", "start", "snapd")
 			cmd.Run() // 忽略错误
-			
+
 			cmd = exec.Command("systemctl", "enable", "snapd")
 			cmd.Run() // 忽略错误
-			
+
 			// 等待 snapd 启动
 			time.Sleep(3 * time.Second)
-			
+
 			// 使用 snap 安装 LXD
 			log.Println("正在使用 snap 安装 LXD...")
 			cmd = exec.Command("snap", "install", "lxd")
@@ -1051,7 +1354,7 @@ func autoInstallLXD() bool {
 				log.Printf("snap install lxd 失败: %v", err)
 				return false
 			}
-			
+
 			// 初始化 LXD
 			log.Println("正在初始化 LXD...")
 			cmd = exec.Command("/snap/bin/lxd", "init", "--auto")
@@ -1061,12 +1364,12 @@ func autoInstallLXD() bool {
 				log.Printf("lxd init 失败: %v", err)
 				return false
 			}
-			
+
 			return true
 		}
-		
+
 		log.Println("正在初始化 LXD...")
-		
+
 		// 创建 preseed 配置
 		preseed := `config: {}
 networks:
@@ -1099,7 +1402,7 @@ profiles:
 projects: []
 cluster: null
 `
-		
+
 		// 初始化 LXD
 		cmd = exec.Command("/snap/bin/lxd", "init", "--preseed")
 		cmd.Stdin = strings.NewReader(preseed)
@@ -1109,10 +1412,10 @@ cluster: null
 			log.Printf("lxd init 失败: %v", err)
 			return false
 		}
-		
+
 		return true
 	}
-	
+
 	log.Println("未检测到 snap 或 apt，无法自动安装")
 	return false
 }
@@ -762,3 +762,30 @@ setInterval(() => {
             break;
     }
 }, 30000);
+
+// 实时事件：容器状态变化时立即刷新列表（多个事件合并为一次刷新）
+let containerRefreshTimer = null;
+
+function connectEvents() {
+    if (!window.EventSource) {
+        return;
+    }
+    const source = new EventSource('/api/events?types=lifecycle,operation&api_key=' + encodeURIComponent(API_KEY));
+    const refresh = () => {
+        const activeTab = document.querySelector('.tab-content.active');
+        if (!activeTab || activeTab.id !== 'tab-containers') {
+            return;
+        }
+        clearTimeout(containerRefreshTimer);
+        containerRefreshTimer = setTimeout(loadContainers, 500);
+    };
+    source.addEventListener('lifecycle', refresh);
+    source.addEventListener('operation', (e) => {
+        const op = JSON.parse(e.data).data;
+        if (op.status !== 'running') {
+            refresh();
+        }
+    });
+}
+
+connectEvents();
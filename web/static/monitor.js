@@ -24,9 +24,11 @@ async function loadCurrentSystemMetrics() {
         return;
     }
     
-    const metric = data.data;
-    
-    // 更新系统指标卡片
+    updateSystemCards(data.data);
+}
+
+// 更新系统指标卡片
+function updateSystemCards(metric) {
     document.getElementById('monitor-cpu').textContent = metric.cpu_usage ? metric.cpu_usage.toFixed(2) + '%' : '-';
     document.getElementById('monitor-memory').textContent = metric.memory_usage ? metric.memory_usage.toFixed(2) + '%' : '-';
     document.getElementById('monitor-disk').textContent = metric.disk_usage ? metric.disk_usage.toFixed(2) + '%' : '-';
@@ -37,24 +39,24 @@ async function loadHistoricalData() {
     // 获取最近1小时的数据
     const data = await apiRequest('/api/monitor/system?hours=1');
     
-    if (!data || data.code !== 200 || !data.data || data.data.length === 0) {
+    if (!data || data.code !== 200 || !data.data || !data.data.points || data.data.points.length === 0) {
         console.log('没有历史监控数据');
         return;
     }
     
-    const metrics = data.data;
+    const metrics = data.data.points;
     
     // 提取时间标签和数据
     const labels = metrics.map(m => {
-        const date = new Date(m.created_at);
+        const date = new Date(m.timestamp);
         return date.toLocaleTimeString('zh-CN', { hour: '2-digit', minute: '2-digit' });
     });
     
-    const cpuData = metrics.map(m => m.cpu_usage);
-    const memoryData = metrics.map(m => m.memory_usage);
-    const diskData = metrics.map(m => m.disk_usage);
-    const networkRxData = metrics.map(m => (m.network_rx_rate || 0) / 1024 / 1024); // 转换为 MB/s
-    const networkTxData = metrics.map(m => (m.network_tx_rate || 0) / 1024 / 1024); // 转换为 MB/s
+    const cpuData = metrics.map(m => m.cpu_usage.avg);
+    const memoryData = metrics.map(m => m.memory_usage.avg);
+    const diskData = metrics.map(m => m.disk_usage.avg);
+    const networkRxData = metrics.map(m => (m.network_rx_rate.avg || 0) / 1024 / 1024); // 转换为 MB/s
+    const networkTxData = metrics.map(m => (m.network_tx_rate.avg || 0) / 1024 / 1024); // 转换为 MB/s
     
     // 绘制图表
     drawCPUChart(labels, cpuData);
@@ -339,3 +341,19 @@ if (document.readyState === 'loading') {
 } else {
     startMonitorAutoRefresh();
 }
+
+// 实时采样：主机指标通过 /api/events 推送，卡片无需等待轮询
+function connectMetricEvents() {
+    if (!window.EventSource) {
+        return;
+    }
+    const source = new EventSource('/api/events?types=metrics&api_key=' + encodeURIComponent(API_KEY));
+    source.addEventListener('metrics', (e) => {
+        const event = JSON.parse(e.data);
+        if (!event.container) {
+            updateSystemCards(event.data);
+        }
+    });
+}
+
+connectMetricEvents();
@@ -66,7 +66,7 @@ function updateUserInfo() {
         apiKeyElement.innerHTML = `
             <div class="api-key-section">
                 <label>API 密钥：</label>
-                <input type="text" value="${currentUser.api_key}" readonly class="api-key-input">
+                <input type="text" value="${currentUser.api_key || '已隐藏，仅在生成时显示一次'}" readonly class="api-key-input">
                 <button onclick="regenerateAPIKey()" class="btn-regenerate">重新生成</button>
             </div>
         `;
@@ -272,8 +272,19 @@ async function regenerateAPIKey() {
     }
 }
 
-// 退出登录
-function logout() {
+// 退出登录（服务端撤销当前令牌）
+async function logout() {
+    const token = localStorage.getItem('auth_token');
+    try {
+        await fetch('/api/account/logout', {
+            method: 'POST',
+            headers: {
+                'Authorization': `Bearer ${token}`
+            }
+        });
+    } catch (error) {
+        console.error('Error logging out:', error);
+    }
     localStorage.removeItem('auth_token');
     window.location.href = '/login.html';
 }